@@ -49,6 +49,31 @@ type Actor interface {
 	// specify which protocol scheme to handle the incoming request and the
 	// data stored within the application (HTTP, HTTPS, etc).
 	PostInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error)
+	// PostSharedInbox returns true if the request was handled as an
+	// ActivityPub POST to the server's shared inbox. If false, the request
+	// was not an ActivityPub request and may still be handled by the caller
+	// in another way.
+	//
+	// If the error is nil, then the ResponseWriter's headers and response
+	// has already been written. If a non-nil error is returned, then no
+	// response has been written.
+	//
+	// The request is authenticated and the Activity authorized once. The
+	// Activity is then posted to every local inbox it is addressed to, with
+	// the same side effects as if it had been POSTed to each inbox.
+	//
+	// If the Federated Protocol is not enabled, writes the
+	// http.StatusMethodNotAllowed status code in the response. No side
+	// effects occur.
+	//
+	// The request and data of your application will be interpreted as
+	// having an HTTPS protocol scheme.
+	PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+	// PostSharedInboxScheme is similar to PostSharedInbox, except clients
+	// are able to specify which protocol scheme to handle the incoming
+	// request and the data stored within the application (HTTP, HTTPS,
+	// etc).
+	PostSharedInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error)
 	// GetInbox returns true if the request was handled as an ActivityPub
 	// GET to an actor's inbox. If false, the request was not an ActivityPub
 	// request and may still be handled by the caller in another way, such
@@ -124,4 +149,19 @@ type FederatingActor interface {
 	// method will guaranteed work for non-custom Actors. For custom actors,
 	// care should be used to not call this method if only C2S is supported.
 	Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error)
+	// DeleteActor deletes the local actor owning the outbox, and announces
+	// its deletion to the federation.
+	//
+	// The provided url must be the outbox of the actor being deleted:
+	//   - A Delete of the actor, addressed to the public and to its
+	//     followers, is added to the outbox.
+	//   - The Delete is delivered to the followers, and to the shared
+	//     inboxes of the peers known to have interacted with the actor if
+	//     the Actor was created WithKnownSharedInboxes.
+	//   - The actor is replaced with a Tombstone in the database, which
+	//     NewActivityStreamsHandler serves with a 410 Gone status.
+	//
+	// The Delete is signed with the actor's keys, so the Transport must be
+	// able to sign with them until every delivery is done.
+	DeleteActor(c context.Context, outbox *url.URL) (Activity, error)
 }
@@ -0,0 +1,218 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// OnActorDeleteBehavior enumerates the different default actions that the
+// go-fed library can provide with the content of a federated actor that
+// deletes itself.
+type OnActorDeleteBehavior int
+
+const (
+	// OnActorDeleteKeepContent keeps the content of the deleted actor, such
+	// as its Notes, Likes and Announces.
+	OnActorDeleteKeepContent OnActorDeleteBehavior = iota
+	// OnActorDeletePurgeContent removes the content of the deleted actor
+	// from the database.
+	OnActorDeletePurgeContent
+	// OnActorDeleteTombstoneContent replaces the content of the deleted
+	// actor in the database with Tombstones.
+	OnActorDeleteTombstoneContent
+)
+
+// ActorContentDatabase is a Database able to find the content of an actor.
+//
+// The content of a federated actor that deletes itself is only removed when the
+// Database is an ActorContentDatabase.
+type ActorContentDatabase interface {
+	Database
+	// ActorContent returns the ids of the entries whose 'actor' or
+	// 'attributedTo' is the actor with the given id, such as its Notes,
+	// Likes and Announces.
+	//
+	// The library makes this call only after acquiring a lock on the
+	// actor's id first.
+	ActorContent(c context.Context, actorIRI *url.URL) (ids []*url.URL, err error)
+}
+
+// ActorDeleteHooks are called at each step of removing a federated actor that
+// deletes itself, before the step is taken, such as to keep audit copies of
+// what is removed. Returning an error stops the removal.
+//
+// Every hook is optional.
+type ActorDeleteHooks struct {
+	// Relationships is called before the deleted actor is removed from the
+	// 'followers' and 'following' collections of the local actor, when it
+	// is in either. It is called while holding the lock on the local
+	// actor's id.
+	Relationships func(c context.Context, actorIRI, deletedIRI *url.URL, follower, followed bool) error
+	// Interaction is called with each Like or Announce of the deleted
+	// actor before it is removed from the 'likes' or 'shares' collection
+	// of the objects owned by this server.
+	Interaction func(c context.Context, activity Activity) error
+	// Content is called with each entry of the content of the deleted
+	// actor before it is purged or replaced with a Tombstone.
+	Content func(c context.Context, t vocab.Type) error
+}
+
+// getSelfDeletedActors returns the actors of the Delete that are also its
+// objects.
+func getSelfDeletedActors(a vocab.ActivityStreamsDelete) ([]*url.URL, error) {
+	actorIds, err := getActorIds(a)
+	if err != nil {
+		return nil, err
+	}
+	objectIds, err := getObjectIds(a)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []*url.URL
+	for _, id := range actorIds {
+		if containsIRI(objectIds, id) {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+// deleteActor removes the federated actor that deleted itself from the
+// relationships of the local actor owning this inbox, and handles its content
+// as determined by the OnActorDelete setting.
+func (w FederatingWrappedCallbacks) deleteActor(c context.Context, deletedIRI *url.URL) error {
+	switch w.OnActorDelete {
+	case OnActorDeleteKeepContent, OnActorDeletePurgeContent, OnActorDeleteTombstoneContent:
+	default:
+		return fmt.Errorf("unknown OnActorDeleteBehavior: %d", w.OnActorDelete)
+	}
+	u := &undoer{db: w.db, boxIRI: w.inboxIRI, federated: true}
+	if err := w.removeRelationships(c, u, deletedIRI); err != nil {
+		return err
+	} else if w.OnActorDelete == OnActorDeleteKeepContent {
+		return nil
+	}
+	db, ok := w.db.(ActorContentDatabase)
+	if !ok {
+		return nil
+	}
+	if err := db.Lock(c, deletedIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	ids, err := db.ActorContent(c, deletedIRI)
+	db.Unlock(c, deletedIRI)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := w.removeActorContent(c, u, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRelationships removes the deleted actor from the 'followers' and
+// 'following' collections of the local actor owning this inbox.
+func (w FederatingWrappedCallbacks) removeRelationships(c context.Context, u *undoer, deletedIRI *url.URL) error {
+	me, err := u.localActor(c)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Lock(c, me); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, me)
+	followers, err := w.db.Followers(c, me)
+	if err != nil {
+		return err
+	}
+	following, err := w.db.Following(c, me)
+	if err != nil {
+		return err
+	}
+	follower := removeCollectionItems(followers, []*url.URL{deletedIRI})
+	followed := removeCollectionItems(following, []*url.URL{deletedIRI})
+	if !follower && !followed {
+		return nil
+	}
+	if w.ActorDeleteHooks.Relationships != nil {
+		if err := w.ActorDeleteHooks.Relationships(c, me, deletedIRI, follower, followed); err != nil {
+			return err
+		}
+	}
+	if follower {
+		if err := w.db.Update(c, followers); err != nil {
+			return err
+		}
+	}
+	if followed {
+		return w.db.Update(c, following)
+	}
+	return nil
+}
+
+// removeActorContent removes an entry of the content of the deleted actor: a
+// Like or Announce is removed from the 'likes' or 'shares' of the objects owned
+// by this server, and a reply from their 'replies', before the entry is purged
+// or replaced with a Tombstone.
+func (w FederatingWrappedCallbacks) removeActorContent(c context.Context, u *undoer, id *url.URL) error {
+	var t vocab.Type
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err := func() error {
+		if err := w.db.Lock(c, id); err != nil {
+			return err
+		}
+		defer w.db.Unlock(c, id)
+		if exists, err := w.db.Exists(c, id); err != nil || !exists {
+			return err
+		}
+		var err error
+		t, err = w.db.Get(c, id)
+		return err
+	}()
+	if err != nil || t == nil {
+		return err
+	}
+	if activity, ok := t.(Activity); ok {
+		isLike := streams.IsOrExtendsActivityStreamsLike(t)
+		if isLike || streams.IsOrExtendsActivityStreamsAnnounce(t) {
+			if w.ActorDeleteHooks.Interaction != nil {
+				if err := w.ActorDeleteHooks.Interaction(c, activity); err != nil {
+					return err
+				}
+			}
+			if isLike {
+				err = u.undoLike(c, activity)
+			} else {
+				err = u.undoAnnounce(c, activity)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if w.ActorDeleteHooks.Content != nil {
+		if err := w.ActorDeleteHooks.Content(c, t); err != nil {
+			return err
+		}
+	}
+	if err := removeReply(c, w.db, t); err != nil {
+		return err
+	}
+	if err := w.db.Lock(c, id); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, id)
+	if w.OnActorDelete == OnActorDeletePurgeContent {
+		return w.db.Delete(c, id)
+	}
+	return w.db.Update(c, toTombstone(t, id, w.clock.Now()))
+}
@@ -0,0 +1,220 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// WithAuthorizedFetch serves ActivityStreams values only to the actors they
+// are addressed to, also known as secure mode.
+//
+// ActivityStreams GET requests must have an HTTP Signature verified by the
+// HttpSigVerifier, unless the context already has a VerifiedActor. Requests
+// that are not properly signed receive a 401 Unauthorized.
+//
+// Actors and PublicKeys are served to every request without verifying it, as
+// peers dereference them to verify HTTP Signatures: a peer also in authorized
+// fetch mode signs its request for the key of the actor whose request it is
+// verifying, which could otherwise never be verified in turn.
+//
+// A value is then served if it is public, if the requesting actor is in its
+// 'to', 'bto', 'cc', 'bcc', or 'audience', or if the requesting actor is in a
+// local collection it is addressed to, such as the followers of a local actor.
+// Otherwise, ErrNotFound is returned as if the value did not exist. Values
+// without any addressing, such as collections, as well as Tombstones, are
+// served to every verified actor.
+//
+// An instance actor, which is an Application signing requests on behalf of its
+// whole server, is also served the values addressed to any actor of its host.
+// The Resolver obtains the requesting actors to determine whether they are
+// instance actors, on behalf of the box of the HttpSigVerifier. If the
+// Resolver is nil, instance actors are treated as any other actor.
+//
+// Requests rendered by the HTMLRenderer are not signed, so only public values
+// are rendered. Others are left to the caller as if they did not exist.
+//
+// As the values served depend on the requesting actor, ActivityStreams
+// responses have a 'Cache-Control: private' header so that shared caches do
+// not serve them to other actors.
+//
+// WithAuthorizedFetch panics if the HttpSigVerifier is nil, as no request could
+// then be verified.
+func WithAuthorizedFetch(v *HttpSigVerifier, r *Resolver) HandlerOption {
+	if v == nil {
+		panic("pub: WithAuthorizedFetch requires a non-nil HttpSigVerifier")
+	}
+	return func(o *handlerOptions) {
+		o.authorizedFetch = &authorizedFetch{
+			verifier: v,
+			resolver: r,
+		}
+	}
+}
+
+// authorizedFetch determines which actors may obtain ActivityStreams values.
+type authorizedFetch struct {
+	verifier *HttpSigVerifier
+	resolver *Resolver
+}
+
+// requester returns the verified actor making the request, verifying its HTTP
+// Signature if the context does not already have one.
+//
+// An HttpSigError is returned if the request is not properly signed.
+func (a *authorizedFetch) requester(c context.Context, r *http.Request) (out context.Context, actorIRI *url.URL, err error) {
+	if actorIRI, ok := VerifiedActor(c); ok {
+		return c, actorIRI, nil
+	}
+	return a.verifier.VerifyGet(c, r)
+}
+
+// isServedUnsigned returns true if the value is an actor or a PublicKey, which
+// is served without an HTTP Signature.
+func isServedUnsigned(t vocab.Type) bool {
+	if t == nil {
+		return false
+	}
+	return streams.IsOrExtendsActivityStreamsApplication(t) ||
+		streams.IsOrExtendsActivityStreamsGroup(t) ||
+		streams.IsOrExtendsActivityStreamsOrganization(t) ||
+		streams.IsOrExtendsActivityStreamsPerson(t) ||
+		streams.IsOrExtendsActivityStreamsService(t) ||
+		streams.IsOrExtendsW3IDSecurityV1PublicKey(t)
+}
+
+// isVisible returns true if the value may be served to the requesting actor,
+// which is nil for requests that are not signed.
+func (a *authorizedFetch) isVisible(c context.Context, db Database, t vocab.Type, requester *url.URL) (visible bool, err error) {
+	if streams.IsOrExtendsActivityStreamsTombstone(t) {
+		return true, nil
+	}
+	addressees, err := getAddressees(t)
+	if err != nil {
+		return
+	} else if len(addressees) == 0 {
+		return true, nil
+	}
+	for _, addressee := range addressees {
+		if IsPublic(addressee.String()) {
+			return true, nil
+		}
+	}
+	if requester == nil {
+		return false, nil
+	}
+	if containsIRI(addressees, requester) {
+		return true, nil
+	}
+	// Expand the local collections, such as followers.
+	var members []*url.URL
+	for _, addressee := range addressees {
+		var m []*url.URL
+		m, err = a.localMembers(c, db, addressee)
+		if err != nil {
+			return
+		}
+		members = append(members, m...)
+	}
+	if containsIRI(members, requester) {
+		return true, nil
+	}
+	// Instance actors obtain the values addressed to their server.
+	isInstance, err := a.isInstanceActor(c, requester)
+	if err != nil || !isInstance {
+		return
+	}
+	for _, iri := range append(addressees, members...) {
+		if iri.Host == requester.Host {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// localMembers returns the members of a collection in the Database, or nil if
+// the IRI does not identify one.
+func (a *authorizedFetch) localMembers(c context.Context, db Database, iri *url.URL) (members []*url.URL, err error) {
+	err = db.Lock(c, iri)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock not deferred.
+	owns, err := db.Owns(c, iri)
+	if err != nil || !owns {
+		db.Unlock(c, iri)
+		return
+	}
+	exists, err := db.Exists(c, iri)
+	if err != nil || !exists {
+		db.Unlock(c, iri)
+		return
+	}
+	t, err := db.Get(c, iri)
+	db.Unlock(c, iri)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return
+	}
+	return collectionItems(t)
+}
+
+// isInstanceActor returns true if the actor is an Application.
+func (a *authorizedFetch) isInstanceActor(c context.Context, actorIRI *url.URL) (bool, error) {
+	if a.resolver == nil {
+		return false, nil
+	}
+	actor, err := a.resolver.Resolve(c, a.verifier.fetchBoxIRI, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	return streams.IsOrExtendsActivityStreamsApplication(actor), nil
+}
+
+// getAddressees returns the IRIs in the 'to', 'bto', 'cc', 'bcc', and
+// 'audience' properties of any value.
+func getAddressees(t vocab.Type) (r []*url.URL, err error) {
+	var iters []IdProperty
+	if v, ok := t.(toer); ok && v.GetActivityStreamsTo() != nil {
+		p := v.GetActivityStreamsTo()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			iters = append(iters, iter)
+		}
+	}
+	if v, ok := t.(btoer); ok && v.GetActivityStreamsBto() != nil {
+		p := v.GetActivityStreamsBto()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			iters = append(iters, iter)
+		}
+	}
+	if v, ok := t.(ccer); ok && v.GetActivityStreamsCc() != nil {
+		p := v.GetActivityStreamsCc()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			iters = append(iters, iter)
+		}
+	}
+	if v, ok := t.(bccer); ok && v.GetActivityStreamsBcc() != nil {
+		p := v.GetActivityStreamsBcc()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			iters = append(iters, iter)
+		}
+	}
+	if v, ok := t.(audiencer); ok && v.GetActivityStreamsAudience() != nil {
+		p := v.GetActivityStreamsAudience()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			iters = append(iters, iter)
+		}
+	}
+	for _, iter := range iters {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		r = append(r, id)
+	}
+	return
+}
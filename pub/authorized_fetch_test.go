@@ -0,0 +1,289 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	// testMyFollowersIRI is the followers collection of a local actor.
+	testMyFollowersIRI = "https://example.com/addison/followers"
+	// testInstanceActorIRI is the instance actor of a federated server.
+	testInstanceActorIRI = "https://other.example.com/actor"
+)
+
+// TestAuthorizedFetch tests serving ActivityStreams values only to the actors
+// they are addressed to.
+func TestAuthorizedFetch(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, withResolver bool) (db *MockDatabase, clock *MockClock, hf HandlerFunc) {
+		db = NewMockDatabase(ctl)
+		clock = NewMockClock(ctl)
+		common := NewMockCommonBehavior(ctl)
+		v := NewHttpSigVerifier(db, common, clock, mustParse(testMyInboxIRI))
+		var r *Resolver
+		if withResolver {
+			r = NewResolver(db, common, clock)
+		}
+		hf = NewActivityStreamsHandler(db, clock, WithAuthorizedFetch(v, r))
+		return
+	}
+	newNoteFn := func(to ...string) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		note.SetJSONLDId(id)
+		toProp := streams.NewActivityStreamsToProperty()
+		for _, iri := range to {
+			toProp.AppendIRI(mustParse(iri))
+		}
+		note.SetActivityStreamsTo(toProp)
+		return note
+	}
+	verifiedFn := func(actorIRI string) context.Context {
+		return context.WithValue(ctx, httpSigActorContextKey{}, mustParse(actorIRI))
+	}
+	expectGetFn := func(db *MockDatabase, t vocab.Type) {
+		db.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		db.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(t, nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+	}
+	expectOwnsFn := func(db *MockDatabase, iri string, owns bool) {
+		db.EXPECT().Lock(gomock.Any(), mustParse(iri))
+		db.EXPECT().Owns(gomock.Any(), mustParse(iri)).Return(owns, nil)
+		if !owns {
+			db.EXPECT().Unlock(gomock.Any(), mustParse(iri))
+		}
+	}
+	expectLocalFn := func(db *MockDatabase, iri string, t vocab.Type) {
+		db.EXPECT().Lock(gomock.Any(), mustParse(iri))
+		db.EXPECT().Exists(gomock.Any(), mustParse(iri)).Return(true, nil)
+		db.EXPECT().Get(gomock.Any(), mustParse(iri)).Return(t, nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(iri))
+	}
+	t.Run("RefusesUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Mock
+		expectGetFn(db, newNoteFn(PublicActivityPubIRI))
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RefusesUnsignedRequestForMissingValue", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Mock
+		expectGetFn(db, nil)
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("ServesActorToUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		person := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		person.SetJSONLDId(id)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI2))
+		person.SetActivityStreamsTo(to)
+		// Mock
+		expectGetFn(db, person)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesPublicValue", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Mock
+		expectGetFn(db, newNoteFn(PublicActivityPubIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testFederatedActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Result().Header.Get(cacheControlHeader), "private")
+	})
+	t.Run("ServesValueAddressedToRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Mock
+		expectGetFn(db, newNoteFn(testFederatedActorIRI2, testFederatedActorIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testFederatedActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("HidesValueNotAddressedToRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Mock
+		expectGetFn(db, newNoteFn(testFederatedActorIRI2))
+		expectOwnsFn(db, testFederatedActorIRI2, false)
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testFederatedActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, ErrNotFound)
+		assertEqual(t, len(resp.Result().Header), 0)
+	})
+	t.Run("ServesValueToLocalFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock, hf := setupFn(ctl, false)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		followers := streams.NewActivityStreamsOrderedCollection()
+		items := streams.NewActivityStreamsOrderedItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		followers.SetActivityStreamsOrderedItems(items)
+		// Mock
+		expectGetFn(db, newNoteFn(testMyFollowersIRI))
+		expectOwnsFn(db, testMyFollowersIRI, true)
+		db.EXPECT().Exists(gomock.Any(), mustParse(testMyFollowersIRI)).Return(true, nil)
+		db.EXPECT().Get(gomock.Any(), mustParse(testMyFollowersIRI)).Return(followers, nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testMyFollowersIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testFederatedActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesValueAddressedToServerOfInstanceActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock, hf := setupFn(ctl, true)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		instance := streams.NewActivityStreamsApplication()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testInstanceActorIRI))
+		instance.SetJSONLDId(id)
+		// Mock
+		expectGetFn(db, newNoteFn(testFederatedActorIRI2))
+		expectOwnsFn(db, testFederatedActorIRI2, false)
+		expectLocalFn(db, testInstanceActorIRI, instance)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testInstanceActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("HidesValueFromOtherActorsOfServer", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, hf := setupFn(ctl, true)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		person := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI))
+		person.SetJSONLDId(id)
+		// Mock
+		expectGetFn(db, newNoteFn(testFederatedActorIRI2))
+		expectOwnsFn(db, testFederatedActorIRI2, false)
+		expectLocalFn(db, testFederatedActorIRI, person)
+		// Run & Verify
+		isAPReq, err := hf(verifiedFn(testFederatedActorIRI), resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, ErrNotFound)
+	})
+	t.Run("RendersOnlyPublicValuesAsHTML", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		v := NewHttpSigVerifier(db, NewMockCommonBehavior(ctl), clock, mustParse(testMyInboxIRI))
+		hf := NewActivityStreamsHandler(db, clock, WithAuthorizedFetch(v, nil), WithHTMLRenderer(func(c context.Context, w http.ResponseWriter, r *http.Request, t vocab.Type) error {
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}))
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		// Mock
+		expectGetFn(db, newNoteFn(testMyFollowersIRI))
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, false)
+		assertEqual(t, err, nil)
+	})
+}
+
+// TestWithAuthorizedFetchRequiresVerifier ensures a nil HttpSigVerifier is
+// refused.
+func TestWithAuthorizedFetchRequiresVerifier(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	WithAuthorizedFetch(nil, nil)
+}
+
+// TestGetAddressees ensures all addressing properties are obtained.
+func TestGetAddressees(t *testing.T) {
+	note := streams.NewActivityStreamsNote()
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParse(testFederatedActorIRI))
+	note.SetActivityStreamsTo(to)
+	bcc := streams.NewActivityStreamsBccProperty()
+	bcc.AppendIRI(mustParse(testFederatedActorIRI2))
+	note.SetActivityStreamsBcc(bcc)
+	audience := streams.NewActivityStreamsAudienceProperty()
+	audience.AppendIRI(mustParse(testMyFollowersIRI))
+	note.SetActivityStreamsAudience(audience)
+	iris, err := getAddressees(note)
+	assertEqual(t, err, nil)
+	assertEqual(t, len(iris), 3)
+	for i, expected := range []string{testFederatedActorIRI, testFederatedActorIRI2, testMyFollowersIRI} {
+		assertEqual(t, iris[i].String(), expected)
+	}
+}
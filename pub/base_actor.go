@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 )
@@ -35,6 +34,15 @@ type baseActor struct {
 	enableFederatedProtocol bool
 	// clock simply tracks the current time.
 	clock Clock
+	// inboxPages, if non-nil, serves inboxes a page at a time.
+	inboxPages *boxPages
+	// outboxPages, if non-nil, serves outboxes a page at a time.
+	outboxPages *boxPages
+	// inboxQueue, if non-nil, receives the activities posted to inboxes
+	// instead of processing them while handling the request.
+	inboxQueue InboxQueue
+	// payloadLimits bounds the bodies of POST requests.
+	payloadLimits PayloadLimits
 }
 
 // baseActorFederating must satisfy the FederatingActor interface.
@@ -59,21 +67,33 @@ type baseActorFederating struct {
 // compliant with the ActivityPub specification, while providing enough freedom
 // to be productive without shooting one's self in the foot.
 //
+// Optional behaviors may be enabled by passing ActorOptions.
+//
 // Do not try to use NewSocialActor and NewFederatingActor together to cover
 // both the Social and Federating parts of the protocol. Instead, use NewActor.
 func NewSocialActor(c CommonBehavior,
 	c2s SocialProtocol,
 	db Database,
-	clock Clock) Actor {
+	clock Clock,
+	opts ...ActorOption) Actor {
+	o := newActorOptions(opts)
 	return &baseActor{
 		delegate: &sideEffectActor{
-			common: c,
-			c2s:    c2s,
-			db:     db,
-			clock:  clock,
+			common:             c,
+			c2s:                c2s,
+			db:                 db,
+			clock:              clock,
+			deliveryQueue:      o.deliveryQueue,
+			publicKeyCache:     o.publicKeyCache,
+			maxCollectionPages: o.maxCollectionPages,
+			maxCollectionItems: o.maxCollectionItems,
+			localFollowers:     o.localFollowers,
 		},
 		enableSocialProtocol: true,
 		clock:                clock,
+		inboxPages:           o.pages(o.inboxPages, clock),
+		outboxPages:          o.pages(o.outboxPages, clock),
+		payloadLimits:        o.payloadLimits,
 	}
 }
 
@@ -87,22 +107,38 @@ func NewSocialActor(c CommonBehavior,
 // compliant with the ActivityPub specification, while providing enough freedom
 // to be productive without shooting one's self in the foot.
 //
+// Optional behaviors may be enabled by passing ActorOptions.
+//
 // Do not try to use NewSocialActor and NewFederatingActor together to cover
 // both the Social and Federating parts of the protocol. Instead, use NewActor.
 func NewFederatingActor(c CommonBehavior,
 	s2s FederatingProtocol,
 	db Database,
-	clock Clock) FederatingActor {
+	clock Clock,
+	opts ...ActorOption) FederatingActor {
+	o := newActorOptions(opts)
 	return &baseActorFederating{
 		baseActor{
 			delegate: &sideEffectActor{
-				common: c,
-				s2s:    s2s,
-				db:     db,
-				clock:  clock,
+				common:             c,
+				s2s:                s2s,
+				db:                 db,
+				clock:              clock,
+				deliveryQueue:      o.deliveryQueue,
+				publicKeyCache:     o.publicKeyCache,
+				maxCollectionPages: o.maxCollectionPages,
+				maxCollectionItems: o.maxCollectionItems,
+				localFollowers:     o.localFollowers,
+				federationPolicy:   o.federationPolicy,
+				threadFetcher:      o.threadFetcher,
+				knownSharedInboxes: o.knownSharedInboxes,
 			},
 			enableFederatedProtocol: true,
 			clock:                   clock,
+			inboxPages:              o.pages(o.inboxPages, clock),
+			outboxPages:             o.pages(o.outboxPages, clock),
+			inboxQueue:              o.inboxQueue,
+			payloadLimits:           o.payloadLimits,
 		},
 	}
 }
@@ -116,23 +152,39 @@ func NewFederatingActor(c CommonBehavior,
 // It leverages as much of go-fed as possible to ensure the implementation is
 // compliant with the ActivityPub specification, while providing enough freedom
 // to be productive without shooting one's self in the foot.
+//
+// Optional behaviors may be enabled by passing ActorOptions.
 func NewActor(c CommonBehavior,
 	c2s SocialProtocol,
 	s2s FederatingProtocol,
 	db Database,
-	clock Clock) FederatingActor {
+	clock Clock,
+	opts ...ActorOption) FederatingActor {
+	o := newActorOptions(opts)
 	return &baseActorFederating{
 		baseActor{
 			delegate: &sideEffectActor{
-				common: c,
-				c2s:    c2s,
-				s2s:    s2s,
-				db:     db,
-				clock:  clock,
+				common:             c,
+				c2s:                c2s,
+				s2s:                s2s,
+				db:                 db,
+				clock:              clock,
+				deliveryQueue:      o.deliveryQueue,
+				publicKeyCache:     o.publicKeyCache,
+				maxCollectionPages: o.maxCollectionPages,
+				maxCollectionItems: o.maxCollectionItems,
+				localFollowers:     o.localFollowers,
+				federationPolicy:   o.federationPolicy,
+				threadFetcher:      o.threadFetcher,
+				knownSharedInboxes: o.knownSharedInboxes,
 			},
 			enableSocialProtocol:    true,
 			enableFederatedProtocol: true,
 			clock:                   clock,
+			inboxPages:              o.pages(o.inboxPages, clock),
+			outboxPages:             o.pages(o.outboxPages, clock),
+			inboxQueue:              o.inboxQueue,
+			payloadLimits:           o.payloadLimits,
 		},
 	}
 }
@@ -185,56 +237,198 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return true, nil
 	}
-	// Check the peer request is authentic.
-	c, authenticated, err := b.delegate.AuthenticatePostInbox(c, w, r)
-	if err != nil {
+	inboxId := requestId(r, scheme)
+	c, activity, ok, err := b.authorizedInboxActivity(c, w, r, inboxId)
+	if !ok {
 		return true, err
-	} else if !authenticated {
+	}
+	// Post the activity to the actor's inbox and trigger side effects for
+	// that particular Activity type. It is up to the delegate to resolve
+	// the given map.
+	if b.inboxQueue != nil {
+		return true, b.enqueueInbox(c, w, activity, []*url.URL{inboxId})
+	}
+	if ok, err = b.postToInbox(c, w, inboxId, activity); !ok {
+		return true, err
+	}
+	// Request has been processed. Begin responding to the request.
+	//
+	// Simply respond with an OK status to the peer.
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+// PostSharedInbox implements the generic algorithm for handling a POST request
+// to the server's shared inbox independent on an application. It relies on a
+// delegate to implement application specific functionality.
+//
+// Only supports serving data with identifiers having the HTTPS scheme.
+func (b *baseActor) PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	return b.PostSharedInboxScheme(c, w, r, "https")
+}
+
+// PostSharedInboxScheme implements the generic algorithm for handling a POST
+// request to the server's shared inbox independent on an application. It
+// relies on a delegate to implement application specific functionality.
+//
+// Specifying the "scheme" allows for retrieving ActivityStreams content with
+// identifiers such as HTTP, HTTPS, or other protocol schemes.
+func (b *baseActor) PostSharedInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error) {
+	// Do nothing if it is not an ActivityPub POST request.
+	if !isActivityPubPost(r) {
+		return false, nil
+	}
+	// If the Federated Protocol is not enabled, then this endpoint is not
+	// enabled.
+	if !b.enableFederatedProtocol {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		return true, nil
 	}
+	c, activity, ok, err := b.authorizedInboxActivity(c, w, r, nil)
+	if !ok {
+		return true, err
+	}
+	// Determine the local inboxes the activity is addressed to, and post
+	// it to each as if it was received in that inbox.
+	inboxes, err := b.delegate.SharedInboxRecipients(c, activity)
+	if err != nil {
+		return true, err
+	}
+	inboxes = dedupeIRIs(inboxes, nil)
+	if b.inboxQueue != nil {
+		return true, b.enqueueInbox(c, w, activity, inboxes)
+	}
+	// The side effects that do not depend on the inbox are only applied
+	// when posting to the first one.
+	for i, inboxId := range inboxes {
+		ic := c
+		if i > 0 {
+			ic = withSharedInboxCopy(c)
+		}
+		if ok, err = b.postToInbox(ic, w, inboxId, activity); !ok {
+			return true, err
+		}
+	}
+	// Request has been processed. Begin responding to the request.
+	//
+	// Simply respond with an OK status to the peer.
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+// sharedInboxCopyContextKey is the key of the context value marking the posting
+// of an Activity received in the shared inbox to any of its inboxes but the
+// first.
+type sharedInboxCopyContextKey struct{}
+
+// withSharedInboxCopy marks the context as posting an Activity received in the
+// shared inbox to another of its inboxes than the first.
+func withSharedInboxCopy(c context.Context) context.Context {
+	return context.WithValue(c, sharedInboxCopyContextKey{}, true)
+}
+
+// isSharedInboxCopy returns true when an Activity received in the shared inbox
+// is posted to another of its inboxes than the first. The side effects that do
+// not depend on the inbox, such as storing created objects and inbox
+// forwarding, are then left to the first inbox.
+func isSharedInboxCopy(c context.Context) bool {
+	copied, _ := c.Value(sharedInboxCopyContextKey{}).(bool)
+	return copied
+}
+
+// authorizedInboxActivity authenticates a POST request to an inbox, and obtains
+// and authorizes the activity in its body.
+//
+// The inboxId is nil for the shared inbox. Otherwise, it is available to the
+// authorization through the context, so that the actors blocked by the owner
+// of the inbox may be refused.
+//
+// If ok is false, the request must not be processed further: either a
+// response has been written, or the returned error must be handled.
+func (b *baseActor) authorizedInboxActivity(c context.Context, w http.ResponseWriter, r *http.Request, inboxId *url.URL) (out context.Context, activity Activity, ok bool, err error) {
+	// Check the peer request is authentic.
+	c, authenticated, err := b.delegate.AuthenticatePostInbox(c, w, r)
+	if err != nil || !authenticated {
+		return
+	}
 	// Begin processing the request, but have not yet applied
 	// authorization (ex: blocks). Obtain the activity reject unknown
 	// activities.
-	raw, err := ioutil.ReadAll(r.Body)
+	raw, err := b.payloadLimits.read(r.Body)
 	if err != nil {
-		return true, err
+		// Respond with an error status if the body is beyond our
+		// limits, and still return the error so that it may be logged.
+		writePayloadLimitError(w, err)
+		return
 	}
 	var m map[string]interface{}
 	if err = json.Unmarshal(raw, &m); err != nil {
-		return true, err
+		return
 	}
 	asValue, err := streams.ToType(c, m)
 	if err != nil && !streams.IsUnmatchedErr(err) {
-		return true, err
+		return
 	} else if streams.IsUnmatchedErr(err) {
 		// Respond with bad request -- we do not understand the type.
 		w.WriteHeader(http.StatusBadRequest)
-		return true, nil
+		err = nil
+		return
 	}
-	activity, ok := asValue.(Activity)
-	if !ok {
-		return true, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+	activity, isActivity := asValue.(Activity)
+	if !isActivity {
+		err = fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+		return
 	}
 	if activity.GetJSONLDId() == nil {
 		w.WriteHeader(http.StatusBadRequest)
-		return true, nil
+		return
 	}
 	// Allow server implementations to set context data with a hook.
 	c, err = b.delegate.PostInboxRequestBodyHook(c, r, activity)
 	if err != nil {
-		return true, err
+		return
 	}
 	// Check authorization of the activity.
-	authorized, err := b.delegate.AuthorizePostInbox(c, w, activity)
+	authC := c
+	if inboxId != nil {
+		authC = withInboxIRI(c, inboxId)
+	}
+	authorized, err := b.delegate.AuthorizePostInbox(authC, w, activity)
+	if err != nil || !authorized {
+		return
+	}
+	return c, activity, true, nil
+}
+
+// enqueueInbox persists the activity to the InboxQueue to be posted to each of
+// the inboxes by an InboxWorker, and responds to the peer that it has been
+// accepted.
+func (b *baseActor) enqueueInbox(c context.Context, w http.ResponseWriter, activity Activity, inboxes []*url.URL) error {
+	jobs, err := newInboxJobs(c, activity, inboxes, b.clock.Now())
 	if err != nil {
-		return true, err
-	} else if !authorized {
-		return true, nil
+		return err
 	}
-	// Post the activity to the actor's inbox and trigger side effects for
-	// that particular Activity type. It is up to the delegate to resolve
-	// the given map.
-	inboxId := requestId(r, scheme)
+	if len(jobs) > 0 {
+		if err = b.inboxQueue.Enqueue(c, jobs); err != nil {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// delegateActor returns the DelegateActor processing activities, so that an
+// InboxWorker can process the activities in the InboxQueue.
+func (b *baseActor) delegateActor() DelegateActor {
+	return b.delegate
+}
+
+// postToInbox posts the activity to the inbox, triggering its side effects,
+// and then delegates inbox forwarding.
+//
+// If ok is false, the request must not be processed further: either a
+// response has been written, or the returned error must be handled.
+func (b *baseActor) postToInbox(c context.Context, w http.ResponseWriter, inboxId *url.URL, activity Activity) (ok bool, err error) {
 	err = b.delegate.PostInbox(c, inboxId, activity)
 	if err != nil {
 		// Special case: We know it is a bad request if the object or
@@ -243,19 +437,15 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 		// Send the rejection to the peer.
 		if err == ErrObjectRequired || err == ErrTargetRequired {
 			w.WriteHeader(http.StatusBadRequest)
-			return true, nil
+			return false, nil
 		}
-		return true, err
+		return false, err
 	}
 	// Our side effects are complete, now delegate determining whether to
 	// do inbox forwarding, as well as the action to do it.
-	if err := b.delegate.InboxForwarding(c, inboxId, activity); err != nil {
-		return true, err
+	if err = b.delegate.InboxForwarding(c, inboxId, activity); err != nil {
+		return false, err
 	}
-	// Request has been processed. Begin responding to the request.
-	//
-	// Simply respond with an OK status to the peer.
-	w.WriteHeader(http.StatusOK)
 	return true, nil
 }
 
@@ -274,6 +464,10 @@ func (b *baseActor) GetInbox(c context.Context, w http.ResponseWriter, r *http.R
 	} else if !authenticated {
 		return true, nil
 	}
+	// Serve the box a page at a time, if enabled.
+	if b.inboxPages != nil {
+		return true, b.inboxPages.serve(c, w, r)
+	}
 	// Everything is good to begin processing the request.
 	oc, err := b.delegate.GetInbox(c, r)
 	if err != nil {
@@ -340,8 +534,11 @@ func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r
 		return true, nil
 	}
 	// Everything is good to begin processing the request.
-	raw, err := ioutil.ReadAll(r.Body)
+	raw, err := b.payloadLimits.read(r.Body)
 	if err != nil {
+		// Respond with an error status if the body is beyond our
+		// limits, and still return the error so that it may be logged.
+		writePayloadLimitError(w, err)
 		return true, err
 	}
 	var m map[string]interface{}
@@ -400,6 +597,10 @@ func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.
 	} else if !authenticated {
 		return true, nil
 	}
+	// Serve the box a page at a time, if enabled.
+	if b.outboxPages != nil {
+		return true, b.outboxPages.serve(c, w, r)
+	}
 	// Everything is good to begin processing the request.
 	oc, err := b.delegate.GetOutbox(c, r)
 	if err != nil {
@@ -492,3 +693,9 @@ func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Ty
 func (b *baseActorFederating) Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error) {
 	return b.deliver(c, outbox, t, nil)
 }
+
+// DeleteActor is programmatically accessible if the federated protocol is
+// enabled.
+func (b *baseActorFederating) DeleteActor(c context.Context, outbox *url.URL) (Activity, error) {
+	return b.delegate.DeleteActor(c, outbox)
+}
@@ -56,6 +56,20 @@ func TestBaseActorSocialProtocol(t *testing.T) {
 		assertEqual(t, handled, true)
 		assertEqual(t, resp.Code, http.StatusMethodNotAllowed)
 	})
+	t.Run("PostSharedInboxNotAllowed", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusMethodNotAllowed)
+	})
 	t.Run("GetInboxIgnoresNonActivityPubRequest", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -178,6 +192,22 @@ func TestBaseActorSocialProtocol(t *testing.T) {
 		assertEqual(t, handled, true)
 		assertEqual(t, resp.Code, http.StatusBadRequest)
 	})
+	t.Run("PostOutboxRequestEntityTooLarge", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		a.(*baseActorFederating).payloadLimits = PayloadLimits{MaxBytes: 8}
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostOutboxRequest(testCreateNoId))
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run the test
+		handled, err := a.PostOutbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, IsPayloadLimitError(err), true)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
 	t.Run("PostOutboxRespondsWithDataAndHeaders", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -433,7 +463,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
 		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, activity Activity) (bool, error) {
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, activity Activity) (bool, error) {
 			resp.WriteHeader(http.StatusForbidden)
 			return false, nil
 		})
@@ -453,7 +483,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
 		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		// Run the test
@@ -472,7 +502,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
 		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
 		// Run the test
 		handled, err := a.PostInbox(ctx, resp, req)
@@ -490,7 +520,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
 		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrTargetRequired)
 		// Run the test
 		handled, err := a.PostInbox(ctx, resp, req)
@@ -499,6 +529,129 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		assertEqual(t, handled, true)
 		assertEqual(t, resp.Code, http.StatusBadRequest)
 	})
+	t.Run("PostInboxRequestEntityTooLarge", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		a.(*baseActorFederating).payloadLimits = PayloadLimits{MaxBytes: 8}
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, IsPayloadLimitError(err), true)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("PostInboxBadRequestIfTooDeep", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		a.(*baseActorFederating).payloadLimits = PayloadLimits{MaxDepth: 1}
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, IsPayloadLimitError(err), true)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("PostSharedInboxIgnoresNonActivityPubRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toPostInboxRequest(testCreate)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+	t.Run("PostSharedInboxDeniesIfNotAuthenticated", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) (context.Context, bool, error) {
+			resp.WriteHeader(http.StatusForbidden)
+			return ctx, false, nil
+		})
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("PostSharedInboxPostsToEachInboxAsCopiesAfterFirst", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		otherInbox := mustParse("https://example.com/jordan/inbox")
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return([]*url.URL{mustParse(testMyInboxIRI), otherInbox, mustParse(testMyInboxIRI)}, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().PostInbox(withSharedInboxCopy(ctx), otherInbox, toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(withSharedInboxCopy(ctx), otherInbox, toDeserializedForm(testCreate)).Return(nil)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("PostSharedInboxRespondsWithStatusIfNoRecipients", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return(nil, nil)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("PostSharedInboxBadRequestForErrObjectRequired", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return([]*url.URL{mustParse(testMyInboxIRI)}, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
 	t.Run("GetInboxIgnoresNonActivityPubRequest", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -658,6 +811,18 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		assertEqual(t, err, nil)
 		assertByteEqual(t, b, []byte(testOrderedCollectionUniqueElemsString))
 	})
+	t.Run("DeleteActorDelegates", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		delegate.EXPECT().DeleteActor(ctx, mustParse(testMyOutboxIRI)).Return(testMyCreate, nil)
+		// Run the test
+		got, err := a.(FederatingActor).DeleteActor(ctx, mustParse(testMyOutboxIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, Activity(testMyCreate))
+	})
 }
 
 // TestBaseActor tests the Actor returned with NewCustomActor and having both
@@ -686,7 +851,7 @@ func TestBaseActor(t *testing.T) {
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
 		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		// Run the test
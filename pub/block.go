@@ -0,0 +1,158 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// BlocksDatabase is a Database able to record the actors blocked by the local
+// actors.
+//
+// Blocks are only recorded and enforced when the Database is a BlocksDatabase.
+type BlocksDatabase interface {
+	Database
+	// Blocks obtains the Collection of the actors blocked by the actor
+	// with the given id.
+	//
+	// Unlike the other collections of an actor, it is private to the
+	// actor and must not be served to peers. It is consulted to refuse
+	// the activities of blocked actors, and to not deliver to them.
+	//
+	// If modified, the library will then call Update.
+	//
+	// The library makes this call only after acquiring a lock first.
+	Blocks(c context.Context, actorIRI *url.URL) (blocks vocab.ActivityStreamsCollection, err error)
+}
+
+// inboxIRIContextKey is the context key of the inbox a POST request is
+// addressed to, when it is not the shared inbox.
+type inboxIRIContextKey struct{}
+
+// withInboxIRI returns a context carrying the inbox a POST request is addressed
+// to, so that its authorization may consult the blocks of the inbox's actor.
+func withInboxIRI(c context.Context, inboxIRI *url.URL) context.Context {
+	return context.WithValue(c, inboxIRIContextKey{}, inboxIRI)
+}
+
+// inboxIRIFromContext returns the inbox a POST request is addressed to, or nil
+// if it is the shared inbox.
+func inboxIRIFromContext(c context.Context) *url.URL {
+	inboxIRI, _ := c.Value(inboxIRIContextKey{}).(*url.URL)
+	return inboxIRI
+}
+
+// addBlocks adds the ids to the 'blocks' of the local actor, and removes them
+// from its 'followers' and 'following' collections.
+func addBlocks(c context.Context, db BlocksDatabase, actorIRI *url.URL, ids []*url.URL) error {
+	if err := db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer db.Unlock(c, actorIRI)
+	blocks, err := db.Blocks(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	items := blocks.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		blocks.SetActivityStreamsItems(items)
+	}
+	existing := make(map[string]bool, items.Len())
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		if id, err := ToId(iter); err == nil {
+			existing[id.String()] = true
+		}
+	}
+	for _, id := range ids {
+		if !existing[id.String()] {
+			items.PrependIRI(id)
+			existing[id.String()] = true
+		}
+	}
+	if err = db.Update(c, blocks); err != nil {
+		return err
+	}
+	// The blocked actors no longer follow, nor are followed by, the local
+	// actor.
+	followers, err := db.Followers(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if removeCollectionItems(followers, ids) {
+		if err = db.Update(c, followers); err != nil {
+			return err
+		}
+	}
+	following, err := db.Following(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if removeCollectionItems(following, ids) {
+		return db.Update(c, following)
+	}
+	return nil
+}
+
+// blockedActors returns the ids in the 'blocks' of the local actor, or none if
+// the Database is not a BlocksDatabase.
+func blockedActors(c context.Context, d Database, actorIRI *url.URL) (map[string]bool, error) {
+	db, ok := d.(BlocksDatabase)
+	if !ok {
+		return nil, nil
+	}
+	if err := db.Lock(c, actorIRI); err != nil {
+		return nil, err
+	}
+	defer db.Unlock(c, actorIRI)
+	blocks, err := db.Blocks(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	return blockedIds(blocks)
+}
+
+// blockedIds returns the ids in a 'blocks' collection.
+func blockedIds(blocks vocab.ActivityStreamsCollection) (map[string]bool, error) {
+	ids, err := collectionItems(blocks)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		blocked[id.String()] = true
+	}
+	return blocked, nil
+}
+
+// isBlockedByInbox returns true if any of the actors is blocked by the actor
+// owning the inbox. It is always false if the Database is not a
+// BlocksDatabase.
+func isBlockedByInbox(c context.Context, db Database, inboxIRI *url.URL, actorIRIs []*url.URL) (bool, error) {
+	if _, ok := db.(BlocksDatabase); !ok {
+		return false, nil
+	}
+	if err := db.Lock(c, inboxIRI); err != nil {
+		return false, err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := db.ActorForInbox(c, inboxIRI)
+	if err != nil {
+		db.Unlock(c, inboxIRI)
+		return false, err
+	}
+	db.Unlock(c, inboxIRI)
+	// Unlock must be called by now and every branch above.
+	blocked, err := blockedActors(c, db, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range actorIRIs {
+		if blocked[id.String()] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,204 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// pageQuery is the query parameter selecting a page of an inbox or
+	// outbox instead of the OrderedCollection itself.
+	pageQuery = "page"
+	// maxIdQuery is the query parameter selecting the items older than a
+	// cursor.
+	maxIdQuery = "max_id"
+	// minIdQuery is the query parameter selecting the items newer than a
+	// cursor.
+	minIdQuery = "min_id"
+	// lastQuery is the query parameter selecting the page of the oldest
+	// items.
+	lastQuery = "last"
+	// trueQueryValue is the value of boolean query parameters.
+	trueQueryValue = "true"
+	// DefaultBoxPageSize is the maximum number of items on a page of an
+	// inbox or outbox.
+	DefaultBoxPageSize = 20
+)
+
+// BoxCursor identifies a page of an actor's inbox or outbox.
+//
+// Items in a box are ordered newest first. At most one of MaxId, MinId, and
+// Last is set; when none are, the cursor identifies the first page.
+type BoxCursor struct {
+	// MaxId, if non-empty, selects the items that are older than the item
+	// with this cursor.
+	MaxId string
+	// MinId, if non-empty, selects the items that are newer than the item
+	// with this cursor, closest to it.
+	MinId string
+	// Last selects the page of the oldest items.
+	Last bool
+	// Limit is the maximum number of items on the page. When zero, no items
+	// are needed and only the TotalItems of the BoxPage is used.
+	Limit int
+}
+
+// BoxPage is a page of the items in an actor's inbox or outbox.
+type BoxPage struct {
+	// TotalItems is the number of items in the entire box.
+	TotalItems int
+	// Items are the items on the page, newest first. Each may be either an
+	// IRI or a value. May be nil if the page is empty.
+	Items vocab.ActivityStreamsOrderedItemsProperty
+	// Next is the cursor of the oldest item on the page, or empty if there
+	// are no older items.
+	Next string
+	// Prev is the cursor of the newest item on the page, or empty if there
+	// are no newer items.
+	Prev string
+}
+
+// BoxPageFunc returns a page of the inbox or outbox at boxIRI.
+//
+// The context is the one returned by AuthenticateGetInbox or
+// AuthenticateGetOutbox, and it is up to the implementation to provide the
+// items appropriate for the kind of authorization given in the request.
+//
+// Cursors are opaque to the library: they are only passed back to the
+// BoxPageFunc as given in a previous BoxPage.
+type BoxPageFunc func(c context.Context, r *http.Request, boxIRI *url.URL, cursor BoxCursor) (BoxPage, error)
+
+// boxPages serves an actor's inbox or outbox as an OrderedCollection whose
+// items are obtained a page at a time.
+type boxPages struct {
+	// fn obtains the pages of the box.
+	fn BoxPageFunc
+	// scheme is the scheme of the ids of the box and its pages.
+	scheme string
+	// clock is used to set the Date header on responses.
+	clock Clock
+}
+
+// serve writes either the OrderedCollection or one of its
+// OrderedCollectionPages as a response to the request.
+func (p boxPages) serve(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	boxIRI := &url.URL{
+		Scheme: p.scheme,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+	}
+	q := r.URL.Query()
+	var t vocab.Type
+	if q.Get(pageQuery) != trueQueryValue {
+		page, err := p.fn(c, r, boxIRI, BoxCursor{})
+		if err != nil {
+			return err
+		}
+		t = p.toCollection(boxIRI, page)
+	} else {
+		cursor := BoxCursor{
+			MaxId: q.Get(maxIdQuery),
+			MinId: q.Get(minIdQuery),
+			Last:  q.Get(lastQuery) == trueQueryValue,
+			Limit: DefaultBoxPageSize,
+		}
+		page, err := p.fn(c, r, boxIRI, cursor)
+		if err != nil {
+			return err
+		}
+		pageIRI := *boxIRI
+		pageIRI.RawQuery = r.URL.RawQuery
+		ocp, err := p.toPage(boxIRI, &pageIRI, page)
+		if err != nil {
+			return err
+		}
+		t = ocp
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	addResponseHeaders(w.Header(), p.clock, raw)
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(raw)
+	if err != nil {
+		return err
+	} else if n != len(raw) {
+		return fmt.Errorf("ResponseWriter.Write wrote %d of %d bytes", n, len(raw))
+	}
+	return nil
+}
+
+// toCollection builds the OrderedCollection at the box IRI, which links to
+// its first and last pages.
+func (p boxPages) toCollection(boxIRI *url.URL, page BoxPage) vocab.ActivityStreamsOrderedCollection {
+	oc := streams.NewActivityStreamsOrderedCollection()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(boxIRI)
+	oc.SetJSONLDId(id)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(page.TotalItems)
+	oc.SetActivityStreamsTotalItems(total)
+	first := streams.NewActivityStreamsFirstProperty()
+	first.SetIRI(boxPageIRI(boxIRI, "", ""))
+	oc.SetActivityStreamsFirst(first)
+	last := streams.NewActivityStreamsLastProperty()
+	last.SetIRI(boxPageIRI(boxIRI, lastQuery, trueQueryValue))
+	oc.SetActivityStreamsLast(last)
+	return oc
+}
+
+// toPage builds an OrderedCollectionPage of the box, which links to the
+// adjacent pages.
+func (p boxPages) toPage(boxIRI, pageIRI *url.URL, page BoxPage) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	ocp := streams.NewActivityStreamsOrderedCollectionPage()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(pageIRI)
+	ocp.SetJSONLDId(id)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(boxIRI)
+	ocp.SetActivityStreamsPartOf(partOf)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(page.TotalItems)
+	ocp.SetActivityStreamsTotalItems(total)
+	if page.Items != nil {
+		ocp.SetActivityStreamsOrderedItems(page.Items)
+		if err := dedupeOrderedItems(ocp); err != nil {
+			return nil, err
+		}
+	}
+	if len(page.Next) > 0 {
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(boxPageIRI(boxIRI, maxIdQuery, page.Next))
+		ocp.SetActivityStreamsNext(next)
+	}
+	if len(page.Prev) > 0 {
+		prev := streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(boxPageIRI(boxIRI, minIdQuery, page.Prev))
+		ocp.SetActivityStreamsPrev(prev)
+	}
+	return ocp, nil
+}
+
+// boxPageIRI returns the IRI of a page of the box, selected by the query
+// parameter if it is non-empty.
+func boxPageIRI(boxIRI *url.URL, param, value string) *url.URL {
+	u := *boxIRI
+	q := url.Values{}
+	q.Set(pageQuery, trueQueryValue)
+	if len(param) > 0 {
+		q.Set(param, value)
+	}
+	u.RawQuery = q.Encode()
+	return &u
+}
@@ -0,0 +1,228 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/golang/mock/gomock"
+)
+
+// TestBoxPages tests the Actor serving inboxes and outboxes a page at a time.
+func TestBoxPages(t *testing.T) {
+	ctx := context.Background()
+	// pageFn records the cursor it is called with and returns the page.
+	type pageFn struct {
+		boxIRI *url.URL
+		cursor BoxCursor
+		page   BoxPage
+		err    error
+	}
+	newFn := func(p *pageFn) BoxPageFunc {
+		return func(c context.Context, r *http.Request, boxIRI *url.URL, cursor BoxCursor) (BoxPage, error) {
+			p.boxIRI = boxIRI
+			p.cursor = cursor
+			return p.page, p.err
+		}
+	}
+	setupFn := func(ctl *gomock.Controller, inbox, outbox *pageFn) (cb *MockCommonBehavior, sp *MockSocialProtocol, db *MockDatabase, clock *MockClock, a Actor) {
+		cb = NewMockCommonBehavior(ctl)
+		sp = NewMockSocialProtocol(ctl)
+		db = NewMockDatabase(ctl)
+		clock = NewMockClock(ctl)
+		var inboxFn, outboxFn BoxPageFunc
+		if inbox != nil {
+			inboxFn = newFn(inbox)
+		}
+		if outbox != nil {
+			outboxFn = newFn(outbox)
+		}
+		a = NewSocialActor(cb, sp, db, clock, WithBoxPages("https", inboxFn, outboxFn))
+		return
+	}
+	toResponseMap := func(t *testing.T, resp *httptest.ResponseRecorder) map[string]interface{} {
+		b, err := ioutil.ReadAll(resp.Result().Body)
+		assertEqual(t, err, nil)
+		var m map[string]interface{}
+		err = json.Unmarshal(b, &m)
+		assertEqual(t, err, nil)
+		return m
+	}
+	toItems := func(ids ...string) BoxPage {
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		for _, id := range ids {
+			oi.AppendIRI(mustParse(id))
+		}
+		return BoxPage{TotalItems: 3, Items: oi}
+	}
+	t.Run("ServesOutboxCollection", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		outbox := &pageFn{page: BoxPage{TotalItems: 3}}
+		cb, _, _, clock, a := setupFn(ctl, nil, outbox)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		handled, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Result().Header.Get(dateHeader), nowDateHeader())
+		assertEqual(t, outbox.boxIRI.String(), testMyOutboxIRI)
+		assertEqual(t, outbox.cursor, BoxCursor{})
+		m := toResponseMap(t, resp)
+		assertEqual(t, m["type"], "OrderedCollection")
+		assertEqual(t, m["id"], testMyOutboxIRI)
+		assertEqual(t, m["totalItems"], float64(3))
+		assertEqual(t, m["first"], testMyOutboxIRI+"?page=true")
+		assertEqual(t, m["last"], testMyOutboxIRI+"?last=true&page=true")
+		assertEqual(t, m["orderedItems"], nil)
+	})
+	t.Run("ServesFirstOutboxPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		outbox := &pageFn{page: toItems(testNoteId1, testNoteId2)}
+		outbox.page.Next = "2"
+		cb, _, _, clock, a := setupFn(ctl, nil, outbox)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testMyOutboxIRI+"?page=true", nil))
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		handled, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, outbox.cursor, BoxCursor{Limit: DefaultBoxPageSize})
+		m := toResponseMap(t, resp)
+		assertEqual(t, m["type"], "OrderedCollectionPage")
+		assertEqual(t, m["id"], testMyOutboxIRI+"?page=true")
+		assertEqual(t, m["partOf"], testMyOutboxIRI)
+		assertEqual(t, m["totalItems"], float64(3))
+		assertEqual(t, m["next"], testMyOutboxIRI+"?max_id=2&page=true")
+		assertEqual(t, m["prev"], nil)
+		assertEqual(t, fmt.Sprint(m["orderedItems"]), fmt.Sprint([]interface{}{testNoteId1, testNoteId2}))
+	})
+	t.Run("ServesInboxPageAtCursor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		inbox := &pageFn{page: toItems(testNoteId1)}
+		inbox.page.Prev = "3"
+		cb, _, _, clock, a := setupFn(ctl, inbox, nil)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testMyInboxIRI+"?page=true&max_id=4", nil))
+		// Mock
+		cb.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		handled, err := a.GetInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, inbox.boxIRI.String(), testMyInboxIRI)
+		assertEqual(t, inbox.cursor, BoxCursor{MaxId: "4", Limit: DefaultBoxPageSize})
+		m := toResponseMap(t, resp)
+		assertEqual(t, m["id"], testMyInboxIRI+"?page=true&max_id=4")
+		assertEqual(t, m["next"], nil)
+		assertEqual(t, m["prev"], testMyInboxIRI+"?min_id=3&page=true")
+		assertEqual(t, m["orderedItems"], testNoteId1)
+	})
+	t.Run("ParsesCursors", func(t *testing.T) {
+		for query, want := range map[string]BoxCursor{
+			"?page=true&min_id=7":  {MinId: "7", Limit: DefaultBoxPageSize},
+			"?page=true&last=true": {Last: true, Limit: DefaultBoxPageSize},
+		} {
+			// Setup
+			ctl := gomock.NewController(t)
+			outbox := &pageFn{page: toItems()}
+			cb, _, _, clock, a := setupFn(ctl, nil, outbox)
+			resp := httptest.NewRecorder()
+			req := toAPRequest(httptest.NewRequest("GET", testMyOutboxIRI+query, nil))
+			// Mock
+			cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+			clock.EXPECT().Now().Return(now())
+			// Run & Verify
+			_, err := a.GetOutbox(ctx, resp, req)
+			assertEqual(t, err, nil)
+			assertEqual(t, outbox.cursor, want)
+			ctl.Finish()
+		}
+	})
+	t.Run("DeduplicatesPageItems", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		outbox := &pageFn{page: toItems(testNoteId1, testNoteId1)}
+		cb, _, _, clock, a := setupFn(ctl, nil, outbox)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testMyOutboxIRI+"?page=true", nil))
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		m := toResponseMap(t, resp)
+		assertEqual(t, m["orderedItems"], testNoteId1)
+	})
+	t.Run("ReturnsPageError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		outbox := &pageFn{err: fmt.Errorf("test error")}
+		cb, _, _, _, a := setupFn(ctl, nil, outbox)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run & Verify
+		handled, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, handled, true)
+		assertEqual(t, err, outbox.err)
+	})
+	t.Run("DoesNotServeIfNotAuthenticated", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		outbox := &pageFn{}
+		cb, _, _, _, a := setupFn(ctl, nil, outbox)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, false, nil)
+		// Run & Verify
+		handled, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, outbox.boxIRI, (*url.URL)(nil))
+	})
+	t.Run("UsesGetOutboxWithoutPageFunc", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cb, _, _, clock, a := setupFn(ctl, &pageFn{}, nil)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		// Mock
+		cb.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
+		cb.EXPECT().GetOutbox(ctx, req).Return(testOrderedCollectionUniqueElems, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, err := a.GetOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		b, err := ioutil.ReadAll(resp.Result().Body)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, b, []byte(testOrderedCollectionUniqueElemsString))
+	})
+}
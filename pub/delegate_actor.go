@@ -146,6 +146,22 @@ type DelegateActor interface {
 	//
 	// If an error is returned, it is returned to the caller of PostInbox.
 	InboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error
+	// SharedInboxRecipients determines the inboxes of the local actors that
+	// an Activity POSTed to the shared inbox is addressed to.
+	//
+	// Only called if the Federated Protocol is enabled.
+	//
+	// The Activity is then passed to PostInbox and InboxForwarding once for
+	// each of the returned inboxes. Only the first inbox applies the side
+	// effects that do not depend on the inbox, such as storing the created
+	// objects and forwarding the Activity.
+	//
+	// An Activity that was already received must have no recipients, so
+	// that redeliveries are not processed again.
+	//
+	// If an error is returned, it is returned to the caller of
+	// PostSharedInbox.
+	SharedInboxRecipients(c context.Context, activity Activity) (inboxes []*url.URL, err error)
 	// PostOutbox delegates the logic for side effects and adding to the
 	// outbox.
 	//
@@ -183,6 +199,15 @@ type DelegateActor interface {
 	//
 	// If an error is returned, it is returned to the caller of PostOutbox.
 	Deliver(c context.Context, outbox *url.URL, activity Activity) error
+	// DeleteActor deletes the local actor owning the outbox: a Delete of
+	// the actor is added to the outbox and delivered, and the actor is
+	// then replaced with a Tombstone in the database.
+	//
+	// Called if the Federated Protocol is enabled.
+	//
+	// If an error is returned, it is returned to the caller of
+	// DeleteActor.
+	DeleteActor(c context.Context, outbox *url.URL) (Activity, error)
 	// AuthenticatePostOutbox delegates the authentication and authorization
 	// of a POST to an outbox.
 	//
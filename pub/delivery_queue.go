@@ -0,0 +1,324 @@
+package pub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DeliveryStatus is the state of a single DeliveryJob.
+type DeliveryStatus int
+
+const (
+	// DeliveryPending indicates the job has not yet been delivered, and
+	// will be attempted again.
+	DeliveryPending DeliveryStatus = iota
+	// DeliveryDelivered indicates the peer accepted the delivery.
+	DeliveryDelivered
+	// DeliveryAbandoned indicates every attempt failed and the retry
+	// horizon has passed, or the peer permanently refused the delivery,
+	// so no more attempts will be made.
+	DeliveryAbandoned
+)
+
+// String returns a human-readable form of the status.
+func (d DeliveryStatus) String() string {
+	switch d {
+	case DeliveryPending:
+		return "pending"
+	case DeliveryDelivered:
+		return "delivered"
+	case DeliveryAbandoned:
+		return "abandoned"
+	default:
+		return fmt.Sprintf("DeliveryStatus(%d)", int(d))
+	}
+}
+
+// DeliveryJob is the delivery of one serialized Activity to one recipient
+// inbox.
+type DeliveryJob struct {
+	// ID uniquely identifies this job within a DeliveryQueue.
+	ID string
+	// ActivityIRI is the 'id' of the Activity being delivered. It may be
+	// nil if the Activity had no id.
+	ActivityIRI *url.URL
+	// BoxIRI is the inbox or outbox of the actor on whose behalf the
+	// delivery is made. It is passed to CommonBehavior.NewTransport.
+	BoxIRI *url.URL
+	// Recipient is the inbox IRI to deliver to.
+	Recipient *url.URL
+	// Payload is the serialized Activity.
+	Payload []byte
+	// Status is the current state of the job.
+	Status DeliveryStatus
+	// Attempts is the number of failed delivery attempts so far.
+	Attempts int
+	// Created is when the job was first enqueued.
+	Created time.Time
+	// NextAttempt is the earliest time the job is next attempted.
+	NextAttempt time.Time
+	// Updated is when the job's status was last changed.
+	Updated time.Time
+	// LastError describes why the most recent attempt failed, if it did.
+	LastError string
+}
+
+// DeliveryQueue persists the outbound deliveries of an Actor configured with
+// WithDeliveryQueue, so that they can be conducted asynchronously and retried
+// upon failure by a DeliveryWorker.
+//
+// Implementations must be safe for concurrent use.
+//
+// The MemoryDeliveryQueue and FileDeliveryQueue are provided.
+type DeliveryQueue interface {
+	// Enqueue persists new pending jobs. Each job has a unique ID.
+	Enqueue(c context.Context, jobs []DeliveryJob) error
+	// Claim returns up to max pending jobs whose NextAttempt is not after
+	// now.
+	//
+	// Claimed jobs must not be returned by Claim again until 'now' plus
+	// the lease has passed, so that jobs claimed by a worker which stopped
+	// before calling Update are eventually attempted again.
+	Claim(c context.Context, now time.Time, lease time.Duration, max int) (jobs []DeliveryJob, err error)
+	// Update saves the outcome of an attempt on a previously claimed job.
+	Update(c context.Context, job DeliveryJob) error
+	// Jobs returns all jobs delivering the Activity with the given id, in
+	// any status. Applications use this to determine the delivery status
+	// of an Activity.
+	Jobs(c context.Context, activityIRI *url.URL) (jobs []DeliveryJob, err error)
+	// Prune removes jobs that are no longer pending and whose last update
+	// was before the given time.
+	Prune(c context.Context, before time.Time) error
+}
+
+// DeliveryRetryPolicy determines how a DeliveryWorker retries failed
+// deliveries.
+type DeliveryRetryPolicy struct {
+	// InitialBackoff is the delay before the first retry. Each subsequent
+	// retry doubles the delay.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between zero and one, of each delay that is
+	// randomized to avoid many jobs being retried at the same time.
+	Jitter float64
+	// Horizon is how long after being enqueued a job is abandoned if it
+	// has still not been delivered.
+	Horizon time.Duration
+	// Lease is how long a claimed job is reserved for one attempt.
+	Lease time.Duration
+	// BatchSize is the maximum number of jobs claimed at once.
+	BatchSize int
+	// PollInterval is how long the worker waits before checking the queue
+	// again when there are no jobs due.
+	PollInterval time.Duration
+	// Retention is how long delivered and abandoned jobs are kept so that
+	// their status may be queried. Zero or negative keeps them forever.
+	Retention time.Duration
+}
+
+// DefaultDeliveryRetryPolicy returns a policy that retries deliveries for up
+// to three days, with delays growing from one minute to six hours.
+func DefaultDeliveryRetryPolicy() DeliveryRetryPolicy {
+	return DeliveryRetryPolicy{
+		InitialBackoff: time.Minute,
+		MaxBackoff:     6 * time.Hour,
+		Jitter:         0.2,
+		Horizon:        72 * time.Hour,
+		Lease:          5 * time.Minute,
+		BatchSize:      32,
+		PollInterval:   5 * time.Second,
+		Retention:      24 * time.Hour,
+	}
+}
+
+// DeliveryWorker conducts the deliveries persisted in a DeliveryQueue.
+//
+// It is the application's responsibility to call Run, and to run as many
+// workers as it desires. Multiple workers may share a single DeliveryQueue.
+type DeliveryWorker struct {
+	queue  DeliveryQueue
+	common CommonBehavior
+	clock  Clock
+	policy DeliveryRetryPolicy
+	randMu *sync.Mutex
+	rand   *mrand.Rand
+}
+
+// NewDeliveryWorker returns a worker delivering the jobs in the queue on
+// behalf of the actors whose Transports are created by the CommonBehavior.
+//
+// The clock determines when jobs are due and when they are abandoned.
+func NewDeliveryWorker(q DeliveryQueue, common CommonBehavior, clock Clock, policy DeliveryRetryPolicy) *DeliveryWorker {
+	return &DeliveryWorker{
+		queue:  q,
+		common: common,
+		clock:  clock,
+		policy: policy,
+		randMu: &sync.Mutex{},
+		rand:   mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run attempts due deliveries until the context is done, at which point the
+// context's error is returned. An error from the DeliveryQueue also stops the
+// worker and is returned.
+func (d *DeliveryWorker) Run(c context.Context) error {
+	for {
+		n, err := d.RunOnce(c)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			// Immediately check for more due jobs.
+			select {
+			case <-c.Done():
+				return c.Err()
+			default:
+				continue
+			}
+		}
+		t := time.NewTimer(d.policy.PollInterval)
+		select {
+		case <-c.Done():
+			t.Stop()
+			return c.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce claims one batch of due jobs and attempts each of them once,
+// returning the number of jobs attempted.
+//
+// It is useful for applications that schedule deliveries on their own, instead
+// of calling Run.
+func (d *DeliveryWorker) RunOnce(c context.Context) (n int, err error) {
+	now := d.clock.Now()
+	if d.policy.Retention > 0 {
+		if err = d.queue.Prune(c, now.Add(-d.policy.Retention)); err != nil {
+			return
+		}
+	}
+	jobs, err := d.queue.Claim(c, now, d.policy.Lease, d.policy.BatchSize)
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		job = d.attempt(c, job)
+		if err = d.queue.Update(c, job); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
+
+// attempt delivers the job once, and returns it with its updated status.
+func (d *DeliveryWorker) attempt(c context.Context, job DeliveryJob) DeliveryJob {
+	tp, err := d.common.NewTransport(c, job.BoxIRI, goFedUserAgent())
+	if err == nil {
+		err = tp.Deliver(c, job.Payload, job.Recipient)
+	}
+	now := d.clock.Now()
+	job.Updated = now
+	if err == nil {
+		job.Status = DeliveryDelivered
+		job.LastError = ""
+		return job
+	}
+	job.Attempts++
+	job.LastError = err.Error()
+	next := now.Add(d.backoff(job.Attempts))
+	if isPermanentDeliveryError(err) || next.Sub(job.Created) > d.policy.Horizon {
+		job.Status = DeliveryAbandoned
+	} else {
+		job.NextAttempt = next
+	}
+	return job
+}
+
+// isPermanentDeliveryError returns true if the peer responded with a client
+// error that retrying will not resolve: the request is malformed or too large,
+// or the inbox does not exist. Others, such as 401 Unauthorized while the peer
+// cannot fetch our key yet, are retried until the horizon.
+func isPermanentDeliveryError(err error) bool {
+	e, ok := err.(*HttpStatusError)
+	if !ok {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusBadRequest,
+		http.StatusNotFound,
+		http.StatusGone,
+		http.StatusRequestEntityTooLarge:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff determines the delay after the given number of failed attempts.
+func (d *DeliveryWorker) backoff(attempts int) time.Duration {
+	d.randMu.Lock()
+	f := d.rand.Float64()
+	d.randMu.Unlock()
+	return d.policy.delay(attempts, f)
+}
+
+// delay determines the delay after the given number of failed attempts, where
+// f is a random number in [0, 1) used to apply the jitter.
+func (p DeliveryRetryPolicy) delay(attempts int, f float64) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		// Spread the delay within [delay*(1-jitter), delay].
+		delay -= time.Duration(float64(delay) * p.Jitter * f)
+	}
+	return delay
+}
+
+// newDeliveryJobs creates the pending jobs delivering the payload to each of
+// the recipients.
+func newDeliveryJobs(activityIRI, boxIRI *url.URL, payload []byte, recipients []*url.URL, now time.Time) ([]DeliveryJob, error) {
+	jobs := make([]DeliveryJob, 0, len(recipients))
+	for _, r := range recipients {
+		id, err := newDeliveryJobID()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, DeliveryJob{
+			ID:          id,
+			ActivityIRI: activityIRI,
+			BoxIRI:      boxIRI,
+			Recipient:   r,
+			Payload:     payload,
+			Status:      DeliveryPending,
+			Created:     now,
+			NextAttempt: now,
+			Updated:     now,
+		})
+	}
+	return jobs, nil
+}
+
+// newDeliveryJobID creates a random job identifier.
+func newDeliveryJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,421 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/golang/mock/gomock"
+)
+
+// testDeliveryJobs creates two pending jobs delivering a test payload.
+func testDeliveryJobs(t *testing.T) []DeliveryJob {
+	jobs, err := newDeliveryJobs(
+		mustParse(testNewActivityIRI),
+		mustParse(testMyOutboxIRI),
+		[]byte("payload"),
+		[]*url.URL{mustParse(testFederatedInboxIRI), mustParse(testFederatedInboxIRI2)},
+		now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+// testDeliveryQueue runs the behaviors every DeliveryQueue must have.
+func testDeliveryQueue(t *testing.T, newQueue func(t *testing.T) DeliveryQueue) {
+	ctx := context.Background()
+	t.Run("ClaimsDueJobs", func(t *testing.T) {
+		q := newQueue(t)
+		jobs := testDeliveryJobs(t)
+		jobs[1].NextAttempt = now().Add(time.Hour)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 1)
+		assertEqual(t, claimed[0].ID, jobs[0].ID)
+	})
+	t.Run("DoesNotReclaimLeasedJobs", func(t *testing.T) {
+		q := newQueue(t)
+		assertEqual(t, q.Enqueue(ctx, testDeliveryJobs(t)), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 2)
+		claimed, err = q.Claim(ctx, now().Add(time.Second), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 0)
+		claimed, err = q.Claim(ctx, now().Add(time.Minute), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 2)
+	})
+	t.Run("ClaimsAtMostMax", func(t *testing.T) {
+		q := newQueue(t)
+		assertEqual(t, q.Enqueue(ctx, testDeliveryJobs(t)), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 1)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 1)
+	})
+	t.Run("DoesNotClaimFinishedJobs", func(t *testing.T) {
+		q := newQueue(t)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = DeliveryDelivered
+		jobs[1].Status = DeliveryAbandoned
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		assertEqual(t, q.Update(ctx, jobs[1]), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 0)
+	})
+	t.Run("ReturnsJobsForActivity", func(t *testing.T) {
+		q := newQueue(t)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = DeliveryDelivered
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(got), 2)
+		status := make(map[string]DeliveryStatus)
+		for _, job := range got {
+			status[job.ID] = job.Status
+		}
+		assertEqual(t, status[jobs[0].ID], DeliveryDelivered)
+		assertEqual(t, status[jobs[1].ID], DeliveryPending)
+		got, err = q.Jobs(ctx, mustParse(testNewActivityIRI2))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(got), 0)
+	})
+	t.Run("PrunesOnlyFinishedJobs", func(t *testing.T) {
+		q := newQueue(t)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = DeliveryDelivered
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		assertEqual(t, q.Prune(ctx, now().Add(time.Hour)), nil)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(got), 1)
+		assertEqual(t, got[0].ID, jobs[1].ID)
+	})
+	t.Run("ErrorIfDuplicateJob", func(t *testing.T) {
+		q := newQueue(t)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		assertNotEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+	})
+	t.Run("ErrorIfUpdatingUnknownJob", func(t *testing.T) {
+		q := newQueue(t)
+		assertNotEqual(t, q.Update(ctx, testDeliveryJobs(t)[0]), nil)
+	})
+}
+
+func TestMemoryDeliveryQueue(t *testing.T) {
+	testDeliveryQueue(t, func(t *testing.T) DeliveryQueue {
+		return NewMemoryDeliveryQueue()
+	})
+}
+
+func TestFileDeliveryQueue(t *testing.T) {
+	ctx := context.Background()
+	parent, err := ioutil.TempDir("", "gofed-delivery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	newDir := func(t *testing.T) string {
+		dir, err := ioutil.TempDir(parent, "queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	testDeliveryQueue(t, func(t *testing.T) DeliveryQueue {
+		dir := newDir(t)
+		q, err := NewFileDeliveryQueue(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	})
+	t.Run("ReloadsPersistedJobs", func(t *testing.T) {
+		dir := newDir(t)
+		q, err := NewFileDeliveryQueue(dir)
+		assertEqual(t, err, nil)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = DeliveryDelivered
+		jobs[0].LastError = "old error"
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		// Reopen
+		q, err = NewFileDeliveryQueue(dir)
+		assertEqual(t, err, nil)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(got), 2)
+		for _, job := range got {
+			if job.ID == jobs[0].ID {
+				assertEqual(t, job.Status, DeliveryDelivered)
+				assertEqual(t, job.LastError, "old error")
+			} else {
+				assertEqual(t, job.Status, DeliveryPending)
+			}
+			assertEqual(t, job.BoxIRI.String(), testMyOutboxIRI)
+			assertByteEqual(t, job.Payload, []byte("payload"))
+			assertEqual(t, job.Created.Equal(now()), true)
+		}
+	})
+	t.Run("PruneRemovesFiles", func(t *testing.T) {
+		dir := newDir(t)
+		q, err := NewFileDeliveryQueue(dir)
+		assertEqual(t, err, nil)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = DeliveryAbandoned
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		assertEqual(t, q.Prune(ctx, now().Add(time.Hour)), nil)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 1)
+	})
+}
+
+func TestDeliveryWorker(t *testing.T) {
+	ctx := context.Background()
+	policy := DeliveryRetryPolicy{
+		InitialBackoff: time.Minute,
+		MaxBackoff:     time.Hour,
+		Horizon:        3 * time.Hour,
+		Lease:          time.Minute,
+		BatchSize:      10,
+	}
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, cl *MockClock, tp *MockTransport, q *MemoryDeliveryQueue, w *DeliveryWorker) {
+		c = NewMockCommonBehavior(ctl)
+		cl = NewMockClock(ctl)
+		tp = NewMockTransport(ctl)
+		q = NewMemoryDeliveryQueue()
+		w = NewDeliveryWorker(q, c, cl, policy)
+		return
+	}
+	t.Run("DeliversDueJobs", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, cl, tp, q, w := setupFn(ctl)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(3)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil).Times(2)
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI))
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI2))
+		// Run & Verify
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 2)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		for _, job := range got {
+			assertEqual(t, job.Status, DeliveryDelivered)
+		}
+	})
+	t.Run("RetriesWithExponentialBackoff", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, cl, tp, q, w := setupFn(ctl)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil).Times(2)
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI)).Return(fmt.Errorf("test error")).Times(2)
+		// Run & Verify
+		cl.EXPECT().Now().Return(now()).Times(2)
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, got[0].Status, DeliveryPending)
+		assertEqual(t, got[0].Attempts, 1)
+		assertEqual(t, got[0].LastError, "test error")
+		assertEqual(t, got[0].NextAttempt.Equal(now().Add(time.Minute)), true)
+		// Not yet due
+		cl.EXPECT().Now().Return(now().Add(time.Second))
+		n, err = w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 0)
+		// Second failure doubles the delay
+		later := now().Add(time.Minute)
+		cl.EXPECT().Now().Return(later).Times(2)
+		n, err = w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		got, err = q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, got[0].Attempts, 2)
+		assertEqual(t, got[0].NextAttempt.Equal(later.Add(2*time.Minute)), true)
+	})
+	t.Run("AbandonsAfterHorizon", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, cl, tp, q, w := setupFn(ctl)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		later := now().Add(policy.Horizon)
+		// Mock
+		cl.EXPECT().Now().Return(later).Times(2)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI)).Return(fmt.Errorf("test error"))
+		// Run & Verify
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, got[0].Status, DeliveryAbandoned)
+	})
+	t.Run("AbandonsPermanentFailures", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, cl, tp, q, w := setupFn(ctl)
+		jobs := testDeliveryJobs(t)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(3)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil).Times(2)
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI)).Return(&HttpStatusError{
+			Method:     "POST",
+			IRI:        mustParse(testFederatedInboxIRI),
+			StatusCode: http.StatusGone,
+			Status:     "410 Gone",
+		})
+		tp.EXPECT().Deliver(ctx, []byte("payload"), mustParse(testFederatedInboxIRI2)).Return(&HttpStatusError{
+			Method:     "POST",
+			IRI:        mustParse(testFederatedInboxIRI2),
+			StatusCode: http.StatusUnauthorized,
+			Status:     "401 Unauthorized",
+		})
+		// Run & Verify
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 2)
+		got, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+		assertEqual(t, err, nil)
+		for _, job := range got {
+			if job.Recipient.String() == testFederatedInboxIRI {
+				assertEqual(t, job.Status, DeliveryAbandoned)
+			} else {
+				assertEqual(t, job.Status, DeliveryPending)
+			}
+		}
+	})
+	t.Run("BackoffIsCappedAndJittered", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, cl, _, q, _ := setupFn(ctl)
+		p := policy
+		p.Jitter = 0.5
+		w := NewDeliveryWorker(q, nil, cl, p)
+		// Run & Verify
+		for i := 1; i < 20; i++ {
+			d := w.backoff(i)
+			if d > p.MaxBackoff || d < p.InitialBackoff/2 {
+				t.Errorf("backoff %d out of range: %s", i, d)
+			}
+		}
+		if d := w.backoff(20); d < p.MaxBackoff/2 {
+			t.Errorf("backoff did not grow: %s", d)
+		}
+	})
+}
+
+// TestDeliverWithDeliveryQueue ensures deliveries are enqueued instead of
+// delivered when a DeliveryQueue is configured.
+func TestDeliverWithDeliveryQueue(t *testing.T) {
+	ctx := context.Background()
+	// Setup
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	setupData()
+	c := NewMockCommonBehavior(ctl)
+	fp := NewMockFederatingProtocol(ctl)
+	db := NewMockDatabase(ctl)
+	cl := NewMockClock(ctl)
+	mockTp := NewMockTransport(ctl)
+	q := NewMemoryDeliveryQueue()
+	a := &sideEffectActor{
+		common:        c,
+		s2s:           fp,
+		db:            db,
+		clock:         cl,
+		deliveryQueue: q,
+	}
+	act := streams.NewActivityStreamsCreate()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testNewActivityIRI))
+	act.SetJSONLDId(id)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParse(testFederatedActorIRI))
+	act.SetActivityStreamsTo(to)
+	// Mock
+	db.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+	db.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(mustParse(testFederatedInboxIRI), nil)
+	db.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+	c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(mockTp, nil)
+	fp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+	db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+	db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(mustParse(testPersonIRI), nil)
+	db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+	db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+	db.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(testMyPerson, nil)
+	db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+	cl.EXPECT().Now().Return(now())
+	// Run
+	err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+	// Verify
+	assertEqual(t, err, nil)
+	jobs, err := q.Jobs(ctx, mustParse(testNewActivityIRI))
+	assertEqual(t, err, nil)
+	assertEqual(t, len(jobs), 1)
+	assertEqual(t, jobs[0].Recipient.String(), testFederatedInboxIRI)
+	assertEqual(t, jobs[0].BoxIRI.String(), testMyOutboxIRI)
+	assertByteEqual(t, jobs[0].Payload, mustSerializeToBytes(act))
+}
+
+// TestIsPermanentDeliveryError ensures only definitive refusals of a peer
+// abandon a delivery.
+func TestIsPermanentDeliveryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Bad Request", &HttpStatusError{StatusCode: http.StatusBadRequest}, true},
+		{"Unauthorized", &HttpStatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"Forbidden", &HttpStatusError{StatusCode: http.StatusForbidden}, false},
+		{"Not Found", &HttpStatusError{StatusCode: http.StatusNotFound}, true},
+		{"Request Timeout", &HttpStatusError{StatusCode: http.StatusRequestTimeout}, false},
+		{"Gone", &HttpStatusError{StatusCode: http.StatusGone}, true},
+		{"Request Entity Too Large", &HttpStatusError{StatusCode: http.StatusRequestEntityTooLarge}, true},
+		{"Too Many Requests", &HttpStatusError{StatusCode: http.StatusTooManyRequests}, false},
+		{"Internal Server Error", &HttpStatusError{StatusCode: http.StatusInternalServerError}, false},
+		{"Other Error", testErr, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := isPermanentDeliveryError(test.err); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
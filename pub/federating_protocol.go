@@ -102,6 +102,9 @@ type FederatingProtocol interface {
 	// collections owned by peers when they are targeted to receive a
 	// delivery.
 	//
+	// The pages of a collection do not count towards this depth; they are
+	// instead bounded by the limits set with WithCollectionLimits.
+	//
 	// Zero or negative numbers indicate infinite recursion.
 	MaxDeliveryRecursionDepth(c context.Context) int
 	// FilterForwarding allows the implementation to apply business logic
@@ -25,6 +25,20 @@ const (
 	OnFollowAutomaticallyReject
 )
 
+// OnMoveBehavior enumerates the different default actions that the go-fed
+// library can provide when receiving a Move Activity from a peer.
+type OnMoveBehavior int
+
+const (
+	// OnMoveDoNothing does not take any action when a Move Activity is
+	// received, beyond validating it.
+	OnMoveDoNothing OnMoveBehavior = iota
+	// OnMoveFollowTarget triggers the side effect of unfollowing the moved
+	// actor and sending a Follow to the actor it moved to, if the actor
+	// owning the inbox was following the moved actor.
+	OnMoveFollowTarget
+)
+
 // FederatingWrappedCallbacks lists the callback functions that already have
 // some side effect behavior provided by the pub library.
 //
@@ -37,6 +51,18 @@ type FederatingWrappedCallbacks struct {
 	// 'object' property is created in the database.
 	//
 	// Create calls Create for each object in the federated Activity.
+	//
+	// A created Note replying to a Question owned by this server, and
+	// named after one of its 'oneOf' or 'anyOf' options, is a vote. Votes
+	// are tallied in the option's 'replies' collection and the Question's
+	// 'votersCount', and the updated Question is delivered to its
+	// recipients. Votes are not tallied once the Question is 'closed' or
+	// past its 'endTime'.
+	//
+	// Other created objects replying to objects owned by this server are
+	// added to their 'replies' collection. The threads of objects replying
+	// to objects missing from the database are backfilled in the
+	// background if the Actor was created WithThreadFetcher.
 	Create func(context.Context, vocab.ActivityStreamsCreate) error
 	// Update handles additional side effects for the Update ActivityStreams
 	// type, specific to the application using go-fed.
@@ -50,8 +76,25 @@ type FederatingWrappedCallbacks struct {
 	// Delete handles additional side effects for the Delete ActivityStreams
 	// type, specific to the application using go-fed.
 	//
-	// Delete removes the federated entry from the database.
+	// Delete removes the federated entry from the database. Keys of the
+	// entry are also evicted from the PublicKeyCache if the Actor was
+	// created with EvictPublicKeysOnDelete. A deleted reply is removed from
+	// the 'replies' collection of the objects owned by this server.
+	//
+	// An actor deleting itself is also removed from the 'followers' and
+	// 'following' collections of this actor. Depending on the value of the
+	// OnActorDelete setting, its content is then purged or replaced with
+	// Tombstones, after its Likes and Announces are removed from the
+	// objects owned by this server. The ActorDeleteHooks are called before
+	// each step.
 	Delete func(context.Context, vocab.ActivityStreamsDelete) error
+	// OnActorDelete determines what action to take with the content of a
+	// federated actor that deletes itself. The content is only found if
+	// the Database is an ActorContentDatabase.
+	OnActorDelete OnActorDeleteBehavior
+	// ActorDeleteHooks are called when removing a federated actor that
+	// deletes itself.
+	ActorDeleteHooks ActorDeleteHooks
 	// Follow handles additional side effects for the Follow ActivityStreams
 	// type, specific to the application using go-fed.
 	//
@@ -64,19 +107,28 @@ type FederatingWrappedCallbacks struct {
 	// Accept handles additional side effects for the Accept ActivityStreams
 	// type, specific to the application using go-fed.
 	//
-	// The wrapping function determines if this 'Accept' is in response to a
-	// 'Follow'. If so, then the 'actor' is added to the original 'actor's
-	// 'following' collection.
+	// The wrapping function determines if this 'Accept' is in response to
+	// one or more 'Follow' activities, which are looked up by id in the
+	// database to verify each was sent by this actor to the 'actor' of
+	// the 'Accept'. If any is verified, then the 'actor' is added to the
+	// original 'actor's 'following' collection.
+	//
+	// The outcome for each 'Follow' is available to this callback with
+	// FollowResponses.
 	//
 	// Otherwise, no side effects are done by go-fed.
 	Accept func(context.Context, vocab.ActivityStreamsAccept) error
 	// Reject handles additional side effects for the Reject ActivityStreams
 	// type, specific to the application using go-fed.
 	//
-	// The wrapping function has no default side effects. However, if this
-	// 'Reject' is in response to a 'Follow' then the client MUST NOT go
-	// forward with adding the 'actor' to the original 'actor's 'following'
-	// collection by the client application.
+	// The wrapping function verifies the 'Follow' activities being
+	// rejected in the same manner as for 'Accept'. If any is verified, then
+	// the 'actor' is removed from the original 'actor's 'following'
+	// collection, if present. The client application MUST NOT go forward
+	// with adding the 'actor' to the 'following' collection.
+	//
+	// The outcome for each 'Follow' is available to this callback with
+	// FollowResponses.
 	Reject func(context.Context, vocab.ActivityStreamsReject) error
 	// Add handles additional side effects for the Add ActivityStreams
 	// type, specific to the application using go-fed.
@@ -112,8 +164,15 @@ type FederatingWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// The wrapping function reverses the side effects of undone Follow,
+	// Accept, Like, and Announce activities: the actors are removed from
+	// the "followers" or "following" collection of this actor, and the
+	// activity from the "likes" or "shares" collection of all 'object'
+	// targets owned by this server. Activities referred to by IRI are
+	// resolved from the database.
+	//
 	// It is expected that the application will implement the proper
-	// reversal of activities that are being undone.
+	// reversal of any other activities that are being undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type, specific to the application using go-fed.
@@ -123,6 +182,31 @@ type FederatingWrappedCallbacks struct {
 	// received from a federated peer, as delivering Blocks explicitly
 	// deviates from the original ActivityPub specification.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// The wrapping function ensures the 'Move' has a single 'object' and
+	// 'target', that the moved 'object' is the 'actor' of the 'Move', and
+	// that the 'target' lists the 'object' in its 'alsoKnownAs' property.
+	//
+	// Depending on the value of the OnMove setting, the wrapping function
+	// then replaces the 'object' in the "following" collection of this
+	// actor by sending a Follow to the 'target'. Moves are delivered to
+	// the inbox of each local follower, so each of them is handled.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
+	// OnMove determines what action to take for this particular callback
+	// if a Move Activity is handled.
+	OnMove OnMoveBehavior
+	// Flag handles additional side effects for the Flag ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// The wrapping function ensures every 'object' being reported is owned
+	// by this server, such as its actors and their content, and then
+	// stores the 'Flag' in the database.
+	//
+	// It is expected that the application will bring the report to the
+	// attention of its moderators.
+	Flag func(context.Context, vocab.ActivityStreamsFlag) error
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -136,8 +220,17 @@ type FederatingWrappedCallbacks struct {
 	addNewIds func(c context.Context, activity Activity) error
 	// deliver delivers an outgoing message.
 	deliver func(c context.Context, outboxIRI *url.URL, activity Activity) error
+	// addToOutbox adds an outgoing message to the outbox and creates it in
+	// the database.
+	addToOutbox func(c context.Context, outboxIRI *url.URL, activity Activity) error
+	// clock is the server's clock.
+	clock Clock
 	// newTransport creates a new Transport.
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	// publicKeyCache, if non-nil, has the keys of deleted actors evicted.
+	publicKeyCache PublicKeyCache
+	// threadFetcher, if non-nil, backfills the threads of created replies.
+	threadFetcher *ThreadFetcher
 }
 
 // callbacks returns the WrappedCallbacks members into a single interface slice
@@ -158,6 +251,8 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableAnnounce := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
+	enableFlag := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -186,6 +281,10 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
+		case func(context.Context, vocab.ActivityStreamsFlag) error:
+			enableFlag = false
 		}
 	}
 	if enableCreate {
@@ -224,6 +323,12 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
+	if enableFlag {
+		fns = append(fns, w.flag)
+	}
 	return fns
 }
 
@@ -233,6 +338,15 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 	if op == nil || op.Len() == 0 {
 		return ErrObjectRequired
 	}
+	// The first inbox of an Activity received in the shared inbox already
+	// stored its objects.
+	if isSharedInboxCopy(c) {
+		if w.Create != nil {
+			return w.Create(c, a)
+		}
+		return nil
+	}
+	var created []vocab.Type
 	// Create anonymous loop function to be able to properly scope the defer
 	// for the database lock at each iteration.
 	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
@@ -270,6 +384,7 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 		if err := w.db.Create(c, t); err != nil {
 			return err
 		}
+		created = append(created, t)
 		return nil
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
@@ -277,6 +392,22 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 			return err
 		}
 	}
+	// Record the created objects that are votes in a local Question, and
+	// the replies to local objects. Backfill the threads of replies to
+	// unknown objects in the background.
+	for _, t := range created {
+		if err := w.vote(c, a, t); err != nil {
+			return err
+		}
+		if err := addReply(c, w.db, t); err != nil {
+			return err
+		}
+		if w.threadFetcher != nil {
+			if err := w.threadFetcher.backfillMissingParent(c, w.inboxIRI, t); err != nil {
+				return err
+			}
+		}
+	}
 	if w.Create != nil {
 		return w.Create(c, a)
 	}
@@ -333,6 +464,8 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 	if err := mustHaveActivityOriginMatchObjects(a); err != nil {
 		return err
 	}
+	var deleted []vocab.Type
+	var deletedIds []*url.URL
 	// Create anonymous loop function to be able to properly scope the defer
 	// for the database lock at each iteration.
 	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
@@ -345,9 +478,21 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 			return err
 		}
 		defer w.db.Unlock(c, id)
+		// Keep the deleted object, to remove it from the replies of
+		// local objects.
+		if exists, err := w.db.Exists(c, id); err != nil {
+			return err
+		} else if exists {
+			t, err := w.db.Get(c, id)
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, t)
+		}
 		if err := w.db.Delete(c, id); err != nil {
 			return err
 		}
+		deletedIds = append(deletedIds, id)
 		return nil
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
@@ -355,6 +500,29 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 			return err
 		}
 	}
+	// Evict the keys once the locks are released, as the PublicKeyCache
+	// may lock them in the Database.
+	if w.publicKeyCache != nil {
+		for _, id := range deletedIds {
+			if err := w.publicKeyCache.Evict(c, id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range deleted {
+		if err := removeReply(c, w.db, t); err != nil {
+			return err
+		}
+	}
+	deletedActors, err := getSelfDeletedActors(a)
+	if err != nil {
+		return err
+	}
+	for _, actorIRI := range deletedActors {
+		if err := w.deleteActor(c, actorIRI); err != nil {
+			return err
+		}
+	}
 	if w.Delete != nil {
 		return w.Delete(c, a)
 	}
@@ -480,184 +648,48 @@ func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivitySt
 
 // accept implements the federating Accept activity side effects.
 func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivityStreamsAccept) error {
-	op := a.GetActivityStreamsObject()
-	if op != nil && op.Len() > 0 {
-		// Get this actor's id.
-		if err := w.db.Lock(c, w.inboxIRI); err != nil {
+	c, actorIRI, responses, err := w.verifyFollowResponses(c, a)
+	if err != nil {
+		return err
+	}
+	// If we received an Accept of one of our Follows, add the peers to
+	// the following collection.
+	if verifiedFollowResponse(responses) {
+		peers, err := getActorIds(a)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, actorIRI); err != nil {
 			return err
 		}
 		// WARNING: Unlock not deferred.
-		actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+		following, err := w.db.Following(c, actorIRI)
 		if err != nil {
-			w.db.Unlock(c, w.inboxIRI)
+			w.db.Unlock(c, actorIRI)
 			return err
 		}
-		w.db.Unlock(c, w.inboxIRI)
-		// Unlock must be called by now and every branch above.
-		//
-		// Determine if we are in a follow on the 'object' property.
-		//
-		// TODO: Handle Accept multiple Follow.
-		var maybeMyFollowIRI *url.URL
-		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
-			t := iter.GetType()
-			if t == nil && iter.IsIRI() {
-				// Attempt to dereference the IRI instead
-				tport, err := w.newTransport(c, w.inboxIRI, goFedUserAgent())
-				if err != nil {
-					return err
-				}
-				b, err := tport.Dereference(c, iter.GetIRI())
-				if err != nil {
-					return err
-				}
-				var m map[string]interface{}
-				if err = json.Unmarshal(b, &m); err != nil {
-					return err
-				}
-				t, err = streams.ToType(c, m)
-				if err != nil {
-					return err
-				}
-			} else if t == nil {
-				return fmt.Errorf("cannot handle federated create: object is neither a value nor IRI")
-			}
-			// Ensure it is a Follow.
-			if !streams.IsOrExtendsActivityStreamsFollow(t) {
-				continue
-			}
-			follow, ok := t.(Activity)
-			if !ok {
-				return fmt.Errorf("a Follow in an Accept does not satisfy the Activity interface")
-			}
-			followId, err := GetId(follow)
-			if err != nil {
-				return err
-			}
-			// Ensure that we are one of the actors on the Follow.
-			actors := follow.GetActivityStreamsActor()
-			for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
-				id, err := ToId(iter)
-				if err != nil {
-					return err
-				}
-				if id.String() == actorIRI.String() {
-					maybeMyFollowIRI = followId
-					break
-				}
-			}
-			// Continue breaking if we found ourselves
-			if maybeMyFollowIRI != nil {
-				break
-			}
+		items := following.GetActivityStreamsItems()
+		if items == nil {
+			items = streams.NewActivityStreamsItemsProperty()
+			following.SetActivityStreamsItems(items)
 		}
-		// If we received an Accept whose 'object' is a Follow with an
-		// Accept that we sent, add to the following collection.
-		if maybeMyFollowIRI != nil {
-			// Verify our Follow request exists and the peer didn't
-			// fabricate it.
-			activityActors := a.GetActivityStreamsActor()
-			if activityActors == nil || activityActors.Len() == 0 {
-				return fmt.Errorf("an Accept with a Follow has no actors")
+		existing := make(map[string]bool, items.Len())
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if id, err := ToId(iter); err == nil {
+				existing[id.String()] = true
 			}
-			// This may be a duplicate check if we dereferenced the
-			// Follow above. TODO: Separate this logic to avoid
-			// redundancy.
-			//
-			// Use an anonymous function to properly scope the
-			// database lock, immediately call it.
-			err = func() error {
-				if err := w.db.Lock(c, maybeMyFollowIRI); err != nil {
-					return err
-				}
-				defer w.db.Unlock(c, maybeMyFollowIRI)
-				t, err := w.db.Get(c, maybeMyFollowIRI)
-				if err != nil {
-					return err
-				}
-				if !streams.IsOrExtendsActivityStreamsFollow(t) {
-					return fmt.Errorf("peer gave an Accept wrapping a Follow but provided a non-Follow id")
-				}
-				follow, ok := t.(Activity)
-				if !ok {
-					return fmt.Errorf("a Follow in an Accept does not satisfy the Activity interface")
-				}
-				// Ensure that we are one of the actors on the Follow.
-				ok = false
-				actors := follow.GetActivityStreamsActor()
-				for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
-					id, err := ToId(iter)
-					if err != nil {
-						return err
-					}
-					if id.String() == actorIRI.String() {
-						ok = true
-						break
-					}
-				}
-				if !ok {
-					return fmt.Errorf("peer gave an Accept wrapping a Follow but we are not the actor on that Follow")
-				}
-				// Build map of original Accept actors
-				acceptActors := make(map[string]bool)
-				for iter := activityActors.Begin(); iter != activityActors.End(); iter = iter.Next() {
-					id, err := ToId(iter)
-					if err != nil {
-						return err
-					}
-					acceptActors[id.String()] = false
-				}
-				// Verify all actor(s) were on the original Follow.
-				followObj := follow.GetActivityStreamsObject()
-				for iter := followObj.Begin(); iter != followObj.End(); iter = iter.Next() {
-					id, err := ToId(iter)
-					if err != nil {
-						return err
-					}
-					if _, ok := acceptActors[id.String()]; ok {
-						acceptActors[id.String()] = true
-					}
-				}
-				for _, found := range acceptActors {
-					if !found {
-						return fmt.Errorf("peer gave an Accept wrapping a Follow but was not an object in the original Follow")
-					}
-				}
-				return nil
-			}()
-			if err != nil {
-				return err
-			}
-			// Add the peer to our following collection.
-			if err := w.db.Lock(c, actorIRI); err != nil {
-				return err
-			}
-			// WARNING: Unlock not deferred.
-			following, err := w.db.Following(c, actorIRI)
-			if err != nil {
-				w.db.Unlock(c, actorIRI)
-				return err
-			}
-			items := following.GetActivityStreamsItems()
-			if items == nil {
-				items = streams.NewActivityStreamsItemsProperty()
-				following.SetActivityStreamsItems(items)
-			}
-			for iter := activityActors.Begin(); iter != activityActors.End(); iter = iter.Next() {
-				id, err := ToId(iter)
-				if err != nil {
-					w.db.Unlock(c, actorIRI)
-					return err
-				}
-				items.PrependIRI(id)
-			}
-			if err = w.db.Update(c, following); err != nil {
-				w.db.Unlock(c, actorIRI)
-				return err
+		}
+		for _, peer := range peers {
+			if !existing[peer.String()] {
+				items.PrependIRI(peer)
 			}
+		}
+		if err = w.db.Update(c, following); err != nil {
 			w.db.Unlock(c, actorIRI)
-			// Unlock must be called by now and every branch above.
+			return err
 		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
 	}
 	if w.Accept != nil {
 		return w.Accept(c, a)
@@ -667,6 +699,35 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 
 // reject implements the federating Reject activity side effects.
 func (w FederatingWrappedCallbacks) reject(c context.Context, a vocab.ActivityStreamsReject) error {
+	c, actorIRI, responses, err := w.verifyFollowResponses(c, a)
+	if err != nil {
+		return err
+	}
+	// If we received a Reject of one of our Follows, ensure the peers are
+	// not in the following collection.
+	if verifiedFollowResponse(responses) {
+		peers, err := getActorIds(a)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		following, err := w.db.Following(c, actorIRI)
+		if err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+		if removeCollectionItems(following, peers) {
+			if err = w.db.Update(c, following); err != nil {
+				w.db.Unlock(c, actorIRI)
+				return err
+			}
+		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+	}
 	if w.Reject != nil {
 		return w.Reject(c, a)
 	}
@@ -888,6 +949,10 @@ func (w FederatingWrappedCallbacks) undo(c context.Context, a vocab.ActivityStre
 	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.inboxIRI); err != nil {
 		return err
 	}
+	u := &undoer{db: w.db, boxIRI: w.inboxIRI, federated: true}
+	if err := u.undo(c, a); err != nil {
+		return err
+	}
 	if w.Undo != nil {
 		return w.Undo(c, a)
 	}
@@ -905,3 +970,140 @@ func (w FederatingWrappedCallbacks) block(c context.Context, a vocab.ActivityStr
 	}
 	return nil
 }
+
+// move implements the federating Move activity side effects.
+func (w FederatingWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	origin, target, err := getMoveOriginAndTarget(a)
+	if err != nil {
+		return err
+	}
+	// Only the moved actor may announce its move.
+	actors, err := getActorIds(a)
+	if err != nil {
+		return err
+	}
+	if !containsIRI(actors, origin) {
+		return fmt.Errorf("cannot move %s: it is not the actor of the Move", origin)
+	}
+	if err := mustHaveMoveTargetAlias(c, w.db, w.newTransport, w.inboxIRI, origin, target); err != nil {
+		return err
+	}
+	if w.OnMove == OnMoveFollowTarget {
+		if err := w.followMoveTarget(c, origin, target); err != nil {
+			return err
+		}
+	} else if w.OnMove != OnMoveDoNothing {
+		return fmt.Errorf("unknown OnMoveBehavior: %d", w.OnMove)
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
+
+// followMoveTarget removes the moved actor from the "following" collection of
+// the actor owning this inbox, and sends a Follow to the actor it moved to.
+//
+// Nothing is done if the moved actor was not being followed.
+func (w FederatingWrappedCallbacks) followMoveTarget(c context.Context, origin, target *url.URL) error {
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	following, err := w.db.Following(c, actorIRI)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	if !removeCollectionItems(following, []*url.URL{origin}) {
+		w.db.Unlock(c, actorIRI)
+		return nil
+	}
+	if err = w.db.Update(c, following); err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	//
+	// Follow the target. It is added to the following collection once it
+	// accepts.
+	follow := streams.NewActivityStreamsFollow()
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(actorIRI)
+	follow.SetActivityStreamsActor(me)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(target)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(target)
+	follow.SetActivityStreamsTo(to)
+	if err := w.addNewIds(c, follow); err != nil {
+		return err
+	} else if err := w.addToOutbox(c, outboxIRI, follow); err != nil {
+		return err
+	}
+	return w.deliver(c, outboxIRI, follow)
+}
+
+// flag implements the federating Flag activity side effects.
+func (w FederatingWrappedCallbacks) flag(c context.Context, a vocab.ActivityStreamsFlag) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	// Ensure only this server's objects are reported to it.
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, id); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		owns, err := w.db.Owns(c, id)
+		w.db.Unlock(c, id)
+		// Unlock must be called by now and every branch above.
+		if err != nil {
+			return err
+		} else if !owns {
+			return fmt.Errorf("cannot handle federated flag: %s is not owned by this server", id)
+		}
+	}
+	// Store the report.
+	id, err := GetId(a)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Lock(c, id); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	err = w.db.Create(c, a)
+	w.db.Unlock(c, id)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return err
+	}
+	if w.Flag != nil {
+		return w.Flag(c, a)
+	}
+	return nil
+}
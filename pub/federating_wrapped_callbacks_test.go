@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
@@ -278,6 +279,22 @@ func TestFederatedCreate(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("LeavesObjectsOfSharedInboxCopyToFirstInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		called := false
+		w.Create = func(c context.Context, a vocab.ActivityStreamsCreate) error {
+			called = true
+			return nil
+		}
+		c := newCreateFn()
+		err := w.create(withSharedInboxCopy(ctx), c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, called, true)
+	})
 	t.Run("CreatesAllFederatedObjects", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -295,6 +312,43 @@ func TestFederatedCreate(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("AddsReplyToLocalObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId2))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId1))
+		reply.SetActivityStreamsInReplyTo(irt)
+		expectNote := streams.NewActivityStreamsNote()
+		expectReplies := streams.NewActivityStreamsRepliesProperty()
+		expectCol := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testNoteId2))
+		expectCol.SetActivityStreamsItems(expectItems)
+		expectReplies.SetActivityStreamsCollection(expectCol)
+		expectNote.SetActivityStreamsReplies(expectReplies)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Create(ctx, reply)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(
+			streams.NewActivityStreamsNote(), nil)
+		mockDB.EXPECT().Update(ctx, expectNote).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		c := newCreateFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(reply)
+		c.SetActivityStreamsObject(op)
+		err := w.create(ctx, c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("DereferencesIRIObject", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -505,6 +559,7 @@ func TestFederatedDelete(t *testing.T) {
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		d := newDeleteFn()
@@ -518,9 +573,11 @@ func TestFederatedDelete(t *testing.T) {
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId2)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId2))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
 		d := newDeleteFn()
@@ -530,11 +587,120 @@ func TestFederatedDelete(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("RemovesReplyFromLocalObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		reply.SetActivityStreamsInReplyTo(irt)
+		parent := streams.NewActivityStreamsNote()
+		replies := streams.NewActivityStreamsRepliesProperty()
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testNoteId1))
+		col.SetActivityStreamsItems(items)
+		replies.SetActivityStreamsCollection(col)
+		parent.SetActivityStreamsReplies(replies)
+		expectParent := streams.NewActivityStreamsNote()
+		expectReplies := streams.NewActivityStreamsRepliesProperty()
+		expectCol := streams.NewActivityStreamsCollection()
+		expectCol.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+		expectReplies.SetActivityStreamsCollection(expectCol)
+		expectParent.SetActivityStreamsReplies(expectReplies)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(reply, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(parent, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expectParent))
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		d := newDeleteFn()
+		err := w.deleteFn(ctx, d)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("EvictsPublicKeys", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockClock := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(mockClock, time.Hour)
+		w.publicKeyCache = cache
+		keyId := mustParse(testNoteId1 + "#main-key")
+		mockClock.EXPECT().Now().Return(now())
+		err := cache.Set(ctx, testPublicKey(keyId.String(), testNoteId1, testRSAKey))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		d := newDeleteFn()
+		err = w.deleteFn(ctx, d)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		_, found, err := cache.Get(ctx, keyId)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+	})
+	t.Run("EvictsPublicKeysOfDatabaseCacheOnceUnlocked", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockClock := NewMockClock(ctl)
+		db := newLockingDatabase(mockDB)
+		cache := NewDatabasePublicKeyCache(db, mockClock, time.Hour)
+		var w FederatingWrappedCallbacks
+		w.db = db
+		w.publicKeyCache = cache
+		keyId := mustParse(testNoteId1 + "#main-key")
+		key := testPublicKey(keyId.String(), testNoteId1, testRSAKey)
+		mockClock.EXPECT().Now().Return(now())
+		mockDB.EXPECT().Exists(ctx, keyId).Return(false, nil)
+		mockDB.EXPECT().Create(ctx, key)
+		err := cache.Set(ctx, key)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil).Times(2)
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, keyId).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, keyId).Return(key, nil)
+		mockDB.EXPECT().Delete(ctx, keyId)
+		d := newDeleteFn()
+		done := make(chan error, 1)
+		go func() {
+			done <- w.deleteFn(ctx, d)
+		}()
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("deadlocked evicting the keys of the deleted object")
+		}
+	})
 	t.Run("CallsCustomCallback", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		d := newDeleteFn()
@@ -552,6 +718,185 @@ func TestFederatedDelete(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, d, got)
 	})
+	newActorDeleteFn := func() vocab.ActivityStreamsDelete {
+		d := streams.NewActivityStreamsDelete()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		d.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		d.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		d.SetActivityStreamsObject(op)
+		return d
+	}
+	newCollectionFn := func(id string, items ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		idProp := streams.NewJSONLDIdProperty()
+		idProp.Set(mustParse(id))
+		col.SetJSONLDId(idProp)
+		itemsProp := streams.NewActivityStreamsItemsProperty()
+		for _, item := range items {
+			itemsProp.AppendIRI(mustParse(item))
+		}
+		col.SetActivityStreamsItems(itemsProp)
+		return col
+	}
+	t.Run("RemovesSelfDeletedActorFromRelationships", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		var gotFollower, gotFollowed bool
+		w.ActorDeleteHooks.Relationships = func(c context.Context, actorIRI, deletedIRI *url.URL, follower, followed bool) error {
+			assertEqual(t, actorIRI.String(), testPersonIRI)
+			assertEqual(t, deletedIRI.String(), testFederatedActorIRI)
+			gotFollower = follower
+			gotFollowed = followed
+			return nil
+		}
+		followers := newCollectionFn(testPersonIRI+"/followers", testFederatedActorIRI, testFederatedActorIRI2)
+		expectFollowers := newCollectionFn(testPersonIRI+"/followers", testFederatedActorIRI2)
+		following := newCollectionFn(testPersonIRI+"/following", testFederatedActorIRI3)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(followers, nil)
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(following, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expectFollowers))
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		err := w.deleteFn(ctx, newActorDeleteFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, gotFollower, true)
+		assertEqual(t, gotFollowed, false)
+	})
+	setupActorContentFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockActorContentDatabase) {
+		mockDB = NewMockActorContentDatabase(ctl)
+		w.db = mockDB
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(newCollectionFn(testPersonIRI+"/followers"), nil)
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(newCollectionFn(testPersonIRI+"/following"), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		return
+	}
+	newContentFn := func() vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI2))
+		note.SetJSONLDId(id)
+		attributedTo := streams.NewActivityStreamsAttributedToProperty()
+		attributedTo.AppendIRI(mustParse(testFederatedActorIRI))
+		note.SetActivityStreamsAttributedTo(attributedTo)
+		return note
+	}
+	t.Run("PurgesContentOfSelfDeletedActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupActorContentFn(ctl)
+		w.OnActorDelete = OnActorDeletePurgeContent
+		likeIRI := mustParse(testFederatedActivityIRI + "/like")
+		like := streams.NewActivityStreamsLike()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(likeIRI)
+		like.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		like.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId1))
+		like.SetActivityStreamsObject(op)
+		liked := streams.NewActivityStreamsNote()
+		likes := streams.NewActivityStreamsLikesProperty()
+		likes.SetActivityStreamsCollection(newCollectionFn(testNoteId1+"/likes", likeIRI.String()))
+		liked.SetActivityStreamsLikes(likes)
+		expectLiked := streams.NewActivityStreamsNote()
+		expectLikes := streams.NewActivityStreamsLikesProperty()
+		expectLikes.SetActivityStreamsCollection(newCollectionFn(testNoteId1 + "/likes"))
+		expectLiked.SetActivityStreamsLikes(expectLikes)
+		note := newContentFn()
+		var interactions, content []vocab.Type
+		w.ActorDeleteHooks.Interaction = func(c context.Context, activity Activity) error {
+			interactions = append(interactions, activity)
+			return nil
+		}
+		w.ActorDeleteHooks.Content = func(c context.Context, t vocab.Type) error {
+			content = append(content, t)
+			return nil
+		}
+		mockDB.EXPECT().ActorContent(ctx, mustParse(testFederatedActorIRI)).Return(
+			[]*url.URL{likeIRI, mustParse(testFederatedActivityIRI2)}, nil)
+		mockDB.EXPECT().Lock(ctx, likeIRI).Times(2)
+		mockDB.EXPECT().Exists(ctx, likeIRI).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, likeIRI).Return(like, nil)
+		mockDB.EXPECT().Delete(ctx, likeIRI)
+		mockDB.EXPECT().Unlock(ctx, likeIRI).Times(2)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(liked, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expectLiked))
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2)).Times(2)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI2)).Return(note, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2)).Times(2)
+		err := w.deleteFn(ctx, newActorDeleteFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, len(interactions), 1)
+		assertEqual(t, interactions[0], vocab.Type(like))
+		assertEqual(t, len(content), 2)
+		assertEqual(t, content[0], vocab.Type(like))
+		assertEqual(t, content[1], vocab.Type(note))
+	})
+	t.Run("TombstonesContentOfSelfDeletedActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupActorContentFn(ctl)
+		mockClock := NewMockClock(ctl)
+		w.clock = mockClock
+		w.OnActorDelete = OnActorDeleteTombstoneContent
+		note := newContentFn()
+		expectTomb := toTombstone(note, mustParse(testFederatedActivityIRI2), now())
+		mockDB.EXPECT().ActorContent(ctx, mustParse(testFederatedActorIRI)).Return(
+			[]*url.URL{mustParse(testFederatedActivityIRI2)}, nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2)).Times(2)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI2)).Return(note, nil)
+		mockClock.EXPECT().Now().Return(now())
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expectTomb))
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2)).Times(2)
+		err := w.deleteFn(ctx, newActorDeleteFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 }
 
 func TestFederatedFollow(t *testing.T) {
@@ -765,10 +1110,10 @@ func TestFederatedAccept(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("DereferencesObjectIRI", func(t *testing.T) {
+	t.Run("ResolvesObjectIRIFromDatabase", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockDB, mockTp := setupFn(ctl)
+		w, mockDB, _ := setupFn(ctl)
 		followers := streams.NewActivityStreamsCollection()
 		expectFollowers := streams.NewActivityStreamsCollection()
 		expectItems := streams.NewActivityStreamsItemsProperty()
@@ -778,17 +1123,16 @@ func TestFederatedAccept(t *testing.T) {
 		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
 			mustParse(testFederatedActorIRI2), nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
-		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
-			mustSerializeToBytes(testFollow), nil)
 		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
 		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
 			testFollow, nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
-		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
-		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+		mockDB.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(gomock.Any(), mustParse(testFederatedActorIRI2)).Return(
 			followers, nil)
-		mockDB.EXPECT().Update(ctx, expectFollowers)
-		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Update(gomock.Any(), expectFollowers)
+		mockDB.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI2))
 		a := newAcceptFn()
 		op := streams.NewActivityStreamsObjectProperty()
 		op.AppendIRI(mustParse(testFederatedActivityIRI))
@@ -815,7 +1159,33 @@ func TestFederatedAccept(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("IgnoresFollowObjectsNotContainingMe", func(t *testing.T) {
+	t.Run("IgnoresObjectIRIsNotOwned", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		var got []FollowResponse
+		w.Accept = func(c context.Context, v vocab.ActivityStreamsAccept) error {
+			got, _ = FollowResponses(c)
+			return nil
+		}
+		a := newAcceptFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		a.SetActivityStreamsObject(op)
+		err := w.accept(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, len(got), 0)
+	})
+	t.Run("DoesNotUpdateFollowingIfFollowNotFromMe", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB, _ := setupFn(ctl)
@@ -823,13 +1193,18 @@ func TestFederatedAccept(t *testing.T) {
 		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
 			mustParse(testFederatedActorIRI3), nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
+			testFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
 		a := newAcceptFn()
 		err := w.accept(ctx, a)
 		if err != nil {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("ErrorIfPeerLiedAboutOurFollowId", func(t *testing.T) {
+	t.Run("DoesNotUpdateFollowingIfPeerLiedAboutOurFollowId", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB, _ := setupFn(ctl)
@@ -838,13 +1213,47 @@ func TestFederatedAccept(t *testing.T) {
 			mustParse(testFederatedActorIRI2), nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
 		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
 		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
 			testListen, nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		var got []FollowResponse
+		w.Accept = func(c context.Context, v vocab.ActivityStreamsAccept) error {
+			got, _ = FollowResponses(c)
+			return nil
+		}
 		a := newAcceptFn()
 		err := w.accept(ctx, a)
-		if err == nil {
-			t.Fatalf("expected error, got none")
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("expected 1 follow response, got %d", len(got))
+		}
+		assertEqual(t, got[0].Follow.String(), testFederatedActivityIRI)
+		assertEqual(t, got[0].Verified, false)
+		assertNotEqual(t, got[0].Err, nil)
+	})
+	t.Run("DoesNotUpdateFollowingIfPeerWasNotFollowed", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
+			testFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		a := newAcceptFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI3))
+		a.SetActivityStreamsActor(actor)
+		err := w.accept(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
 		}
 	})
 	t.Run("UpdatesFollowingCollection", func(t *testing.T) {
@@ -861,29 +1270,122 @@ func TestFederatedAccept(t *testing.T) {
 			mustParse(testFederatedActorIRI2), nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
 		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
 		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
 			testFollow, nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
-		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
-		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+		mockDB.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(gomock.Any(), mustParse(testFederatedActorIRI2)).Return(
 			followers, nil)
-		mockDB.EXPECT().Update(ctx, expectFollowers)
-		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Update(gomock.Any(), expectFollowers)
+		mockDB.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI2))
 		a := newAcceptFn()
 		err := w.accept(ctx, a)
 		if err != nil {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("CallsCustomCallback", func(t *testing.T) {
+	t.Run("DoesNotDuplicateFollowing", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		following.SetActivityStreamsItems(items)
+		expectFollowing := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI))
+		expectFollowing.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
+			testFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(gomock.Any(), mustParse(testFederatedActorIRI2)).Return(
+			following, nil)
+		mockDB.EXPECT().Update(gomock.Any(), expectFollowing)
+		mockDB.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI2))
 		a := newAcceptFn()
-		a.SetActivityStreamsObject(nil)
-		var w FederatingWrappedCallbacks
-		var gotc context.Context
-		var got vocab.ActivityStreamsAccept
-		w.Accept = func(ctx context.Context, v vocab.ActivityStreamsAccept) error {
-			gotc = ctx
-			got = v
+		err := w.accept(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("HandlesMultipleFollows", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		otherFollow := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		otherFollow.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		otherFollow.SetActivityStreamsActor(actor)
+		followOp := streams.NewActivityStreamsObjectProperty()
+		followOp.AppendIRI(mustParse(testFederatedActorIRI3))
+		otherFollow.SetActivityStreamsObject(followOp)
+		followers := streams.NewActivityStreamsCollection()
+		expectFollowers := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI))
+		expectFollowers.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNewActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNewActivityIRI)).Return(
+			otherFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
+			testFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(gomock.Any(), mustParse(testFederatedActorIRI2)).Return(
+			followers, nil)
+		mockDB.EXPECT().Update(gomock.Any(), expectFollowers)
+		mockDB.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		var got []FollowResponse
+		w.Accept = func(c context.Context, v vocab.ActivityStreamsAccept) error {
+			got, _ = FollowResponses(c)
+			return nil
+		}
+		a := newAcceptFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(otherFollow)
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		a.SetActivityStreamsObject(op)
+		err := w.accept(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("expected 2 follow responses, got %d", len(got))
+		}
+		assertEqual(t, got[0].Follow.String(), testNewActivityIRI)
+		assertEqual(t, got[0].Verified, false)
+		assertEqual(t, got[1].Follow.String(), testFederatedActivityIRI)
+		assertEqual(t, got[1].Verified, true)
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		a := newAcceptFn()
+		a.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		var gotc context.Context
+		var got vocab.ActivityStreamsAccept
+		w.Accept = func(ctx context.Context, v vocab.ActivityStreamsAccept) error {
+			gotc = ctx
+			got = v
 			return nil
 		}
 		err := w.accept(ctx, a)
@@ -896,7 +1398,85 @@ func TestFederatedAccept(t *testing.T) {
 }
 
 func TestFederatedReject(t *testing.T) {
+	newRejectFn := func() vocab.ActivityStreamsReject {
+		r := streams.NewActivityStreamsReject()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI2))
+		r.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		r.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(testFollow)
+		r.SetActivityStreamsObject(op)
+		return r
+	}
 	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.db = mockDB
+		return
+	}
+	t.Run("RemovesFromFollowingCollection", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		items.AppendIRI(mustParse(testFederatedActorIRI3))
+		following.SetActivityStreamsItems(items)
+		expectFollowing := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI3))
+		expectFollowing.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(
+			testFollow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(gomock.Any(), mustParse(testFederatedActorIRI2)).Return(
+			following, nil)
+		mockDB.EXPECT().Update(gomock.Any(), expectFollowing)
+		mockDB.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI2))
+		var got []FollowResponse
+		w.Reject = func(c context.Context, v vocab.ActivityStreamsReject) error {
+			got, _ = FollowResponses(c)
+			return nil
+		}
+		r := newRejectFn()
+		err := w.reject(ctx, r)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("expected 1 follow response, got %d", len(got))
+		}
+		assertEqual(t, got[0].Verified, true)
+	})
+	t.Run("DoesNotRemoveFromFollowingIfUnverified", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		r := newRejectFn()
+		err := w.reject(ctx, r)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("CallsCustomCallback", func(t *testing.T) {
 		r := streams.NewActivityStreamsReject()
 		var w FederatingWrappedCallbacks
@@ -1675,8 +2255,10 @@ func TestFederatedUndo(t *testing.T) {
 		return u
 	}
 	ctx := context.Background()
-	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockTp *MockTransport) {
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockTp *MockTransport, mockDB *MockDatabase) {
 		mockTp = NewMockTransport(ctl)
+		mockDB = NewMockDatabase(ctl)
+		w.db = mockDB
 		w.inboxIRI = mustParse(testMyInboxIRI)
 		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
 			return mockTp, nil
@@ -1704,7 +2286,7 @@ func TestFederatedUndo(t *testing.T) {
 	t.Run("ErrorIfActorMismatch", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockTp := setupFn(ctl)
+		w, mockTp, _ := setupFn(ctl)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
 			mustSerializeToBytes(testListen), nil)
 		u := newUndoFn()
@@ -1719,7 +2301,7 @@ func TestFederatedUndo(t *testing.T) {
 	t.Run("ErrorIfActorMismatchWhenDereferencingIRI", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockTp := setupFn(ctl)
+		w, mockTp, _ := setupFn(ctl)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
 			mustSerializeToBytes(testFollow), nil)
 		u := newUndoFn()
@@ -1734,7 +2316,7 @@ func TestFederatedUndo(t *testing.T) {
 	t.Run("DereferencesWhenUndoValue", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockTp := setupFn(ctl)
+		w, mockTp, _ := setupFn(ctl)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
 			mustSerializeToBytes(testListen), nil)
 		u := newUndoFn()
@@ -1746,9 +2328,12 @@ func TestFederatedUndo(t *testing.T) {
 	t.Run("DereferencesWhenUndoIRI", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockTp := setupFn(ctl)
+		w, mockTp, mockDB := setupFn(ctl)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
 			mustSerializeToBytes(testListen), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
 		u := newUndoFn()
 		op := streams.NewActivityStreamsObjectProperty()
 		op.AppendIRI(mustParse(testFederatedActivityIRI))
@@ -1758,10 +2343,249 @@ func TestFederatedUndo(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	newFollowFn := func() vocab.ActivityStreamsFollow {
+		f := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		f.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		f.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI2))
+		f.SetActivityStreamsObject(op)
+		return f
+	}
+	newCollectionFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	emptiedCollectionFn := func() vocab.ActivityStreamsCollection {
+		col := newCollectionFn(testFederatedActivityIRI)
+		col.GetActivityStreamsItems().Remove(0)
+		return col
+	}
+	t.Run("UndoFollowRemovesFromFollowers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		follow := newFollowFn()
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(follow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI2)).Return(
+			newCollectionFn(testFederatedActorIRI3, testFederatedActorIRI), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI3)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoFollowIgnoresFollowOfOtherActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		follow := newFollowFn()
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(follow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI4), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("ResolvesUndoneIRIFromDatabase", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		follow := newFollowFn()
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(follow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(follow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI2)).Return(
+			newCollectionFn(testFederatedActorIRI), nil)
+		mockDB.EXPECT().Update(ctx, emptiedCollectionFn()).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoAcceptRemovesFromFollowing", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		follow := streams.NewActivityStreamsFollow()
+		followId := streams.NewJSONLDIdProperty()
+		followId.Set(mustParse(testNewActivityIRI))
+		follow.SetJSONLDId(followId)
+		followActor := streams.NewActivityStreamsActorProperty()
+		followActor.AppendIRI(mustParse(testFederatedActorIRI2))
+		follow.SetActivityStreamsActor(followActor)
+		followOp := streams.NewActivityStreamsObjectProperty()
+		followOp.AppendIRI(mustParse(testFederatedActorIRI))
+		follow.SetActivityStreamsObject(followOp)
+		accept := streams.NewActivityStreamsAccept()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		accept.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		accept.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		accept.SetActivityStreamsObject(op)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(accept), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+			newCollectionFn(testFederatedActorIRI, testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI3)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		u := newUndoFn()
+		uop := streams.NewActivityStreamsObjectProperty()
+		uop.AppendActivityStreamsAccept(accept)
+		u.SetActivityStreamsObject(uop)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoLikeRemovesFromLikes", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		like := streams.NewActivityStreamsLike()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		like.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		like.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId1))
+		like.SetActivityStreamsObject(op)
+		note := streams.NewActivityStreamsNote()
+		likes := streams.NewActivityStreamsLikesProperty()
+		likes.SetActivityStreamsCollection(newCollectionFn(testFederatedActivityIRI2, testFederatedActivityIRI))
+		note.SetActivityStreamsLikes(likes)
+		expectNote := streams.NewActivityStreamsNote()
+		expectLikes := streams.NewActivityStreamsLikesProperty()
+		expectLikes.SetActivityStreamsCollection(newCollectionFn(testFederatedActivityIRI2))
+		expectNote.SetActivityStreamsLikes(expectLikes)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(like), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Update(ctx, expectNote).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		u := newUndoFn()
+		uop := streams.NewActivityStreamsObjectProperty()
+		uop.AppendActivityStreamsLike(like)
+		u.SetActivityStreamsObject(uop)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoAnnounceRemovesFromShares", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, mockDB := setupFn(ctl)
+		announce := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		announce.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		announce.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId1))
+		announce.SetActivityStreamsObject(op)
+		note := streams.NewActivityStreamsNote()
+		shares := streams.NewActivityStreamsSharesProperty()
+		shares.SetIRI(mustParse(testNoteId2))
+		note.SetActivityStreamsShares(shares)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(announce), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(
+			newCollectionFn(testFederatedActivityIRI), nil)
+		mockDB.EXPECT().Update(ctx, emptiedCollectionFn()).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		u := newUndoFn()
+		uop := streams.NewActivityStreamsObjectProperty()
+		uop.AppendActivityStreamsAnnounce(announce)
+		u.SetActivityStreamsObject(uop)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("ErrorIfUndoneActivityFromOtherOrigin", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp, _ := setupFn(ctl)
+		follow := newFollowFn()
+		follow.GetJSONLDId().Set(mustParse(testToIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testToIRI)).Return(
+			mustSerializeToBytes(follow), nil)
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
 	t.Run("CallsCustomCallback", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		w, mockTp := setupFn(ctl)
+		w, mockTp, _ := setupFn(ctl)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
 			mustSerializeToBytes(testListen), nil)
 		var gotc context.Context
@@ -1832,3 +2656,281 @@ func TestFederatedBlock(t *testing.T) {
 		assertEqual(t, b, got)
 	})
 }
+
+func TestFederatedMove(t *testing.T) {
+	newMoveFn := func() vocab.ActivityStreamsMove {
+		m := streams.NewActivityStreamsMove()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		m.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsObject(op)
+		tp := streams.NewActivityStreamsTargetProperty()
+		tp.AppendIRI(mustParse(testFederatedActorIRI3))
+		m.SetActivityStreamsTarget(tp)
+		return m
+	}
+	newTargetFn := func(alsoKnownAs ...string) vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI3))
+		p.SetJSONLDId(id)
+		aka := make([]interface{}, 0, len(alsoKnownAs))
+		for _, s := range alsoKnownAs {
+			aka = append(aka, s)
+		}
+		p.GetUnknownProperties()["alsoKnownAs"] = aka
+		return p
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockTp *MockTransport) {
+		mockDB = NewMockDatabase(ctl)
+		mockTp = NewMockTransport(ctl)
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.db = mockDB
+		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
+			return mockTp, nil
+		}
+		return
+	}
+	expectTargetFn := func(mockDB *MockDatabase, mockTp *MockTransport, target vocab.Type) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI3))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActorIRI3)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI3))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI3)).Return(
+			mustSerializeToBytes(target), nil)
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		m := newMoveFn()
+		m.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		assertEqual(t, err, ErrObjectRequired)
+	})
+	t.Run("ErrorIfNoTarget", func(t *testing.T) {
+		m := newMoveFn()
+		m.SetActivityStreamsTarget(nil)
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		assertEqual(t, err, ErrTargetRequired)
+	})
+	t.Run("ErrorIfObjectIsNotActor", func(t *testing.T) {
+		m := newMoveFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		m.SetActivityStreamsActor(actor)
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ErrorIfTargetDoesNotListAlias", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		expectTargetFn(mockDB, mockTp, newTargetFn(testFederatedActorIRI4))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("DoesNothingByDefault", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		expectTargetFn(mockDB, mockTp, newTargetFn(testFederatedActorIRI))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("OnMoveFollowTargetDoesNothingIfNotFollowing", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		w.OnMove = OnMoveFollowTarget
+		expectTargetFn(mockDB, mockTp, newTargetFn(testFederatedActorIRI))
+		following := streams.NewActivityStreamsCollection()
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+			following, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("OnMoveFollowTargetUnfollowsAndFollowsTarget", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		w.OnMove = OnMoveFollowTarget
+		var added, delivered Activity
+		var gotOutbox *url.URL
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(testNewActivityIRI))
+			activity.SetJSONLDId(id)
+			return nil
+		}
+		w.addToOutbox = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			added = activity
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			gotOutbox = outboxIRI
+			delivered = activity
+			return nil
+		}
+		expectTargetFn(mockDB, mockTp, newTargetFn(testFederatedActorIRI4, testFederatedActorIRI))
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		items.AppendIRI(mustParse(testFederatedActorIRI4))
+		following.SetActivityStreamsItems(items)
+		expectFollowing := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI4))
+		expectFollowing.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+			following, nil)
+		mockDB.EXPECT().Update(ctx, expectFollowing)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		expectFollow := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		expectFollow.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		expectFollow.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI3))
+		expectFollow.SetActivityStreamsObject(op)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI3))
+		expectFollow.SetActivityStreamsTo(to)
+		assertEqual(t, added, delivered)
+		assertEqual(t, gotOutbox.String(), testMyOutboxIRI)
+		assertByteEqual(t, mustSerializeToBytes(delivered), mustSerializeToBytes(expectFollow))
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		expectTargetFn(mockDB, mockTp, newTargetFn(testFederatedActorIRI))
+		var gotc context.Context
+		var got vocab.ActivityStreamsMove
+		w.Move = func(ctx context.Context, v vocab.ActivityStreamsMove) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, m, got)
+	})
+}
+
+func TestFederatedFlag(t *testing.T) {
+	newFlagFn := func() vocab.ActivityStreamsFlag {
+		f := streams.NewActivityStreamsFlag()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		f.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		f.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testPersonIRI))
+		op.AppendIRI(mustParse(testNoteId1))
+		f.SetActivityStreamsObject(op)
+		return f
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		w.db = mockDB
+		return
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		f := newFlagFn()
+		f.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		err := w.flag(ctx, f)
+		assertEqual(t, err, ErrObjectRequired)
+	})
+	t.Run("ErrorIfObjectNotOwned", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		f := newFlagFn()
+		err := w.flag(ctx, f)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("StoresReport", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		f := newFlagFn()
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Create(ctx, f)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		var gotc context.Context
+		var got vocab.ActivityStreamsFlag
+		w.Flag = func(ctx context.Context, v vocab.ActivityStreamsFlag) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		err := w.flag(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, f, got)
+	})
+}
@@ -0,0 +1,203 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HostPolicy is how this server federates with the servers of a host.
+//
+// The zero value federates normally.
+type HostPolicy struct {
+	// Suspend refuses the activities and signed requests of the host, and
+	// nothing is delivered nor forwarded to it.
+	Suspend bool
+	// Silence accepts the activities of the host, but they are not
+	// forwarded. The application must not show them publicly, such as on
+	// public timelines.
+	Silence bool
+	// RejectMedia accepts the activities of the host, but the application
+	// must not fetch nor store their media attachments.
+	RejectMedia bool
+}
+
+// merge returns the most restrictive combination of both policies.
+func (p HostPolicy) merge(o HostPolicy) HostPolicy {
+	return HostPolicy{
+		Suspend:     p.Suspend || o.Suspend,
+		Silence:     p.Silence || o.Silence,
+		RejectMedia: p.RejectMedia || o.RejectMedia,
+	}
+}
+
+// FederationPolicy determines how this server federates with other servers,
+// by their host.
+//
+// It is applied to the activities POSTed to inboxes, the signed GET requests
+// served by the handler of NewActivityStreamsHandler, the deliveries of
+// activities, and inbox forwarding.
+type FederationPolicy interface {
+	// HostPolicy returns the HostPolicy of the host, which is the
+	// hostname of an IRI without its port.
+	HostPolicy(c context.Context, host string) (HostPolicy, error)
+}
+
+// DomainPolicy is a FederationPolicy configured with lists of domains.
+//
+// A domain applies to its subdomains as well: "example.com" applies to
+// "social.example.com".
+type DomainPolicy struct {
+	// Allowlist enables strict allowlist mode: the hosts that are not in
+	// Allowed are suspended. The domain of this server must be in Allowed.
+	Allowlist bool
+	// Allowed are the domains federated with in allowlist mode.
+	Allowed []string
+	// Suspended are the domains whose hosts are suspended.
+	Suspended []string
+	// Silenced are the domains whose hosts are silenced.
+	Silenced []string
+	// MediaRejected are the domains whose media is rejected.
+	MediaRejected []string
+}
+
+// DomainPolicy is a FederationPolicy.
+var _ FederationPolicy = DomainPolicy{}
+
+// HostPolicy returns the HostPolicy of the host given by the domain lists.
+func (d DomainPolicy) HostPolicy(c context.Context, host string) (p HostPolicy, err error) {
+	p.Suspend = matchesDomain(host, d.Suspended) ||
+		(d.Allowlist && !matchesDomain(host, d.Allowed))
+	p.Silence = matchesDomain(host, d.Silenced)
+	p.RejectMedia = matchesDomain(host, d.MediaRejected)
+	return
+}
+
+// matchesDomain returns true if the host is one of the domains, or one of
+// their subdomains.
+func matchesDomain(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSuffix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPolicies obtains the HostPolicy of the hosts of IRIs, only asking the
+// FederationPolicy once for each host.
+//
+// A nil FederationPolicy federates normally with all hosts.
+type hostPolicies struct {
+	policy FederationPolicy
+	byHost map[string]HostPolicy
+}
+
+// newHostPolicies creates a hostPolicies for the lifetime of a single request.
+func newHostPolicies(policy FederationPolicy) *hostPolicies {
+	return &hostPolicies{
+		policy: policy,
+		byHost: make(map[string]HostPolicy),
+	}
+}
+
+// of returns the HostPolicy of the host of the IRI.
+func (h *hostPolicies) of(c context.Context, iri *url.URL) (HostPolicy, error) {
+	if h.policy == nil {
+		return HostPolicy{}, nil
+	}
+	host := iri.Hostname()
+	if p, ok := h.byHost[host]; ok {
+		return p, nil
+	}
+	p, err := h.policy.HostPolicy(c, host)
+	if err != nil {
+		return HostPolicy{}, err
+	}
+	h.byHost[host] = p
+	return p, nil
+}
+
+// merged returns the most restrictive HostPolicy of the hosts of the IRIs.
+func (h *hostPolicies) merged(c context.Context, iris []*url.URL) (p HostPolicy, err error) {
+	for _, iri := range iris {
+		var o HostPolicy
+		o, err = h.of(c, iri)
+		if err != nil {
+			return
+		}
+		p = p.merge(o)
+	}
+	return
+}
+
+// withoutSuspended returns the IRIs whose hosts are not suspended.
+func (h *hostPolicies) withoutSuspended(c context.Context, iris []*url.URL) ([]*url.URL, error) {
+	if h.policy == nil {
+		return iris, nil
+	}
+	out := make([]*url.URL, 0, len(iris))
+	for _, iri := range iris {
+		p, err := h.of(c, iri)
+		if err != nil {
+			return nil, err
+		} else if !p.Suspend {
+			out = append(out, iri)
+		}
+	}
+	return out, nil
+}
+
+// activityOrigins returns the id of an activity along with the ids of its
+// actors, whose hosts determine the HostPolicy applying to it.
+func activityOrigins(activity Activity) ([]*url.URL, error) {
+	iris, err := getActorIds(activity)
+	if err != nil {
+		return nil, err
+	}
+	if id := activity.GetJSONLDId(); id != nil && id.Get() != nil {
+		iris = append(iris, id.Get())
+	}
+	return iris, nil
+}
+
+// hostPolicyContextKey is the context key of the HostPolicy of a received
+// activity.
+type hostPolicyContextKey struct{}
+
+// ReceivedHostPolicy returns the HostPolicy applying to an activity received
+// from a peer, if the context is the one passed to the FederatingProtocol's
+// FederatingCallbacks and DefaultCallback, as well as to the callbacks they
+// return, and a FederationPolicy is configured.
+//
+// It is the most restrictive HostPolicy of the hosts of the activity and of
+// its actors. Applications use it to not show activities from silenced hosts
+// publicly, and to not fetch the media of activities from hosts whose media is
+// rejected.
+func ReceivedHostPolicy(c context.Context) (p HostPolicy, ok bool) {
+	p, ok = c.Value(hostPolicyContextKey{}).(HostPolicy)
+	return
+}
+
+// signedRequester returns the IRI identifying the server that signed a
+// request: its actor verified by an HttpSigVerifier, or otherwise the keyId of
+// its HTTP Signature. Returns nil if the request is not signed.
+//
+// The keyId is not verified, which is only suitable to refuse a request.
+func signedRequester(c context.Context, r *http.Request) *url.URL {
+	if actorIRI, ok := VerifiedActor(c); ok {
+		return actorIRI
+	}
+	params := httpSigParams(r.Header)
+	if params == nil {
+		return nil
+	}
+	keyId, err := url.Parse(params["keyid"])
+	if err != nil || len(keyId.Host) == 0 {
+		return nil
+	}
+	return keyId
+}
@@ -0,0 +1,57 @@
+package pub
+
+import (
+	"context"
+	"testing"
+)
+
+// TestDomainPolicy ensures domains apply to their hosts and subdomains.
+func TestDomainPolicy(t *testing.T) {
+	ctx := context.Background()
+	t.Run("AppliesToSubdomains", func(t *testing.T) {
+		d := DomainPolicy{
+			Suspended:     []string{"example.com"},
+			Silenced:      []string{"silenced.example"},
+			MediaRejected: []string{"Media.Example."},
+		}
+		p, err := d.HostPolicy(ctx, "other.example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{Suspend: true})
+		p, err = d.HostPolicy(ctx, "silenced.example")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{Silence: true})
+		p, err = d.HostPolicy(ctx, "cdn.media.example")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{RejectMedia: true})
+	})
+	t.Run("DoesNotApplyToSuffixesOfOtherDomains", func(t *testing.T) {
+		d := DomainPolicy{
+			Suspended: []string{"example.com"},
+		}
+		p, err := d.HostPolicy(ctx, "notexample.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{})
+	})
+	t.Run("AllowlistSuspendsOtherHosts", func(t *testing.T) {
+		d := DomainPolicy{
+			Allowlist: true,
+			Allowed:   []string{"example.com"},
+		}
+		p, err := d.HostPolicy(ctx, "maybe.example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{})
+		p, err = d.HostPolicy(ctx, "example.org")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{Suspend: true})
+	})
+	t.Run("SuspendedWinsOverAllowed", func(t *testing.T) {
+		d := DomainPolicy{
+			Allowlist: true,
+			Allowed:   []string{"example.com"},
+			Suspended: []string{"other.example.com"},
+		}
+		p, err := d.HostPolicy(ctx, "other.example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, p, HostPolicy{Suspend: true})
+	})
+}
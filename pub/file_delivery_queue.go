@@ -0,0 +1,233 @@
+package pub
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeliveryQueue must be implemented by FileDeliveryQueue.
+var _ DeliveryQueue = &FileDeliveryQueue{}
+
+const (
+	// fileDeliveryJobExt is the file extension of persisted jobs.
+	fileDeliveryJobExt = ".json"
+)
+
+// FileDeliveryQueue is a DeliveryQueue that persists each job as a file in a
+// directory, so that pending deliveries survive restarts.
+//
+// Jobs are also kept in memory, so the directory must not be shared between
+// multiple FileDeliveryQueues at the same time.
+type FileDeliveryQueue struct {
+	mem *MemoryDeliveryQueue
+	dir string
+}
+
+// NewFileDeliveryQueue opens the queue persisted in the directory, creating
+// the directory if needed. Jobs previously persisted there are loaded.
+func NewFileDeliveryQueue(dir string) (*FileDeliveryQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f := &FileDeliveryQueue{
+		mem: NewMemoryDeliveryQueue(),
+		dir: dir,
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+fileDeliveryJobExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var fj fileDeliveryJob
+		if err = json.Unmarshal(b, &fj); err != nil {
+			return nil, fmt.Errorf("cannot load delivery job %s: %s", name, err)
+		}
+		job, err := fj.toJob()
+		if err != nil {
+			return nil, fmt.Errorf("cannot load delivery job %s: %s", name, err)
+		}
+		f.mem.jobs[job.ID] = job
+	}
+	return f, nil
+}
+
+// Enqueue persists the jobs, then adds them to the queue.
+func (f *FileDeliveryQueue) Enqueue(c context.Context, jobs []DeliveryJob) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	for _, job := range jobs {
+		if _, ok := f.mem.jobs[job.ID]; ok {
+			return fmt.Errorf("delivery job %q already exists", job.ID)
+		}
+	}
+	for _, job := range jobs {
+		if err := f.write(job); err != nil {
+			return err
+		}
+		f.mem.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// Claim returns the due pending jobs, earliest first, persisting their lease.
+func (f *FileDeliveryQueue) Claim(c context.Context, now time.Time, lease time.Duration, max int) ([]DeliveryJob, error) {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	jobs := f.mem.claim(now, lease, max)
+	for _, job := range jobs {
+		if err := f.write(f.mem.jobs[job.ID]); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+// Update persists the job.
+func (f *FileDeliveryQueue) Update(c context.Context, job DeliveryJob) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	if _, ok := f.mem.jobs[job.ID]; !ok {
+		return fmt.Errorf("delivery job %q does not exist", job.ID)
+	}
+	if err := f.write(job); err != nil {
+		return err
+	}
+	f.mem.jobs[job.ID] = job
+	return nil
+}
+
+// Jobs returns the jobs for an Activity, oldest first.
+func (f *FileDeliveryQueue) Jobs(c context.Context, activityIRI *url.URL) ([]DeliveryJob, error) {
+	return f.mem.Jobs(c, activityIRI)
+}
+
+// Prune removes finished jobs last updated before the given time, and their
+// files.
+func (f *FileDeliveryQueue) Prune(c context.Context, before time.Time) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	for _, id := range f.mem.prune(before) {
+		if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// path determines the file name of the job with the given id. The id is
+// encoded so that it cannot escape the directory.
+func (f *FileDeliveryQueue) path(id string) string {
+	return filepath.Join(f.dir, hex.EncodeToString([]byte(id))+fileDeliveryJobExt)
+}
+
+// write atomically replaces the job's file.
+func (f *FileDeliveryQueue) write(job DeliveryJob) error {
+	b, err := json.Marshal(newFileDeliveryJob(job))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(f.dir, f.path(job.ID), b)
+}
+
+// writeFileAtomically replaces the file at the path, within the directory, with
+// the bytes. The file is either wholly replaced or left untouched.
+func writeFileAtomically(dir, path string, b []byte) error {
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileDeliveryJob is the serialized form of a DeliveryJob.
+type fileDeliveryJob struct {
+	ID          string    `json:"id"`
+	ActivityIRI string    `json:"activity,omitempty"`
+	BoxIRI      string    `json:"box"`
+	Recipient   string    `json:"recipient"`
+	Payload     []byte    `json:"payload"`
+	Status      int       `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Created     time.Time `json:"created"`
+	NextAttempt time.Time `json:"next_attempt"`
+	Updated     time.Time `json:"updated"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// newFileDeliveryJob converts a job into its serialized form.
+func newFileDeliveryJob(job DeliveryJob) fileDeliveryJob {
+	fj := fileDeliveryJob{
+		ID:          job.ID,
+		Payload:     job.Payload,
+		Status:      int(job.Status),
+		Attempts:    job.Attempts,
+		Created:     job.Created,
+		NextAttempt: job.NextAttempt,
+		Updated:     job.Updated,
+		LastError:   job.LastError,
+	}
+	if job.ActivityIRI != nil {
+		fj.ActivityIRI = job.ActivityIRI.String()
+	}
+	if job.BoxIRI != nil {
+		fj.BoxIRI = job.BoxIRI.String()
+	}
+	if job.Recipient != nil {
+		fj.Recipient = job.Recipient.String()
+	}
+	return fj
+}
+
+// toJob converts the serialized form back into a job.
+func (fj fileDeliveryJob) toJob() (job DeliveryJob, err error) {
+	if strings.TrimSpace(fj.ID) == "" {
+		err = fmt.Errorf("delivery job has no id")
+		return
+	}
+	job = DeliveryJob{
+		ID:          fj.ID,
+		Payload:     fj.Payload,
+		Status:      DeliveryStatus(fj.Status),
+		Attempts:    fj.Attempts,
+		Created:     fj.Created,
+		NextAttempt: fj.NextAttempt,
+		Updated:     fj.Updated,
+		LastError:   fj.LastError,
+	}
+	if len(fj.ActivityIRI) > 0 {
+		if job.ActivityIRI, err = url.Parse(fj.ActivityIRI); err != nil {
+			return
+		}
+	}
+	if job.BoxIRI, err = url.Parse(fj.BoxIRI); err != nil {
+		return
+	}
+	job.Recipient, err = url.Parse(fj.Recipient)
+	return
+}
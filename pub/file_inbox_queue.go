@@ -0,0 +1,212 @@
+package pub
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InboxQueue must be implemented by FileInboxQueue.
+var _ InboxQueue = &FileInboxQueue{}
+
+const (
+	// fileInboxJobExt is the file extension of persisted jobs.
+	fileInboxJobExt = ".json"
+)
+
+// FileInboxQueue is an InboxQueue that persists each job as a file in a
+// directory, so that received Activities not yet processed survive restarts.
+//
+// Jobs are also kept in memory, so the directory must not be shared between
+// multiple FileInboxQueues at the same time.
+type FileInboxQueue struct {
+	mem *MemoryInboxQueue
+	dir string
+}
+
+// NewFileInboxQueue opens the queue persisted in the directory, creating the
+// directory if needed. Jobs previously persisted there are loaded.
+func NewFileInboxQueue(dir string) (*FileInboxQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f := &FileInboxQueue{
+		mem: NewMemoryInboxQueue(),
+		dir: dir,
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+fileInboxJobExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var fj fileInboxJob
+		if err = json.Unmarshal(b, &fj); err != nil {
+			return nil, fmt.Errorf("cannot load inbox job %s: %s", name, err)
+		}
+		job, err := fj.toJob()
+		if err != nil {
+			return nil, fmt.Errorf("cannot load inbox job %s: %s", name, err)
+		}
+		f.mem.jobs[job.ID] = job
+	}
+	return f, nil
+}
+
+// Enqueue persists the jobs, then adds them to the queue.
+func (f *FileInboxQueue) Enqueue(c context.Context, jobs []InboxJob) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	for _, job := range jobs {
+		if _, ok := f.mem.jobs[job.ID]; ok {
+			return fmt.Errorf("inbox job %q already exists", job.ID)
+		}
+	}
+	for _, job := range jobs {
+		if err := f.write(job); err != nil {
+			return err
+		}
+		f.mem.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// Claim returns the due pending jobs, earliest first, persisting their lease.
+func (f *FileInboxQueue) Claim(c context.Context, now time.Time, lease time.Duration, max int) ([]InboxJob, error) {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	jobs := f.mem.claim(now, lease, max)
+	for _, job := range jobs {
+		if err := f.write(f.mem.jobs[job.ID]); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+// Update persists the job.
+func (f *FileInboxQueue) Update(c context.Context, job InboxJob) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	if _, ok := f.mem.jobs[job.ID]; !ok {
+		return fmt.Errorf("inbox job %q does not exist", job.ID)
+	}
+	if err := f.write(job); err != nil {
+		return err
+	}
+	f.mem.jobs[job.ID] = job
+	return nil
+}
+
+// Prune removes finished jobs last updated before the given time, and their
+// files.
+func (f *FileInboxQueue) Prune(c context.Context, before time.Time) error {
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	for _, id := range f.mem.prune(before) {
+		if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// path determines the file name of the job with the given id. The id is
+// encoded so that it cannot escape the directory.
+func (f *FileInboxQueue) path(id string) string {
+	return filepath.Join(f.dir, hex.EncodeToString([]byte(id))+fileInboxJobExt)
+}
+
+// write atomically replaces the job's file.
+func (f *FileInboxQueue) write(job InboxJob) error {
+	b, err := json.Marshal(newFileInboxJob(job))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(f.dir, f.path(job.ID), b)
+}
+
+// fileInboxJob is the serialized form of an InboxJob.
+type fileInboxJob struct {
+	ID            string    `json:"id"`
+	ActivityIRI   string    `json:"activity,omitempty"`
+	InboxIRI      string    `json:"inbox"`
+	VerifiedActor string    `json:"verified_actor,omitempty"`
+	Payload       []byte    `json:"payload"`
+	Status        int       `json:"status"`
+	Posted        bool      `json:"posted,omitempty"`
+	SharedCopy    bool      `json:"shared_copy,omitempty"`
+	Attempts      int       `json:"attempts"`
+	Created       time.Time `json:"created"`
+	NextAttempt   time.Time `json:"next_attempt"`
+	Updated       time.Time `json:"updated"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// newFileInboxJob converts a job into its serialized form.
+func newFileInboxJob(job InboxJob) fileInboxJob {
+	fj := fileInboxJob{
+		ID:          job.ID,
+		Payload:     job.Payload,
+		Status:      int(job.Status),
+		Posted:      job.Posted,
+		SharedCopy:  job.SharedCopy,
+		Attempts:    job.Attempts,
+		Created:     job.Created,
+		NextAttempt: job.NextAttempt,
+		Updated:     job.Updated,
+		LastError:   job.LastError,
+	}
+	if job.ActivityIRI != nil {
+		fj.ActivityIRI = job.ActivityIRI.String()
+	}
+	if job.InboxIRI != nil {
+		fj.InboxIRI = job.InboxIRI.String()
+	}
+	if job.VerifiedActor != nil {
+		fj.VerifiedActor = job.VerifiedActor.String()
+	}
+	return fj
+}
+
+// toJob converts the serialized form back into a job.
+func (fj fileInboxJob) toJob() (job InboxJob, err error) {
+	if strings.TrimSpace(fj.ID) == "" {
+		err = fmt.Errorf("inbox job has no id")
+		return
+	}
+	job = InboxJob{
+		ID:          fj.ID,
+		Payload:     fj.Payload,
+		Status:      InboxJobStatus(fj.Status),
+		Posted:      fj.Posted,
+		SharedCopy:  fj.SharedCopy,
+		Attempts:    fj.Attempts,
+		Created:     fj.Created,
+		NextAttempt: fj.NextAttempt,
+		Updated:     fj.Updated,
+		LastError:   fj.LastError,
+	}
+	if len(fj.ActivityIRI) > 0 {
+		if job.ActivityIRI, err = url.Parse(fj.ActivityIRI); err != nil {
+			return
+		}
+	}
+	if len(fj.VerifiedActor) > 0 {
+		if job.VerifiedActor, err = url.Parse(fj.VerifiedActor); err != nil {
+			return
+		}
+	}
+	job.InboxIRI, err = url.Parse(fj.InboxIRI)
+	return
+}
@@ -0,0 +1,154 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// FollowResponse is the outcome of verifying one of the Follows in the
+// 'object' of an Accept or Reject received from a peer.
+type FollowResponse struct {
+	// Follow is the id of the Follow being accepted or rejected.
+	Follow *url.URL
+	// Verified is true if the Follow was sent by this server, with the
+	// receiving actor as its 'actor' and all of the actors of the Accept or
+	// Reject as its 'object'.
+	Verified bool
+	// Err explains why the Follow could not be verified.
+	Err error
+}
+
+// followResponsesContextKey is the context key of the FollowResponses.
+type followResponsesContextKey struct{}
+
+// FollowResponses returns the outcome of verifying each Follow accepted or
+// rejected by a peer, if the context is the one passed to the Accept or Reject
+// callback of the FederatingWrappedCallbacks.
+func FollowResponses(c context.Context) (responses []FollowResponse, ok bool) {
+	responses, ok = c.Value(followResponsesContextKey{}).([]FollowResponse)
+	return
+}
+
+// verifyFollowResponses verifies each Follow in the 'object' of an Accept or
+// Reject against the database, returning the receiving actor and the outcome of
+// each Follow along with the context to pass to the application callback.
+//
+// Follows are looked up by their id in the database, so that a peer cannot
+// accept or reject a Follow that this server never sent. An 'object' that is
+// not a Follow is ignored.
+func (w FederatingWrappedCallbacks) verifyFollowResponses(c context.Context, a Activity) (out context.Context, actorIRI *url.URL, responses []FollowResponse, err error) {
+	out = c
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return
+	}
+	// Get this actor's id.
+	if err = w.db.Lock(c, w.inboxIRI); err != nil {
+		return
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err = w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	peers, err := getActorIds(a)
+	if err != nil {
+		return
+	}
+	responses = make([]FollowResponse, 0, op.Len())
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		t := iter.GetType()
+		if t != nil && !streams.IsOrExtendsActivityStreamsFollow(t) {
+			continue
+		}
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		var isFollow bool
+		var r FollowResponse
+		r, isFollow, err = w.verifyFollowResponse(c, id, t != nil, actorIRI, peers)
+		if err != nil {
+			return
+		} else if isFollow {
+			responses = append(responses, r)
+		}
+	}
+	out = context.WithValue(c, followResponsesContextKey{}, responses)
+	return
+}
+
+// verifyFollowResponse verifies the Follow with the given id was sent by this
+// server from the actor to the peers. An IRI that does not refer to a Follow
+// of this server is not considered a Follow, unless the peer embedded it as
+// one.
+func (w FederatingWrappedCallbacks) verifyFollowResponse(c context.Context, id *url.URL, embedded bool, actorIRI *url.URL, peers []*url.URL) (r FollowResponse, isFollow bool, err error) {
+	r.Follow = id
+	isFollow = embedded
+	if err = w.db.Lock(c, id); err != nil {
+		return
+	}
+	defer w.db.Unlock(c, id)
+	owns, err := w.db.Owns(c, id)
+	if err != nil {
+		return
+	} else if !owns {
+		r.Err = fmt.Errorf("follow %s was not sent by this server", id)
+		return
+	}
+	t, err := w.db.Get(c, id)
+	if err != nil {
+		return
+	}
+	if !streams.IsOrExtendsActivityStreamsFollow(t) {
+		r.Err = fmt.Errorf("peer gave an Accept or Reject wrapping a Follow but provided a non-Follow id %s", id)
+		return
+	}
+	isFollow = true
+	follow, ok := t.(Activity)
+	if !ok {
+		err = fmt.Errorf("a Follow in an Accept or Reject does not satisfy the Activity interface")
+		return
+	}
+	followActors, err := getActorIds(follow)
+	if err != nil {
+		return
+	}
+	if !containsIRI(followActors, actorIRI) {
+		r.Err = fmt.Errorf("follow %s was not sent by actor %s", id, actorIRI)
+		return
+	}
+	followObjects, err := getObjectIds(follow)
+	if err != nil {
+		return
+	}
+	if len(peers) == 0 {
+		r.Err = fmt.Errorf("follow %s was responded to without an actor", id)
+		return
+	}
+	for _, peer := range peers {
+		if !containsIRI(followObjects, peer) {
+			r.Err = fmt.Errorf("follow %s was not sent to %s", id, peer)
+			return
+		}
+	}
+	r.Verified = true
+	return
+}
+
+// verifiedFollowResponse returns true if any of the Follows were verified.
+func verifiedFollowResponse(responses []FollowResponse) bool {
+	for _, r := range responses {
+		if r.Verified {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 )
 
 var ErrNotFound = errors.New("go-fed/activity: ActivityStreams data not found")
@@ -26,9 +28,67 @@ var ErrNotFound = errors.New("go-fed/activity: ActivityStreams data not found")
 // If 'isASRequest' is true and there is no error, then the HandlerFunc
 // successfully served the request and wrote to the ResponseWriter.
 //
+// If an HTMLRenderer is configured with WithHTMLRenderer, then GET requests
+// that are not ActivityStreams requests are served by it as well, and
+// 'isASRequest' is true when it wrote to the ResponseWriter.
+//
 // Callers are responsible for authorized access to this resource.
 type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error)
 
+// HandlerOption configures optional behaviors of the HandlerFunc created by
+// NewActivityStreamsHandler and NewActivityStreamsHandlerScheme.
+type HandlerOption func(o *handlerOptions)
+
+// handlerOptions is the set of optional behaviors configured by
+// HandlerOptions.
+type handlerOptions struct {
+	// federationPolicy, if non-nil, determines the servers whose signed
+	// requests are refused.
+	federationPolicy FederationPolicy
+	// htmlRenderer, if non-nil, serves the GET requests that do not
+	// accept ActivityStreams media types.
+	htmlRenderer HTMLRenderer
+	// authorizedFetch, if non-nil, restricts the values served to the
+	// actors they are addressed to.
+	authorizedFetch *authorizedFetch
+}
+
+// HTMLRenderer writes a representation of an ActivityStreams value for
+// clients that do not accept ActivityStreams media types, such as browsers.
+//
+// The value has been stripped of its sensitive fields ('bto' and 'bcc'). The
+// HTMLRenderer is responsible for the entire response, including its status
+// code for Tombstones.
+type HTMLRenderer func(c context.Context, w http.ResponseWriter, r *http.Request, t vocab.Type) error
+
+// WithHandlerFederationPolicy refuses the signed GET requests of the servers
+// suspended by the FederationPolicy with a 403 Forbidden.
+//
+// The signing server is the actor in the context, if the request was
+// authenticated by an HttpSigVerifier. Otherwise, it is the host of the keyId
+// of the request's HTTP Signature. Requests that are not signed are not
+// refused.
+func WithHandlerFederationPolicy(p FederationPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.federationPolicy = p
+	}
+}
+
+// WithHTMLRenderer passes the ActivityStreams value requested by a GET request
+// that does not accept an ActivityStreams media type to the HTMLRenderer,
+// instead of leaving the request to the caller.
+//
+// The response is served with a 'Vary: Accept' header so that caches keep the
+// HTML and ActivityStreams representations apart.
+//
+// If there is no value to render, the request is left to the caller, with
+// isASRequest false and no error, so that it may serve its own page.
+func WithHTMLRenderer(r HTMLRenderer) HandlerOption {
+	return func(o *handlerOptions) {
+		o.htmlRenderer = r
+	}
+}
+
 // NewActivityStreamsHandler creates a HandlerFunc to serve ActivityStreams
 // requests which are coming from other clients or servers that wish to obtain
 // an ActivityStreams representation of data.
@@ -38,8 +98,10 @@ type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request)
 // Tombstone Activities as well.
 //
 // Defaults to supporting content to be retrieved by HTTPS only.
-func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
-	return NewActivityStreamsHandlerScheme(db, clock, "https")
+//
+// Optional behaviors may be enabled by passing HandlerOptions.
+func NewActivityStreamsHandler(db Database, clock Clock, opts ...HandlerOption) HandlerFunc {
+	return NewActivityStreamsHandlerScheme(db, clock, "https", opts...)
 }
 
 // NewActivityStreamsHandlerScheme creates a HandlerFunc to serve
@@ -54,15 +116,44 @@ func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
 // Specifying the "scheme" allows for retrieving ActivityStreams content with
 // identifiers such as HTTP, HTTPS, or other protocol schemes.
 //
+// Responds with the ActivityStreams media type that the request accepts,
+// either 'application/activity+json' or 'application/ld+json' with the
+// ActivityStreams profile. Supports conditional requests with the ETag and
+// Last-Modified headers, the latter being the 'updated' or 'published' time
+// of the value, by responding with 304 Not Modified. Tombstones are always
+// served with 410 Gone, as preconditions only apply to successful responses.
+//
 // Returns ErrNotFound when the database does not retrieve any data and no
 // errors occurred during retrieval.
-func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string) HandlerFunc {
+//
+// Optional behaviors may be enabled by passing HandlerOptions.
+func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string, opts ...HandlerOption) HandlerFunc {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
-		// Do nothing if it is not an ActivityPub GET request
+		// Do nothing if it is not an ActivityPub GET request, unless
+		// it is to be rendered as HTML.
+		isHTMLRequest := false
 		if !isActivityPubGet(r) {
-			return
+			if o.htmlRenderer == nil || r.Method != "GET" {
+				return
+			}
+			isHTMLRequest = true
 		}
 		isASRequest = true
+		// Refuse the requests signed by suspended servers.
+		if signer := signedRequester(c, r); signer != nil {
+			var policy HostPolicy
+			policy, err = newHostPolicies(o.federationPolicy).of(c, signer)
+			if err != nil {
+				return
+			} else if policy.Suspend {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
 		id := requestId(r, scheme)
 		// Lock and obtain a copy of the requested ActivityStreams value
 		err = db.Lock(c, id)
@@ -78,12 +169,51 @@ func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string) Ha
 		db.Unlock(c, id)
 		// Unlock must have been called by this point and in every
 		// branch above
+		// Require a valid HTTP Signature in authorized fetch mode, except
+		// for the actors and keys that peers need to verify signatures.
+		var requester *url.URL
+		checkVisibility := o.authorizedFetch != nil && !isServedUnsigned(t)
+		if checkVisibility && !isHTMLRequest {
+			c, requester, err = o.authorizedFetch.requester(c, r)
+			if IsHttpSigError(err) {
+				err = nil
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				return
+			}
+		}
 		if t == nil {
-			err = ErrNotFound
+			if isHTMLRequest {
+				isASRequest = false
+			} else {
+				err = ErrNotFound
+			}
 			return
 		}
+		// Hide the values not addressed to the requester in authorized
+		// fetch mode.
+		if checkVisibility {
+			var visible bool
+			visible, err = o.authorizedFetch.isVisible(c, db, t, requester)
+			if err != nil {
+				return
+			} else if !visible && isHTMLRequest {
+				isASRequest = false
+				return
+			} else if !visible {
+				err = ErrNotFound
+				return
+			}
+		}
 		// Remove sensitive fields.
 		clearSensitiveFields(t)
+		// Let browsers obtain a webpage instead.
+		if isHTMLRequest {
+			w.Header().Add(varyHeader, acceptHeader)
+			err = o.htmlRenderer(c, w, r, t)
+			return
+		}
 		// Serialize the fetched value.
 		m, err := streams.Serialize(t)
 		if err != nil {
@@ -94,10 +224,28 @@ func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string) Ha
 			return
 		}
 		// Construct the response.
-		addResponseHeaders(w.Header(), clock, raw)
-		// Write the response.
+		h := w.Header()
+		addResponseHeaders(h, clock, raw)
+		h.Set(contentTypeHeader, negotiateMediaType(r.Header.Get(acceptHeader)))
+		h.Add(varyHeader, acceptHeader)
+		if o.authorizedFetch != nil {
+			h.Set(cacheControlHeader, "private")
+		}
+		eTag := entityTag(raw)
+		h.Set(eTagHeader, eTag)
+		lastModified, hasLastModified := lastModifiedTime(t)
+		if hasLastModified {
+			h.Set(lastModifiedHeader, lastModified.UTC().Format(http.TimeFormat))
+		}
+		// Write the response. The preconditions of a conditional request
+		// are ignored for Tombstones, as RFC 7232 only applies them to
+		// responses that would otherwise be successful.
 		if streams.IsOrExtendsActivityStreamsTombstone(t) {
 			w.WriteHeader(http.StatusGone)
+		} else if isNotModified(r, eTag, lastModified, hasLastModified) {
+			h.Del(digestHeader)
+			w.WriteHeader(http.StatusNotModified)
+			return
 		} else {
 			w.WriteHeader(http.StatusOK)
 		}
@@ -7,7 +7,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
 )
 
@@ -21,6 +24,19 @@ func TestActivityStreamsHandler(t *testing.T) {
 		hf = NewActivityStreamsHandler(db, clock)
 		return
 	}
+	newUpdatedNoteFn := func(updated time.Time) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		note.SetJSONLDId(id)
+		published := streams.NewActivityStreamsPublishedProperty()
+		published.Set(updated.Add(-time.Hour))
+		note.SetActivityStreamsPublished(published)
+		upd := streams.NewActivityStreamsUpdatedProperty()
+		upd.Set(updated)
+		note.SetActivityStreamsUpdated(upd)
+		return note
+	}
 	t.Run("IgnoresIfNotActivityPubGetRequest", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -70,7 +86,7 @@ func TestActivityStreamsHandler(t *testing.T) {
 		assertEqual(t, err, nil)
 		assertEqual(t, resp.Code, http.StatusGone)
 		respV := resp.Result()
-		assertEqual(t, respV.Header.Get(contentTypeHeader), "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"")
+		assertEqual(t, respV.Header.Get(contentTypeHeader), "application/activity+json")
 		assertEqual(t, respV.Header.Get(dateHeader), nowDateHeader())
 		assertNotEqual(t, len(respV.Header.Get(digestHeader)), 0)
 		b, err := ioutil.ReadAll(respV.Body)
@@ -95,11 +111,239 @@ func TestActivityStreamsHandler(t *testing.T) {
 		assertEqual(t, err, nil)
 		assertEqual(t, resp.Code, http.StatusOK)
 		respV := resp.Result()
-		assertEqual(t, respV.Header.Get(contentTypeHeader), "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"")
+		assertEqual(t, respV.Header.Get(contentTypeHeader), "application/activity+json")
 		assertEqual(t, respV.Header.Get(dateHeader), nowDateHeader())
 		assertNotEqual(t, len(respV.Header.Get(digestHeader)), 0)
 		b, err := ioutil.ReadAll(respV.Body)
 		assertEqual(t, err, nil)
 		assertByteEqual(t, b, mustSerializeToBytes(testMyNote))
+		assertEqual(t, respV.Header.Get(varyHeader), acceptHeader)
+		assertEqual(t, respV.Header.Get(eTagHeader), entityTag(mustSerializeToBytes(testMyNote)))
+	})
+	t.Run("EchoesAcceptedMediaType", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\", application/activity+json; q=0.9")
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Result().Header.Get(contentTypeHeader), "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"")
+	})
+	t.Run("RespondsNotModifiedWhenETagMatches", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set(ifNoneMatchHeader, "\"other\", W/"+entityTag(mustSerializeToBytes(testMyNote)))
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusNotModified)
+		respV := resp.Result()
+		assertEqual(t, respV.Header.Get(eTagHeader), entityTag(mustSerializeToBytes(testMyNote)))
+		assertEqual(t, respV.Header.Get(varyHeader), acceptHeader)
+		assertEqual(t, respV.Header.Get(digestHeader), "")
+		b, err := ioutil.ReadAll(respV.Body)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(b), 0)
+	})
+	t.Run("ServesContentWhenETagDoesNotMatch", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set(ifNoneMatchHeader, "\"other\"")
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("RespondsNotModifiedWhenNotModifiedSince", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set(ifModifiedSinceHeader, now().UTC().Format(http.TimeFormat))
+		note := newUpdatedNoteFn(now().Add(-time.Hour))
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusNotModified)
+		assertEqual(t, resp.Result().Header.Get(lastModifiedHeader), now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	})
+	t.Run("ServesContentWhenModifiedSince", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set(ifModifiedSinceHeader, now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		note := newUpdatedNoteFn(now())
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		respV := resp.Result()
+		assertEqual(t, respV.Header.Get(lastModifiedHeader), now().UTC().Format(http.TimeFormat))
+		b, err := ioutil.ReadAll(respV.Body)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, b, mustSerializeToBytes(note))
+	})
+	t.Run("ServesTombstoneDespiteMatchingETag", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set(ifNoneMatchHeader, "*")
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testTombstone, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusGone)
+	})
+	t.Run("RendersHTMLForOtherGetRequests", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb := NewMockDatabase(ctl)
+		mockClock := NewMockClock(ctl)
+		hf := NewActivityStreamsHandler(mockDb, mockClock, WithHTMLRenderer(func(c context.Context, w http.ResponseWriter, r *http.Request, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testMyNote))
+			w.Header().Set(contentTypeHeader, "text/html")
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write([]byte("<p>My Note</p>"))
+			return err
+		}))
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "text/html")
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		respV := resp.Result()
+		assertEqual(t, respV.Header.Get(contentTypeHeader), "text/html")
+		assertEqual(t, respV.Header.Get(varyHeader), acceptHeader)
+		b, err := ioutil.ReadAll(respV.Body)
+		assertEqual(t, err, nil)
+		assertEqual(t, string(b), "<p>My Note</p>")
+	})
+	t.Run("LeavesMissingHTMLValueToCaller", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb := NewMockDatabase(ctl)
+		mockClock := NewMockClock(ctl)
+		hf := NewActivityStreamsHandler(mockDb, mockClock, WithHTMLRenderer(func(c context.Context, w http.ResponseWriter, r *http.Request, v vocab.Type) error {
+			t.Errorf("expected no value to render")
+			return nil
+		}))
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "text/html")
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, false)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(resp.Result().Header), 0)
+	})
+	t.Run("RefusesSignedRequestOfSuspendedServer", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		hf := NewActivityStreamsHandler(db, clock, WithHandlerFederationPolicy(DomainPolicy{
+			Suspended: []string{"other.example.com"},
+		}))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set("Signature", `keyId="https://other.example.com/dakota#main-key",headers="(request-target) date",signature="c2ln"`)
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("ServesSignedRequestOfOtherServers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb := NewMockDatabase(ctl)
+		mockClock := NewMockClock(ctl)
+		hf := NewActivityStreamsHandler(mockDb, mockClock, WithHandlerFederationPolicy(DomainPolicy{
+			Suspended: []string{"other.example.com"},
+		}))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		req.Header.Set("Signature", `keyId="https://maybe.example.com/person#main-key",headers="(request-target) date",signature="c2ln"`)
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		isAPReq, err := hf(ctx, resp, req)
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
 	})
 }
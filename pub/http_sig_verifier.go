@@ -0,0 +1,628 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+)
+
+const (
+	// defaultMaxDateSkew is the default maximum difference between the
+	// Date of a signed request and the Clock.
+	defaultMaxDateSkew = 5 * time.Minute
+	// requestTargetHeader is the HTTP Signature pseudo-header for the
+	// request method and path.
+	requestTargetHeader = "(request-target)"
+)
+
+// HttpSigError indicates that a request does not have a valid HTTP Signature.
+//
+// It is distinct from errors that prevent verification from taking place, such
+// as a failing Database, so applications are able to respond with a 401
+// Unauthorized instead of an internal error.
+type HttpSigError struct {
+	// Reason describes why the HTTP Signature is not valid.
+	Reason string
+}
+
+// Error returns a description of the invalid HTTP Signature.
+func (e *HttpSigError) Error() string {
+	return "invalid HTTP Signature: " + e.Reason
+}
+
+// newHttpSigError creates an HttpSigError with a formatted reason.
+func newHttpSigError(format string, args ...interface{}) *HttpSigError {
+	return &HttpSigError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsHttpSigError returns true if the error is due to a request without a valid
+// HTTP Signature.
+func IsHttpSigError(err error) bool {
+	_, ok := err.(*HttpSigError)
+	return ok
+}
+
+// httpSigActorContextKey is the context key of the verified actor IRI.
+type httpSigActorContextKey struct{}
+
+// VerifiedActor returns the IRI of the actor whose HTTP Signature was verified
+// by an HttpSigVerifier, if the context was returned by one.
+func VerifiedActor(c context.Context) (actorIRI *url.URL, ok bool) {
+	actorIRI, ok = c.Value(httpSigActorContextKey{}).(*url.URL)
+	return
+}
+
+// HttpSigVerifierOption configures optional behaviors of an HttpSigVerifier.
+type HttpSigVerifierOption func(v *HttpSigVerifier)
+
+// WithMaxDateSkew sets the maximum difference between the Date header of a
+// request and the Clock for its HTTP Signature to be accepted. The default is
+// five minutes.
+func WithMaxDateSkew(d time.Duration) HttpSigVerifierOption {
+	return func(v *HttpSigVerifier) {
+		v.maxDateSkew = d
+	}
+}
+
+// WithPublicKeyCache caches the PublicKeys resolved by the HttpSigVerifier.
+//
+// When a signature does not verify with a cached key, the key is fetched once
+// more in case the peer rotated it. A key whose document is Gone is evicted.
+func WithPublicKeyCache(cache PublicKeyCache) HttpSigVerifierOption {
+	return func(v *HttpSigVerifier) {
+		v.keyCache = cache
+	}
+}
+
+// WithPostPayloadLimits bounds the bodies of the POST requests read by
+// VerifyPost. Without this option, DefaultPayloadLimits apply.
+func WithPostPayloadLimits(l PayloadLimits) HttpSigVerifierOption {
+	return func(v *HttpSigVerifier) {
+		v.limits = l
+	}
+}
+
+// HttpSigVerifier verifies the HTTP Signatures of requests made by peers, as
+// created by the HttpSigTransport.
+//
+// It is meant to be used to implement AuthenticatePostInbox of the
+// FederatingProtocol, as well as the authentication of GET requests. A request
+// is verified when:
+//
+// - It is signed with a Signature or Authorization header whose signed headers
+// include at least '(request-target)' and 'Date', and 'Digest' when it has a
+// body.
+//
+// - Its Date is within the maximum skew of the Clock.
+//
+// - Its Digest matches the body.
+//
+// - The keyId resolves to a PublicKey found in the document whose id is the
+// keyId without its fragment, and whose 'owner' shares the key's origin.
+//
+// - The signature is verified by that PublicKey.
+//
+// - For POST requests, the key's owner is the 'actor' of the Activity.
+//
+// The keyId is resolved by first looking in the PublicKeyCache, if one is
+// configured, then in the Database, then by dereferencing it with a Transport.
+type HttpSigVerifier struct {
+	db          Database
+	common      CommonBehavior
+	clock       Clock
+	fetchBoxIRI *url.URL
+	maxDateSkew time.Duration
+	keyCache    PublicKeyCache
+	limits      PayloadLimits
+}
+
+// NewHttpSigVerifier returns a verifier that resolves unknown public keys with
+// Transports created by the CommonBehavior on behalf of the actor with the
+// given inbox or outbox IRI, such as a server-wide actor.
+func NewHttpSigVerifier(db Database, common CommonBehavior, clock Clock, fetchBoxIRI *url.URL, opts ...HttpSigVerifierOption) *HttpSigVerifier {
+	v := &HttpSigVerifier{
+		db:          db,
+		common:      common,
+		clock:       clock,
+		fetchBoxIRI: fetchBoxIRI,
+		maxDateSkew: defaultMaxDateSkew,
+		limits:      DefaultPayloadLimits(),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// AuthenticatePostInbox verifies a POST to an inbox, and has the semantics of
+// FederatingProtocol's AuthenticatePostInbox so that it may be called from it.
+//
+// If the HTTP Signature is not valid, a 401 Unauthorized is written and
+// authenticated is false. If the body exceeds the PayloadLimits, a 413 or 400
+// is written and a PayloadLimitError is returned.
+func (v *HttpSigVerifier) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	out, _, err = v.VerifyPost(c, r)
+	return v.toAuthenticated(out, w, err)
+}
+
+// AuthenticateGet verifies a GET request, and has the semantics of the
+// CommonBehavior's AuthenticateGetInbox and AuthenticateGetOutbox so that it
+// may be called from them.
+//
+// If the HTTP Signature is not valid, a 401 Unauthorized is written and
+// authenticated is false.
+func (v *HttpSigVerifier) AuthenticateGet(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	out, _, err = v.VerifyGet(c, r)
+	return v.toAuthenticated(out, w, err)
+}
+
+// toAuthenticated converts the outcome of a verification into the semantics of
+// the Authenticate methods.
+func (v *HttpSigVerifier) toAuthenticated(c context.Context, w http.ResponseWriter, err error) (out context.Context, authenticated bool, outErr error) {
+	out = c
+	if IsHttpSigError(err) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if writePayloadLimitError(w, err) {
+		outErr = err
+		return
+	} else if err != nil {
+		outErr = err
+		return
+	}
+	authenticated = true
+	return
+}
+
+// VerifyPost verifies the HTTP Signature and Digest of a POST request, and
+// that the signer is the actor of the Activity in the body.
+//
+// The body is read and then restored, so that it may be read again, such as
+// by PostInbox.
+//
+// The returned context contains the verified actor IRI, obtainable with
+// VerifiedActor. An HttpSigError is returned if the request is not properly
+// signed, and a PayloadLimitError if its body exceeds the PayloadLimits.
+func (v *HttpSigVerifier) VerifyPost(c context.Context, r *http.Request) (out context.Context, actorIRI *url.URL, err error) {
+	out = c
+	var raw []byte
+	if r.Body != nil {
+		raw, err = v.limits.read(r.Body)
+		if err != nil {
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	}
+	if err = verifyDigest(r.Header, raw); err != nil {
+		return
+	}
+	owner, err := v.verify(c, r, true)
+	if err != nil {
+		return
+	}
+	// The signer must be the actor of the Activity.
+	var m map[string]interface{}
+	if err = json.Unmarshal(raw, &m); err != nil {
+		err = newHttpSigError("cannot parse the body to determine its actor: %s", err)
+		return
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		err = newHttpSigError("cannot parse the body to determine its actor: %s", err)
+		return
+	}
+	ac, ok := t.(actorer)
+	if !ok || ac.GetActivityStreamsActor() == nil || ac.GetActivityStreamsActor().Len() == 0 {
+		err = newHttpSigError("the body has no actor")
+		return
+	}
+	actors := ac.GetActivityStreamsActor()
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			err = newHttpSigError("cannot determine the actor of the body: %s", err)
+			return
+		}
+		if id.String() != owner.String() {
+			err = newHttpSigError("actor %s is not the key owner %s", id, owner)
+			return
+		}
+	}
+	actorIRI = owner
+	out = context.WithValue(c, httpSigActorContextKey{}, actorIRI)
+	return
+}
+
+// VerifyGet verifies the HTTP Signature of a GET request.
+//
+// The returned context contains the verified actor IRI, obtainable with
+// VerifiedActor. An HttpSigError is returned if the request is not properly
+// signed.
+func (v *HttpSigVerifier) VerifyGet(c context.Context, r *http.Request) (out context.Context, actorIRI *url.URL, err error) {
+	out = c
+	actorIRI, err = v.verify(c, r, false)
+	if err != nil {
+		return
+	}
+	out = context.WithValue(c, httpSigActorContextKey{}, actorIRI)
+	return
+}
+
+// verify checks the signature of the request, returning the owner of the
+// signing key.
+func (v *HttpSigVerifier) verify(c context.Context, r *http.Request, hasBody bool) (owner *url.URL, err error) {
+	params := httpSigParams(r.Header)
+	if params == nil {
+		err = newHttpSigError("the request is not signed")
+		return
+	}
+	// Without the 'headers' parameter, only the Date is signed.
+	signed := []string{"date"}
+	if h, ok := params["headers"]; ok {
+		signed = strings.Fields(strings.ToLower(h))
+	}
+	required := []string{requestTargetHeader, "date"}
+	if hasBody {
+		required = append(required, "digest")
+	}
+	for _, req := range required {
+		if !containsString(signed, req) {
+			err = newHttpSigError("the %s header is not signed", req)
+			return
+		}
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		err = newHttpSigError("cannot parse the Date: %s", err)
+		return
+	}
+	skew := v.clock.Now().Sub(date)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.maxDateSkew {
+		err = newHttpSigError("the Date %s is too far from now", r.Header.Get("Date"))
+		return
+	}
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		err = newHttpSigError("%s", err)
+		return
+	}
+	keyId, err := url.Parse(verifier.KeyId())
+	if err != nil {
+		err = newHttpSigError("cannot parse the keyId: %s", err)
+		return
+	}
+	key, cached, err := v.resolveKey(c, keyId)
+	if err != nil {
+		return
+	}
+	owner, err = verifyWithKey(verifier, key, params["algorithm"])
+	if err != nil && cached {
+		// The peer may have rotated its key since it was cached, so
+		// fetch it once more.
+		key, err = v.refetchKey(c, keyId)
+		if err != nil {
+			return
+		}
+		owner, err = verifyWithKey(verifier, key, params["algorithm"])
+	}
+	return
+}
+
+// verifyWithKey verifies the signature with the PublicKey, returning the owner
+// of the key.
+func verifyWithKey(verifier httpsig.Verifier, key vocab.W3IDSecurityV1PublicKey, algorithm string) (owner *url.URL, err error) {
+	o, pubKey, err := parsePublicKey(key)
+	if err != nil {
+		return
+	}
+	for _, algo := range httpSigAlgorithms(algorithm) {
+		if err = verifier.Verify(pubKey, algo); err == nil {
+			owner = o
+			return
+		}
+	}
+	err = newHttpSigError("the signature does not verify with key %s: %s", verifier.KeyId(), err)
+	return
+}
+
+// resolveKey obtains the PublicKey with the given id, from the PublicKeyCache
+// if configured, from the Database if present, or else by dereferencing it.
+//
+// Returns whether the key was obtained from the PublicKeyCache.
+func (v *HttpSigVerifier) resolveKey(c context.Context, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, cached bool, err error) {
+	if v.keyCache != nil {
+		key, cached, err = v.keyCache.Get(c, keyId)
+		if err != nil || cached {
+			return
+		}
+	}
+	key, err = v.fetchKey(c, keyId, true)
+	if err != nil {
+		return
+	}
+	if v.keyCache != nil {
+		err = v.keyCache.Set(c, key)
+	}
+	return
+}
+
+// refetchKey dereferences the PublicKey with the given id, bypassing the
+// PublicKeyCache and Database, and caches it.
+func (v *HttpSigVerifier) refetchKey(c context.Context, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, err error) {
+	key, err = v.fetchKey(c, keyId, false)
+	if err != nil {
+		return
+	}
+	err = v.keyCache.Set(c, key)
+	return
+}
+
+// fetchKey obtains the PublicKey with the given id, optionally looking in the
+// Database before dereferencing it.
+//
+// The key is found either as the document itself, or within the 'publicKey'
+// property of the document, such as an actor.
+func (v *HttpSigVerifier) fetchKey(c context.Context, keyId *url.URL, useDb bool) (key vocab.W3IDSecurityV1PublicKey, err error) {
+	docIRI := withoutFragment(keyId)
+	var t vocab.Type
+	if useDb {
+		t, err = v.fetch(c, docIRI)
+	} else {
+		t, err = v.dereference(c, docIRI)
+	}
+	if err != nil {
+		return
+	}
+	key, err = publicKeyInDocument(t, keyId)
+	return
+}
+
+// fetch obtains the value with the given id, from the Database if present, or
+// else by dereferencing it.
+func (v *HttpSigVerifier) fetch(c context.Context, iri *url.URL) (t vocab.Type, err error) {
+	err = v.db.Lock(c, iri)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock is not deferred
+	exists, err := v.db.Exists(c, iri)
+	if err != nil {
+		v.db.Unlock(c, iri)
+		return
+	}
+	if exists {
+		t, err = v.db.Get(c, iri)
+		v.db.Unlock(c, iri)
+		return
+	}
+	v.db.Unlock(c, iri)
+	// Unlock must be called by now and every branch above.
+	return v.dereference(c, iri)
+}
+
+// dereference obtains the value with the given id from its peer.
+//
+// If the peer responds that it is Gone, the keys of the document are evicted
+// from the PublicKeyCache.
+func (v *HttpSigVerifier) dereference(c context.Context, iri *url.URL) (t vocab.Type, err error) {
+	tp, err := v.common.NewTransport(c, v.fetchBoxIRI, goFedUserAgent())
+	if err != nil {
+		return
+	}
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		if isGone(err) && v.keyCache != nil {
+			if evictErr := v.keyCache.Evict(c, iri); evictErr != nil {
+				err = evictErr
+				return
+			}
+		}
+		err = newHttpSigError("cannot dereference %s: %s", iri, err)
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		err = newHttpSigError("cannot parse %s: %s", iri, err)
+		return
+	}
+	t, err = streams.ToType(c, m)
+	if err != nil {
+		err = newHttpSigError("cannot parse %s: %s", iri, err)
+		return
+	}
+	return
+}
+
+// publicKeyInDocument finds the PublicKey with the given id in a document.
+//
+// The document must be the one identified by the key id without its fragment,
+// and the owner of the key must share the origin of the key, so that a server
+// cannot claim a key on behalf of an actor on another server.
+func publicKeyInDocument(t vocab.Type, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, err error) {
+	docId, err := GetId(t)
+	if err != nil {
+		err = newHttpSigError("document of key %s has no id", keyId)
+		return
+	}
+	docIRI := withoutFragment(keyId)
+	if withoutFragment(docId).String() != docIRI.String() {
+		err = newHttpSigError("document %s of key %s has the id %s", docIRI, keyId, docId)
+		return
+	}
+	if k, ok := t.(vocab.W3IDSecurityV1PublicKey); ok {
+		key = k
+	} else if pk, ok := t.(publicKeyer); ok && pk.GetW3IDSecurityV1PublicKey() != nil {
+		keys := pk.GetW3IDSecurityV1PublicKey()
+		for iter := keys.Begin(); iter != keys.End(); iter = iter.Next() {
+			if !iter.IsW3IDSecurityV1PublicKey() {
+				continue
+			}
+			k := iter.Get()
+			if id, err := GetId(k); err == nil && id.String() == keyId.String() {
+				key = k
+				break
+			}
+		}
+	}
+	if key == nil {
+		err = newHttpSigError("cannot find key %s in %s", keyId, docId)
+		return
+	}
+	if id, idErr := GetId(key); idErr != nil || id.String() != keyId.String() {
+		err = newHttpSigError("key id does not match %s", keyId)
+		return
+	}
+	owner, _, err := parsePublicKey(key)
+	if err != nil {
+		return
+	}
+	if owner.Scheme != keyId.Scheme || owner.Host != keyId.Host {
+		err = newHttpSigError("owner %s does not share the origin of key %s", owner, keyId)
+		return
+	}
+	return
+}
+
+// withoutFragment returns a copy of the IRI without its fragment.
+func withoutFragment(iri *url.URL) *url.URL {
+	u := &url.URL{}
+	*u = *iri
+	u.Fragment = ""
+	return u
+}
+
+// parsePublicKey obtains the owner and the parsed PEM of the PublicKey.
+func parsePublicKey(key vocab.W3IDSecurityV1PublicKey) (owner *url.URL, pubKey crypto.PublicKey, err error) {
+	o := key.GetW3IDSecurityV1Owner()
+	if o == nil || !o.IsXMLSchemaAnyURI() {
+		err = newHttpSigError("key has no owner")
+		return
+	}
+	owner = o.Get()
+	p := key.GetW3IDSecurityV1PublicKeyPem()
+	if p == nil || !p.IsXMLSchemaString() {
+		err = newHttpSigError("key has no publicKeyPem")
+		return
+	}
+	block, _ := pem.Decode([]byte(p.Get()))
+	if block == nil {
+		err = newHttpSigError("key publicKeyPem is not PEM encoded")
+		return
+	}
+	pubKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		// Some servers use the PKCS#1 encoding of RSA keys.
+		pubKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			err = newHttpSigError("cannot parse key publicKeyPem: %s", err)
+			return
+		}
+	}
+	return
+}
+
+// httpSigParams parses the parameters of the HTTP Signature in either the
+// Signature or Authorization header. Returns nil if there is no signature.
+func httpSigParams(h http.Header) map[string]string {
+	s := h.Get("Signature")
+	if len(s) == 0 {
+		s = h.Get("Authorization")
+		if !strings.HasPrefix(s, "Signature ") {
+			return nil
+		}
+		s = strings.TrimPrefix(s, "Signature ")
+	}
+	params := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], "\"")
+	}
+	return params
+}
+
+// httpSigAlgorithms determines the algorithms to verify a signature with,
+// based on its 'algorithm' parameter.
+//
+// The parameter is deprecated, so absent or unknown values such as 'hs2019'
+// result in all supported algorithms being tried.
+func httpSigAlgorithms(param string) []httpsig.Algorithm {
+	switch a := httpsig.Algorithm(strings.ToLower(param)); a {
+	case httpsig.RSA_SHA256, httpsig.RSA_SHA512:
+		return []httpsig.Algorithm{a}
+	default:
+		return []httpsig.Algorithm{httpsig.RSA_SHA256, httpsig.RSA_SHA512}
+	}
+}
+
+// verifyDigest ensures the Digest header matches the body. At least one of
+// the SHA-256 or SHA-512 digests must be present.
+func verifyDigest(h http.Header, body []byte) error {
+	d := h.Get("Digest")
+	if len(d) == 0 {
+		return newHttpSigError("the request has no Digest")
+	}
+	verified := false
+	for _, elem := range strings.Split(d, ",") {
+		kv := strings.SplitN(strings.TrimSpace(elem), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var h hash.Hash
+		switch strings.ToUpper(kv[0]) {
+		case "SHA-256":
+			h = sha256.New()
+		case "SHA-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		// The version of httpsig used by the HttpSigTransport appends the
+		// digest of no data to the body instead of hashing the body. It
+		// still covers the entire body, so accept it from such peers.
+		legacy := base64.StdEncoding.EncodeToString(h.Sum(body))
+		h.Write(body)
+		sum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		if kv[1] != sum && kv[1] != legacy {
+			return newHttpSigError("the %s Digest does not match the body", kv[0])
+		}
+		verified = true
+	}
+	if !verified {
+		return newHttpSigError("the Digest has no supported algorithm")
+	}
+	return nil
+}
+
+// containsString returns true if the string is in the slice.
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,544 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testKeyId = testFederatedActorIRI2 + "#main-key"
+)
+
+var (
+	// testRSAKey signs requests in the verifier tests.
+	testRSAKey = mustGenerateRSAKey()
+	// testOtherRSAKey is a key other than the one published by the
+	// signer.
+	testOtherRSAKey = mustGenerateRSAKey()
+)
+
+// mustGenerateRSAKey generates a test RSA key or panics.
+func mustGenerateRSAKey() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// testPublicKey creates a PublicKey with the given id and owner, whose PEM is
+// the public half of the private key.
+func testPublicKey(keyId, owner string, k *rsa.PrivateKey) vocab.W3IDSecurityV1PublicKey {
+	b, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	key := streams.NewW3IDSecurityV1PublicKey()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(keyId))
+	key.SetJSONLDId(id)
+	o := streams.NewW3IDSecurityV1OwnerProperty()
+	o.Set(mustParse(owner))
+	key.SetW3IDSecurityV1Owner(o)
+	p := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	p.Set(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b})))
+	key.SetW3IDSecurityV1PublicKeyPem(p)
+	return key
+}
+
+// testSigningPerson creates the Person of testFederatedActorIRI2 with its
+// testKeyId PublicKey.
+func testSigningPerson(key vocab.W3IDSecurityV1PublicKey) vocab.ActivityStreamsPerson {
+	p := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActorIRI2))
+	p.SetJSONLDId(id)
+	pk := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pk.AppendW3IDSecurityV1PublicKey(key)
+	p.SetW3IDSecurityV1PublicKey(pk)
+	return p
+}
+
+// toSignedRequest signs the request with the private key, as testKeyId.
+func toSignedRequest(r *http.Request, body []byte, k *rsa.PrivateKey, date time.Time) *http.Request {
+	headers := []string{requestTargetHeader, "date"}
+	if body != nil {
+		headers = append(headers, "digest")
+	}
+	s, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, headers, httpsig.Signature)
+	if err != nil {
+		panic(err)
+	}
+	r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	if body != nil {
+		sum := sha256.Sum256(body)
+		r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	// The Digest is already set, so the body is not given to the signer.
+	if err = s.SignRequest(k, testKeyId, r, nil); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// toSignedPostInboxRequest creates a signed POST of testFollow to the inbox.
+func toSignedPostInboxRequest(k *rsa.PrivateKey, date time.Time) (*http.Request, []byte) {
+	b := mustSerializeToBytes(testFollow)
+	r := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewBuffer(b))
+	return toSignedRequest(r, b, k, date), b
+}
+
+func TestHttpSigVerifier(t *testing.T) {
+	ctx := context.Background()
+	setupData()
+	docIRI := mustParse(testFederatedActorIRI2)
+	setupFn := func(ctl *gomock.Controller) (v *HttpSigVerifier, db *MockDatabase, cb *MockCommonBehavior, tp *MockTransport, c *MockClock) {
+		db = NewMockDatabase(ctl)
+		cb = NewMockCommonBehavior(ctl)
+		tp = NewMockTransport(ctl)
+		c = NewMockClock(ctl)
+		v = NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI))
+		return
+	}
+	expectDereference := func(db *MockDatabase, cb *MockCommonBehavior, tp *MockTransport, b []byte) {
+		db.EXPECT().Lock(ctx, docIRI)
+		db.EXPECT().Exists(ctx, docIRI).Return(false, nil)
+		db.EXPECT().Unlock(ctx, docIRI)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, docIRI).Return(b, nil)
+	}
+	t.Run("VerifiesPostWithDereferencedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req, body := toSignedPostInboxRequest(testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		out, actor, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+		ctxActor, ok := VerifiedActor(out)
+		assertEqual(t, ok, true)
+		assertEqual(t, ctxActor.String(), testFederatedActorIRI2)
+		restored, err := ioutil.ReadAll(req.Body)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, restored, body)
+	})
+	t.Run("VerifiesPostWithDatabaseKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, _, _, c := setupFn(ctl)
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, docIRI)
+		db.EXPECT().Exists(ctx, docIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, docIRI).Return(person, nil)
+		db.EXPECT().Unlock(ctx, docIRI)
+		// Run & Verify
+		_, actor, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+	})
+	t.Run("VerifiesGet", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req := toSignedRequest(httptest.NewRequest("GET", testNoteId1, nil), nil, testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		out, actor, err := v.VerifyGet(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+		ctxActor, ok := VerifiedActor(out)
+		assertEqual(t, ok, true)
+		assertEqual(t, ctxActor.String(), testFederatedActorIRI2)
+	})
+	t.Run("VerifiesStandaloneKeyDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		const standaloneKeyId = testFederatedActorIRI2 + "/key"
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+		s, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{requestTargetHeader, "date"}, httpsig.Signature)
+		assertEqual(t, err, nil)
+		err = s.SignRequest(testRSAKey, standaloneKeyId, req, nil)
+		assertEqual(t, err, nil)
+		keyDoc := mustSerialize(testPublicKey(standaloneKeyId, testFederatedActorIRI2, testRSAKey))
+		keyDoc["type"] = "PublicKey"
+		keyDocBytes, err := json.Marshal(keyDoc)
+		assertEqual(t, err, nil)
+		keyDocIRI := mustParse(standaloneKeyId)
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, keyDocIRI)
+		db.EXPECT().Exists(ctx, keyDocIRI).Return(false, nil)
+		db.EXPECT().Unlock(ctx, keyDocIRI)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, keyDocIRI).Return(keyDocBytes, nil)
+		// Run & Verify
+		_, actor, err := v.VerifyGet(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+	})
+	t.Run("VerifiesWithCachedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		cb := NewMockCommonBehavior(ctl)
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithPublicKeyCache(cache))
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(3)
+		// Run & Verify
+		err := cache.Set(ctx, testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		assertEqual(t, err, nil)
+		_, actor, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+	})
+	t.Run("CachesResolvedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		cb := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithPublicKeyCache(cache))
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(3)
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+		_, found, err := cache.Get(ctx, mustParse(testKeyId))
+		assertEqual(t, err, nil)
+		assertEqual(t, found, true)
+	})
+	t.Run("RefetchesRotatedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		cb := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithPublicKeyCache(cache))
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		rotated := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(4)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, docIRI).Return(mustSerializeToBytes(testSigningPerson(rotated)), nil)
+		// Run & Verify
+		err := cache.Set(ctx, testPublicKey(testKeyId, testFederatedActorIRI2, testOtherRSAKey))
+		assertEqual(t, err, nil)
+		_, actor, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+	})
+	t.Run("EvictsGoneKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		cb := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithPublicKeyCache(cache))
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(3)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, docIRI).Return(nil, &HttpStatusError{
+			Method:     "GET",
+			IRI:        docIRI,
+			StatusCode: http.StatusGone,
+			Status:     "410 Gone",
+		})
+		// Run & Verify
+		err := cache.Set(ctx, testPublicKey(testKeyId, testFederatedActorIRI2, testOtherRSAKey))
+		assertEqual(t, err, nil)
+		_, _, err = v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+		_, found, err := cache.Get(ctx, mustParse(testKeyId))
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+	})
+	t.Run("RejectsUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, _, _, _, _ := setupFn(ctl)
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		// Run & Verify
+		_, actor, err := v.VerifyGet(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+		assertEqual(t, actor, (*url.URL)(nil))
+	})
+	t.Run("RejectsUnsignedDigest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, _, _, _, _ := setupFn(ctl)
+		b := mustSerializeToBytes(testFollow)
+		req := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewBuffer(b))
+		req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+		s, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{requestTargetHeader, "date"}, httpsig.Signature)
+		assertEqual(t, err, nil)
+		err = s.SignRequest(testRSAKey, testKeyId, req, b)
+		assertEqual(t, err, nil)
+		// Run & Verify
+		_, _, err = v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("AcceptsHttpSigTransportDigest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		b := mustSerializeToBytes(testFollow)
+		req := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewBuffer(b))
+		req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+		s, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{requestTargetHeader, "date", "digest"}, httpsig.Signature)
+		assertEqual(t, err, nil)
+		err = s.SignRequest(testRSAKey, testKeyId, req, b)
+		assertEqual(t, err, nil)
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err = v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+	})
+	t.Run("RejectsDigestMismatch", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, _, _, _, _ := setupFn(ctl)
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		req.Body = ioutil.NopCloser(bytes.NewBufferString("{}"))
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("RejectsDateSkew", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, _, _, _, c := setupFn(ctl)
+		req, _ := toSignedPostInboxRequest(testRSAKey, now().Add(-time.Hour))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("PermitsConfiguredDateSkew", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		cb := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		c := NewMockClock(ctl)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithMaxDateSkew(2*time.Hour))
+		req, _ := toSignedPostInboxRequest(testRSAKey, now().Add(-time.Hour))
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, err, nil)
+	})
+	t.Run("RejectsWrongKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req, _ := toSignedPostInboxRequest(testOtherRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("RejectsActorNotOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req, _ := toSignedPostInboxRequest(testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err := v.VerifyPost(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("RejectsOwnerOfOtherOrigin", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req := toSignedRequest(httptest.NewRequest("GET", testNoteId1, nil), nil, testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testPersonIRI, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		_, _, err := v.VerifyGet(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("RejectsDocumentClaimingIdOfOtherServer", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		const evilKeyId = "https://evil.example/k#key"
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+		s, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{requestTargetHeader, "date"}, httpsig.Signature)
+		assertEqual(t, err, nil)
+		err = s.SignRequest(testRSAKey, evilKeyId, req, nil)
+		assertEqual(t, err, nil)
+		// The evil server serves a document claiming to be the victim.
+		forged := testSigningPerson(testPublicKey(evilKeyId, testFederatedActorIRI2, testRSAKey))
+		evilDocIRI := mustParse("https://evil.example/k")
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, evilDocIRI)
+		db.EXPECT().Exists(ctx, evilDocIRI).Return(false, nil)
+		db.EXPECT().Unlock(ctx, evilDocIRI)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, evilDocIRI).Return(mustSerializeToBytes(forged), nil)
+		// Run & Verify
+		_, actor, err := v.VerifyGet(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+		assertEqual(t, actor == nil, true)
+	})
+	t.Run("RejectsUndereferenceableKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		req := toSignedRequest(httptest.NewRequest("GET", testNoteId1, nil), nil, testRSAKey, now())
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, docIRI)
+		db.EXPECT().Exists(ctx, docIRI).Return(false, nil)
+		db.EXPECT().Unlock(ctx, docIRI)
+		cb.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, docIRI).Return(nil, fmt.Errorf("test error"))
+		// Run & Verify
+		_, _, err := v.VerifyGet(ctx, req)
+		assertEqual(t, IsHttpSigError(err), true)
+	})
+	t.Run("ReturnsDatabaseError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, _, _, c := setupFn(ctl)
+		req := toSignedRequest(httptest.NewRequest("GET", testNoteId1, nil), nil, testRSAKey, now())
+		testErr := fmt.Errorf("test error")
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, docIRI)
+		db.EXPECT().Exists(ctx, docIRI).Return(false, testErr)
+		db.EXPECT().Unlock(ctx, docIRI)
+		// Run & Verify
+		_, _, err := v.VerifyGet(ctx, req)
+		assertEqual(t, err, testErr)
+	})
+	t.Run("AuthenticatePostInboxWritesUnauthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, _, _, _, _ := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toPostInboxRequest(testFollow)
+		// Run & Verify
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("AuthenticatePostInboxRejectsLargeBody", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, cb, _, c := setupFn(ctl)
+		v := NewHttpSigVerifier(db, cb, c, mustParse(testMyInboxIRI), WithPostPayloadLimits(PayloadLimits{MaxBytes: 8}))
+		resp := httptest.NewRecorder()
+		req := toPostInboxRequest(testFollow)
+		// Run & Verify
+		_, authenticated, err := v.AuthenticatePostInbox(ctx, resp, req)
+		assertEqual(t, IsPayloadLimitError(err), true)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusRequestEntityTooLarge)
+	})
+	t.Run("AuthenticateGetAuthenticates", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		v, db, cb, tp, c := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toSignedRequest(httptest.NewRequest("GET", testMyOutboxIRI, nil), nil, testRSAKey, now())
+		person := testSigningPerson(testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		// Mock
+		c.EXPECT().Now().Return(now())
+		expectDereference(db, cb, tp, mustSerializeToBytes(person))
+		// Run & Verify
+		out, authenticated, err := v.AuthenticateGet(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		actor, ok := VerifiedActor(out)
+		assertEqual(t, ok, true)
+		assertEqual(t, actor.String(), testFederatedActorIRI2)
+	})
+}
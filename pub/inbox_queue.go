@@ -0,0 +1,367 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// InboxJobStatus is the state of a single InboxJob.
+type InboxJobStatus int
+
+const (
+	// InboxJobPending indicates the job has not yet been processed, and
+	// will be attempted again.
+	InboxJobPending InboxJobStatus = iota
+	// InboxJobProcessed indicates the Activity was posted to the inbox and
+	// inbox forwarding was done.
+	InboxJobProcessed
+	// InboxJobAbandoned indicates the job failed permanently or the retry
+	// horizon has passed, so no more attempts will be made.
+	InboxJobAbandoned
+)
+
+// String returns a human-readable form of the status.
+func (i InboxJobStatus) String() string {
+	switch i {
+	case InboxJobPending:
+		return "pending"
+	case InboxJobProcessed:
+		return "processed"
+	case InboxJobAbandoned:
+		return "abandoned"
+	default:
+		return fmt.Sprintf("InboxJobStatus(%d)", int(i))
+	}
+}
+
+// InboxJob is the processing of one Activity received in one inbox.
+type InboxJob struct {
+	// ID uniquely identifies this job within an InboxQueue.
+	ID string
+	// ActivityIRI is the 'id' of the received Activity.
+	ActivityIRI *url.URL
+	// InboxIRI is the inbox the Activity is posted to.
+	InboxIRI *url.URL
+	// VerifiedActor is the actor whose HTTP Signature was verified when the
+	// Activity was received, if any. It is available with VerifiedActor
+	// while the job is processed.
+	VerifiedActor *url.URL
+	// Payload is the serialized Activity.
+	Payload []byte
+	// Status is the current state of the job.
+	Status InboxJobStatus
+	// Posted is true once the Activity has been posted to the inbox, so
+	// that only inbox forwarding remains to be done.
+	Posted bool
+	// SharedCopy is true for the jobs of an Activity received in the shared
+	// inbox other than the first, which leave the side effects that do not
+	// depend on the inbox to the first job.
+	SharedCopy bool
+	// Attempts is the number of failed processing attempts so far.
+	Attempts int
+	// Created is when the job was first enqueued.
+	Created time.Time
+	// NextAttempt is the earliest time the job is next attempted.
+	NextAttempt time.Time
+	// Updated is when the job's status was last changed.
+	Updated time.Time
+	// LastError describes why the most recent attempt failed, if it did.
+	LastError string
+}
+
+// InboxQueue persists the Activities received by an Actor configured with
+// WithInboxQueue, so that they can be processed asynchronously and retried
+// upon failure by an InboxWorker.
+//
+// Implementations must be safe for concurrent use.
+//
+// The MemoryInboxQueue is provided.
+type InboxQueue interface {
+	// Enqueue persists new pending jobs. Each job has a unique ID.
+	Enqueue(c context.Context, jobs []InboxJob) error
+	// Claim returns up to max pending jobs whose NextAttempt is not after
+	// now.
+	//
+	// Claimed jobs must not be returned by Claim again until 'now' plus
+	// the lease has passed, so that jobs claimed by a worker which stopped
+	// before calling Update are eventually attempted again.
+	Claim(c context.Context, now time.Time, lease time.Duration, max int) (jobs []InboxJob, err error)
+	// Update saves the outcome of an attempt on a previously claimed job.
+	Update(c context.Context, job InboxJob) error
+	// Prune removes jobs that are no longer pending and whose last update
+	// was before the given time.
+	Prune(c context.Context, before time.Time) error
+}
+
+// InboxDeadLetterFunc is called with each InboxJob that is abandoned, and the
+// error of its last attempt.
+type InboxDeadLetterFunc func(c context.Context, job InboxJob, err error)
+
+// DefaultInboxRetryPolicy returns a policy that retries the processing of
+// received Activities for up to six hours, with delays growing from ten
+// seconds to ten minutes.
+func DefaultInboxRetryPolicy() DeliveryRetryPolicy {
+	return DeliveryRetryPolicy{
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     10 * time.Minute,
+		Jitter:         0.2,
+		Horizon:        6 * time.Hour,
+		Lease:          5 * time.Minute,
+		BatchSize:      32,
+		PollInterval:   time.Second,
+		Retention:      time.Hour,
+	}
+}
+
+// delegator is implemented by the Actors of this package, which process
+// Activities with a DelegateActor.
+type delegator interface {
+	delegateActor() DelegateActor
+}
+
+// InboxWorker processes the Activities persisted in an InboxQueue, by calling
+// the PostInbox and InboxForwarding of an Actor's DelegateActor.
+//
+// It is the application's responsibility to call Run or RunPool. Multiple
+// workers may share a single InboxQueue.
+//
+// Processing happens with the worker's context, so values set on the request
+// context by AuthenticatePostInbox and PostInboxRequestBodyHook are not
+// available, except for VerifiedActor.
+//
+// A retried job triggers the side effects of its Activity and forwards it again
+// even though a failed attempt already added it to the inbox or stored it.
+// Jobs claimed again after the lease of a worker that stopped mid-attempt are
+// not retries, and are skipped if their Activity is already in the inbox.
+type InboxWorker struct {
+	queue      InboxQueue
+	delegate   DelegateActor
+	clock      Clock
+	policy     DeliveryRetryPolicy
+	deadLetter InboxDeadLetterFunc
+	randMu     *sync.Mutex
+	rand       *mrand.Rand
+}
+
+// NewInboxWorker returns a worker processing the jobs in the queue with the
+// given Actor, which must have been created by this package.
+//
+// The clock determines when jobs are due and when they are abandoned. The
+// deadLetter function, if non-nil, is called with every abandoned job.
+func NewInboxWorker(q InboxQueue, a Actor, clock Clock, policy DeliveryRetryPolicy, deadLetter InboxDeadLetterFunc) (*InboxWorker, error) {
+	d, ok := a.(delegator)
+	if !ok {
+		return nil, fmt.Errorf("actor was not created by this package: %T", a)
+	}
+	return &InboxWorker{
+		queue:      q,
+		delegate:   d.delegateActor(),
+		clock:      clock,
+		policy:     policy,
+		deadLetter: deadLetter,
+		randMu:     &sync.Mutex{},
+		rand:       mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Run processes due jobs until the context is done, at which point the
+// context's error is returned. An error from the InboxQueue also stops the
+// worker and is returned.
+func (w *InboxWorker) Run(c context.Context) error {
+	for {
+		n, err := w.RunOnce(c)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			// Immediately check for more due jobs.
+			select {
+			case <-c.Done():
+				return c.Err()
+			default:
+				continue
+			}
+		}
+		t := time.NewTimer(w.policy.PollInterval)
+		select {
+		case <-c.Done():
+			t.Stop()
+			return c.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// RunPool calls Run from n goroutines, and returns once all of them have
+// stopped. The first error returned by Run stops the others, and is returned.
+func (w *InboxWorker) RunPool(c context.Context, n int) error {
+	c, cancel := context.WithCancel(c)
+	defer cancel()
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			errs <- w.Run(c)
+		}()
+	}
+	err := <-errs
+	cancel()
+	for i := 1; i < n; i++ {
+		<-errs
+	}
+	return err
+}
+
+// RunOnce claims one batch of due jobs and attempts each of them once,
+// returning the number of jobs attempted.
+//
+// It is useful for applications that schedule processing on their own,
+// instead of calling Run.
+func (w *InboxWorker) RunOnce(c context.Context) (n int, err error) {
+	now := w.clock.Now()
+	if w.policy.Retention > 0 {
+		if err = w.queue.Prune(c, now.Add(-w.policy.Retention)); err != nil {
+			return
+		}
+	}
+	jobs, err := w.queue.Claim(c, now, w.policy.Lease, w.policy.BatchSize)
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		var failure error
+		job, failure = w.attempt(c, job)
+		if err = w.queue.Update(c, job); err != nil {
+			return
+		}
+		if job.Status == InboxJobAbandoned && w.deadLetter != nil {
+			w.deadLetter(c, job, failure)
+		}
+		n++
+	}
+	return
+}
+
+// attempt processes the job once, and returns it with its updated status as
+// well as the error that caused the attempt to fail, if any.
+func (w *InboxWorker) attempt(c context.Context, job InboxJob) (InboxJob, error) {
+	if job.VerifiedActor != nil {
+		c = context.WithValue(c, httpSigActorContextKey{}, job.VerifiedActor)
+	}
+	if job.Attempts > 0 {
+		c = context.WithValue(c, inboxRetryContextKey{}, true)
+	}
+	if job.SharedCopy {
+		c = withSharedInboxCopy(c)
+	}
+	permanent := false
+	activity, err := job.activity(c)
+	if err != nil {
+		permanent = true
+	} else if !job.Posted {
+		err = w.delegate.PostInbox(c, job.InboxIRI, activity)
+		if err == ErrObjectRequired || err == ErrTargetRequired {
+			permanent = true
+		} else if err == nil {
+			job.Posted = true
+		}
+	}
+	if err == nil {
+		err = w.delegate.InboxForwarding(c, job.InboxIRI, activity)
+	}
+	now := w.clock.Now()
+	job.Updated = now
+	if err == nil {
+		job.Status = InboxJobProcessed
+		job.LastError = ""
+		return job, nil
+	}
+	job.Attempts++
+	job.LastError = err.Error()
+	next := now.Add(w.backoff(job.Attempts))
+	if permanent || next.Sub(job.Created) > w.policy.Horizon {
+		job.Status = InboxJobAbandoned
+	} else {
+		job.NextAttempt = next
+	}
+	return job, err
+}
+
+// inboxRetryContextKey is the key of the context value marking the retry of an
+// InboxJob whose previous attempt failed.
+type inboxRetryContextKey struct{}
+
+// isInboxRetry returns true when the context is that of a retried InboxJob.
+//
+// A failed attempt may have already added the Activity to the inbox and
+// stored it before its side effects or inbox forwarding failed, so a retry
+// must not treat the Activity as a duplicate.
+func isInboxRetry(c context.Context) bool {
+	retry, _ := c.Value(inboxRetryContextKey{}).(bool)
+	return retry
+}
+
+// backoff determines the delay after the given number of failed attempts.
+func (w *InboxWorker) backoff(attempts int) time.Duration {
+	w.randMu.Lock()
+	f := w.rand.Float64()
+	w.randMu.Unlock()
+	return w.policy.delay(attempts, f)
+}
+
+// activity deserializes the Activity of the job.
+func (job InboxJob) activity(c context.Context) (Activity, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(job.Payload, &m); err != nil {
+		return nil, err
+	}
+	asValue, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	activity, ok := asValue.(Activity)
+	if !ok {
+		return nil, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+	}
+	return activity, nil
+}
+
+// newInboxJobs creates the pending jobs posting the activity to each of the
+// inboxes.
+func newInboxJobs(c context.Context, activity Activity, inboxes []*url.URL, now time.Time) ([]InboxJob, error) {
+	m, err := streams.Serialize(activity)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	verified, _ := VerifiedActor(c)
+	jobs := make([]InboxJob, 0, len(inboxes))
+	for i, inbox := range inboxes {
+		id, err := newDeliveryJobID()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, InboxJob{
+			ID:            id,
+			ActivityIRI:   activity.GetJSONLDId().Get(),
+			InboxIRI:      inbox,
+			VerifiedActor: verified,
+			Payload:       payload,
+			SharedCopy:    i > 0,
+			Status:        InboxJobPending,
+			Created:       now,
+			NextAttempt:   now,
+			Updated:       now,
+		})
+	}
+	return jobs, nil
+}
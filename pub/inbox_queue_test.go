@@ -0,0 +1,388 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// testInboxJobs creates two pending jobs posting testCreate to two inboxes.
+func testInboxJobs(t *testing.T, c context.Context) []InboxJob {
+	setupData()
+	jobs, err := newInboxJobs(
+		c,
+		testCreate,
+		[]*url.URL{mustParse(testMyInboxIRI), mustParse(testFederatedInboxIRI)},
+		now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestMemoryInboxQueue(t *testing.T) {
+	ctx := context.Background()
+	t.Run("ClaimsDueJobs", func(t *testing.T) {
+		q := NewMemoryInboxQueue()
+		jobs := testInboxJobs(t, ctx)
+		jobs[1].NextAttempt = now().Add(time.Hour)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 1)
+		assertEqual(t, claimed[0].ID, jobs[0].ID)
+	})
+	t.Run("DoesNotReclaimLeasedJobs", func(t *testing.T) {
+		q := NewMemoryInboxQueue()
+		assertEqual(t, q.Enqueue(ctx, testInboxJobs(t, ctx)), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 2)
+		claimed, err = q.Claim(ctx, now().Add(time.Second), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 0)
+		claimed, err = q.Claim(ctx, now().Add(time.Minute), time.Minute, 1)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 1)
+	})
+	t.Run("PrunesOnlyFinishedJobs", func(t *testing.T) {
+		q := NewMemoryInboxQueue()
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = InboxJobProcessed
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		assertEqual(t, q.Prune(ctx, now().Add(time.Hour)), nil)
+		assertEqual(t, len(q.jobs), 1)
+		_, ok := q.jobs[jobs[1].ID]
+		assertEqual(t, ok, true)
+	})
+	t.Run("ErrorIfDuplicateJob", func(t *testing.T) {
+		q := NewMemoryInboxQueue()
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		assertNotEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+	})
+	t.Run("ErrorIfUpdatingUnknownJob", func(t *testing.T) {
+		q := NewMemoryInboxQueue()
+		assertNotEqual(t, q.Update(ctx, testInboxJobs(t, ctx)[0]), nil)
+	})
+}
+
+func TestFileInboxQueue(t *testing.T) {
+	ctx := context.Background()
+	parent, err := ioutil.TempDir("", "gofed-inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	newDir := func(t *testing.T) string {
+		dir, err := ioutil.TempDir(parent, "queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	t.Run("ReloadsPersistedJobs", func(t *testing.T) {
+		dir := newDir(t)
+		q, err := NewFileInboxQueue(dir)
+		assertEqual(t, err, nil)
+		verified := context.WithValue(ctx, httpSigActorContextKey{}, mustParse(testFederatedActorIRI))
+		jobs := testInboxJobs(t, verified)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = InboxJobProcessed
+		jobs[0].Posted = true
+		jobs[0].LastError = "old error"
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		// Reopen
+		q, err = NewFileInboxQueue(dir)
+		assertEqual(t, err, nil)
+		got, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(got), 1)
+		assertEqual(t, got[0].ID, jobs[1].ID)
+		assertEqual(t, got[0].InboxIRI.String(), testFederatedInboxIRI)
+		assertEqual(t, got[0].VerifiedActor.String(), testFederatedActorIRI)
+		assertByteEqual(t, got[0].Payload, mustSerializeToBytes(testCreate))
+		assertEqual(t, got[0].Created.Equal(now()), true)
+		processed := q.mem.jobs[jobs[0].ID]
+		assertEqual(t, processed.Status, InboxJobProcessed)
+		assertEqual(t, processed.Posted, true)
+		assertEqual(t, processed.LastError, "old error")
+		assertEqual(t, processed.ActivityIRI.String(), testFederatedActivityIRI)
+	})
+	t.Run("PersistsLease", func(t *testing.T) {
+		dir := newDir(t)
+		q, err := NewFileInboxQueue(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, q.Enqueue(ctx, testInboxJobs(t, ctx)), nil)
+		claimed, err := q.Claim(ctx, now(), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 2)
+		// Reopen
+		q, err = NewFileInboxQueue(dir)
+		assertEqual(t, err, nil)
+		claimed, err = q.Claim(ctx, now().Add(time.Second), time.Minute, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(claimed), 0)
+	})
+	t.Run("PruneRemovesFiles", func(t *testing.T) {
+		dir := newDir(t)
+		q, err := NewFileInboxQueue(dir)
+		assertEqual(t, err, nil)
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		jobs[0].Status = InboxJobAbandoned
+		assertEqual(t, q.Update(ctx, jobs[0]), nil)
+		assertEqual(t, q.Prune(ctx, now().Add(time.Hour)), nil)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 1)
+	})
+}
+
+func TestInboxWorker(t *testing.T) {
+	ctx := context.Background()
+	policy := DeliveryRetryPolicy{
+		InitialBackoff: time.Minute,
+		MaxBackoff:     time.Hour,
+		Horizon:        3 * time.Hour,
+		Lease:          time.Minute,
+		BatchSize:      10,
+	}
+	// deadLetters records the jobs given to the dead-letter function.
+	type deadLetters struct {
+		jobs []InboxJob
+		errs []error
+	}
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, cl *MockClock, q *MemoryInboxQueue, dl *deadLetters, w *InboxWorker) {
+		delegate = NewMockDelegateActor(ctl)
+		cl = NewMockClock(ctl)
+		q = NewMemoryInboxQueue()
+		dl = &deadLetters{}
+		a := NewCustomActor(delegate, false, true, cl)
+		var err error
+		w, err = NewInboxWorker(q, a, cl, policy, func(c context.Context, job InboxJob, err error) {
+			dl.jobs = append(dl.jobs, job)
+			dl.errs = append(dl.errs, err)
+		})
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	t.Run("ProcessesDueJobs", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, cl, q, dl, w := setupFn(ctl)
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs), nil)
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(3)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate))
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate))
+		delegate.EXPECT().PostInbox(withSharedInboxCopy(ctx), mustParse(testFederatedInboxIRI), toDeserializedForm(testCreate))
+		delegate.EXPECT().InboxForwarding(withSharedInboxCopy(ctx), mustParse(testFederatedInboxIRI), toDeserializedForm(testCreate))
+		// Run & Verify
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 2)
+		for _, job := range q.jobs {
+			assertEqual(t, job.Status, InboxJobProcessed)
+		}
+		assertEqual(t, len(dl.jobs), 0)
+	})
+	t.Run("ProvidesVerifiedActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, cl, q, _, w := setupFn(ctl)
+		verified := context.WithValue(ctx, httpSigActorContextKey{}, mustParse(testFederatedActorIRI))
+		jobs := testInboxJobs(t, verified)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		var got *url.URL
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(2)
+		delegate.EXPECT().PostInbox(gomock.Any(), mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).DoAndReturn(func(c context.Context, inboxIRI *url.URL, activity Activity) error {
+			got, _ = VerifiedActor(c)
+			return nil
+		})
+		delegate.EXPECT().InboxForwarding(gomock.Any(), mustParse(testMyInboxIRI), toDeserializedForm(testCreate))
+		// Run & Verify
+		_, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, got.String(), testFederatedActorIRI)
+	})
+	t.Run("RetriesOnlyInboxForwardingOncePosted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, cl, q, _, w := setupFn(ctl)
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(2)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate))
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(fmt.Errorf("test error"))
+		// Run & Verify
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		job := q.jobs[jobs[0].ID]
+		assertEqual(t, job.Status, InboxJobPending)
+		assertEqual(t, job.Posted, true)
+		assertEqual(t, job.Attempts, 1)
+		assertEqual(t, job.LastError, "test error")
+		assertEqual(t, job.NextAttempt.Equal(now().Add(time.Minute)), true)
+		// Retry
+		later := now().Add(time.Minute)
+		cl.EXPECT().Now().Return(later).Times(2)
+		delegate.EXPECT().InboxForwarding(context.WithValue(ctx, inboxRetryContextKey{}, true), mustParse(testMyInboxIRI), toDeserializedForm(testCreate))
+		n, err = w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		assertEqual(t, q.jobs[jobs[0].ID].Status, InboxJobProcessed)
+	})
+	t.Run("DeadLettersPermanentFailures", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, cl, q, dl, w := setupFn(ctl)
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		// Mock
+		cl.EXPECT().Now().Return(now()).Times(2)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
+		// Run & Verify
+		_, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, q.jobs[jobs[0].ID].Status, InboxJobAbandoned)
+		assertEqual(t, len(dl.jobs), 1)
+		assertEqual(t, dl.jobs[0].ID, jobs[0].ID)
+		assertEqual(t, dl.errs[0], ErrObjectRequired)
+	})
+	t.Run("DeadLettersAfterHorizon", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, cl, q, dl, w := setupFn(ctl)
+		jobs := testInboxJobs(t, ctx)
+		assertEqual(t, q.Enqueue(ctx, jobs[:1]), nil)
+		testErr := fmt.Errorf("test error")
+		// Mock
+		cl.EXPECT().Now().Return(now().Add(policy.Horizon)).Times(2)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		// Run & Verify
+		_, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, q.jobs[jobs[0].ID].Status, InboxJobAbandoned)
+		assertEqual(t, q.jobs[jobs[0].ID].Posted, false)
+		assertEqual(t, len(dl.jobs), 1)
+		assertEqual(t, dl.errs[0], testErr)
+	})
+	t.Run("ErrorIfActorNotFromPackage", func(t *testing.T) {
+		_, err := NewInboxWorker(NewMemoryInboxQueue(), nil, nil, policy, nil)
+		assertNotEqual(t, err, nil)
+	})
+}
+
+// TestPostInboxWithInboxQueue ensures received activities are enqueued instead
+// of processed when an InboxQueue is configured.
+func TestPostInboxWithInboxQueue(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, clock *MockClock, q *MemoryInboxQueue, a Actor) {
+		setupData()
+		delegate = NewMockDelegateActor(ctl)
+		clock = NewMockClock(ctl)
+		q = NewMemoryInboxQueue()
+		a = &baseActor{
+			delegate:                delegate,
+			enableFederatedProtocol: true,
+			clock:                   clock,
+			inboxQueue:              q,
+		}
+		return
+	}
+	t.Run("PostInboxRespondsAccepted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, q, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Mock
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).Return(true, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		handled, err := a.PostInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		assertEqual(t, len(q.jobs), 1)
+		for _, job := range q.jobs {
+			assertEqual(t, job.InboxIRI.String(), testMyInboxIRI)
+			assertEqual(t, job.ActivityIRI.String(), testFederatedActivityIRI)
+			assertEqual(t, job.Status, InboxJobPending)
+			assertByteEqual(t, job.Payload, mustSerializeToBytes(testCreate))
+		}
+	})
+	t.Run("PostSharedInboxEnqueuesEachInbox", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, q, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		otherInbox := mustParse("https://example.com/jordan/inbox")
+		// Mock
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return([]*url.URL{mustParse(testMyInboxIRI), otherInbox}, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run & Verify
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		assertEqual(t, len(q.jobs), 2)
+		copies := 0
+		for _, job := range q.jobs {
+			if job.SharedCopy {
+				copies++
+			}
+		}
+		assertEqual(t, copies, 1)
+	})
+	t.Run("DoesNotEnqueueIfNotAuthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, q, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Mock
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(withInboxIRI(ctx, mustParse(testMyInboxIRI)), resp, toDeserializedForm(testCreate)).DoAndReturn(func(c context.Context, w http.ResponseWriter, activity Activity) (bool, error) {
+			w.WriteHeader(http.StatusForbidden)
+			return false, nil
+		})
+		// Run & Verify
+		handled, err := a.PostInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+		assertEqual(t, len(q.jobs), 0)
+	})
+}
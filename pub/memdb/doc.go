@@ -0,0 +1,15 @@
+// Package memdb provides an in-memory implementation of pub.Database.
+//
+// It is intended for prototypes and tests: nothing is persisted, and every
+// value is kept in memory until it is deleted. A working Actor can be created
+// in a few lines:
+//
+//	db := memdb.New("https", "example.com")
+//	person, err := db.CreatePerson(ctx, "alex")
+//	...
+//	actor := pub.NewActor(myCommonBehavior, mySocialProtocol, myFederatingProtocol, db, myClock)
+//
+// Values are stored in their serialized form, so values returned by Get are
+// copies that may be freely modified without affecting the Database until
+// they are passed to Update.
+package memdb
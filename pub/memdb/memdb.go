@@ -0,0 +1,586 @@
+package memdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Database must implement pub.Database.
+var _ pub.Database = &Database{}
+
+// Database must implement pub.ActorContentDatabase.
+var _ pub.ActorContentDatabase = &Database{}
+
+// Database must implement pub.BlocksDatabase.
+var _ pub.BlocksDatabase = &Database{}
+
+// idLock is the lock of a single id, which is discarded once no goroutine
+// holds or waits for it.
+type idLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Database is a concurrency-safe, in-memory pub.Database.
+//
+// Every id on the configured scheme and host is owned by the Database, and
+// NewID creates ids on it.
+//
+// The first page of every inbox and outbox contains all of its items.
+type Database struct {
+	scheme string
+	host   string
+	// locksMu guards locks.
+	locksMu *sync.Mutex
+	locks   map[string]*idLock
+	// mu guards the remaining fields.
+	mu *sync.RWMutex
+	// values are the serialized values, keyed by id.
+	values map[string][]byte
+	// boxes are the item ids of each inbox and outbox, newest first.
+	boxes map[string][]*url.URL
+	// inboxActors and outboxActors map the boxes of stored actors to the
+	// actor ids.
+	inboxActors  map[string]*url.URL
+	outboxActors map[string]*url.URL
+}
+
+// New returns an empty Database owning the ids with the given scheme and host,
+// such as "https" and "example.com".
+func New(scheme, host string) *Database {
+	return &Database{
+		scheme:       scheme,
+		host:         host,
+		locksMu:      &sync.Mutex{},
+		locks:        make(map[string]*idLock),
+		mu:           &sync.RWMutex{},
+		values:       make(map[string][]byte),
+		boxes:        make(map[string][]*url.URL),
+		inboxActors:  make(map[string]*url.URL),
+		outboxActors: make(map[string]*url.URL),
+	}
+}
+
+// Lock takes the lock for the id, which need not exist.
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	l, ok := d.locks[k]
+	if !ok {
+		l = &idLock{}
+		d.locks[k] = l
+	}
+	l.refs++
+	d.locksMu.Unlock()
+	l.mu.Lock()
+	return nil
+}
+
+// Unlock releases the lock for the id.
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	l, ok := d.locks[k]
+	if !ok {
+		d.locksMu.Unlock()
+		return fmt.Errorf("memdb: %s is not locked", id)
+	}
+	l.refs--
+	if l.refs == 0 {
+		delete(d.locks, k)
+	}
+	d.locksMu.Unlock()
+	l.mu.Unlock()
+	return nil
+}
+
+// InboxContains returns true if the inbox has an item with the id.
+func (d *Database) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, item := range d.boxes[inbox.String()] {
+		if item.String() == id.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetInbox returns the first page of the inbox.
+func (d *Database) GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	return d.getBox(inboxIRI)
+}
+
+// SetInbox replaces the first page of the inbox it is part of.
+func (d *Database) SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return d.setBox(inbox)
+}
+
+// Owns returns true if the id is on the configured scheme and host, and is
+// either stored or the inbox or outbox of a stored actor.
+func (d *Database) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	if id.Scheme != d.scheme || id.Host != d.host {
+		return false, nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	k := id.String()
+	_, isValue := d.values[k]
+	_, isInbox := d.inboxActors[k]
+	_, isOutbox := d.outboxActors[k]
+	return isValue || isInbox || isOutbox, nil
+}
+
+// ActorForOutbox returns the stored actor with the outbox.
+func (d *Database) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.outboxActors[outboxIRI.String()]
+	if !ok {
+		err = fmt.Errorf("memdb: no actor has outbox %s", outboxIRI)
+	}
+	return
+}
+
+// ActorForInbox returns the stored actor with the inbox.
+func (d *Database) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.inboxActors[inboxIRI.String()]
+	if !ok {
+		err = fmt.Errorf("memdb: no actor has inbox %s", inboxIRI)
+	}
+	return
+}
+
+// OutboxForInbox returns the outbox of the stored actor with the inbox.
+func (d *Database) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	actorIRI, err := d.ActorForInbox(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	t, err := d.get(c, actorIRI)
+	if err != nil {
+		return
+	}
+	if o, ok := t.(outboxer); ok && o.GetActivityStreamsOutbox() != nil {
+		return pub.ToId(o.GetActivityStreamsOutbox())
+	}
+	err = fmt.Errorf("memdb: actor %s has no outbox", actorIRI)
+	return
+}
+
+// InboxForActor returns the inbox of the actor if it is stored, or nil
+// otherwise.
+func (d *Database) InboxForActor(c context.Context, actorIRI *url.URL) (inboxIRI *url.URL, err error) {
+	t, err := d.get(c, actorIRI)
+	if err != nil {
+		// Let the library dereference the actor instead.
+		return nil, nil
+	}
+	if i, ok := t.(inboxer); ok && i.GetActivityStreamsInbox() != nil {
+		return pub.ToId(i.GetActivityStreamsInbox())
+	}
+	return nil, nil
+}
+
+// Exists returns true if a value with the id is stored.
+func (d *Database) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exists = d.values[id.String()]
+	return
+}
+
+// Get returns a copy of the stored value with the id.
+func (d *Database) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	return d.get(c, id)
+}
+
+// Create stores the value by its id, replacing any value with the same id as
+// Create may be called multiple times for the same value.
+func (d *Database) Create(c context.Context, asType vocab.Type) error {
+	return d.set(asType)
+}
+
+// Update replaces the stored value with the same id.
+func (d *Database) Update(c context.Context, asType vocab.Type) error {
+	return d.set(asType)
+}
+
+// Delete removes the value with the id.
+func (d *Database) Delete(c context.Context, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := id.String()
+	delete(d.values, k)
+	d.unindexActor(k)
+	return nil
+}
+
+// GetOutbox returns the first page of the outbox.
+func (d *Database) GetOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	return d.getBox(outboxIRI)
+}
+
+// SetOutbox replaces the first page of the outbox it is part of.
+func (d *Database) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return d.setBox(outbox)
+}
+
+// NewID creates a random id on the configured scheme and host, with a path
+// based on the type, such as "/note/0123456789abcdef0123456789abcdef".
+func (d *Database) NewID(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	id = &url.URL{
+		Scheme: d.scheme,
+		Host:   d.host,
+		Path:   fmt.Sprintf("/%s/%s", strings.ToLower(t.GetTypeName()), hex.EncodeToString(b)),
+	}
+	return
+}
+
+// Followers returns the followers Collection of the stored actor.
+func (d *Database) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "followers", func(t vocab.Type) pub.IdProperty {
+		if f, ok := t.(followerser); ok && f.GetActivityStreamsFollowers() != nil {
+			return f.GetActivityStreamsFollowers()
+		}
+		return nil
+	})
+}
+
+// Following returns the following Collection of the stored actor.
+func (d *Database) Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "following", func(t vocab.Type) pub.IdProperty {
+		if f, ok := t.(followinger); ok && f.GetActivityStreamsFollowing() != nil {
+			return f.GetActivityStreamsFollowing()
+		}
+		return nil
+	})
+}
+
+// Liked returns the liked Collection of the stored actor.
+func (d *Database) Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "liked", func(t vocab.Type) pub.IdProperty {
+		if l, ok := t.(likeder); ok && l.GetActivityStreamsLiked() != nil {
+			return l.GetActivityStreamsLiked()
+		}
+		return nil
+	})
+}
+
+// Blocks returns the blocks Collection of the stored actor, whose id is the
+// actor's id followed by "/blocks". It is not a property of the actor.
+func (d *Database) Blocks(c context.Context, actorIRI *url.URL) (blocks vocab.ActivityStreamsCollection, err error) {
+	if _, err = d.get(c, actorIRI); err != nil {
+		return
+	}
+	collectionIRI := *actorIRI
+	collectionIRI.Path += "/blocks"
+	return d.collection(c, actorIRI, &collectionIRI, "blocks")
+}
+
+// ActorContent returns the ids of the stored values whose 'actor' or
+// 'attributedTo' is the actor, sorted.
+func (d *Database) ActorContent(c context.Context, actorIRI *url.URL) (ids []*url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actor := actorIRI.String()
+	var keys []string
+	for k, b := range d.values {
+		var m map[string]interface{}
+		if err = json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		if refersTo(m["actor"], actor) || refersTo(m["attributedTo"], actor) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var id *url.URL
+		if id, err = url.Parse(k); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// CreatePerson stores a new Person with the preferred username, whose id is
+// the username under the configured scheme and host, along with its empty
+// followers, following, and liked Collections.
+//
+// Its inbox and outbox are empty. The Person is returned so that it may be
+// further modified and passed to Update.
+func (d *Database) CreatePerson(c context.Context, username string) (vocab.ActivityStreamsPerson, error) {
+	actorIRI := &url.URL{
+		Scheme: d.scheme,
+		Host:   d.host,
+		Path:   "/" + username,
+	}
+	sub := func(s string) *url.URL {
+		u := *actorIRI
+		u.Path += "/" + s
+		return &u
+	}
+	p := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(actorIRI)
+	p.SetJSONLDId(id)
+	name := streams.NewActivityStreamsPreferredUsernameProperty()
+	name.SetXMLSchemaString(username)
+	p.SetActivityStreamsPreferredUsername(name)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(sub("inbox"))
+	p.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(sub("outbox"))
+	p.SetActivityStreamsOutbox(outbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(sub("followers"))
+	p.SetActivityStreamsFollowers(followers)
+	following := streams.NewActivityStreamsFollowingProperty()
+	following.SetIRI(sub("following"))
+	p.SetActivityStreamsFollowing(following)
+	liked := streams.NewActivityStreamsLikedProperty()
+	liked.SetIRI(sub("liked"))
+	p.SetActivityStreamsLiked(liked)
+	for _, collectionIRI := range []*url.URL{sub("followers"), sub("following"), sub("liked")} {
+		if err := d.set(newCollection(collectionIRI)); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.set(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// get deserializes the stored value with the id.
+func (d *Database) get(c context.Context, id *url.URL) (vocab.Type, error) {
+	d.mu.RLock()
+	b, ok := d.values[id.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("memdb: %s does not exist", id)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// set serializes and stores the value by its id.
+func (d *Database) set(t vocab.Type) error {
+	id, err := pub.GetId(t)
+	if err != nil {
+		return err
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	// Some types, such as the PublicKey, do not serialize their type but
+	// must have one to be deserialized.
+	if _, ok := m["type"]; !ok {
+		m["type"] = t.GetTypeName()
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := id.String()
+	d.values[k] = b
+	d.unindexActor(k)
+	if i, ok := t.(inboxer); ok && i.GetActivityStreamsInbox() != nil {
+		if inboxIRI, err := pub.ToId(i.GetActivityStreamsInbox()); err == nil {
+			d.inboxActors[inboxIRI.String()] = id
+		}
+	}
+	if o, ok := t.(outboxer); ok && o.GetActivityStreamsOutbox() != nil {
+		if outboxIRI, err := pub.ToId(o.GetActivityStreamsOutbox()); err == nil {
+			d.outboxActors[outboxIRI.String()] = id
+		}
+	}
+	return nil
+}
+
+// unindexActor removes the boxes of the actor with the id from the indexes. It
+// must be called while holding the write lock.
+func (d *Database) unindexActor(id string) {
+	for box, actorIRI := range d.inboxActors {
+		if actorIRI.String() == id {
+			delete(d.inboxActors, box)
+		}
+	}
+	for box, actorIRI := range d.outboxActors {
+		if actorIRI.String() == id {
+			delete(d.outboxActors, box)
+		}
+	}
+}
+
+// getBox returns the page of all items of the inbox or outbox. The page is
+// part of the box, which identifies the box when the page is set.
+func (d *Database) getBox(boxIRI *url.URL) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	items := d.boxes[boxIRI.String()]
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	id := streams.NewJSONLDIdProperty()
+	pageIRI := *boxIRI
+	pageIRI.RawQuery = "page=true"
+	id.Set(&pageIRI)
+	page.SetJSONLDId(id)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(boxIRI)
+	page.SetActivityStreamsPartOf(partOf)
+	oi := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items {
+		oi.AppendIRI(item)
+	}
+	page.SetActivityStreamsOrderedItems(oi)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(len(items))
+	page.SetActivityStreamsTotalItems(total)
+	return page, nil
+}
+
+// setBox replaces the items of the inbox or outbox the page is part of.
+func (d *Database) setBox(page vocab.ActivityStreamsOrderedCollectionPage) error {
+	partOf := page.GetActivityStreamsPartOf()
+	if partOf == nil {
+		return fmt.Errorf("memdb: page is not part of an inbox or outbox")
+	}
+	boxIRI, err := pub.ToId(partOf)
+	if err != nil {
+		return err
+	}
+	var items []*url.URL
+	if oi := page.GetActivityStreamsOrderedItems(); oi != nil {
+		for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			items = append(items, id)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.boxes[boxIRI.String()] = items
+	return nil
+}
+
+// actorCollection returns the Collection of the stored actor given by the
+// property, creating it if needed.
+func (d *Database) actorCollection(c context.Context, actorIRI *url.URL, name string, prop func(vocab.Type) pub.IdProperty) (vocab.ActivityStreamsCollection, error) {
+	actor, err := d.get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	p := prop(actor)
+	if p == nil {
+		return nil, fmt.Errorf("memdb: actor %s has no %s collection", actorIRI, name)
+	}
+	collectionIRI, err := pub.ToId(p)
+	if err != nil {
+		return nil, err
+	}
+	return d.collection(c, actorIRI, collectionIRI, name)
+}
+
+// collection returns the stored Collection with the id, creating it if needed.
+func (d *Database) collection(c context.Context, actorIRI, collectionIRI *url.URL, name string) (vocab.ActivityStreamsCollection, error) {
+	if exists, _ := d.Exists(c, collectionIRI); !exists {
+		col := newCollection(collectionIRI)
+		if err := d.set(col); err != nil {
+			return nil, err
+		}
+		return col, nil
+	}
+	t, err := d.get(c, collectionIRI)
+	if err != nil {
+		return nil, err
+	}
+	col, ok := t.(vocab.ActivityStreamsCollection)
+	if !ok {
+		return nil, fmt.Errorf("memdb: %s collection of %s is not a Collection", name, actorIRI)
+	}
+	return col, nil
+}
+
+// refersTo returns true if the serialized property value is the id, or an
+// object or array referring to it.
+func refersTo(v interface{}, id string) bool {
+	switch t := v.(type) {
+	case string:
+		return t == id
+	case map[string]interface{}:
+		return refersTo(t["id"], id)
+	case []interface{}:
+		for _, e := range t {
+			if refersTo(e, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newCollection creates an empty Collection with the id.
+func newCollection(id *url.URL) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(id)
+	col.SetJSONLDId(idp)
+	col.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(0)
+	col.SetActivityStreamsTotalItems(total)
+	return col
+}
+
+// inboxer is an ActivityStreams type with an 'inbox' property.
+type inboxer interface {
+	GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+}
+
+// outboxer is an ActivityStreams type with an 'outbox' property.
+type outboxer interface {
+	GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+}
+
+// followerser is an ActivityStreams type with a 'followers' property.
+type followerser interface {
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+}
+
+// followinger is an ActivityStreams type with a 'following' property.
+type followinger interface {
+	GetActivityStreamsFollowing() vocab.ActivityStreamsFollowingProperty
+}
+
+// likeder is an ActivityStreams type with a 'liked' property.
+type likeder interface {
+	GetActivityStreamsLiked() vocab.ActivityStreamsLikedProperty
+}
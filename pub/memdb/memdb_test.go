@@ -0,0 +1,663 @@
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+)
+
+const (
+	testScheme = "https"
+	testHost   = "example.com"
+)
+
+// mustParse parses a URL or panics.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// assertEqual ensures two values are equal.
+func assertEqual(t *testing.T, a, b interface{}) {
+	if a != b {
+		t.Errorf("expected equal: %v != %v", a, b)
+	}
+}
+
+// newNote creates a Note with the id and content.
+func newNote(id, content string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(mustParse(id))
+	n.SetJSONLDId(idp)
+	cp := streams.NewActivityStreamsContentProperty()
+	cp.AppendXMLSchemaString(content)
+	n.SetActivityStreamsContent(cp)
+	return n
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	t.Run("LocksMissingId", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		id := mustParse("https://example.com/missing")
+		assertEqual(t, db.Lock(ctx, id), nil)
+		assertEqual(t, db.Unlock(ctx, id), nil)
+	})
+	t.Run("ErrorIfNotLocked", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		err := db.Unlock(ctx, mustParse("https://example.com/missing"))
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ExcludesConcurrentHolders", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		id := mustParse("https://example.com/contended")
+		var wg sync.WaitGroup
+		counter := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				db.Lock(ctx, id)
+				v := counter
+				time.Sleep(time.Microsecond)
+				counter = v + 1
+				db.Unlock(ctx, id)
+			}()
+		}
+		wg.Wait()
+		assertEqual(t, counter, 50)
+		assertEqual(t, len(db.locks), 0)
+	})
+}
+
+func TestValues(t *testing.T) {
+	ctx := context.Background()
+	const noteId = "https://example.com/note/1"
+	t.Run("CreatesAndGets", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		err := db.Create(ctx, newNote(noteId, "hello"))
+		assertEqual(t, err, nil)
+		exists, err := db.Exists(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		assertEqual(t, exists, true)
+		v, err := db.Get(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		n, ok := v.(vocab.ActivityStreamsNote)
+		assertEqual(t, ok, true)
+		assertEqual(t, n.GetActivityStreamsContent().At(0).GetXMLSchemaString(), "hello")
+	})
+	t.Run("CreatesTwice", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+	})
+	t.Run("GetReturnsCopy", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+		v, err := db.Get(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		v.(vocab.ActivityStreamsNote).GetActivityStreamsContent().At(0).SetXMLSchemaString("changed")
+		v, err = db.Get(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		assertEqual(t, v.(vocab.ActivityStreamsNote).GetActivityStreamsContent().At(0).GetXMLSchemaString(), "hello")
+	})
+	t.Run("Updates", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+		assertEqual(t, db.Update(ctx, newNote(noteId, "bye")), nil)
+		v, err := db.Get(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		assertEqual(t, v.(vocab.ActivityStreamsNote).GetActivityStreamsContent().At(0).GetXMLSchemaString(), "bye")
+	})
+	t.Run("Deletes", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+		assertEqual(t, db.Delete(ctx, mustParse(noteId)), nil)
+		exists, err := db.Exists(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		assertEqual(t, exists, false)
+		_, err = db.Get(ctx, mustParse(noteId))
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("OwnsOnlyStoredLocalIds", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		assertEqual(t, db.Create(ctx, newNote(noteId, "hello")), nil)
+		assertEqual(t, db.Create(ctx, newNote("https://other.example.com/note/1", "hello")), nil)
+		owns, err := db.Owns(ctx, mustParse(noteId))
+		assertEqual(t, err, nil)
+		assertEqual(t, owns, true)
+		owns, err = db.Owns(ctx, mustParse("https://other.example.com/note/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, owns, false)
+		owns, err = db.Owns(ctx, mustParse("https://example.com/note/2"))
+		assertEqual(t, err, nil)
+		assertEqual(t, owns, false)
+	})
+	t.Run("NewIDOnHost", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		id, err := db.NewID(ctx, streams.NewActivityStreamsNote())
+		assertEqual(t, err, nil)
+		assertEqual(t, id.Scheme, testScheme)
+		assertEqual(t, id.Host, testHost)
+		other, err := db.NewID(ctx, streams.NewActivityStreamsNote())
+		assertEqual(t, err, nil)
+		if id.String() == other.String() {
+			t.Fatalf("expected unique ids, got %s twice", id)
+		}
+	})
+}
+
+func TestActors(t *testing.T) {
+	ctx := context.Background()
+	const (
+		actorIRI  = "https://example.com/alex"
+		inboxIRI  = "https://example.com/alex/inbox"
+		outboxIRI = "https://example.com/alex/outbox"
+	)
+	t.Run("MapsBoxes", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		_, err := db.CreatePerson(ctx, "alex")
+		assertEqual(t, err, nil)
+		actor, err := db.ActorForInbox(ctx, mustParse(inboxIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), actorIRI)
+		actor, err = db.ActorForOutbox(ctx, mustParse(outboxIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, actor.String(), actorIRI)
+		outbox, err := db.OutboxForInbox(ctx, mustParse(inboxIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, outbox.String(), outboxIRI)
+		inbox, err := db.InboxForActor(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, inbox.String(), inboxIRI)
+		owns, err := db.Owns(ctx, mustParse(inboxIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, owns, true)
+	})
+	t.Run("UnknownActorHasNoInbox", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		inbox, err := db.InboxForActor(ctx, mustParse("https://other.example.com/sam"))
+		assertEqual(t, err, nil)
+		assertEqual(t, inbox, (*url.URL)(nil))
+	})
+	t.Run("DeletedActorHasNoBoxes", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		_, err := db.CreatePerson(ctx, "alex")
+		assertEqual(t, err, nil)
+		assertEqual(t, db.Delete(ctx, mustParse(actorIRI)), nil)
+		_, err = db.ActorForInbox(ctx, mustParse(inboxIRI))
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ReturnsCollections", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		_, err := db.CreatePerson(ctx, "alex")
+		assertEqual(t, err, nil)
+		followers, err := db.Followers(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, followers.GetJSONLDId().Get().String(), actorIRI+"/followers")
+		followers.GetActivityStreamsItems().AppendIRI(mustParse("https://other.example.com/sam"))
+		assertEqual(t, db.Update(ctx, followers), nil)
+		followers, err = db.Followers(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, followers.GetActivityStreamsItems().Len(), 1)
+		following, err := db.Following(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, following.GetJSONLDId().Get().String(), actorIRI+"/following")
+		liked, err := db.Liked(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, liked.GetJSONLDId().Get().String(), actorIRI+"/liked")
+		blocks, err := db.Blocks(ctx, mustParse(actorIRI))
+		assertEqual(t, err, nil)
+		assertEqual(t, blocks.GetJSONLDId().Get().String(), actorIRI+"/blocks")
+	})
+	t.Run("FindsActorContent", func(t *testing.T) {
+		const sam = "https://other.example.com/sam"
+		db := New(testScheme, testHost)
+		note := newNote("https://other.example.com/note/1", "hi")
+		attributedTo := streams.NewActivityStreamsAttributedToProperty()
+		attributedTo.AppendIRI(mustParse(sam))
+		note.SetActivityStreamsAttributedTo(attributedTo)
+		like := streams.NewActivityStreamsLike()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://other.example.com/like/1"))
+		like.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(sam))
+		like.SetActivityStreamsActor(actor)
+		assertEqual(t, db.Create(ctx, note), nil)
+		assertEqual(t, db.Create(ctx, like), nil)
+		assertEqual(t, db.Create(ctx, newNote("https://example.com/note/1", "mine")), nil)
+		ids, err := db.ActorContent(ctx, mustParse(sam))
+		assertEqual(t, err, nil)
+		assertEqual(t, len(ids), 2)
+		assertEqual(t, ids[0].String(), "https://other.example.com/like/1")
+		assertEqual(t, ids[1].String(), "https://other.example.com/note/1")
+	})
+}
+
+func TestBoxes(t *testing.T) {
+	ctx := context.Background()
+	inboxIRI := mustParse("https://example.com/alex/inbox")
+	t.Run("PrependsToFirstPage", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		for _, id := range []string{"https://other.example.com/1", "https://other.example.com/2"} {
+			page, err := db.GetInbox(ctx, inboxIRI)
+			assertEqual(t, err, nil)
+			oi := page.GetActivityStreamsOrderedItems()
+			oi.PrependIRI(mustParse(id))
+			assertEqual(t, db.SetInbox(ctx, page), nil)
+		}
+		contains, err := db.InboxContains(ctx, inboxIRI, mustParse("https://other.example.com/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, contains, true)
+		page, err := db.GetInbox(ctx, inboxIRI)
+		assertEqual(t, err, nil)
+		oi := page.GetActivityStreamsOrderedItems()
+		assertEqual(t, oi.Len(), 2)
+		assertEqual(t, oi.At(0).GetIRI().String(), "https://other.example.com/2")
+		assertEqual(t, oi.At(1).GetIRI().String(), "https://other.example.com/1")
+		// The items are not independent entries.
+		exists, err := db.Exists(ctx, mustParse("https://other.example.com/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, exists, false)
+	})
+	t.Run("KeepsInboxAndOutboxApart", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		page, err := db.GetOutbox(ctx, mustParse("https://example.com/alex/outbox"))
+		assertEqual(t, err, nil)
+		page.GetActivityStreamsOrderedItems().PrependIRI(mustParse("https://example.com/create/1"))
+		assertEqual(t, db.SetOutbox(ctx, page), nil)
+		contains, err := db.InboxContains(ctx, inboxIRI, mustParse("https://example.com/create/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, contains, false)
+	})
+}
+
+// testSocialApp is a minimal application using the Social Protocol.
+type testSocialApp struct{}
+
+func (testSocialApp) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+func (testSocialApp) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+func (testSocialApp) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (testSocialApp) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (testSocialApp) PostOutboxRequestBodyHook(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
+	return c, nil
+}
+
+func (testSocialApp) AuthenticatePostOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+func (testSocialApp) SocialCallbacks(c context.Context) (pub.SocialWrappedCallbacks, []interface{}, error) {
+	return pub.SocialWrappedCallbacks{}, nil, nil
+}
+
+func (testSocialApp) DefaultCallback(c context.Context, activity pub.Activity) error {
+	return nil
+}
+
+// testClock is a Clock at a fixed time.
+type testClock struct{}
+
+func (testClock) Now() time.Time {
+	return time.Date(2000, 2, 3, 4, 5, 6, 7, time.UTC)
+}
+
+func TestSocialActor(t *testing.T) {
+	ctx := context.Background()
+	db := New(testScheme, testHost)
+	person, err := db.CreatePerson(ctx, "alex")
+	assertEqual(t, err, nil)
+	actor := pub.NewSocialActor(testSocialApp{}, testSocialApp{}, db, testClock{})
+	// Post a Note, which is wrapped in a Create.
+	note := streams.NewActivityStreamsNote()
+	cp := streams.NewActivityStreamsContentProperty()
+	cp.AppendXMLSchemaString("hello")
+	note.SetActivityStreamsContent(cp)
+	ap := streams.NewActivityStreamsAttributedToProperty()
+	ap.AppendIRI(person.GetJSONLDId().Get())
+	note.SetActivityStreamsAttributedTo(ap)
+	m, err := streams.Serialize(note)
+	assertEqual(t, err, nil)
+	b, err := json.Marshal(m)
+	assertEqual(t, err, nil)
+	req := httptest.NewRequest("POST", "https://example.com/alex/outbox", bytes.NewBuffer(b))
+	req.Header.Set("Content-Type", "application/activity+json")
+	resp := httptest.NewRecorder()
+	handled, err := actor.PostOutbox(ctx, resp, req)
+	assertEqual(t, err, nil)
+	assertEqual(t, handled, true)
+	assertEqual(t, resp.Code, http.StatusCreated)
+	// The Create is in the outbox and stored, as is its Note.
+	createIRI := mustParse(resp.Header().Get("Location"))
+	page, err := db.GetOutbox(ctx, mustParse("https://example.com/alex/outbox"))
+	assertEqual(t, err, nil)
+	assertEqual(t, page.GetActivityStreamsOrderedItems().Len(), 1)
+	assertEqual(t, page.GetActivityStreamsOrderedItems().At(0).GetIRI().String(), createIRI.String())
+	v, err := db.Get(ctx, createIRI)
+	assertEqual(t, err, nil)
+	create, ok := v.(vocab.ActivityStreamsCreate)
+	assertEqual(t, ok, true)
+	noteIRI, err := pub.ToId(create.GetActivityStreamsObject().At(0))
+	assertEqual(t, err, nil)
+	exists, err := db.Exists(ctx, noteIRI)
+	assertEqual(t, err, nil)
+	assertEqual(t, exists, true)
+}
+
+// testFederatingApp is a minimal application using the Federating Protocol,
+// whose Create callback fails a number of times before succeeding.
+type testFederatingApp struct {
+	testSocialApp
+	failures int
+	creates  int
+}
+
+func (a *testFederatingApp) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
+	return c, nil
+}
+
+func (a *testFederatingApp) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+func (a *testFederatingApp) Blocked(c context.Context, actorIRIs []*url.URL) (bool, error) {
+	return false, nil
+}
+
+func (a *testFederatingApp) FederatingCallbacks(c context.Context) (pub.FederatingWrappedCallbacks, []interface{}, error) {
+	return pub.FederatingWrappedCallbacks{
+		Create: func(c context.Context, create vocab.ActivityStreamsCreate) error {
+			a.creates++
+			if a.creates <= a.failures {
+				return fmt.Errorf("test error")
+			}
+			return nil
+		},
+	}, nil, nil
+}
+
+func (a *testFederatingApp) DefaultCallback(c context.Context, activity pub.Activity) error {
+	return nil
+}
+
+func (a *testFederatingApp) MaxInboxForwardingRecursionDepth(c context.Context) int {
+	return 1
+}
+
+func (a *testFederatingApp) MaxDeliveryRecursionDepth(c context.Context) int {
+	return 1
+}
+
+func (a *testFederatingApp) FilterForwarding(c context.Context, potentialRecipients []*url.URL, activity pub.Activity) ([]*url.URL, error) {
+	return nil, nil
+}
+
+func (a *testFederatingApp) GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestInboxWorker(t *testing.T) {
+	ctx := context.Background()
+	t.Run("RetriesSideEffectsOfActivityInInbox", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		_, err := db.CreatePerson(ctx, "alex")
+		assertEqual(t, err, nil)
+		q := pub.NewMemoryInboxQueue()
+		app := &testFederatingApp{failures: 1}
+		actor := pub.NewFederatingActor(app, app, db, testClock{}, pub.WithInboxQueue(q))
+		// Receive a Create of a Note.
+		create := streams.NewActivityStreamsCreate()
+		idp := streams.NewJSONLDIdProperty()
+		idp.Set(mustParse("https://other.example.com/create/1"))
+		create.SetJSONLDId(idp)
+		ap := streams.NewActivityStreamsActorProperty()
+		ap.AppendIRI(mustParse("https://other.example.com/sam"))
+		create.SetActivityStreamsActor(ap)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse("https://example.com/alex"))
+		create.SetActivityStreamsTo(to)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(newNote("https://other.example.com/note/1", "hello"))
+		create.SetActivityStreamsObject(op)
+		m, err := streams.Serialize(create)
+		assertEqual(t, err, nil)
+		b, err := json.Marshal(m)
+		assertEqual(t, err, nil)
+		req := httptest.NewRequest("POST", "https://example.com/alex/inbox", bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/activity+json")
+		resp := httptest.NewRecorder()
+		handled, err := actor.PostInbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		// The first attempt adds the Create to the inbox, but its
+		// callback fails.
+		w, err := pub.NewInboxWorker(q, actor, testClock{}, pub.DeliveryRetryPolicy{
+			Horizon:   time.Hour,
+			Lease:     time.Minute,
+			BatchSize: 10,
+		}, nil)
+		assertEqual(t, err, nil)
+		n, err := w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		assertEqual(t, app.creates, 1)
+		contains, err := db.InboxContains(ctx, mustParse("https://example.com/alex/inbox"), mustParse("https://other.example.com/create/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, contains, true)
+		// The retry calls the callback again, which then succeeds.
+		n, err = w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 1)
+		assertEqual(t, app.creates, 2)
+		// The job is processed, so it is not attempted again.
+		n, err = w.RunOnce(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 0)
+		assertEqual(t, app.creates, 2)
+	})
+}
+
+func TestSharedInbox(t *testing.T) {
+	ctx := context.Background()
+	t.Run("IgnoresActivityAlreadyReceived", func(t *testing.T) {
+		db := New(testScheme, testHost)
+		_, err := db.CreatePerson(ctx, "alex")
+		assertEqual(t, err, nil)
+		_, err = db.CreatePerson(ctx, "kim")
+		assertEqual(t, err, nil)
+		app := &testFederatingApp{}
+		actor := pub.NewFederatingActor(app, app, db, testClock{})
+		// Receive a Create of a Note addressed to both local actors.
+		create := streams.NewActivityStreamsCreate()
+		idp := streams.NewJSONLDIdProperty()
+		idp.Set(mustParse("https://other.example.com/create/1"))
+		create.SetJSONLDId(idp)
+		ap := streams.NewActivityStreamsActorProperty()
+		ap.AppendIRI(mustParse("https://other.example.com/sam"))
+		create.SetActivityStreamsActor(ap)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse("https://example.com/alex"))
+		to.AppendIRI(mustParse("https://example.com/kim"))
+		create.SetActivityStreamsTo(to)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(newNote("https://other.example.com/note/1", "hello"))
+		create.SetActivityStreamsObject(op)
+		m, err := streams.Serialize(create)
+		assertEqual(t, err, nil)
+		b, err := json.Marshal(m)
+		assertEqual(t, err, nil)
+		post := func() {
+			req := httptest.NewRequest("POST", "https://example.com/inbox", bytes.NewBuffer(b))
+			req.Header.Set("Content-Type", "application/activity+json")
+			resp := httptest.NewRecorder()
+			handled, err := actor.PostSharedInbox(ctx, resp, req)
+			assertEqual(t, err, nil)
+			assertEqual(t, handled, true)
+			assertEqual(t, resp.Code, http.StatusOK)
+		}
+		// Both inboxes receive the Create.
+		post()
+		assertEqual(t, app.creates, 2)
+		for _, inbox := range []string{"https://example.com/alex/inbox", "https://example.com/kim/inbox"} {
+			contains, err := db.InboxContains(ctx, mustParse(inbox), mustParse("https://other.example.com/create/1"))
+			assertEqual(t, err, nil)
+			assertEqual(t, contains, true)
+		}
+		exists, err := db.Exists(ctx, mustParse("https://other.example.com/note/1"))
+		assertEqual(t, err, nil)
+		assertEqual(t, exists, true)
+		// Receiving it again posts it to no inbox.
+		post()
+		assertEqual(t, app.creates, 2)
+	})
+}
+
+// testRouter is an HttpClient serving requests with the handler of the host
+// they are sent to, refusing those nested too deeply.
+type testRouter struct {
+	handlers map[string]pub.HandlerFunc
+	depth    int
+}
+
+func (r *testRouter) Do(req *http.Request) (*http.Response, error) {
+	if r.depth >= 4 {
+		return nil, fmt.Errorf("requests nested too deeply")
+	}
+	r.depth++
+	defer func() { r.depth-- }()
+	resp := httptest.NewRecorder()
+	isASRequest, err := r.handlers[req.URL.Host](req.Context(), resp, req)
+	if err == pub.ErrNotFound || !isASRequest {
+		resp.WriteHeader(http.StatusNotFound)
+	} else if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+	}
+	return resp.Result(), nil
+}
+
+// testPeer is an application of a server whose Transports sign as its actor.
+type testPeer struct {
+	testSocialApp
+	transport pub.Transport
+}
+
+func (p testPeer) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return p.transport, nil
+}
+
+// newAuthorizedFetchPeer creates a server on the host with the actor 'alex',
+// serving values in authorized fetch mode. It returns the Transport signing as
+// 'alex'.
+func newAuthorizedFetchPeer(t *testing.T, host string, router *testRouter) (*Database, pub.Transport) {
+	ctx := context.Background()
+	db := New(testScheme, host)
+	person, err := db.CreatePerson(ctx, "alex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actorIRI, err := pub.GetId(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyId := actorIRI.String() + "#main-key"
+	pk := streams.NewW3IDSecurityV1PublicKey()
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(mustParse(keyId))
+	pk.SetJSONLDId(idp)
+	owner := streams.NewW3IDSecurityV1OwnerProperty()
+	owner.Set(actorIRI)
+	pk.SetW3IDSecurityV1Owner(owner)
+	pemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	pemProp.Set(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	pk.SetW3IDSecurityV1PublicKeyPem(pemProp)
+	pkp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pkp.AppendW3IDSecurityV1PublicKey(pk)
+	person.SetW3IDSecurityV1PublicKey(pkp)
+	if err = db.Update(ctx, person); err != nil {
+		t.Fatal(err)
+	}
+	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
+	getSigner, _, err := httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{"(request-target)", "date"}, httpsig.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postSigner, _, err := httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{"(request-target)", "date", "digest"}, httpsig.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := pub.NewHttpSigTransport(router, "memdb", testClock{}, getSigner, postSigner, keyId, key)
+	app := testPeer{transport: tp}
+	v := pub.NewHttpSigVerifier(db, app, testClock{}, mustParse(actorIRI.String()+"/inbox"))
+	router.handlers[host] = pub.NewActivityStreamsHandler(db, testClock{}, pub.WithAuthorizedFetch(v, nil))
+	return db, tp
+}
+
+func TestAuthorizedFetch(t *testing.T) {
+	ctx := context.Background()
+	t.Run("VerifiesPeersInAuthorizedFetchMode", func(t *testing.T) {
+		router := &testRouter{handlers: make(map[string]pub.HandlerFunc)}
+		_, tpA := newAuthorizedFetchPeer(t, "a.example.com", router)
+		dbB, _ := newAuthorizedFetchPeer(t, "b.example.com", router)
+		// A Note on B addressed to the actor of A.
+		note := newNote("https://b.example.com/note/1", "hello")
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse("https://a.example.com/alex"))
+		note.SetActivityStreamsTo(to)
+		assertEqual(t, dbB.Create(ctx, note), nil)
+		// B fetches the key of A with a request signed by B, which A
+		// serves without verifying it.
+		b, err := tpA.Dereference(ctx, mustParse("https://b.example.com/note/1"))
+		assertEqual(t, err, nil)
+		var m map[string]interface{}
+		assertEqual(t, json.Unmarshal(b, &m), nil)
+		assertEqual(t, m["id"], "https://b.example.com/note/1")
+	})
+}
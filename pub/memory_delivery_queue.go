@@ -0,0 +1,122 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeliveryQueue must be implemented by MemoryDeliveryQueue.
+var _ DeliveryQueue = &MemoryDeliveryQueue{}
+
+// MemoryDeliveryQueue is a DeliveryQueue that keeps its jobs in memory.
+//
+// Pending deliveries are lost when the process exits. Use a FileDeliveryQueue
+// or an application-specific DeliveryQueue for durability.
+type MemoryDeliveryQueue struct {
+	mu   *sync.Mutex
+	jobs map[string]DeliveryJob
+}
+
+// NewMemoryDeliveryQueue returns an empty in-memory queue.
+func NewMemoryDeliveryQueue() *MemoryDeliveryQueue {
+	return &MemoryDeliveryQueue{
+		mu:   &sync.Mutex{},
+		jobs: make(map[string]DeliveryJob),
+	}
+}
+
+// Enqueue adds the jobs to the queue.
+func (m *MemoryDeliveryQueue) Enqueue(c context.Context, jobs []DeliveryJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range jobs {
+		if _, ok := m.jobs[job.ID]; ok {
+			return fmt.Errorf("delivery job %q already exists", job.ID)
+		}
+	}
+	for _, job := range jobs {
+		m.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// Claim returns the due pending jobs, earliest first.
+func (m *MemoryDeliveryQueue) Claim(c context.Context, now time.Time, lease time.Duration, max int) ([]DeliveryJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := m.claim(now, lease, max)
+	return jobs, nil
+}
+
+// claim implements Claim, and must be called while holding the lock.
+func (m *MemoryDeliveryQueue) claim(now time.Time, lease time.Duration, max int) []DeliveryJob {
+	var due []DeliveryJob
+	for _, job := range m.jobs {
+		if job.Status == DeliveryPending && !job.NextAttempt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if max > 0 && len(due) > max {
+		due = due[:max]
+	}
+	for _, job := range due {
+		leased := job
+		leased.NextAttempt = now.Add(lease)
+		m.jobs[job.ID] = leased
+	}
+	return due
+}
+
+// Update replaces the stored job.
+func (m *MemoryDeliveryQueue) Update(c context.Context, job DeliveryJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[job.ID]; !ok {
+		return fmt.Errorf("delivery job %q does not exist", job.ID)
+	}
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// Jobs returns the jobs for an Activity, oldest first.
+func (m *MemoryDeliveryQueue) Jobs(c context.Context, activityIRI *url.URL) ([]DeliveryJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []DeliveryJob
+	for _, job := range m.jobs {
+		if job.ActivityIRI != nil && job.ActivityIRI.String() == activityIRI.String() {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs, nil
+}
+
+// Prune removes finished jobs last updated before the given time.
+func (m *MemoryDeliveryQueue) Prune(c context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(before)
+	return nil
+}
+
+// prune implements Prune, returning the removed job ids. It must be called
+// while holding the lock.
+func (m *MemoryDeliveryQueue) prune(before time.Time) (removed []string) {
+	for id, job := range m.jobs {
+		if job.Status != DeliveryPending && job.Updated.Before(before) {
+			delete(m.jobs, id)
+			removed = append(removed, id)
+		}
+	}
+	return
+}
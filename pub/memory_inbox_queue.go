@@ -0,0 +1,105 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InboxQueue must be implemented by MemoryInboxQueue.
+var _ InboxQueue = &MemoryInboxQueue{}
+
+// MemoryInboxQueue is an InboxQueue that keeps its jobs in memory.
+//
+// Received Activities not yet processed are lost when the process exits. Use a
+// FileInboxQueue or an application-specific InboxQueue for durability.
+type MemoryInboxQueue struct {
+	mu   *sync.Mutex
+	jobs map[string]InboxJob
+}
+
+// NewMemoryInboxQueue returns an empty in-memory queue.
+func NewMemoryInboxQueue() *MemoryInboxQueue {
+	return &MemoryInboxQueue{
+		mu:   &sync.Mutex{},
+		jobs: make(map[string]InboxJob),
+	}
+}
+
+// Enqueue adds the jobs to the queue.
+func (m *MemoryInboxQueue) Enqueue(c context.Context, jobs []InboxJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range jobs {
+		if _, ok := m.jobs[job.ID]; ok {
+			return fmt.Errorf("inbox job %q already exists", job.ID)
+		}
+	}
+	for _, job := range jobs {
+		m.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// Claim returns the due pending jobs, earliest first.
+func (m *MemoryInboxQueue) Claim(c context.Context, now time.Time, lease time.Duration, max int) ([]InboxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := m.claim(now, lease, max)
+	return jobs, nil
+}
+
+// claim implements Claim, and must be called while holding the lock.
+func (m *MemoryInboxQueue) claim(now time.Time, lease time.Duration, max int) []InboxJob {
+	var due []InboxJob
+	for _, job := range m.jobs {
+		if job.Status == InboxJobPending && !job.NextAttempt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if max > 0 && len(due) > max {
+		due = due[:max]
+	}
+	for _, job := range due {
+		leased := job
+		leased.NextAttempt = now.Add(lease)
+		m.jobs[job.ID] = leased
+	}
+	return due
+}
+
+// Update replaces the stored job.
+func (m *MemoryInboxQueue) Update(c context.Context, job InboxJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[job.ID]; !ok {
+		return fmt.Errorf("inbox job %q does not exist", job.ID)
+	}
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// Prune removes finished jobs last updated before the given time.
+func (m *MemoryInboxQueue) Prune(c context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(before)
+	return nil
+}
+
+// prune implements Prune, returning the removed job ids. It must be called
+// while holding the lock.
+func (m *MemoryInboxQueue) prune(before time.Time) (removed []string) {
+	for id, job := range m.jobs {
+		if job.Status != InboxJobPending && job.Updated.Before(before) {
+			delete(m.jobs, id)
+			removed = append(removed, id)
+		}
+	}
+	return
+}
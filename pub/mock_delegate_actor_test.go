@@ -141,6 +141,21 @@ func (mr *MockDelegateActorMockRecorder) InboxForwarding(c, inboxIRI, activity i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InboxForwarding", reflect.TypeOf((*MockDelegateActor)(nil).InboxForwarding), c, inboxIRI, activity)
 }
 
+// SharedInboxRecipients mocks base method
+func (m *MockDelegateActor) SharedInboxRecipients(c context.Context, activity Activity) ([]*url.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SharedInboxRecipients", c, activity)
+	ret0, _ := ret[0].([]*url.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SharedInboxRecipients indicates an expected call of SharedInboxRecipients
+func (mr *MockDelegateActorMockRecorder) SharedInboxRecipients(c, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SharedInboxRecipients", reflect.TypeOf((*MockDelegateActor)(nil).SharedInboxRecipients), c, activity)
+}
+
 // PostOutbox mocks base method
 func (m *MockDelegateActor) PostOutbox(c context.Context, a Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (bool, error) {
 	m.ctrl.T.Helper()
@@ -184,6 +199,21 @@ func (mr *MockDelegateActorMockRecorder) Deliver(c, outbox, activity interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deliver", reflect.TypeOf((*MockDelegateActor)(nil).Deliver), c, outbox, activity)
 }
 
+// DeleteActor mocks base method
+func (m *MockDelegateActor) DeleteActor(c context.Context, outbox *url.URL) (Activity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteActor", c, outbox)
+	ret0, _ := ret[0].(Activity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteActor indicates an expected call of DeleteActor
+func (mr *MockDelegateActorMockRecorder) DeleteActor(c, outbox interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteActor", reflect.TypeOf((*MockDelegateActor)(nil).DeleteActor), c, outbox)
+}
+
 // AuthenticatePostOutbox mocks base method
 func (m *MockDelegateActor) AuthenticatePostOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
 	m.ctrl.T.Helper()
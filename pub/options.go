@@ -0,0 +1,239 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	// DefaultMaxCollectionPages is the default limit on the number of pages
+	// of a collection that are dereferenced when resolving delivery
+	// recipients.
+	DefaultMaxCollectionPages = 100
+	// DefaultMaxCollectionItems is the default limit on the number of
+	// members of a collection that are resolved as delivery recipients.
+	DefaultMaxCollectionItems = 10000
+)
+
+// ActorOption configures optional behaviors of the Actors created by
+// NewSocialActor, NewFederatingActor, and NewActor.
+//
+// Omitting all options results in the default behaviors documented on each
+// constructor.
+type ActorOption func(o *actorOptions)
+
+// actorOptions is the set of optional behaviors configured by ActorOptions.
+type actorOptions struct {
+	// deliveryQueue, if non-nil, receives all outbound deliveries instead
+	// of delivering them while handling the request.
+	deliveryQueue DeliveryQueue
+	// publicKeyCache, if non-nil, has the keys of deleted actors evicted.
+	publicKeyCache PublicKeyCache
+	// inboxPages, if non-nil, obtains the pages of served inboxes.
+	inboxPages BoxPageFunc
+	// outboxPages, if non-nil, obtains the pages of served outboxes.
+	outboxPages BoxPageFunc
+	// boxPagesScheme is the scheme of the ids of paged inboxes and
+	// outboxes.
+	boxPagesScheme string
+	// maxCollectionPages limits the pages of a collection dereferenced
+	// when resolving delivery recipients.
+	maxCollectionPages int
+	// maxCollectionItems limits the members of a collection resolved as
+	// delivery recipients.
+	maxCollectionItems int
+	// localFollowers, if non-nil, determines the local followers of the
+	// actors of activities received in the shared inbox.
+	localFollowers LocalFollowersFunc
+	// inboxQueue, if non-nil, receives the activities posted to inboxes
+	// instead of processing them while handling the request.
+	inboxQueue InboxQueue
+	// payloadLimits bounds the bodies of POST requests.
+	payloadLimits PayloadLimits
+	// federationPolicy, if non-nil, determines how to federate with other
+	// servers by their host.
+	federationPolicy FederationPolicy
+	// threadFetcher, if non-nil, backfills the threads of received replies.
+	threadFetcher *ThreadFetcher
+	// knownSharedInboxes, if non-nil, determines the shared inboxes of the
+	// peers that interacted with a deleted local actor.
+	knownSharedInboxes KnownSharedInboxesFunc
+}
+
+// newActorOptions applies the given options to the default configuration.
+func newActorOptions(opts []ActorOption) actorOptions {
+	o := actorOptions{
+		maxCollectionPages: DefaultMaxCollectionPages,
+		maxCollectionItems: DefaultMaxCollectionItems,
+		payloadLimits:      DefaultPayloadLimits(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// pages returns the boxPages serving with the BoxPageFunc, or nil if it is
+// nil.
+func (o actorOptions) pages(fn BoxPageFunc, clock Clock) *boxPages {
+	if fn == nil {
+		return nil
+	}
+	return &boxPages{
+		fn:     fn,
+		scheme: o.boxPagesScheme,
+		clock:  clock,
+	}
+}
+
+// WithDeliveryQueue makes the Actor deliver federated Activities
+// asynchronously.
+//
+// Instead of sending Activities to peers while handling the PostOutbox,
+// Send, or inbox forwarding call, each recipient inbox becomes a DeliveryJob
+// persisted in the queue. A DeliveryWorker must be run by the application to
+// conduct the deliveries, retrying failed ones.
+func WithDeliveryQueue(q DeliveryQueue) ActorOption {
+	return func(o *actorOptions) {
+		o.deliveryQueue = q
+	}
+}
+
+// EvictPublicKeysOnDelete makes the Actor evict the keys of actors and keys
+// from the PublicKeyCache when a federated Delete of them is received.
+func EvictPublicKeysOnDelete(cache PublicKeyCache) ActorOption {
+	return func(o *actorOptions) {
+		o.publicKeyCache = cache
+	}
+}
+
+// WithBoxPages makes the Actor serve inboxes and outboxes a page at a time.
+//
+// A GET request to an inbox or outbox is answered with an OrderedCollection
+// with its totalItems and links to its first and last pages. Requests with
+// the "page=true" query parameter are answered with an OrderedCollectionPage
+// linking to the next and prev pages with the "max_id" and "min_id" query
+// parameters. The items of each page are obtained from the inbox or outbox
+// BoxPageFunc, instead of the single page returned by GetInbox or GetOutbox.
+//
+// The ids of the inboxes, outboxes, and their pages have the given scheme.
+// A nil BoxPageFunc keeps the default behavior for that kind of box.
+func WithBoxPages(scheme string, inbox, outbox BoxPageFunc) ActorOption {
+	return func(o *actorOptions) {
+		o.boxPagesScheme = scheme
+		o.inboxPages = inbox
+		o.outboxPages = outbox
+	}
+}
+
+// WithCollectionLimits limits how much of a remote Collection or
+// OrderedCollection is resolved when it is the recipient of a delivery.
+//
+// The members of a collection are found in its items, and in the items of its
+// pages, which are followed through its 'first' and then each page's 'next'
+// property. At most maxPages pages are dereferenced and at most maxItems
+// members are delivered to, per collection. Zero or negative numbers indicate
+// no limit. Without this option, DefaultMaxCollectionPages and
+// DefaultMaxCollectionItems apply.
+//
+// Collections nested within collections are further bounded by the
+// FederatingProtocol's MaxDeliveryRecursionDepth.
+func WithCollectionLimits(maxPages, maxItems int) ActorOption {
+	return func(o *actorOptions) {
+		o.maxCollectionPages = maxPages
+		o.maxCollectionItems = maxItems
+	}
+}
+
+// LocalFollowersFunc returns the inboxes of the local actors that follow the
+// actor with the given id.
+type LocalFollowersFunc func(c context.Context, actorIRI *url.URL) (inboxes []*url.URL, err error)
+
+// WithLocalFollowers determines the local recipients of activities received in
+// the shared inbox that are not only addressed to specific local actors.
+//
+// When such an activity is addressed to the public or to a collection that is
+// not ours, such as the followers of its actor, it is posted to the inboxes of
+// the local actors following its actor. Without this option, activities in the
+// shared inbox are only posted to the local actors they address directly.
+func WithLocalFollowers(fn LocalFollowersFunc) ActorOption {
+	return func(o *actorOptions) {
+		o.localFollowers = fn
+	}
+}
+
+// WithInboxQueue makes the Actor process the Activities it receives
+// asynchronously.
+//
+// Instead of posting an Activity to the inbox, triggering its side effects,
+// and doing inbox forwarding while handling the PostInbox or PostSharedInbox
+// call, the Activity is authenticated, validated, and authorized, persisted as
+// an InboxJob in the queue for each recipient inbox, and the peer receives a
+// 202 Accepted. An InboxWorker must be run by the application to process the
+// jobs, retrying failed ones.
+//
+// Only applies to Actors supporting the Federating Protocol.
+func WithInboxQueue(q InboxQueue) ActorOption {
+	return func(o *actorOptions) {
+		o.inboxQueue = q
+	}
+}
+
+// WithPayloadLimits bounds the size and structure of the bodies of the POST
+// requests to inboxes and outboxes. Without this option, DefaultPayloadLimits
+// apply.
+//
+// A request whose body exceeds the limits receives a 413 Request Entity Too
+// Large when it is too big, or a 400 Bad Request when its structure is beyond
+// the limits. A PayloadLimitError is then returned by PostInbox, PostOutbox, or
+// their variants, so that the application may log it.
+func WithPayloadLimits(l PayloadLimits) ActorOption {
+	return func(o *actorOptions) {
+		o.payloadLimits = l
+	}
+}
+
+// WithFederationPolicy applies the FederationPolicy to the federation with
+// other servers.
+//
+// Activities POSTed to inboxes by suspended servers receive a 403 Forbidden.
+// Nothing is delivered to suspended servers, and the activities of silenced
+// and suspended servers are not forwarded. The HostPolicy of each received
+// activity is available to the application with ReceivedHostPolicy.
+//
+// Only applies to Actors supporting the Federating Protocol. The GET requests
+// served by NewActivityStreamsHandler are configured separately.
+func WithFederationPolicy(p FederationPolicy) ActorOption {
+	return func(o *actorOptions) {
+		o.federationPolicy = p
+	}
+}
+
+// WithThreadFetcher backfills the thread of each reply federated in a Create,
+// when the object it replies to is not in the Database. The backfill runs in the
+// background, so that it does not delay handling the Create, for up to the
+// Timeout of the ThreadFetchPolicy, and is skipped when its MaxConcurrent
+// backfills are running.
+//
+// Only applies to Actors supporting the Federating Protocol.
+func WithThreadFetcher(f *ThreadFetcher) ActorOption {
+	return func(o *actorOptions) {
+		o.threadFetcher = f
+	}
+}
+
+// KnownSharedInboxesFunc returns the shared inboxes of the peers known to have
+// interacted with the local actor with the given id, such as the servers of the
+// actors it follows, or of those that replied to, liked or shared its content.
+type KnownSharedInboxesFunc func(c context.Context, actorIRI *url.URL) (sharedInboxes []*url.URL, err error)
+
+// WithKnownSharedInboxes determines the additional recipients of the Delete of a
+// local actor sent by DeleteActor. Without this option, the Delete is only
+// delivered to the followers of the deleted actor.
+//
+// Only applies to Actors supporting the Federating Protocol.
+func WithKnownSharedInboxes(fn KnownSharedInboxesFunc) ActorOption {
+	return func(o *actorOptions) {
+		o.knownSharedInboxes = fn
+	}
+}
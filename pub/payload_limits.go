@@ -0,0 +1,189 @@
+package pub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// PayloadLimits bounds the size and structure of the ActivityStreams payloads
+// received from peers and clients, so that a malicious one cannot exhaust
+// memory. Zero or negative numbers indicate no limit.
+//
+// The limits are enforced before the payload is deserialized with
+// streams.ToType.
+type PayloadLimits struct {
+	// MaxBytes is the maximum size of the payload.
+	MaxBytes int64
+	// MaxDepth is the maximum nesting depth of JSON objects and arrays.
+	MaxDepth int
+	// MaxArrayLength is the maximum number of entries of each JSON array,
+	// such as the values of a property.
+	MaxArrayLength int
+	// MaxObjects is the maximum number of JSON objects embedded within the
+	// payload, not counting the payload itself.
+	MaxObjects int
+}
+
+// DefaultPayloadLimits returns the limits applied unless configured otherwise:
+// 1 MiB payloads, nested up to 32 levels, with at most 5000 array entries and
+// 5000 embedded objects.
+func DefaultPayloadLimits() PayloadLimits {
+	return PayloadLimits{
+		MaxBytes:       1 << 20,
+		MaxDepth:       32,
+		MaxArrayLength: 5000,
+		MaxObjects:     5000,
+	}
+}
+
+// PayloadLimit identifies one of the PayloadLimits.
+type PayloadLimit int
+
+const (
+	// PayloadBytesLimit is the MaxBytes limit.
+	PayloadBytesLimit PayloadLimit = iota
+	// PayloadDepthLimit is the MaxDepth limit.
+	PayloadDepthLimit
+	// PayloadArrayLengthLimit is the MaxArrayLength limit.
+	PayloadArrayLengthLimit
+	// PayloadObjectsLimit is the MaxObjects limit.
+	PayloadObjectsLimit
+)
+
+// String returns a human-readable form of the limit.
+func (p PayloadLimit) String() string {
+	switch p {
+	case PayloadBytesLimit:
+		return "size"
+	case PayloadDepthLimit:
+		return "nesting depth"
+	case PayloadArrayLengthLimit:
+		return "array length"
+	case PayloadObjectsLimit:
+		return "embedded objects"
+	default:
+		return fmt.Sprintf("PayloadLimit(%d)", int(p))
+	}
+}
+
+// PayloadLimitError is returned when a payload exceeds one of the
+// PayloadLimits.
+type PayloadLimitError struct {
+	// Limit is the limit that was exceeded.
+	Limit PayloadLimit
+	// Max is the configured value of the limit.
+	Max int64
+}
+
+// Error describes the exceeded limit.
+func (e *PayloadLimitError) Error() string {
+	return fmt.Sprintf("payload exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// StatusCode is the HTTP status code of the response to a request whose body
+// exceeds the limit: 413 Request Entity Too Large for its size, and 400 Bad
+// Request for its structure.
+func (e *PayloadLimitError) StatusCode() int {
+	if e.Limit == PayloadBytesLimit {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// IsPayloadLimitError returns true if the error is due to a payload exceeding
+// one of the PayloadLimits.
+func IsPayloadLimitError(err error) bool {
+	_, ok := err.(*PayloadLimitError)
+	return ok
+}
+
+// read reads the payload, returning a PayloadLimitError if it exceeds one of
+// the limits. No more than MaxBytes plus one bytes are read.
+func (l PayloadLimits) read(r io.Reader) ([]byte, error) {
+	if l.MaxBytes > 0 {
+		r = io.LimitReader(r, l.MaxBytes+1)
+	}
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if l.MaxBytes > 0 && int64(len(raw)) > l.MaxBytes {
+		return nil, &PayloadLimitError{Limit: PayloadBytesLimit, Max: l.MaxBytes}
+	}
+	if err = l.check(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// check examines the structure of the JSON payload without deserializing it,
+// returning a PayloadLimitError if it exceeds one of the structural limits.
+//
+// Malformed JSON is left for json.Unmarshal to report.
+func (l PayloadLimits) check(raw []byte) error {
+	if l.MaxDepth <= 0 && l.MaxArrayLength <= 0 && l.MaxObjects <= 0 {
+		return nil
+	}
+	// arrayLengths tracks the number of entries of each array being
+	// decoded, or -1 for objects.
+	var arrayLengths []int
+	objects := 0
+	// addEntry counts a value within the innermost array, if any.
+	addEntry := func() error {
+		if n := len(arrayLengths); n > 0 && arrayLengths[n-1] >= 0 {
+			arrayLengths[n-1]++
+			if l.MaxArrayLength > 0 && arrayLengths[n-1] > l.MaxArrayLength {
+				return &PayloadLimitError{Limit: PayloadArrayLengthLimit, Max: int64(l.MaxArrayLength)}
+			}
+		}
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// Either the end of the payload, or malformed JSON.
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if err = addEntry(); err != nil {
+				return err
+			}
+			if tok == json.Delim('{') {
+				if len(arrayLengths) > 0 {
+					objects++
+				}
+				if l.MaxObjects > 0 && objects > l.MaxObjects {
+					return &PayloadLimitError{Limit: PayloadObjectsLimit, Max: int64(l.MaxObjects)}
+				}
+				arrayLengths = append(arrayLengths, -1)
+			} else {
+				arrayLengths = append(arrayLengths, 0)
+			}
+			if l.MaxDepth > 0 && len(arrayLengths) > l.MaxDepth {
+				return &PayloadLimitError{Limit: PayloadDepthLimit, Max: int64(l.MaxDepth)}
+			}
+		case json.Delim('}'), json.Delim(']'):
+			arrayLengths = arrayLengths[:len(arrayLengths)-1]
+		default:
+			if err = addEntry(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writePayloadLimitError responds to a request whose body exceeds the limits,
+// returning true if the error is a PayloadLimitError.
+func writePayloadLimitError(w http.ResponseWriter, err error) bool {
+	e, ok := err.(*PayloadLimitError)
+	if ok {
+		w.WriteHeader(e.StatusCode())
+	}
+	return ok
+}
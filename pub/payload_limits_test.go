@@ -0,0 +1,83 @@
+package pub
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPayloadLimits(t *testing.T) {
+	limits := PayloadLimits{
+		MaxBytes:       64,
+		MaxDepth:       3,
+		MaxArrayLength: 2,
+		MaxObjects:     2,
+	}
+	for _, tc := range []struct {
+		name    string
+		limits  PayloadLimits
+		payload string
+		// limit is the exceeded limit, or -1 if the payload is within
+		// the limits.
+		limit PayloadLimit
+	}{
+		{
+			name:    "AcceptsPayloadWithinLimits",
+			limits:  limits,
+			payload: `{"a":[1,2],"b":{"c":["d"]}}`,
+			limit:   -1,
+		},
+		{
+			name:    "RejectsTooManyBytes",
+			limits:  limits,
+			payload: `{"a":"` + strings.Repeat("x", 64) + `"}`,
+			limit:   PayloadBytesLimit,
+		},
+		{
+			name:    "RejectsTooDeep",
+			limits:  limits,
+			payload: `{"a":[[[1]]]}`,
+			limit:   PayloadDepthLimit,
+		},
+		{
+			name:    "RejectsTooLongArray",
+			limits:  limits,
+			payload: `{"a":[1,"2",{}]}`,
+			limit:   PayloadArrayLengthLimit,
+		},
+		{
+			name:    "RejectsTooManyObjects",
+			limits:  limits,
+			payload: `{"a":{},"b":{},"c":{}}`,
+			limit:   PayloadObjectsLimit,
+		},
+		{
+			name:    "AcceptsAnythingWithoutLimits",
+			limits:  PayloadLimits{},
+			payload: `{"a":{"b":{"c":{"d":[1,2,3,{},{},{}]}}}}`,
+			limit:   -1,
+		},
+		{
+			name:    "LeavesMalformedJSONToUnmarshal",
+			limits:  limits,
+			payload: `{"a":`,
+			limit:   -1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.limits.read(bytes.NewBufferString(tc.payload))
+			if tc.limit < 0 {
+				assertEqual(t, err, nil)
+				assertByteEqual(t, b, []byte(tc.payload))
+				return
+			}
+			assertEqual(t, IsPayloadLimitError(err), true)
+			assertEqual(t, err.(*PayloadLimitError).Limit, tc.limit)
+		})
+	}
+	t.Run("StatusCodes", func(t *testing.T) {
+		assertEqual(t, (&PayloadLimitError{Limit: PayloadBytesLimit}).StatusCode(), http.StatusRequestEntityTooLarge)
+		assertEqual(t, (&PayloadLimitError{Limit: PayloadDepthLimit}).StatusCode(), http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,376 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// vote records a Note replying to a Question owned by this server as a vote,
+// if the Note is named after one of the Question's options.
+//
+// The vote is added to the 'replies' collection of the chosen option, and the
+// option's 'totalItems' as well as the Question's 'votersCount' are updated.
+// Each actor may vote once for a 'oneOf' Question, and once per option for an
+// 'anyOf' Question. Votes are not recorded once the Question is 'closed' or
+// its 'endTime' has passed.
+//
+// The updated Question is then delivered to its recipients in an Update.
+//
+// The voter is the 'attributedTo' of the Note, which must be an actor of the
+// Create and share the host of the Note's id, so that a peer cannot vote on
+// behalf of actors of other servers.
+//
+// Votes are only recorded when received in the inbox of the Question's
+// author, so that a vote delivered to several local inboxes is counted once.
+func (w FederatingWrappedCallbacks) vote(c context.Context, a vocab.ActivityStreamsCreate, t vocab.Type) error {
+	if !streams.IsOrExtendsActivityStreamsNote(t) {
+		return nil
+	}
+	name, ok := singleName(t)
+	if !ok {
+		return nil
+	}
+	questionIRI := singleInReplyTo(t)
+	if questionIRI == nil {
+		return nil
+	}
+	voter := singleAttributedTo(t)
+	if voter == nil {
+		return nil
+	}
+	voteId, err := GetId(t)
+	if err != nil {
+		return err
+	}
+	actors, err := getActorIds(a)
+	if err != nil {
+		return err
+	} else if !containsIRI(actors, voter) || voter.Host != voteId.Host {
+		return nil
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	var update Activity
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err = func() error {
+		if err := w.db.Lock(c, questionIRI); err != nil {
+			return err
+		}
+		defer w.db.Unlock(c, questionIRI)
+		if owns, err := w.db.Owns(c, questionIRI); err != nil {
+			return err
+		} else if !owns {
+			return nil
+		}
+		qt, err := w.db.Get(c, questionIRI)
+		if err != nil {
+			return err
+		}
+		q, ok := qt.(vocab.ActivityStreamsQuestion)
+		if !ok {
+			return nil
+		}
+		if author := singleAttributedTo(q); author == nil || author.String() != actorIRI.String() {
+			return nil
+		}
+		if pollIsClosed(q, w.clock.Now()) {
+			return nil
+		}
+		options, oneOf := pollOptions(q)
+		var chosen vocab.Type
+		voters := make(map[string]bool)
+		for _, option := range options {
+			optionName, _ := singleName(option)
+			isChosen := optionName == name
+			if isChosen {
+				chosen = option
+			}
+			for _, id := range pollOptionVotes(option) {
+				if id.String() == voteId.String() {
+					// Already recorded.
+					return nil
+				}
+				v, err := w.voterOf(c, id)
+				if err != nil {
+					return err
+				} else if v == nil {
+					continue
+				}
+				voters[v.String()] = true
+				if v.String() == voter.String() && (oneOf || isChosen) {
+					return nil
+				}
+			}
+		}
+		if chosen == nil {
+			return nil
+		}
+		voters[voter.String()] = true
+		if err := addPollOptionVote(chosen, voteId); err != nil {
+			return err
+		}
+		votersCount := streams.NewTootVotersCountProperty()
+		votersCount.Set(len(voters))
+		q.SetTootVotersCount(votersCount)
+		if err := w.db.Update(c, q); err != nil {
+			return err
+		}
+		update, err = pollUpdate(c, q, actorIRI)
+		return err
+	}()
+	if err != nil || update == nil {
+		return err
+	}
+	if err := w.addNewIds(c, update); err != nil {
+		return err
+	}
+	return w.deliver(c, outboxIRI, update)
+}
+
+// voterOf returns the actor that cast the vote, or nil if the vote is not in
+// the database.
+func (w FederatingWrappedCallbacks) voterOf(c context.Context, voteId *url.URL) (*url.URL, error) {
+	if err := w.db.Lock(c, voteId); err != nil {
+		return nil, err
+	}
+	defer w.db.Unlock(c, voteId)
+	if exists, err := w.db.Exists(c, voteId); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, nil
+	}
+	t, err := w.db.Get(c, voteId)
+	if err != nil {
+		return nil, err
+	}
+	return singleAttributedTo(t), nil
+}
+
+// pollOptions returns the options of a Question, and whether each actor may
+// choose only one of them.
+func pollOptions(q vocab.ActivityStreamsQuestion) (options []vocab.Type, oneOf bool) {
+	if p := q.GetActivityStreamsOneOf(); p != nil && p.Len() > 0 {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			if t := iter.GetType(); t != nil {
+				options = append(options, t)
+			}
+		}
+		return options, true
+	}
+	if p := q.GetActivityStreamsAnyOf(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			if t := iter.GetType(); t != nil {
+				options = append(options, t)
+			}
+		}
+	}
+	return options, false
+}
+
+// isPollVote returns true if the type is a Note named after one of the options
+// of the Question.
+func isPollVote(q vocab.ActivityStreamsQuestion, t vocab.Type) bool {
+	if !streams.IsOrExtendsActivityStreamsNote(t) {
+		return false
+	}
+	name, ok := singleName(t)
+	if !ok {
+		return false
+	}
+	options, _ := pollOptions(q)
+	for _, option := range options {
+		if optionName, _ := singleName(option); optionName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pollIsClosed returns true if the Question no longer accepts votes.
+func pollIsClosed(q vocab.ActivityStreamsQuestion, now time.Time) bool {
+	if closed := q.GetActivityStreamsClosed(); closed != nil && closed.Len() > 0 {
+		return true
+	}
+	if end := q.GetActivityStreamsEndTime(); end != nil && end.IsXMLSchemaDateTime() {
+		return !now.Before(end.Get())
+	}
+	return false
+}
+
+// pollOptionVotes returns the ids of the votes recorded in the 'replies'
+// collection of a poll option.
+func pollOptionVotes(option vocab.Type) (ids []*url.URL) {
+	col := pollOptionReplies(option)
+	if col == nil || col.GetActivityStreamsItems() == nil {
+		return
+	}
+	items := col.GetActivityStreamsItems()
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		if id, err := ToId(iter); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// pollOptionReplies returns the embedded 'replies' collection of a poll option,
+// or nil if it has none.
+func pollOptionReplies(option vocab.Type) vocab.ActivityStreamsCollection {
+	r, ok := option.(replieser)
+	if !ok || r.GetActivityStreamsReplies() == nil {
+		return nil
+	}
+	return r.GetActivityStreamsReplies().GetActivityStreamsCollection()
+}
+
+// addPollOptionVote adds the vote to the 'replies' collection of the poll
+// option, creating it if needed, and updates its 'totalItems'.
+func addPollOptionVote(option vocab.Type, voteId *url.URL) error {
+	r, ok := option.(replieser)
+	if !ok {
+		return fmt.Errorf("poll option %T has no replies property", option)
+	}
+	col := pollOptionReplies(option)
+	if col == nil {
+		col = streams.NewActivityStreamsCollection()
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetActivityStreamsCollection(col)
+		r.SetActivityStreamsReplies(replies)
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		col.SetActivityStreamsItems(items)
+	}
+	items.AppendIRI(voteId)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(items.Len())
+	col.SetActivityStreamsTotalItems(totalItems)
+	return nil
+}
+
+// pollUpdate creates an Update of the Question by its author, addressed to the
+// Question's recipients.
+//
+// The votes are removed from the copy of the Question being delivered, so that
+// only the tallies are disclosed.
+func pollUpdate(c context.Context, q vocab.ActivityStreamsQuestion, actorIRI *url.URL) (Activity, error) {
+	m, err := streams.Serialize(q)
+	if err != nil {
+		return nil, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	tally, ok := t.(vocab.ActivityStreamsQuestion)
+	if !ok {
+		return nil, fmt.Errorf("a copied Question is a %T", t)
+	}
+	options, _ := pollOptions(tally)
+	for _, option := range options {
+		if col := pollOptionReplies(option); col != nil {
+			col.SetActivityStreamsItems(nil)
+		}
+	}
+	update := streams.NewActivityStreamsUpdate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	update.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendActivityStreamsQuestion(tally)
+	update.SetActivityStreamsObject(op)
+	if to := q.GetActivityStreamsTo(); to != nil {
+		updateTo := streams.NewActivityStreamsToProperty()
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return nil, err
+			}
+			updateTo.AppendIRI(id)
+		}
+		update.SetActivityStreamsTo(updateTo)
+	}
+	if cc := q.GetActivityStreamsCc(); cc != nil {
+		updateCc := streams.NewActivityStreamsCcProperty()
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return nil, err
+			}
+			updateCc.AppendIRI(id)
+		}
+		update.SetActivityStreamsCc(updateCc)
+	}
+	return update, nil
+}
+
+// singleName returns the 'name' of a type if it has exactly one plain string
+// name.
+func singleName(t vocab.Type) (string, bool) {
+	n, ok := t.(namer)
+	if !ok {
+		return "", false
+	}
+	name := n.GetActivityStreamsName()
+	if name == nil || name.Len() != 1 || !name.At(0).IsXMLSchemaString() {
+		return "", false
+	}
+	return name.At(0).GetXMLSchemaString(), true
+}
+
+// singleInReplyTo returns the 'inReplyTo' of a type if it has exactly one, or
+// nil.
+func singleInReplyTo(t vocab.Type) *url.URL {
+	r, ok := t.(inReplyToer)
+	if !ok {
+		return nil
+	}
+	irt := r.GetActivityStreamsInReplyTo()
+	if irt == nil || irt.Len() != 1 {
+		return nil
+	}
+	id, err := ToId(irt.At(0))
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// singleAttributedTo returns the 'attributedTo' of a type if it has exactly
+// one, or nil.
+func singleAttributedTo(t vocab.Type) *url.URL {
+	a, ok := t.(attributedToer)
+	if !ok {
+		return nil
+	}
+	at := a.GetActivityStreamsAttributedTo()
+	if at == nil || at.Len() != 1 {
+		return nil
+	}
+	id, err := ToId(at.At(0))
+	if err != nil {
+		return nil
+	}
+	return id
+}
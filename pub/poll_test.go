@@ -0,0 +1,316 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+func TestFederatedVote(t *testing.T) {
+	const (
+		testQuestionIRI = "https://example.com/question/1"
+		testVoteIRI     = "https://other.example.com/vote/1"
+		testVoteIRI2    = "https://other.example.com/vote/2"
+	)
+	ctx := context.Background()
+	newVoteFn := func(name string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testVoteIRI))
+		n.SetJSONLDId(id)
+		nameProp := streams.NewActivityStreamsNameProperty()
+		nameProp.AppendXMLSchemaString(name)
+		n.SetActivityStreamsName(nameProp)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testQuestionIRI))
+		n.SetActivityStreamsInReplyTo(irt)
+		at := streams.NewActivityStreamsAttributedToProperty()
+		at.AppendIRI(mustParse(testFederatedActorIRI))
+		n.SetActivityStreamsAttributedTo(at)
+		return n
+	}
+	newOptionFn := func(name string, votes ...string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		nameProp := streams.NewActivityStreamsNameProperty()
+		nameProp.AppendXMLSchemaString(name)
+		n.SetActivityStreamsName(nameProp)
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, v := range votes {
+			items.AppendIRI(mustParse(v))
+		}
+		col.SetActivityStreamsItems(items)
+		totalItems := streams.NewActivityStreamsTotalItemsProperty()
+		totalItems.Set(len(votes))
+		col.SetActivityStreamsTotalItems(totalItems)
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetActivityStreamsCollection(col)
+		n.SetActivityStreamsReplies(replies)
+		return n
+	}
+	newQuestionFn := func(oneOf bool, options ...vocab.ActivityStreamsNote) vocab.ActivityStreamsQuestion {
+		q := streams.NewActivityStreamsQuestion()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testQuestionIRI))
+		q.SetJSONLDId(id)
+		at := streams.NewActivityStreamsAttributedToProperty()
+		at.AppendIRI(mustParse(testPersonIRI))
+		q.SetActivityStreamsAttributedTo(at)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		q.SetActivityStreamsTo(to)
+		if oneOf {
+			p := streams.NewActivityStreamsOneOfProperty()
+			for _, o := range options {
+				p.AppendActivityStreamsNote(o)
+			}
+			q.SetActivityStreamsOneOf(p)
+		} else {
+			p := streams.NewActivityStreamsAnyOfProperty()
+			for _, o := range options {
+				p.AppendActivityStreamsNote(o)
+			}
+			q.SetActivityStreamsAnyOf(p)
+		}
+		return q
+	}
+	newVoterFn := func(voter string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		at := streams.NewActivityStreamsAttributedToProperty()
+		at.AppendIRI(mustParse(voter))
+		n.SetActivityStreamsAttributedTo(at)
+		return n
+	}
+	newCreateFn := func(actor string) vocab.ActivityStreamsCreate {
+		c := streams.NewActivityStreamsCreate()
+		actorProp := streams.NewActivityStreamsActorProperty()
+		actorProp.AppendIRI(mustParse(actor))
+		c.SetActivityStreamsActor(actorProp)
+		return c
+	}
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockClock *MockClock) {
+		mockDB = NewMockDatabase(ctl)
+		mockClock = NewMockClock(ctl)
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.db = mockDB
+		w.clock = mockClock
+		return
+	}
+	expectQuestionFn := func(mockDB *MockDatabase, q vocab.ActivityStreamsQuestion) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testQuestionIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testQuestionIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testQuestionIRI)).Return(q, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testQuestionIRI))
+	}
+	expectVoterFn := func(mockDB *MockDatabase, voteIRI, voter string) {
+		mockDB.EXPECT().Lock(ctx, mustParse(voteIRI))
+		mockDB.EXPECT().Exists(ctx, mustParse(voteIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(voteIRI)).Return(newVoterFn(voter), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(voteIRI))
+	}
+	t.Run("IgnoresNotesWithoutName", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		v := newVoteFn("Yes")
+		v.SetActivityStreamsName(nil)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), v)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresVoteAttributedToOtherActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI2), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresVoteWithIdOnOtherHost", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		v := newVoteFn("Yes")
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://evil.example/vote/1"))
+		v.SetJSONLDId(id)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), v)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresQuestionNotOwned", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testQuestionIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testQuestionIRI)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testQuestionIRI))
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RecordsVoteAndDeliversUpdate", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockClock := setupFn(ctl)
+		var gotOutbox *url.URL
+		var delivered Activity
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			gotOutbox = outboxIRI
+			delivered = activity
+			return nil
+		}
+		q := newQuestionFn(true, newOptionFn("Yes"), newOptionFn("No", testVoteIRI2))
+		expectQ := newQuestionFn(true, newOptionFn("Yes", testVoteIRI), newOptionFn("No", testVoteIRI2))
+		votersCount := streams.NewTootVotersCountProperty()
+		votersCount.Set(2)
+		expectQ.SetTootVotersCount(votersCount)
+		expectQuestionFn(mockDB, q)
+		mockClock.EXPECT().Now().Return(now())
+		expectVoterFn(mockDB, testVoteIRI2, testFederatedActorIRI2)
+		mockDB.EXPECT().Update(ctx, q)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertByteEqual(t, mustSerializeTallyToBytes(q), mustSerializeTallyToBytes(expectQ))
+		assertEqual(t, gotOutbox.String(), testMyOutboxIRI)
+		// The delivered tally does not disclose the votes.
+		tally := newQuestionFn(true, newOptionFn("Yes", testVoteIRI), newOptionFn("No", testVoteIRI2))
+		tally.SetTootVotersCount(votersCount)
+		options, _ := pollOptions(tally)
+		for _, option := range options {
+			pollOptionReplies(option).SetActivityStreamsItems(nil)
+		}
+		expectUpdate := streams.NewActivityStreamsUpdate()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		expectUpdate.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsQuestion(tally)
+		expectUpdate.SetActivityStreamsObject(op)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		expectUpdate.SetActivityStreamsTo(to)
+		assertByteEqual(t, mustSerializeTallyToBytes(delivered), mustSerializeTallyToBytes(expectUpdate))
+	})
+	t.Run("IgnoresSecondVoteInOneOf", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockClock := setupFn(ctl)
+		q := newQuestionFn(true, newOptionFn("Yes"), newOptionFn("No", testVoteIRI2))
+		expectQuestionFn(mockDB, q)
+		mockClock.EXPECT().Now().Return(now())
+		expectVoterFn(mockDB, testVoteIRI2, testFederatedActorIRI)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RecordsVoteForEachOptionInAnyOf", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockClock := setupFn(ctl)
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			return nil
+		}
+		q := newQuestionFn(false, newOptionFn("Yes"), newOptionFn("No", testVoteIRI2))
+		expectQ := newQuestionFn(false, newOptionFn("Yes", testVoteIRI), newOptionFn("No", testVoteIRI2))
+		votersCount := streams.NewTootVotersCountProperty()
+		votersCount.Set(1)
+		expectQ.SetTootVotersCount(votersCount)
+		expectQuestionFn(mockDB, q)
+		mockClock.EXPECT().Now().Return(now())
+		expectVoterFn(mockDB, testVoteIRI2, testFederatedActorIRI)
+		mockDB.EXPECT().Update(ctx, q)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertByteEqual(t, mustSerializeTallyToBytes(q), mustSerializeTallyToBytes(expectQ))
+	})
+	t.Run("IgnoresVoteAfterEndTime", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockClock := setupFn(ctl)
+		q := newQuestionFn(true, newOptionFn("Yes"), newOptionFn("No"))
+		endTime := streams.NewActivityStreamsEndTimeProperty()
+		endTime.Set(now().Add(-time.Minute))
+		q.SetActivityStreamsEndTime(endTime)
+		expectQuestionFn(mockDB, q)
+		mockClock.EXPECT().Now().Return(now())
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresVoteWhenClosed", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockClock := setupFn(ctl)
+		q := newQuestionFn(true, newOptionFn("Yes"), newOptionFn("No"))
+		closed := streams.NewActivityStreamsClosedProperty()
+		closed.AppendXMLSchemaBoolean(true)
+		q.SetActivityStreamsClosed(closed)
+		expectQuestionFn(mockDB, q)
+		mockClock.EXPECT().Now().Return(now())
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresVoteInOtherActorsInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		q := newQuestionFn(true, newOptionFn("Yes"), newOptionFn("No"))
+		q.GetActivityStreamsAttributedTo().SetIRI(0, mustParse(testServiceIRI))
+		expectQuestionFn(mockDB, q)
+		err := w.vote(ctx, newCreateFn(testFederatedActorIRI), newVoteFn("Yes"))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+}
+
+// mustSerializeTallyToBytes serializes a type containing a Question or panics.
+//
+// The '@context' is omitted as the order of the ActivityStreams and toot
+// vocabularies in it is not stable.
+func mustSerializeTallyToBytes(t vocab.Type) []byte {
+	m := mustSerialize(t)
+	delete(m, "@context")
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -115,3 +115,40 @@ type actorer interface {
 type appendIRIer interface {
 	AppendIRI(v *url.URL)
 }
+
+// publicKeyer is a type with a 'publicKey' property.
+type publicKeyer interface {
+	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+}
+
+// firster is an ActivityStreams type with a 'first' property
+type firster interface {
+	GetActivityStreamsFirst() vocab.ActivityStreamsFirstProperty
+}
+
+// nexter is an ActivityStreams type with a 'next' property
+type nexter interface {
+	GetActivityStreamsNext() vocab.ActivityStreamsNextProperty
+}
+
+// followerser is an ActivityStreams type with a 'followers' property
+type followerser interface {
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+}
+
+// unknownPropertieser is an ActivityStreams type with properties that are not
+// part of any known vocabulary.
+type unknownPropertieser interface {
+	GetUnknownProperties() map[string]interface{}
+}
+
+// namer is an ActivityStreams type with a 'name' property
+type namer interface {
+	GetActivityStreamsName() vocab.ActivityStreamsNameProperty
+}
+
+// replieser is an ActivityStreams type with a 'replies' property
+type replieser interface {
+	GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	SetActivityStreamsReplies(i vocab.ActivityStreamsRepliesProperty)
+}
@@ -11,38 +11,40 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 )
 
 const (
-	testMyInboxIRI            = "https://example.com/addison/inbox"
-	testMyOutboxIRI           = "https://example.com/addison/outbox"
-	testFederatedActivityIRI  = "https://other.example.com/activity/1"
-	testFederatedActivityIRI2 = "https://other.example.com/activity/2"
-	testFederatedActorIRI     = "https://other.example.com/dakota"
-	testFederatedActorIRI2    = "https://other.example.com/addison"
-	testFederatedActorIRI3    = "https://other.example.com/sam"
-	testFederatedActorIRI4    = "https://other.example.com/jessie"
-	testFederatedInboxIRI     = "https://other.example.com/dakota/inbox"
-	testFederatedInboxIRI2    = "https://other.example.com/addison/inbox"
-	testNoteId1               = "https://example.com/note/1"
-	testNoteId2               = "https://example.com/note/2"
-	testNewActivityIRI        = "https://example.com/new/1"
-	testNewActivityIRI2       = "https://example.com/new/2"
-	testNewActivityIRI3       = "https://example.com/new/3"
-	testToIRI                 = "https://maybe.example.com/to/1"
-	testToIRI2                = "https://maybe.example.com/to/2"
-	testCcIRI                 = "https://maybe.example.com/cc/1"
-	testCcIRI2                = "https://maybe.example.com/cc/2"
-	testAudienceIRI           = "https://maybe.example.com/audience/1"
-	testAudienceIRI2          = "https://maybe.example.com/audience/2"
-	testPersonIRI             = "https://maybe.example.com/person"
-	testServiceIRI            = "https://maybe.example.com/service"
-	testTagIRI                = "https://example.com/tag/1"
-	testTagIRI2               = "https://example.com/tag/2"
-	inReplyToIRI              = "https://example.com/inReplyTo/1"
-	inReplyToIRI2             = "https://example.com/inReplyTo/2"
+	testMyInboxIRI              = "https://example.com/addison/inbox"
+	testMyOutboxIRI             = "https://example.com/addison/outbox"
+	testFederatedActivityIRI    = "https://other.example.com/activity/1"
+	testFederatedActivityIRI2   = "https://other.example.com/activity/2"
+	testFederatedActorIRI       = "https://other.example.com/dakota"
+	testFederatedActorIRI2      = "https://other.example.com/addison"
+	testFederatedActorIRI3      = "https://other.example.com/sam"
+	testFederatedActorIRI4      = "https://other.example.com/jessie"
+	testFederatedInboxIRI       = "https://other.example.com/dakota/inbox"
+	testFederatedInboxIRI2      = "https://other.example.com/addison/inbox"
+	testFederatedSharedInboxIRI = "https://other.example.com/inbox"
+	testNoteId1                 = "https://example.com/note/1"
+	testNoteId2                 = "https://example.com/note/2"
+	testNewActivityIRI          = "https://example.com/new/1"
+	testNewActivityIRI2         = "https://example.com/new/2"
+	testNewActivityIRI3         = "https://example.com/new/3"
+	testToIRI                   = "https://maybe.example.com/to/1"
+	testToIRI2                  = "https://maybe.example.com/to/2"
+	testCcIRI                   = "https://maybe.example.com/cc/1"
+	testCcIRI2                  = "https://maybe.example.com/cc/2"
+	testAudienceIRI             = "https://maybe.example.com/audience/1"
+	testAudienceIRI2            = "https://maybe.example.com/audience/2"
+	testPersonIRI               = "https://maybe.example.com/person"
+	testServiceIRI              = "https://maybe.example.com/service"
+	testTagIRI                  = "https://example.com/tag/1"
+	testTagIRI2                 = "https://example.com/tag/2"
+	inReplyToIRI                = "https://example.com/inReplyTo/1"
+	inReplyToIRI2               = "https://example.com/inReplyTo/2"
 )
 
 // mustParse parses a URL or panics.
@@ -130,6 +132,8 @@ var (
 	testPerson vocab.ActivityStreamsPerson
 	// testMyPerson is my Person.
 	testMyPerson vocab.ActivityStreamsPerson
+	// testMyBlocks is the empty blocks Collection of my Person.
+	testMyBlocks vocab.ActivityStreamsCollection
 	// testFederatedPerson1 is a federated Person.
 	testFederatedPerson1 vocab.ActivityStreamsPerson
 	// testFederatedPerson2 is a federated Person.
@@ -366,6 +370,13 @@ func setupData() {
 		outbox.SetIRI(mustParse(testMyOutboxIRI))
 		testMyPerson.SetActivityStreamsOutbox(outbox)
 	}()
+	// testMyBlocks
+	func() {
+		testMyBlocks = streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testPersonIRI + "/blocks"))
+		testMyBlocks.SetJSONLDId(id)
+	}()
 	// testFederatedPerson1
 	func() {
 		testFederatedPerson1 = streams.NewActivityStreamsPerson()
@@ -499,6 +510,20 @@ func toDeserializedForm(t vocab.Type) vocab.Type {
 	return asValue
 }
 
+// withSharedInbox returns a copy of the actor whose endpoints have the given
+// sharedInbox.
+func withSharedInbox(t vocab.Type, sharedInbox string) vocab.Type {
+	m := mustSerialize(t)
+	m["endpoints"] = map[string]interface{}{
+		"sharedInbox": sharedInbox,
+	}
+	asValue, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		panic(err)
+	}
+	return asValue
+}
+
 // withNewId sets a new id property on the activity
 func withNewId(t vocab.Type) Activity {
 	a, ok := t.(Activity)
@@ -705,3 +730,42 @@ func newActivityWithId(id string) vocab.ActivityStreamsActivity {
 	a.SetJSONLDId(i)
 	return a
 }
+
+// lockingDatabase is a Database whose Lock and Unlock hold a mutex per IRI, as
+// real implementations do, so that locking an IRI twice blocks. The other
+// methods are deferred to the embedded Database.
+type lockingDatabase struct {
+	Database
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// newLockingDatabase wraps the Database, such as a mock.
+func newLockingDatabase(db Database) *lockingDatabase {
+	return &lockingDatabase{
+		Database: db,
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// Lock holds the mutex of the IRI.
+func (l *lockingDatabase) Lock(c context.Context, id *url.URL) error {
+	l.mu.Lock()
+	m, ok := l.locks[id.String()]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[id.String()] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return nil
+}
+
+// Unlock releases the mutex of the IRI.
+func (l *lockingDatabase) Unlock(c context.Context, id *url.URL) error {
+	l.mu.Lock()
+	m := l.locks[id.String()]
+	l.mu.Unlock()
+	m.Unlock()
+	return nil
+}
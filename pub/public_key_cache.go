@@ -0,0 +1,285 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// PublicKeyCache must be implemented by MemoryPublicKeyCache.
+var _ PublicKeyCache = &MemoryPublicKeyCache{}
+
+// PublicKeyCache must be implemented by DatabasePublicKeyCache.
+var _ PublicKeyCache = &DatabasePublicKeyCache{}
+
+// PublicKeyCache caches the PublicKeys of peers, so that verifying their HTTP
+// Signatures does not require dereferencing their actor on every request.
+//
+// It is used by an HttpSigVerifier configured with WithPublicKeyCache. Actors
+// configured with EvictPublicKeysOnDelete evict the keys of actors that are
+// federated as deleted.
+//
+// Implementations must be safe for concurrent use.
+//
+// The MemoryPublicKeyCache and DatabasePublicKeyCache are provided.
+type PublicKeyCache interface {
+	// Get returns the key with the given id, if it is cached and has not
+	// expired.
+	Get(c context.Context, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, found bool, err error)
+	// Set caches the key by its id, replacing any existing key.
+	Set(c context.Context, key vocab.W3IDSecurityV1PublicKey) error
+	// Evict removes the key with the given id, as well as all keys owned
+	// by the actor with the given id.
+	Evict(c context.Context, iri *url.URL) error
+}
+
+// publicKeyCacheEntry is a cached key and its expiry.
+type publicKeyCacheEntry struct {
+	key     vocab.W3IDSecurityV1PublicKey
+	owner   string
+	expires time.Time
+}
+
+// MemoryPublicKeyCache is a PublicKeyCache that keeps keys in memory.
+type MemoryPublicKeyCache struct {
+	clock Clock
+	ttl   time.Duration
+	mu    *sync.Mutex
+	keys  map[string]publicKeyCacheEntry
+}
+
+// NewMemoryPublicKeyCache returns an empty cache whose keys expire after the
+// ttl.
+func NewMemoryPublicKeyCache(clock Clock, ttl time.Duration) *MemoryPublicKeyCache {
+	return &MemoryPublicKeyCache{
+		clock: clock,
+		ttl:   ttl,
+		mu:    &sync.Mutex{},
+		keys:  make(map[string]publicKeyCacheEntry),
+	}
+}
+
+// Get returns the unexpired key with the given id.
+func (m *MemoryPublicKeyCache) Get(c context.Context, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, found bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.keys[keyId.String()]
+	if !ok {
+		return
+	}
+	if !m.clock.Now().Before(e.expires) {
+		delete(m.keys, keyId.String())
+		return
+	}
+	return e.key, true, nil
+}
+
+// Set caches the key until the ttl has passed.
+func (m *MemoryPublicKeyCache) Set(c context.Context, key vocab.W3IDSecurityV1PublicKey) error {
+	id, owner, err := publicKeyCacheIds(key)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[id.String()] = publicKeyCacheEntry{
+		key:     key,
+		owner:   owner,
+		expires: m.clock.Now().Add(m.ttl),
+	}
+	return nil
+}
+
+// Evict removes the key with the given id, and the keys owned by it.
+func (m *MemoryPublicKeyCache) Evict(c context.Context, iri *url.URL) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := iri.String()
+	for id, e := range m.keys {
+		if id == s || e.owner == s {
+			delete(m.keys, id)
+		}
+	}
+	return nil
+}
+
+// DatabasePublicKeyCache is a PublicKeyCache that stores keys in the
+// application's Database, by their id. The Database must therefore be able to
+// store PublicKeys, and treat key ids that differ only by fragment, such as
+// 'https://example.com/actor#main-key', as distinct from their actor.
+//
+// The expiry of keys is kept in memory. A key stored in the Database by an
+// earlier process, or another process sharing the Database, expires once the
+// ttl passes after it is first read by this cache. Likewise, evicting an
+// owner only evicts the keys this cache has read or set.
+type DatabasePublicKeyCache struct {
+	db      Database
+	clock   Clock
+	ttl     time.Duration
+	mu      *sync.Mutex
+	expires map[string]publicKeyCacheEntry
+}
+
+// NewDatabasePublicKeyCache returns a cache storing keys in the Database,
+// whose keys expire after the ttl.
+func NewDatabasePublicKeyCache(db Database, clock Clock, ttl time.Duration) *DatabasePublicKeyCache {
+	return &DatabasePublicKeyCache{
+		db:      db,
+		clock:   clock,
+		ttl:     ttl,
+		mu:      &sync.Mutex{},
+		expires: make(map[string]publicKeyCacheEntry),
+	}
+}
+
+// Get returns the unexpired key with the given id from the Database.
+func (d *DatabasePublicKeyCache) Get(c context.Context, keyId *url.URL) (key vocab.W3IDSecurityV1PublicKey, found bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	e, known := d.expires[keyId.String()]
+	if known && !now.Before(e.expires) {
+		err = d.delete(c, keyId)
+		return
+	}
+	err = d.db.Lock(c, keyId)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock is not deferred
+	exists, err := d.db.Exists(c, keyId)
+	if err != nil || !exists {
+		d.db.Unlock(c, keyId)
+		delete(d.expires, keyId.String())
+		return
+	}
+	t, err := d.db.Get(c, keyId)
+	d.db.Unlock(c, keyId)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return
+	}
+	key, found = t.(vocab.W3IDSecurityV1PublicKey)
+	if !found {
+		return
+	}
+	if !known {
+		_, owner, idErr := publicKeyCacheIds(key)
+		if idErr != nil {
+			found = false
+			return
+		}
+		d.expires[keyId.String()] = publicKeyCacheEntry{
+			owner:   owner,
+			expires: now.Add(d.ttl),
+		}
+	}
+	return
+}
+
+// Set stores the key in the Database until the ttl has passed.
+func (d *DatabasePublicKeyCache) Set(c context.Context, key vocab.W3IDSecurityV1PublicKey) error {
+	id, owner, err := publicKeyCacheIds(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = func() error {
+		if err := d.db.Lock(c, id); err != nil {
+			return err
+		}
+		defer d.db.Unlock(c, id)
+		exists, err := d.db.Exists(c, id)
+		if err != nil {
+			return err
+		} else if !exists {
+			return d.db.Create(c, key)
+		}
+		t, err := d.db.Get(c, id)
+		if err != nil {
+			return err
+		}
+		// Never overwrite anything but a key, in case the Database
+		// does not distinguish the key id from its actor.
+		if _, ok := t.(vocab.W3IDSecurityV1PublicKey); !ok {
+			return fmt.Errorf("cannot cache key %s: the Database has a value with its id that is not a key", id)
+		}
+		return d.db.Update(c, key)
+	}()
+	if err != nil {
+		return err
+	}
+	d.expires[id.String()] = publicKeyCacheEntry{
+		owner:   owner,
+		expires: d.clock.Now().Add(d.ttl),
+	}
+	return nil
+}
+
+// Evict deletes the key with the given id, and the keys owned by it, from the
+// Database.
+func (d *DatabasePublicKeyCache) Evict(c context.Context, iri *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := []*url.URL{iri}
+	s := iri.String()
+	for id, e := range d.expires {
+		if e.owner == s {
+			u, err := url.Parse(id)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, u)
+		}
+	}
+	for _, id := range ids {
+		if err := d.delete(c, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete removes the key from the Database, if present. It must be called
+// while holding the lock.
+func (d *DatabasePublicKeyCache) delete(c context.Context, keyId *url.URL) error {
+	delete(d.expires, keyId.String())
+	if err := d.db.Lock(c, keyId); err != nil {
+		return err
+	}
+	defer d.db.Unlock(c, keyId)
+	exists, err := d.db.Exists(c, keyId)
+	if err != nil || !exists {
+		return err
+	}
+	t, err := d.db.Get(c, keyId)
+	if err != nil {
+		return err
+	}
+	// Never delete anything but a key, in case the Database does not
+	// distinguish the key id from its actor.
+	if _, ok := t.(vocab.W3IDSecurityV1PublicKey); !ok {
+		return nil
+	}
+	return d.db.Delete(c, keyId)
+}
+
+// publicKeyCacheIds obtains the id and the owner of a key to cache.
+func publicKeyCacheIds(key vocab.W3IDSecurityV1PublicKey) (id *url.URL, owner string, err error) {
+	id, err = GetId(key)
+	if err != nil {
+		return
+	}
+	o := key.GetW3IDSecurityV1Owner()
+	if o == nil || !o.IsXMLSchemaAnyURI() {
+		err = fmt.Errorf("cannot cache key %s without an owner", id)
+		return
+	}
+	owner = o.Get().String()
+	return
+}
@@ -0,0 +1,227 @@
+package pub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestMemoryPublicKeyCache(t *testing.T) {
+	ctx := context.Background()
+	keyIRI := mustParse(testKeyId)
+	t.Run("GetsUnexpiredKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		c.EXPECT().Now().Return(now())
+		c.EXPECT().Now().Return(now().Add(time.Hour - time.Second))
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+		got, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, true)
+		assertEqual(t, got, key)
+	})
+	t.Run("ExpiresKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		c.EXPECT().Now().Return(now())
+		c.EXPECT().Now().Return(now().Add(time.Hour))
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+		_, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+	})
+	t.Run("EvictsKeyById", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		// Mock
+		c.EXPECT().Now().Return(now())
+		// Run & Verify
+		err := cache.Set(ctx, testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		assertEqual(t, err, nil)
+		err = cache.Evict(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		_, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+	})
+	t.Run("EvictsKeysByOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		otherKeyId := testFederatedActorIRI + "#main-key"
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(3)
+		// Run & Verify
+		err := cache.Set(ctx, testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey))
+		assertEqual(t, err, nil)
+		err = cache.Set(ctx, testPublicKey(otherKeyId, testFederatedActorIRI, testRSAKey))
+		assertEqual(t, err, nil)
+		err = cache.Evict(ctx, mustParse(testFederatedActorIRI2))
+		assertEqual(t, err, nil)
+		_, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+		_, found, err = cache.Get(ctx, mustParse(otherKeyId))
+		assertEqual(t, err, nil)
+		assertEqual(t, found, true)
+	})
+	t.Run("ErrorIfKeyHasNoOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		cache := NewMemoryPublicKeyCache(c, time.Hour)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		key.SetW3IDSecurityV1Owner(nil)
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertNotEqual(t, err, nil)
+	})
+}
+
+func TestDatabasePublicKeyCache(t *testing.T) {
+	ctx := context.Background()
+	keyIRI := mustParse(testKeyId)
+	setupFn := func(ctl *gomock.Controller) (cache *DatabasePublicKeyCache, db *MockDatabase, c *MockClock) {
+		db = NewMockDatabase(ctl)
+		c = NewMockClock(ctl)
+		cache = NewDatabasePublicKeyCache(db, c, time.Hour)
+		return
+	}
+	t.Run("CreatesKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, c := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		db.EXPECT().Lock(ctx, keyIRI)
+		db.EXPECT().Exists(ctx, keyIRI).Return(false, nil)
+		db.EXPECT().Create(ctx, key)
+		db.EXPECT().Unlock(ctx, keyIRI)
+		c.EXPECT().Now().Return(now())
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+	})
+	t.Run("UpdatesKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, c := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		old := testPublicKey(testKeyId, testFederatedActorIRI2, testOtherRSAKey)
+		// Mock
+		db.EXPECT().Lock(ctx, keyIRI)
+		db.EXPECT().Exists(ctx, keyIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, keyIRI).Return(old, nil)
+		db.EXPECT().Update(ctx, key)
+		db.EXPECT().Unlock(ctx, keyIRI)
+		c.EXPECT().Now().Return(now())
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotOverwriteActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, _ := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		db.EXPECT().Lock(ctx, keyIRI)
+		db.EXPECT().Exists(ctx, keyIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, keyIRI).Return(testSigningPerson(key), nil)
+		db.EXPECT().Unlock(ctx, keyIRI)
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("GetsPersistedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, c := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, keyIRI)
+		db.EXPECT().Exists(ctx, keyIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, keyIRI).Return(key, nil)
+		db.EXPECT().Unlock(ctx, keyIRI)
+		// Run & Verify
+		got, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, true)
+		assertEqual(t, got, key)
+	})
+	t.Run("DeletesExpiredKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, c := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		// Mock
+		db.EXPECT().Lock(ctx, keyIRI).Times(2)
+		db.EXPECT().Exists(ctx, keyIRI).Return(false, nil)
+		db.EXPECT().Create(ctx, key)
+		c.EXPECT().Now().Return(now())
+		c.EXPECT().Now().Return(now().Add(time.Hour))
+		db.EXPECT().Exists(ctx, keyIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, keyIRI).Return(key, nil)
+		db.EXPECT().Delete(ctx, keyIRI)
+		db.EXPECT().Unlock(ctx, keyIRI).Times(2)
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+		_, found, err := cache.Get(ctx, keyIRI)
+		assertEqual(t, err, nil)
+		assertEqual(t, found, false)
+	})
+	t.Run("EvictsKeysByOwner", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		cache, db, c := setupFn(ctl)
+		key := testPublicKey(testKeyId, testFederatedActorIRI2, testRSAKey)
+		actorIRI := mustParse(testFederatedActorIRI2)
+		// Mock
+		db.EXPECT().Lock(ctx, keyIRI).Times(2)
+		db.EXPECT().Exists(ctx, keyIRI).Return(false, nil)
+		db.EXPECT().Create(ctx, key)
+		c.EXPECT().Now().Return(now())
+		db.EXPECT().Lock(ctx, actorIRI)
+		db.EXPECT().Exists(ctx, actorIRI).Return(false, nil)
+		db.EXPECT().Unlock(ctx, actorIRI)
+		db.EXPECT().Exists(ctx, keyIRI).Return(true, nil)
+		db.EXPECT().Get(ctx, keyIRI).Return(key, nil)
+		db.EXPECT().Delete(ctx, keyIRI)
+		db.EXPECT().Unlock(ctx, keyIRI).Times(2)
+		// Run & Verify
+		err := cache.Set(ctx, key)
+		assertEqual(t, err, nil)
+		err = cache.Evict(ctx, actorIRI)
+		assertEqual(t, err, nil)
+	})
+}
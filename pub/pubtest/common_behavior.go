@@ -0,0 +1,124 @@
+package pubtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// testAgent is the go-fed user agent passed to NewTransport by the suite.
+const testAgent = "go-fed/activity pubtest"
+
+// NewCommonBehaviorFunc returns a new CommonBehavior under test, serving the
+// returned LocalActor.
+type NewCommonBehaviorFunc func(t *testing.T) (pub.CommonBehavior, LocalActor)
+
+// commonBehaviorCase is a single guarantee of a CommonBehavior.
+type commonBehaviorCase struct {
+	name string
+	fn   func(t *testing.T, cb pub.CommonBehavior, a LocalActor)
+}
+
+// commonBehaviorCases are the guarantees documented on the
+// pub.CommonBehavior interface.
+var commonBehaviorCases = []commonBehaviorCase{
+	{"AuthenticatesGetInbox", testAuthenticatesGetInbox},
+	{"AuthenticatesGetOutbox", testAuthenticatesGetOutbox},
+	{"GetsOutbox", testGetsOutbox},
+	{"CreatesTransports", testCreatesTransports},
+}
+
+// TestCommonBehavior runs the conformance suite for a pub.CommonBehavior
+// implementation.
+//
+// Each case is run as a subtest against a new CommonBehavior obtained from
+// newCommonBehavior. Requests made by the suite carry no credentials, so
+// whether they are authenticated is up to the implementation; the suite only
+// checks that the outcome is reported consistently.
+func TestCommonBehavior(t *testing.T, newCommonBehavior NewCommonBehaviorFunc) {
+	for _, tc := range commonBehaviorCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cb, a := newCommonBehavior(t)
+			tc.fn(t, cb, a)
+		})
+	}
+}
+
+// authenticateFunc is either AuthenticateGetInbox or AuthenticateGetOutbox.
+type authenticateFunc func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error)
+
+// testAuthenticates verifies the contract between the returned values of an
+// authenticateFunc and what it writes to the ResponseWriter.
+func testAuthenticates(t *testing.T, name string, fn authenticateFunc, iri string) {
+	r := httptest.NewRequest("GET", iri, nil)
+	r.Header.Set("Accept", "application/activity+json")
+	w := httptest.NewRecorder()
+	c, authenticated, err := fn(context.Background(), w, r)
+	switch {
+	case err != nil:
+		if w.Code != http.StatusOK || w.Body.Len() > 0 || len(w.Header()) > 0 {
+			t.Fatalf("%s wrote a response and returned an error: %s", name, err)
+		}
+	case !authenticated:
+		if w.Code == http.StatusOK && w.Body.Len() == 0 && len(w.Header()) == 0 {
+			t.Fatalf("%s did not authenticate but wrote no response", name)
+		}
+	default:
+		if c == nil {
+			t.Fatalf("%s authenticated but returned a nil context", name)
+		}
+		if w.Body.Len() > 0 || w.Flushed {
+			t.Fatalf("%s authenticated but wrote a response", name)
+		}
+	}
+}
+
+func testAuthenticatesGetInbox(t *testing.T, cb pub.CommonBehavior, a LocalActor) {
+	testAuthenticates(t, "AuthenticateGetInbox", cb.AuthenticateGetInbox, a.Inbox.String())
+}
+
+func testAuthenticatesGetOutbox(t *testing.T, cb pub.CommonBehavior, a LocalActor) {
+	testAuthenticates(t, "AuthenticateGetOutbox", cb.AuthenticateGetOutbox, a.Outbox.String())
+}
+
+func testGetsOutbox(t *testing.T, cb pub.CommonBehavior, a LocalActor) {
+	r := httptest.NewRequest("GET", a.Outbox.String(), nil)
+	r.Header.Set("Accept", "application/activity+json")
+	w := httptest.NewRecorder()
+	c, authenticated, err := cb.AuthenticateGetOutbox(context.Background(), w, r)
+	if err != nil || !authenticated {
+		t.Skip("AuthenticateGetOutbox does not authenticate requests without credentials")
+	}
+	page, err := cb.GetOutbox(c, r)
+	if err != nil {
+		t.Fatalf("GetOutbox: %s", err)
+	} else if page == nil {
+		t.Fatalf("GetOutbox returned a nil page")
+	}
+	if _, err := streams.Serialize(page); err != nil {
+		t.Fatalf("GetOutbox returned a page that cannot be serialized: %s", err)
+	}
+}
+
+func testCreatesTransports(t *testing.T, cb pub.CommonBehavior, a LocalActor) {
+	for _, box := range []struct {
+		name string
+		iri  *url.URL
+	}{
+		{"inbox", a.Inbox},
+		{"outbox", a.Outbox},
+	} {
+		tp, err := cb.NewTransport(context.Background(), box.iri, testAgent)
+		if err != nil {
+			t.Fatalf("NewTransport for the %s: %s", box.name, err)
+		} else if tp == nil {
+			t.Fatalf("NewTransport for the %s returned a nil Transport", box.name)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package pubtest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// remoteHost is a host that no implementation under test owns.
+	remoteHost = "pubtest.invalid"
+	// lockContenders is the number of goroutines contending for one lock.
+	lockContenders = 20
+	// lockTimeout bounds how long a lock that must be available may take
+	// to acquire.
+	lockTimeout = 5 * time.Second
+)
+
+// LocalActor identifies an actor that is owned by the implementation under
+// test, and whose inbox and outbox it serves.
+type LocalActor struct {
+	// Actor is the id of the actor.
+	Actor *url.URL
+	// Inbox is the id of the actor's inbox.
+	Inbox *url.URL
+	// Outbox is the id of the actor's outbox.
+	Outbox *url.URL
+}
+
+// NewDatabaseFunc returns a new Database under test, which contains the
+// returned LocalActor and its followers, following, and liked collections
+// but is otherwise empty.
+type NewDatabaseFunc func(t *testing.T) (pub.Database, LocalActor)
+
+// databaseCase is a single guarantee of a Database.
+type databaseCase struct {
+	name string
+	fn   func(t *testing.T, db pub.Database, a LocalActor)
+}
+
+// databaseCases are the guarantees documented on the pub.Database interface.
+var databaseCases = []databaseCase{
+	{"LocksMissingId", testLocksMissingId},
+	{"LockExcludesConcurrentHolders", testLockExcludesConcurrentHolders},
+	{"LocksIdsIndependently", testLocksIdsIndependently},
+	{"CreatesAndGets", testCreatesAndGets},
+	{"CreatesTwice", testCreatesTwice},
+	{"Updates", testUpdates},
+	{"Deletes", testDeletes},
+	{"DoesNotHaveMissingId", testDoesNotHaveMissingId},
+	{"OwnsLocalIds", testOwnsLocalIds},
+	{"DoesNotOwnRemoteIds", testDoesNotOwnRemoteIds},
+	{"NewIDIsUnique", testNewIDIsUnique},
+	{"MapsActorBoxes", testMapsActorBoxes},
+	{"PrependsToInbox", testPrependsToInbox},
+	{"PrependsToOutbox", testPrependsToOutbox},
+	{"KeepsBoxItemsDependent", testKeepsBoxItemsDependent},
+	{"UpdatesFollowers", testUpdatesFollowers},
+	{"UpdatesFollowing", testUpdatesFollowing},
+	{"UpdatesLiked", testUpdatesLiked},
+	{"UpdatesBlocks", testUpdatesBlocks},
+}
+
+// TestDatabase runs the conformance suite for a pub.Database implementation.
+//
+// Each case is run as a subtest against a new Database obtained from newDB.
+// The suite acquires a lock before every call that the library makes only
+// after acquiring one.
+func TestDatabase(t *testing.T, newDB NewDatabaseFunc) {
+	for _, tc := range databaseCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, a := newDB(t)
+			tc.fn(t, db, a)
+		})
+	}
+}
+
+// withLock calls fn while holding the lock for id, failing the test if the
+// lock cannot be taken or released.
+func withLock(t *testing.T, db pub.Database, id *url.URL, fn func(c context.Context)) {
+	t.Helper()
+	c := context.Background()
+	if err := db.Lock(c, id); err != nil {
+		t.Fatalf("Lock(%s): %s", id, err)
+	}
+	fn(c)
+	if err := db.Unlock(c, id); err != nil {
+		t.Fatalf("Unlock(%s): %s", id, err)
+	}
+}
+
+// remoteIRI returns an IRI on a host not owned by the Database.
+func remoteIRI(path string) *url.URL {
+	return &url.URL{Scheme: "https", Host: remoteHost, Path: path}
+}
+
+// newNote returns a Note with the id and content.
+func newNote(id *url.URL, content string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(id)
+	n.SetJSONLDId(idp)
+	cp := streams.NewActivityStreamsContentProperty()
+	cp.AppendXMLSchemaString(content)
+	n.SetActivityStreamsContent(cp)
+	return n
+}
+
+// noteContent returns the content of a value expected to be a Note.
+func noteContent(t *testing.T, v vocab.Type) string {
+	t.Helper()
+	n, ok := v.(vocab.ActivityStreamsNote)
+	if !ok {
+		t.Fatalf("expected a Note, got %T", v)
+	}
+	cp := n.GetActivityStreamsContent()
+	if cp == nil || cp.Len() == 0 || !cp.At(0).IsXMLSchemaString() {
+		t.Fatalf("expected a Note with string content")
+	}
+	return cp.At(0).GetXMLSchemaString()
+}
+
+// createNote creates a Note with the id and content in the Database.
+func createNote(t *testing.T, db pub.Database, id *url.URL, content string) {
+	t.Helper()
+	withLock(t, db, id, func(c context.Context) {
+		if err := db.Create(c, newNote(id, content)); err != nil {
+			t.Fatalf("Create(%s): %s", id, err)
+		}
+	})
+}
+
+// exists returns whether the id exists in the Database.
+func exists(t *testing.T, db pub.Database, id *url.URL) (e bool) {
+	t.Helper()
+	withLock(t, db, id, func(c context.Context) {
+		var err error
+		if e, err = db.Exists(c, id); err != nil {
+			t.Fatalf("Exists(%s): %s", id, err)
+		}
+	})
+	return
+}
+
+// get returns the value of the id in the Database.
+func get(t *testing.T, db pub.Database, id *url.URL) (v vocab.Type) {
+	t.Helper()
+	withLock(t, db, id, func(c context.Context) {
+		var err error
+		if v, err = db.Get(c, id); err != nil {
+			t.Fatalf("Get(%s): %s", id, err)
+		}
+	})
+	return
+}
+
+// owns returns whether the Database owns the id.
+func owns(t *testing.T, db pub.Database, id *url.URL) (o bool) {
+	t.Helper()
+	withLock(t, db, id, func(c context.Context) {
+		var err error
+		if o, err = db.Owns(c, id); err != nil {
+			t.Fatalf("Owns(%s): %s", id, err)
+		}
+	})
+	return
+}
+
+// assertIRI fails the test if the IRIs differ.
+func assertIRI(t *testing.T, what string, got, want *url.URL) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("%s: got nil, want %s", what, want)
+	} else if got.String() != want.String() {
+		t.Fatalf("%s: got %s, want %s", what, got, want)
+	}
+}
+
+func testLocksMissingId(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/missing")
+	withLock(t, db, id, func(c context.Context) {})
+	// The lock must have been freed.
+	withLock(t, db, id, func(c context.Context) {})
+}
+
+func testLockExcludesConcurrentHolders(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/contended")
+	var holders, maxHolders int32
+	var wg sync.WaitGroup
+	for i := 0; i < lockContenders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := context.Background()
+			if err := db.Lock(c, id); err != nil {
+				t.Errorf("Lock(%s): %s", id, err)
+				return
+			}
+			n := atomic.AddInt32(&holders, 1)
+			for {
+				m := atomic.LoadInt32(&maxHolders)
+				if n <= m || atomic.CompareAndSwapInt32(&maxHolders, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			if err := db.Unlock(c, id); err != nil {
+				t.Errorf("Unlock(%s): %s", id, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(lockTimeout * lockContenders):
+		t.Fatalf("contended locks were never all acquired")
+	}
+	if maxHolders > 1 {
+		t.Fatalf("%d goroutines held the lock for %s at once", maxHolders, id)
+	}
+}
+
+func testLocksIdsIndependently(t *testing.T, db pub.Database, a LocalActor) {
+	held := remoteIRI("/held")
+	other := remoteIRI("/other")
+	withLock(t, db, held, func(c context.Context) {
+		errCh := make(chan error, 1)
+		go func() {
+			if err := db.Lock(c, other); err != nil {
+				errCh <- err
+				return
+			}
+			errCh <- db.Unlock(c, other)
+		}()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatalf("locking %s while %s is locked: %s", other, held, err)
+			}
+		case <-time.After(lockTimeout):
+			t.Fatalf("locking %s blocked while %s is locked", other, held)
+		}
+	})
+}
+
+func testCreatesAndGets(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/note/1")
+	createNote(t, db, id, "hello")
+	if !exists(t, db, id) {
+		t.Fatalf("created %s does not exist", id)
+	}
+	v := get(t, db, id)
+	got, err := pub.GetId(v)
+	if err != nil {
+		t.Fatalf("value of %s has no id: %s", id, err)
+	}
+	assertIRI(t, "id", got, id)
+	if c := noteContent(t, v); c != "hello" {
+		t.Fatalf("content: got %q, want %q", c, "hello")
+	}
+}
+
+func testCreatesTwice(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/note/1")
+	createNote(t, db, id, "hello")
+	createNote(t, db, id, "hello")
+	if c := noteContent(t, get(t, db, id)); c != "hello" {
+		t.Fatalf("content: got %q, want %q", c, "hello")
+	}
+}
+
+func testUpdates(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/note/1")
+	createNote(t, db, id, "hello")
+	withLock(t, db, id, func(c context.Context) {
+		if err := db.Update(c, newNote(id, "bye")); err != nil {
+			t.Fatalf("Update(%s): %s", id, err)
+		}
+	})
+	if c := noteContent(t, get(t, db, id)); c != "bye" {
+		t.Fatalf("content: got %q, want %q", c, "bye")
+	}
+}
+
+func testDeletes(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/note/1")
+	createNote(t, db, id, "hello")
+	withLock(t, db, id, func(c context.Context) {
+		if err := db.Delete(c, id); err != nil {
+			t.Fatalf("Delete(%s): %s", id, err)
+		}
+	})
+	if exists(t, db, id) {
+		t.Fatalf("deleted %s still exists", id)
+	}
+}
+
+func testDoesNotHaveMissingId(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/missing")
+	if exists(t, db, id) {
+		t.Fatalf("never created %s exists", id)
+	}
+	if owns(t, db, id) {
+		t.Fatalf("never created %s is owned", id)
+	}
+}
+
+func testOwnsLocalIds(t *testing.T, db pub.Database, a LocalActor) {
+	if !owns(t, db, a.Actor) {
+		t.Fatalf("local actor %s is not owned", a.Actor)
+	}
+	id, err := db.NewID(context.Background(), streams.NewActivityStreamsNote())
+	if err != nil {
+		t.Fatalf("NewID: %s", err)
+	}
+	createNote(t, db, id, "hello")
+	if !owns(t, db, id) {
+		t.Fatalf("created %s from NewID is not owned", id)
+	}
+}
+
+func testDoesNotOwnRemoteIds(t *testing.T, db pub.Database, a LocalActor) {
+	id := remoteIRI("/note/1")
+	createNote(t, db, id, "hello")
+	if owns(t, db, id) {
+		t.Fatalf("remote %s is owned", id)
+	}
+}
+
+func testNewIDIsUnique(t *testing.T, db pub.Database, a LocalActor) {
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		id, err := db.NewID(context.Background(), streams.NewActivityStreamsNote())
+		if err != nil {
+			t.Fatalf("NewID: %s", err)
+		} else if id == nil {
+			t.Fatalf("NewID returned a nil id")
+		} else if seen[id.String()] {
+			t.Fatalf("NewID returned %s twice", id)
+		}
+		seen[id.String()] = true
+	}
+}
+
+func testMapsActorBoxes(t *testing.T, db pub.Database, a LocalActor) {
+	withLock(t, db, a.Inbox, func(c context.Context) {
+		actor, err := db.ActorForInbox(c, a.Inbox)
+		if err != nil {
+			t.Fatalf("ActorForInbox(%s): %s", a.Inbox, err)
+		}
+		assertIRI(t, "ActorForInbox", actor, a.Actor)
+		outbox, err := db.OutboxForInbox(c, a.Inbox)
+		if err != nil {
+			t.Fatalf("OutboxForInbox(%s): %s", a.Inbox, err)
+		}
+		assertIRI(t, "OutboxForInbox", outbox, a.Outbox)
+	})
+	withLock(t, db, a.Outbox, func(c context.Context) {
+		actor, err := db.ActorForOutbox(c, a.Outbox)
+		if err != nil {
+			t.Fatalf("ActorForOutbox(%s): %s", a.Outbox, err)
+		}
+		assertIRI(t, "ActorForOutbox", actor, a.Actor)
+	})
+	withLock(t, db, a.Actor, func(c context.Context) {
+		inbox, err := db.InboxForActor(c, a.Actor)
+		if err != nil {
+			t.Fatalf("InboxForActor(%s): %s", a.Actor, err)
+		}
+		// Returning nil is acceptable, as the library then dereferences
+		// the actor instead.
+		if inbox != nil {
+			assertIRI(t, "InboxForActor", inbox, a.Inbox)
+		}
+	})
+}
+
+// boxFuncs are the accessors for either the inbox or the outbox.
+type boxFuncs struct {
+	get func(c context.Context, boxIRI *url.URL) (vocab.ActivityStreamsOrderedCollectionPage, error)
+	set func(c context.Context, page vocab.ActivityStreamsOrderedCollectionPage) error
+}
+
+// prependToBox prepends the item to the first page of the box.
+func prependToBox(t *testing.T, db pub.Database, f boxFuncs, boxIRI, item *url.URL) {
+	t.Helper()
+	withLock(t, db, boxIRI, func(c context.Context) {
+		page, err := f.get(c, boxIRI)
+		if err != nil {
+			t.Fatalf("getting %s: %s", boxIRI, err)
+		} else if page == nil {
+			t.Fatalf("getting %s returned a nil page", boxIRI)
+		}
+		oi := page.GetActivityStreamsOrderedItems()
+		if oi == nil {
+			oi = streams.NewActivityStreamsOrderedItemsProperty()
+			page.SetActivityStreamsOrderedItems(oi)
+		}
+		oi.PrependIRI(item)
+		if err := f.set(c, page); err != nil {
+			t.Fatalf("setting %s: %s", boxIRI, err)
+		}
+	})
+}
+
+// boxItems returns the ids of the items on the first page of the box.
+func boxItems(t *testing.T, db pub.Database, f boxFuncs, boxIRI *url.URL) (items []string) {
+	t.Helper()
+	withLock(t, db, boxIRI, func(c context.Context) {
+		page, err := f.get(c, boxIRI)
+		if err != nil {
+			t.Fatalf("getting %s: %s", boxIRI, err)
+		} else if page == nil {
+			t.Fatalf("getting %s returned a nil page", boxIRI)
+		}
+		oi := page.GetActivityStreamsOrderedItems()
+		if oi == nil {
+			return
+		}
+		for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				t.Fatalf("item in %s has no id: %s", boxIRI, err)
+			}
+			items = append(items, id.String())
+		}
+	})
+	return
+}
+
+// testPrependsToBox verifies that items prepended to the first page of a box
+// are kept in order, ahead of any items that were already present.
+func testPrependsToBox(t *testing.T, db pub.Database, f boxFuncs, boxIRI *url.URL) {
+	before := boxItems(t, db, f, boxIRI)
+	first := remoteIRI("/activity/1")
+	second := remoteIRI("/activity/2")
+	prependToBox(t, db, f, boxIRI, first)
+	prependToBox(t, db, f, boxIRI, second)
+	got := boxItems(t, db, f, boxIRI)
+	want := append([]string{second.String(), first.String()}, before...)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("items of %s: got %v, want %v", boxIRI, got, want)
+	}
+}
+
+func testPrependsToInbox(t *testing.T, db pub.Database, a LocalActor) {
+	item := remoteIRI("/activity/0")
+	withLock(t, db, a.Inbox, func(c context.Context) {
+		contains, err := db.InboxContains(c, a.Inbox, item)
+		if err != nil {
+			t.Fatalf("InboxContains(%s, %s): %s", a.Inbox, item, err)
+		} else if contains {
+			t.Fatalf("empty inbox %s contains %s", a.Inbox, item)
+		}
+	})
+	f := boxFuncs{db.GetInbox, db.SetInbox}
+	prependToBox(t, db, f, a.Inbox, item)
+	withLock(t, db, a.Inbox, func(c context.Context) {
+		contains, err := db.InboxContains(c, a.Inbox, item)
+		if err != nil {
+			t.Fatalf("InboxContains(%s, %s): %s", a.Inbox, item, err)
+		} else if !contains {
+			t.Fatalf("inbox %s does not contain prepended %s", a.Inbox, item)
+		}
+	})
+	testPrependsToBox(t, db, f, a.Inbox)
+}
+
+func testPrependsToOutbox(t *testing.T, db pub.Database, a LocalActor) {
+	testPrependsToBox(t, db, boxFuncs{db.GetOutbox, db.SetOutbox}, a.Outbox)
+	// The outbox must not share items with the inbox.
+	item := remoteIRI("/activity/2")
+	withLock(t, db, a.Inbox, func(c context.Context) {
+		contains, err := db.InboxContains(c, a.Inbox, item)
+		if err != nil {
+			t.Fatalf("InboxContains(%s, %s): %s", a.Inbox, item, err)
+		} else if contains {
+			t.Fatalf("inbox %s contains %s from the outbox", a.Inbox, item)
+		}
+	})
+}
+
+func testKeepsBoxItemsDependent(t *testing.T, db pub.Database, a LocalActor) {
+	item := remoteIRI("/activity/1")
+	prependToBox(t, db, boxFuncs{db.GetInbox, db.SetInbox}, a.Inbox, item)
+	prependToBox(t, db, boxFuncs{db.GetOutbox, db.SetOutbox}, a.Outbox, item)
+	if exists(t, db, item) {
+		t.Fatalf("prepended %s was added as an independent entry", item)
+	}
+}
+
+// testUpdatesCollection verifies that a modified actor collection is saved by
+// calling Update.
+func testUpdatesCollection(t *testing.T, db pub.Database, actorIRI *url.URL, name string, fn func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error)) {
+	item := remoteIRI("/actor")
+	withLock(t, db, actorIRI, func(c context.Context) {
+		col, err := fn(c, actorIRI)
+		if err != nil {
+			t.Fatalf("%s(%s): %s", name, actorIRI, err)
+		} else if col == nil {
+			t.Fatalf("%s(%s) returned a nil collection", name, actorIRI)
+		}
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			items = streams.NewActivityStreamsItemsProperty()
+			col.SetActivityStreamsItems(items)
+		}
+		items.AppendIRI(item)
+		if err := db.Update(c, col); err != nil {
+			t.Fatalf("Update of %s(%s): %s", name, actorIRI, err)
+		}
+	})
+	withLock(t, db, actorIRI, func(c context.Context) {
+		col, err := fn(c, actorIRI)
+		if err != nil {
+			t.Fatalf("%s(%s): %s", name, actorIRI, err)
+		}
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			t.Fatalf("%s(%s) has no items after Update", name, actorIRI)
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil && id.String() == item.String() {
+				return
+			}
+		}
+		t.Fatalf("%s(%s) does not contain %s after Update", name, actorIRI, item)
+	})
+}
+
+func testUpdatesFollowers(t *testing.T, db pub.Database, a LocalActor) {
+	testUpdatesCollection(t, db, a.Actor, "Followers", db.Followers)
+}
+
+func testUpdatesFollowing(t *testing.T, db pub.Database, a LocalActor) {
+	testUpdatesCollection(t, db, a.Actor, "Following", db.Following)
+}
+
+func testUpdatesLiked(t *testing.T, db pub.Database, a LocalActor) {
+	testUpdatesCollection(t, db, a.Actor, "Liked", db.Liked)
+}
+
+func testUpdatesBlocks(t *testing.T, db pub.Database, a LocalActor) {
+	bdb, ok := db.(pub.BlocksDatabase)
+	if !ok {
+		t.Skip("the Database is not a pub.BlocksDatabase")
+	}
+	testUpdatesCollection(t, db, a.Actor, "Blocks", bdb.Blocks)
+}
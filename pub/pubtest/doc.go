@@ -0,0 +1,14 @@
+// Package pubtest provides conformance test suites for implementations of the
+// interfaces that package pub depends on.
+//
+// Each suite exercises the guarantees documented on its interface, so that an
+// application's implementation can be checked from its own tests:
+//
+//	func TestMyDatabase(t *testing.T) {
+//	    pubtest.TestDatabase(t, newMyDB)
+//	}
+//
+// Every case runs as a subtest against a value freshly returned from the
+// constructor, so implementations backed by shared storage should isolate or
+// reset that storage in the constructor.
+package pubtest
@@ -0,0 +1,105 @@
+package pubtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/memdb"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+)
+
+// testClock is a Clock at the current time.
+type testClock struct{}
+
+func (testClock) Now() time.Time {
+	return time.Now()
+}
+
+// newHttpSigTransport returns a HttpSigTransport signing with a new key.
+func newHttpSigTransport(t *testing.T) pub.Transport {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
+	getSigner, _, err := httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{"(request-target)", "date"}, httpsig.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postSigner, _, err := httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{"(request-target)", "date", "digest"}, httpsig.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub.NewHttpSigTransport(
+		&http.Client{},
+		"pubtest",
+		testClock{},
+		getSigner,
+		postSigner,
+		"https://example.com/alex#main-key",
+		key)
+}
+
+// testCommonBehavior serves outboxes publicly from a memdb.Database, and
+// inboxes only to requests with an Authorization header.
+type testCommonBehavior struct {
+	db *memdb.Database
+}
+
+func (b testCommonBehavior) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return c, false, nil
+	}
+	return c, true, nil
+}
+
+func (b testCommonBehavior) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+func (b testCommonBehavior) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	return b.db.GetOutbox(c, r.URL)
+}
+
+func (b testCommonBehavior) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return &pub.HttpSigTransport{}, nil
+}
+
+// newMemDB returns a memdb.Database with a single local actor.
+func newMemDB(t *testing.T) (*memdb.Database, LocalActor) {
+	db := memdb.New("https", "example.com")
+	person, err := db.CreatePerson(context.Background(), "alex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, LocalActor{
+		Actor:  person.GetJSONLDId().Get(),
+		Inbox:  person.GetActivityStreamsInbox().GetIRI(),
+		Outbox: person.GetActivityStreamsOutbox().GetIRI(),
+	}
+}
+
+func TestHttpSigTransportConformance(t *testing.T) {
+	TestTransport(t, newHttpSigTransport)
+}
+
+func TestMemDBConformance(t *testing.T) {
+	TestDatabase(t, func(t *testing.T) (pub.Database, LocalActor) {
+		return newMemDB(t)
+	})
+}
+
+func TestCommonBehaviorConformance(t *testing.T) {
+	TestCommonBehavior(t, func(t *testing.T) (pub.CommonBehavior, LocalActor) {
+		db, a := newMemDB(t)
+		return testCommonBehavior{db}, a
+	})
+}
@@ -0,0 +1,243 @@
+package pubtest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// NewTransportFunc returns a new Transport under test. It must be able to make
+// plain HTTP requests to the test servers the suite starts on the loopback
+// interface.
+type NewTransportFunc func(t *testing.T) pub.Transport
+
+// testActivity is the ActivityStreams payload served and delivered by the
+// Transport suite.
+const testActivity = `{"@context":"https://www.w3.org/ns/activitystreams","id":"https://pubtest.invalid/activity/1","type":"Create"}`
+
+// transportCase is a single guarantee of a Transport.
+type transportCase struct {
+	name string
+	fn   func(t *testing.T, tp pub.Transport)
+}
+
+// transportCases are the guarantees documented on the pub.Transport
+// interface.
+var transportCases = []transportCase{
+	{"DereferencesActivityStreams", testDereferencesActivityStreams},
+	{"DereferenceReturnsHttpStatusError", testDereferenceReturnsHttpStatusError},
+	{"Delivers", testDelivers},
+	{"DeliverReturnsHttpStatusError", testDeliverReturnsHttpStatusError},
+	{"BatchDeliversToEveryRecipient", testBatchDeliversToEveryRecipient},
+	{"BatchDeliverReturnsError", testBatchDeliverReturnsError},
+}
+
+// TestTransport runs the conformance suite for a pub.Transport
+// implementation.
+//
+// Each case is run as a subtest against a new Transport obtained from
+// newTransport.
+func TestTransport(t *testing.T, newTransport NewTransportFunc) {
+	for _, tc := range transportCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newTransport(t))
+		})
+	}
+}
+
+// recordedRequest is a request received by a test server.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// recorder is a test server that records every request it receives and
+// responds with a fixed status and body.
+type recorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+// newRecorder starts a recorder responding with the status and body.
+func newRecorder(status int, body string) *recorder {
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, recordedRequest{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Header: req.Header,
+			Body:   b,
+		})
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	return r
+}
+
+// iri returns the IRI of the path on the recorder.
+func (r *recorder) iri(t *testing.T, path string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(r.URL + path)
+	if err != nil {
+		t.Fatalf("parsing test server IRI: %s", err)
+	}
+	return u
+}
+
+// received returns the requests received so far.
+func (r *recorder) received() []recordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedRequest(nil), r.requests...)
+}
+
+// isActivityStreamsMediaType returns true if the header value names an
+// ActivityStreams media type.
+func isActivityStreamsMediaType(v string) bool {
+	return strings.Contains(v, "application/activity+json") ||
+		(strings.Contains(v, "application/ld+json") &&
+			strings.Contains(v, "https://www.w3.org/ns/activitystreams"))
+}
+
+// assertHttpStatusError fails the test if err is not an HttpStatusError for
+// the status code and IRI.
+func assertHttpStatusError(t *testing.T, err error, code int, iri *url.URL) {
+	t.Helper()
+	e, ok := err.(*pub.HttpStatusError)
+	if !ok {
+		t.Fatalf("expected a *pub.HttpStatusError, got %T: %v", err, err)
+	}
+	if e.StatusCode != code {
+		t.Fatalf("StatusCode: got %d, want %d", e.StatusCode, code)
+	}
+	assertIRI(t, "IRI", e.IRI, iri)
+}
+
+func testDereferencesActivityStreams(t *testing.T, tp pub.Transport) {
+	srv := newRecorder(http.StatusOK, testActivity)
+	defer srv.Close()
+	iri := srv.iri(t, "/activity/1")
+	b, err := tp.Dereference(context.Background(), iri)
+	if err != nil {
+		t.Fatalf("Dereference(%s): %s", iri, err)
+	}
+	if string(b) != testActivity {
+		t.Fatalf("body: got %q, want %q", b, testActivity)
+	}
+	reqs := srv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].Method != http.MethodGet {
+		t.Fatalf("method: got %s, want GET", reqs[0].Method)
+	}
+	if reqs[0].Path != iri.Path {
+		t.Fatalf("path: got %s, want %s", reqs[0].Path, iri.Path)
+	}
+	if a := reqs[0].Header.Get("Accept"); !isActivityStreamsMediaType(a) {
+		t.Fatalf("Accept header %q does not request ActivityStreams", a)
+	}
+}
+
+func testDereferenceReturnsHttpStatusError(t *testing.T, tp pub.Transport) {
+	for _, code := range []int{http.StatusNotFound, http.StatusGone, http.StatusInternalServerError} {
+		srv := newRecorder(code, "")
+		iri := srv.iri(t, "/activity/1")
+		_, err := tp.Dereference(context.Background(), iri)
+		srv.Close()
+		assertHttpStatusError(t, err, code, iri)
+	}
+}
+
+func testDelivers(t *testing.T, tp pub.Transport) {
+	srv := newRecorder(http.StatusOK, "")
+	defer srv.Close()
+	iri := srv.iri(t, "/inbox")
+	if err := tp.Deliver(context.Background(), []byte(testActivity), iri); err != nil {
+		t.Fatalf("Deliver(%s): %s", iri, err)
+	}
+	reqs := srv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].Method != http.MethodPost {
+		t.Fatalf("method: got %s, want POST", reqs[0].Method)
+	}
+	if reqs[0].Path != iri.Path {
+		t.Fatalf("path: got %s, want %s", reqs[0].Path, iri.Path)
+	}
+	if ct := reqs[0].Header.Get("Content-Type"); !isActivityStreamsMediaType(ct) {
+		t.Fatalf("Content-Type header %q is not ActivityStreams", ct)
+	}
+	if !bytes.Equal(reqs[0].Body, []byte(testActivity)) {
+		t.Fatalf("body: got %q, want %q", reqs[0].Body, testActivity)
+	}
+}
+
+func testDeliverReturnsHttpStatusError(t *testing.T, tp pub.Transport) {
+	for _, code := range []int{http.StatusUnauthorized, http.StatusGone, http.StatusInternalServerError} {
+		srv := newRecorder(code, "")
+		iri := srv.iri(t, "/inbox")
+		err := tp.Deliver(context.Background(), []byte(testActivity), iri)
+		srv.Close()
+		assertHttpStatusError(t, err, code, iri)
+	}
+}
+
+func testBatchDeliversToEveryRecipient(t *testing.T, tp pub.Transport) {
+	srv := newRecorder(http.StatusAccepted, "")
+	defer srv.Close()
+	paths := []string{"/alex/inbox", "/sam/inbox", "/kim/inbox"}
+	var recipients []*url.URL
+	for _, p := range paths {
+		recipients = append(recipients, srv.iri(t, p))
+	}
+	if err := tp.BatchDeliver(context.Background(), []byte(testActivity), recipients); err != nil {
+		t.Fatalf("BatchDeliver: %s", err)
+	}
+	var got []string
+	for _, r := range srv.received() {
+		if r.Method != http.MethodPost {
+			t.Fatalf("method: got %s, want POST", r.Method)
+		}
+		if !bytes.Equal(r.Body, []byte(testActivity)) {
+			t.Fatalf("body: got %q, want %q", r.Body, testActivity)
+		}
+		got = append(got, r.Path)
+	}
+	sort.Strings(got)
+	sort.Strings(paths)
+	if strings.Join(got, ",") != strings.Join(paths, ",") {
+		t.Fatalf("delivered to %v, want %v", got, paths)
+	}
+}
+
+func testBatchDeliverReturnsError(t *testing.T, tp pub.Transport) {
+	ok := newRecorder(http.StatusOK, "")
+	defer ok.Close()
+	failing := newRecorder(http.StatusInternalServerError, "")
+	defer failing.Close()
+	recipients := []*url.URL{ok.iri(t, "/inbox"), failing.iri(t, "/inbox")}
+	if err := tp.BatchDeliver(context.Background(), []byte(testActivity), recipients); err == nil {
+		t.Fatalf("expected an error when a delivery fails, got none")
+	}
+	if len(ok.received()) != 1 {
+		t.Fatalf("a failing recipient prevented delivery to the others")
+	}
+}
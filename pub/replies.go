@@ -0,0 +1,173 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// addReply adds the reply to the 'replies' collection of each object owned by
+// this server that it is in reply to. An object without a 'replies' collection
+// gets an embedded Collection.
+//
+// Votes in a local Question are not added, as they are recorded in the
+// 'replies' of the chosen option instead.
+func addReply(c context.Context, db Database, reply vocab.Type) error {
+	id, err := GetId(reply)
+	if err != nil {
+		return err
+	}
+	for _, parentIRI := range getInReplyToIds(reply) {
+		err = updateReplies(c, db, parentIRI, reply, true, func(col vocab.Type) bool {
+			return prependCollectionItem(col, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReply removes the reply from the 'replies' collection of each object
+// owned by this server that it is in reply to.
+func removeReply(c context.Context, db Database, reply vocab.Type) error {
+	id, err := GetId(reply)
+	if err != nil {
+		return err
+	}
+	for _, parentIRI := range getInReplyToIds(reply) {
+		err = updateReplies(c, db, parentIRI, reply, false, func(col vocab.Type) bool {
+			return removeCollectionItems(col, []*url.URL{id})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateReplies applies the change to the 'replies' collection of the parent
+// object, if it is owned by this server. The collection is either embedded in
+// the parent or referred to by its IRI, and is created if missing and create is
+// true.
+//
+// The change returns true if it modified the collection.
+func updateReplies(c context.Context,
+	db Database,
+	parentIRI *url.URL,
+	reply vocab.Type,
+	create bool,
+	change func(col vocab.Type) bool) error {
+	var colIRI *url.URL
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err := func() error {
+		if err := db.Lock(c, parentIRI); err != nil {
+			return err
+		}
+		defer db.Unlock(c, parentIRI)
+		if owns, err := db.Owns(c, parentIRI); err != nil {
+			return err
+		} else if !owns {
+			return nil
+		}
+		t, err := db.Get(c, parentIRI)
+		if err != nil {
+			return err
+		}
+		if q, ok := t.(vocab.ActivityStreamsQuestion); ok && isPollVote(q, reply) {
+			return nil
+		}
+		r, ok := t.(replieser)
+		if !ok {
+			return nil
+		}
+		replies := r.GetActivityStreamsReplies()
+		if replies == nil || (!replies.IsIRI() && replies.GetType() == nil) {
+			if !create {
+				return nil
+			}
+			replies = streams.NewActivityStreamsRepliesProperty()
+			replies.SetActivityStreamsCollection(streams.NewActivityStreamsCollection())
+			r.SetActivityStreamsReplies(replies)
+		}
+		if replies.IsIRI() {
+			colIRI = replies.GetIRI()
+			return nil
+		}
+		if change(replies.GetType()) {
+			return db.Update(c, t)
+		}
+		return nil
+	}()
+	if err != nil || colIRI == nil {
+		return err
+	}
+	if err = db.Lock(c, colIRI); err != nil {
+		return err
+	}
+	defer db.Unlock(c, colIRI)
+	if owns, err := db.Owns(c, colIRI); err != nil {
+		return err
+	} else if !owns {
+		return nil
+	}
+	col, err := db.Get(c, colIRI)
+	if err != nil {
+		return err
+	}
+	if change(col) {
+		return db.Update(c, col)
+	}
+	return nil
+}
+
+// prependCollectionItem prepends the id to the items of a Collection or
+// OrderedCollection, returning true unless it is already an item.
+func prependCollectionItem(t vocab.Type, id *url.URL) bool {
+	if oi, ok := t.(orderedItemser); ok {
+		oItems := oi.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			oItems = streams.NewActivityStreamsOrderedItemsProperty()
+			oi.SetActivityStreamsOrderedItems(oItems)
+		}
+		for iter := oItems.Begin(); iter != oItems.End(); iter = iter.Next() {
+			if itemId, err := ToId(iter); err == nil && itemId.String() == id.String() {
+				return false
+			}
+		}
+		oItems.PrependIRI(id)
+		return true
+	} else if it, ok := t.(itemser); ok {
+		items := it.GetActivityStreamsItems()
+		if items == nil {
+			items = streams.NewActivityStreamsItemsProperty()
+			it.SetActivityStreamsItems(items)
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if itemId, err := ToId(iter); err == nil && itemId.String() == id.String() {
+				return false
+			}
+		}
+		items.PrependIRI(id)
+		return true
+	}
+	return false
+}
+
+// getInReplyToIds returns the ids of the 'inReplyTo' property of a type.
+func getInReplyToIds(t vocab.Type) (ids []*url.URL) {
+	r, ok := t.(inReplyToer)
+	if !ok || r.GetActivityStreamsInReplyTo() == nil {
+		return
+	}
+	irt := r.GetActivityStreamsInReplyTo()
+	for iter := irt.Begin(); iter != irt.End(); iter = iter.Next() {
+		if id, err := ToId(iter); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package pub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+// TestReplies ensures replies are added to and removed from the 'replies' of
+// local objects.
+func TestReplies(t *testing.T) {
+	ctx := context.Background()
+	newReplyFn := func() vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId2))
+		n.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId1))
+		n.SetActivityStreamsInReplyTo(irt)
+		return n
+	}
+	newRepliesFn := func(ids ...string) vocab.ActivityStreamsRepliesProperty {
+		replies := streams.NewActivityStreamsRepliesProperty()
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		replies.SetActivityStreamsCollection(col)
+		return replies
+	}
+	t.Run("SkipsUnownedObjects", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := addReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+	t.Run("AddsToNewRepliesCollection", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		note := streams.NewActivityStreamsNote()
+		expectNote := streams.NewActivityStreamsNote()
+		expectNote.SetActivityStreamsReplies(newRepliesFn(testNoteId2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Update(ctx, expectNote).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := addReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotAddExistingReply", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		note := streams.NewActivityStreamsNote()
+		note.SetActivityStreamsReplies(newRepliesFn(testNoteId2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := addReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+	t.Run("AddsToRepliesCollectionByIRI", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		note := streams.NewActivityStreamsNote()
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetIRI(mustParse(testNoteId1 + "/replies"))
+		note.SetActivityStreamsReplies(replies)
+		col := streams.NewActivityStreamsOrderedCollection()
+		expectCol := streams.NewActivityStreamsOrderedCollection()
+		expectItems := streams.NewActivityStreamsOrderedItemsProperty()
+		expectItems.AppendIRI(mustParse(testNoteId2))
+		expectCol.SetActivityStreamsOrderedItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1+"/replies"))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1+"/replies")).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1+"/replies")).Return(col, nil)
+		mockDB.EXPECT().Update(ctx, expectCol).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1+"/replies"))
+		err := addReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotAddPollVotes", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		q := streams.NewActivityStreamsQuestion()
+		oneOf := streams.NewActivityStreamsOneOfProperty()
+		option := streams.NewActivityStreamsNote()
+		optionName := streams.NewActivityStreamsNameProperty()
+		optionName.AppendXMLSchemaString("Yes")
+		option.SetActivityStreamsName(optionName)
+		oneOf.AppendActivityStreamsNote(option)
+		q.SetActivityStreamsOneOf(oneOf)
+		vote := newReplyFn()
+		name := streams.NewActivityStreamsNameProperty()
+		name.AppendXMLSchemaString("Yes")
+		vote.SetActivityStreamsName(name)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(q, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := addReply(ctx, mockDB, vote)
+		assertEqual(t, err, nil)
+	})
+	t.Run("RemovesReply", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		note := streams.NewActivityStreamsNote()
+		note.SetActivityStreamsReplies(newRepliesFn(testNoteId2, testFederatedActivityIRI))
+		expectNote := streams.NewActivityStreamsNote()
+		expectNote.SetActivityStreamsReplies(newRepliesFn(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDB.EXPECT().Update(ctx, expectNote).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := removeReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotCreateRepliesOnRemove", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(streams.NewActivityStreamsNote(), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := removeReply(ctx, mockDB, newReplyFn())
+		assertEqual(t, err, nil)
+	})
+}
@@ -0,0 +1,437 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// defaultResolverTTL is how long the Resolver caches values whose
+	// responses have no max-age.
+	defaultResolverTTL = 5 * time.Minute
+	// defaultResolverMaxEntries is the number of values the Resolver
+	// caches.
+	defaultResolverMaxEntries = 1024
+)
+
+// resolverEmbeddedProperties are the properties whose IRIs are replaced by the
+// values they identify, when the Resolver has a maximum depth.
+var resolverEmbeddedProperties = []string{
+	"actor",
+	"attributedTo",
+	"inReplyTo",
+	"object",
+	"target",
+}
+
+// OriginMismatchError is returned by the Resolver when a peer responds with a
+// value whose id is not on the origin of the IRI it was dereferenced from. The
+// value is discarded, as the peer may be forging it.
+type OriginMismatchError struct {
+	// IRI is the dereferenced IRI.
+	IRI *url.URL
+	// Id is the id of the value, or nil if the value has none.
+	Id *url.URL
+}
+
+// Error describes the mismatch.
+func (e *OriginMismatchError) Error() string {
+	if e.Id == nil {
+		return fmt.Sprintf("value dereferenced from %s has no id", e.IRI)
+	}
+	return fmt.Sprintf("value dereferenced from %s has id %s of another origin", e.IRI, e.Id)
+}
+
+// resolverCacheKey identifies a cached response of a peer.
+type resolverCacheKey struct {
+	iri string
+	// box is the box whose actor dereferenced the response, and is empty
+	// for responses that may be shared between actors.
+	box string
+}
+
+// resolverCacheEntry is a cached response of a peer.
+type resolverCacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// Resolver obtains the ActivityStreams values identified by IRIs, such as the
+// object of an Announce, the object being replied to, or an actor.
+//
+// Values in the Database are returned from it. Others are dereferenced from
+// peers on behalf of an actor, and cached in memory for as long as their
+// Cache-Control header allows, or the TTL if it does not say. Expired values
+// with an ETag are revalidated with a conditional request when the Transport is
+// a ConditionalTransport.
+//
+// As a signed request may obtain a value only visible to the actor making it,
+// cached values are only returned to the same actor, unless the response was
+// marked 'public' or the request was not signed.
+//
+// A dereferenced value whose id is not on the origin of its IRI is refused with
+// an OriginMismatchError. The values it embeds in the properties above whose
+// ids are not on that origin are replaced by their ids, which are resolved from
+// their own origin within the maximum depth.
+//
+// A Resolver is safe for concurrent use.
+type Resolver struct {
+	db         Database
+	common     CommonBehavior
+	clock      Clock
+	ttl        time.Duration
+	maxDepth   int
+	maxEntries int
+	mu         *sync.Mutex
+	cache      map[resolverCacheKey]resolverCacheEntry
+}
+
+// ResolverOption configures optional behaviors of a Resolver.
+type ResolverOption func(r *Resolver)
+
+// WithResolverTTL caches the values whose responses have no max-age for the
+// duration, instead of five minutes. A zero duration only caches them for
+// revalidation.
+func WithResolverTTL(ttl time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.ttl = ttl
+	}
+}
+
+// WithResolverMaxDepth resolves the IRIs of the 'actor', 'attributedTo',
+// 'inReplyTo', 'object' and 'target' properties of resolved values, replacing
+// them with the values they identify. The values embedded this way also have
+// theirs resolved, up to the maximum depth. IRIs that cannot be resolved are
+// left as they are.
+//
+// By default, the maximum depth is zero and no IRIs are resolved.
+func WithResolverMaxDepth(depth int) ResolverOption {
+	return func(r *Resolver) {
+		r.maxDepth = depth
+	}
+}
+
+// WithResolverMaxEntries bounds the number of values cached, instead of 1024.
+// The entries closest to expiring are evicted first. Zero disables caching.
+func WithResolverMaxEntries(n int) ResolverOption {
+	return func(r *Resolver) {
+		r.maxEntries = n
+	}
+}
+
+// NewResolver returns a Resolver getting local values from the Database, and
+// dereferencing others with the Transports of the CommonBehavior.
+func NewResolver(db Database, common CommonBehavior, clock Clock, opts ...ResolverOption) *Resolver {
+	r := &Resolver{
+		db:         db,
+		common:     common,
+		clock:      clock,
+		ttl:        defaultResolverTTL,
+		maxEntries: defaultResolverMaxEntries,
+		mu:         &sync.Mutex{},
+		cache:      make(map[resolverCacheKey]resolverCacheEntry),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// resolution is the state of a single call to Resolve.
+type resolution struct {
+	// boxIRI is the inbox or outbox of the actor dereferencing values.
+	boxIRI *url.URL
+	// t is only created once a value needs dereferencing.
+	t Transport
+}
+
+// Resolve returns the value identified by the IRI, dereferencing it on behalf of
+// the actor owning the inbox or outbox if it is not in the Database.
+func (r *Resolver) Resolve(c context.Context, boxIRI, iri *url.URL) (vocab.Type, error) {
+	m, err := r.resolve(c, &resolution{boxIRI: boxIRI}, iri, 0)
+	if err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// Evict removes the cached values identified by the IRI, for every actor, such
+// as when it is federated as updated or deleted.
+func (r *Resolver) Evict(iri *url.URL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := iri.String()
+	for k := range r.cache {
+		if k.iri == s {
+			delete(r.cache, k)
+		}
+	}
+}
+
+// resolve returns the serialized value identified by the IRI, with its
+// embedded IRIs resolved.
+func (r *Resolver) resolve(c context.Context, res *resolution, iri *url.URL, depth int) (m map[string]interface{}, err error) {
+	m, err = r.local(c, iri)
+	if err != nil {
+		return
+	} else if m == nil {
+		m, err = r.remote(c, res, iri)
+		if err != nil {
+			return
+		}
+		replaceForeignEmbedded(iri, m)
+	}
+	if depth < r.maxDepth {
+		for _, name := range resolverEmbeddedProperties {
+			if v, ok := m[name]; ok {
+				m[name] = r.embed(c, res, v, depth+1)
+			}
+		}
+	}
+	return
+}
+
+// embed replaces the IRIs of a property by the values they identify. IRIs that
+// cannot be resolved are kept.
+func (r *Resolver) embed(c context.Context, res *resolution, v interface{}, depth int) interface{} {
+	switch x := v.(type) {
+	case string:
+		if IsPublic(x) {
+			return v
+		}
+		iri, err := url.Parse(x)
+		if err != nil || !iri.IsAbs() {
+			return v
+		}
+		if m, err := r.resolve(c, res, iri, depth); err == nil {
+			return m
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = r.embed(c, res, e, depth)
+		}
+	}
+	return v
+}
+
+// local returns the serialized value from the Database, or nil if it is not
+// there.
+func (r *Resolver) local(c context.Context, iri *url.URL) (map[string]interface{}, error) {
+	if err := r.db.Lock(c, iri); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock is not deferred
+	exists, err := r.db.Exists(c, iri)
+	if err != nil || !exists {
+		r.db.Unlock(c, iri)
+		return nil, err
+	}
+	t, err := r.db.Get(c, iri)
+	r.db.Unlock(c, iri)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return nil, err
+	}
+	return streams.Serialize(t)
+}
+
+// remote returns the serialized value from the cache, or dereferences it.
+func (r *Resolver) remote(c context.Context, res *resolution, iri *url.URL) (map[string]interface{}, error) {
+	shared := resolverCacheKey{iri: iri.String()}
+	key := resolverCacheKey{iri: shared.iri, box: res.boxIRI.String()}
+	now := r.clock.Now()
+	r.mu.Lock()
+	e, cached := r.cache[shared]
+	if !cached {
+		e, cached = r.cache[key]
+	}
+	r.mu.Unlock()
+	if cached && now.Before(e.expires) {
+		return unmarshalMap(e.body)
+	}
+	if res.t == nil {
+		var err error
+		res.t, err = r.common.NewTransport(c, res.boxIRI, goFedUserAgent())
+		if err != nil {
+			return nil, err
+		}
+	}
+	var resp DereferenceResponse
+	var err error
+	if ct, ok := res.t.(ConditionalTransport); ok {
+		var etag string
+		if cached {
+			etag = e.etag
+		}
+		resp, err = ct.DereferenceIfNoneMatch(c, iri, etag)
+	} else {
+		resp.Body, err = res.t.Dereference(c, iri)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.NotModified {
+		resp.Body = e.body
+		if len(resp.ETag) == 0 {
+			resp.ETag = e.etag
+		}
+	}
+	m, err := unmarshalMap(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.NotModified {
+		if err = checkOrigin(iri, m); err != nil {
+			return nil, err
+		}
+	}
+	r.store(key, resp, now)
+	return m, nil
+}
+
+// store caches the response as its Cache-Control header allows. The response is
+// only shared with other actors if it is public or the request was not signed.
+func (r *Resolver) store(key resolverCacheKey, resp DereferenceResponse, now time.Time) {
+	cc := parseCacheControl(resp.CacheControl)
+	expires := now.Add(r.ttl)
+	if cc.noCache {
+		expires = now
+	} else if cc.hasMaxAge {
+		expires = now.Add(cc.maxAge)
+	}
+	shared := resolverCacheKey{iri: key.iri}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Any shared entry is replaced, as the value may no longer be public.
+	delete(r.cache, shared)
+	if r.maxEntries <= 0 || cc.noStore || (!expires.After(now) && len(resp.ETag) == 0) {
+		delete(r.cache, key)
+		return
+	}
+	if !cc.private && (cc.public || resp.Unsigned) {
+		delete(r.cache, key)
+		key = shared
+	}
+	if _, ok := r.cache[key]; !ok && len(r.cache) >= r.maxEntries {
+		r.evictClosestToExpiring()
+	}
+	r.cache[key] = resolverCacheEntry{
+		body:    resp.Body,
+		etag:    resp.ETag,
+		expires: expires,
+	}
+}
+
+// evictClosestToExpiring removes the cache entry closest to expiring. It must be
+// called while holding the lock.
+func (r *Resolver) evictClosestToExpiring() {
+	var evict resolverCacheKey
+	var earliest time.Time
+	first := true
+	for k, e := range r.cache {
+		if first || e.expires.Before(earliest) {
+			first = false
+			evict = k
+			earliest = e.expires
+		}
+	}
+	delete(r.cache, evict)
+}
+
+// unmarshalMap unmarshals a serialized ActivityStreams value.
+func unmarshalMap(b []byte) (m map[string]interface{}, err error) {
+	err = json.Unmarshal(b, &m)
+	return
+}
+
+// checkOrigin returns an OriginMismatchError unless the value dereferenced from
+// the IRI has an id with the same scheme and host.
+func checkOrigin(iri *url.URL, m map[string]interface{}) error {
+	s, _ := m["id"].(string)
+	if len(s) == 0 {
+		return &OriginMismatchError{IRI: iri}
+	}
+	id, err := url.Parse(s)
+	if err != nil {
+		return &OriginMismatchError{IRI: iri}
+	}
+	if !strings.EqualFold(id.Scheme, iri.Scheme) || !strings.EqualFold(id.Host, iri.Host) {
+		return &OriginMismatchError{IRI: iri, Id: id}
+	}
+	return nil
+}
+
+// replaceForeignEmbedded replaces the values embedded in the properties of the
+// value dereferenced from the IRI by their ids, when those are not on the
+// origin of the IRI, as the peer may be forging them.
+func replaceForeignEmbedded(iri *url.URL, m map[string]interface{}) {
+	for _, name := range resolverEmbeddedProperties {
+		if v, ok := m[name]; ok {
+			m[name] = replaceForeign(iri, v)
+		}
+	}
+}
+
+// replaceForeign returns the id of an embedded value that is not on the origin
+// of the IRI, or the value with its own embedded values checked otherwise.
+func replaceForeign(iri *url.URL, v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if s, ok := x["id"].(string); ok && len(s) > 0 && checkOrigin(iri, x) != nil {
+			return s
+		}
+		replaceForeignEmbedded(iri, x)
+	case []interface{}:
+		for i, e := range x {
+			x[i] = replaceForeign(iri, e)
+		}
+	}
+	return v
+}
+
+// cacheControl holds the Cache-Control directives relevant to the Resolver.
+type cacheControl struct {
+	noStore   bool
+	noCache   bool
+	public    bool
+	private   bool
+	hasMaxAge bool
+	maxAge    time.Duration
+}
+
+// parseCacheControl parses the directives of a Cache-Control header, ignoring
+// those that are unknown or malformed.
+func parseCacheControl(v string) (cc cacheControl) {
+	for _, d := range strings.Split(v, ",") {
+		name, value := strings.ToLower(strings.TrimSpace(d)), ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		switch name {
+		case "no-store":
+			cc.noStore = true
+		case "no-cache":
+			cc.noCache = true
+		case "public":
+			cc.public = true
+		case "private":
+			cc.private = true
+		case "max-age":
+			if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+				cc.hasMaxAge = true
+				cc.maxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,426 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+// TestResolver ensures values are obtained from the Database, or dereferenced
+// and cached.
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, opts ...ResolverOption) (db *MockDatabase, c *MockCommonBehavior, cl *MockClock, tp *MockConditionalTransport, r *Resolver) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		c = NewMockCommonBehavior(ctl)
+		cl = NewMockClock(ctl)
+		tp = NewMockConditionalTransport(ctl)
+		r = NewResolver(db, c, cl, opts...)
+		return
+	}
+	expectRemote := func(db *MockDatabase, iri *url.URL) {
+		db.EXPECT().Lock(ctx, iri)
+		db.EXPECT().Exists(ctx, iri).Return(false, nil)
+		db.EXPECT().Unlock(ctx, iri)
+	}
+	t.Run("ReturnsValueInDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _, _, r := setupFn(ctl)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		db.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(true, nil)
+		db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), mustParse(testNoteId1))
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testMyNote))
+	})
+	t.Run("DereferencesAndCachesRemoteValue", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(testFederatedNote),
+		}, nil)
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now().Add(time.Minute))
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		v2, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testFederatedNote))
+		assertByteEqual(t, mustSerializeToBytes(v2), mustSerializeToBytes(testFederatedNote))
+	})
+	t.Run("RevalidatesExpiredValueWithETag", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body:         mustSerializeToBytes(testFederatedNote),
+			ETag:         `"v1"`,
+			CacheControl: "public, max-age=60",
+		}, nil)
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now().Add(2 * time.Minute))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, `"v1"`).Return(DereferenceResponse{
+			NotModified: true,
+		}, nil)
+		// Run
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testFederatedNote))
+	})
+	t.Run("DoesNotCacheNoStore", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		for i := 0; i < 2; i++ {
+			expectRemote(db, iri)
+			cl.EXPECT().Now().Return(now())
+			c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+			tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+				Body:         mustSerializeToBytes(testFederatedNote),
+				CacheControl: "no-store",
+			}, nil)
+		}
+		// Run & Verify
+		for i := 0; i < 2; i++ {
+			_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+			assertEqual(t, err, nil)
+		}
+	})
+	t.Run("DoesNotSharePrivateValueWithOtherActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		for _, box := range []string{testMyInboxIRI, testFederatedInboxIRI} {
+			expectRemote(db, iri)
+			cl.EXPECT().Now().Return(now())
+			c.EXPECT().NewTransport(ctx, mustParse(box), goFedUserAgent()).Return(tp, nil)
+			tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+				Body:         mustSerializeToBytes(testFederatedNote),
+				CacheControl: "private",
+			}, nil)
+		}
+		// Run & Verify
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		_, err = r.Resolve(ctx, mustParse(testFederatedInboxIRI), iri)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotShareValueWithoutPublicWithOtherActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		for _, box := range []string{testMyInboxIRI, testFederatedInboxIRI} {
+			expectRemote(db, iri)
+			cl.EXPECT().Now().Return(now())
+			c.EXPECT().NewTransport(ctx, mustParse(box), goFedUserAgent()).Return(tp, nil)
+			tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+				Body:         mustSerializeToBytes(testFederatedNote),
+				CacheControl: "max-age=60",
+			}, nil)
+		}
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		_, err = r.Resolve(ctx, mustParse(testFederatedInboxIRI), iri)
+		assertEqual(t, err, nil)
+		_, err = r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+	})
+	t.Run("SharesPublicValueWithOtherActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body:         mustSerializeToBytes(testFederatedNote),
+			CacheControl: "public, max-age=60",
+		}, nil)
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		v, err := r.Resolve(ctx, mustParse(testFederatedInboxIRI), iri)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testFederatedNote))
+	})
+	t.Run("SharesUnsignedResponseWithOtherActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body:     mustSerializeToBytes(testFederatedNote),
+			Unsigned: true,
+		}, nil)
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		// Run & Verify
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		_, err = r.Resolve(ctx, mustParse(testFederatedInboxIRI), iri)
+		assertEqual(t, err, nil)
+	})
+	t.Run("EvictsValueCachedForEveryActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		for i := 0; i < 2; i++ {
+			expectRemote(db, iri)
+			cl.EXPECT().Now().Return(now())
+			c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+			tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+				Body: mustSerializeToBytes(testFederatedNote),
+			}, nil)
+		}
+		// Run & Verify
+		_, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+		r.Evict(iri)
+		_, err = r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		assertEqual(t, err, nil)
+	})
+	t.Run("RefusesValueOfOtherOrigin", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testFederatedActivityIRI)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(testFederatedNote),
+		}, nil)
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, v, nil)
+		oErr, ok := err.(*OriginMismatchError)
+		assertEqual(t, ok, true)
+		assertEqual(t, oErr.Id.String(), testNoteId1)
+	})
+	t.Run("DereferencesWithPlainTransport", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, _, r := setupFn(ctl)
+		tp := NewMockTransport(ctl)
+		iri := mustParse(testNoteId1)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, iri).Return(mustSerializeToBytes(testFederatedNote), nil)
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(testFederatedNote))
+	})
+	t.Run("ResolvesEmbeddedIRIsUpToMaxDepth", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl, WithResolverMaxDepth(1))
+		iri := mustParse(testFederatedActivityIRI2)
+		announce := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(iri)
+		announce.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		announce.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId1))
+		announce.SetActivityStreamsObject(op)
+		expect := streams.NewActivityStreamsAnnounce()
+		expect.SetJSONLDId(id)
+		expect.SetActivityStreamsActor(actor)
+		expectOp := streams.NewActivityStreamsObjectProperty()
+		expectOp.AppendActivityStreamsNote(testFederatedNote)
+		expect.SetActivityStreamsObject(expectOp)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(announce),
+		}, nil)
+		expectRemote(db, mustParse(testFederatedActorIRI))
+		cl.EXPECT().Now().Return(now())
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, mustParse(testFederatedActorIRI), "").Return(DereferenceResponse{}, testErr)
+		expectRemote(db, mustParse(testNoteId1))
+		cl.EXPECT().Now().Return(now())
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, mustParse(testNoteId1), "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(testFederatedNote),
+		}, nil)
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expect))
+	})
+	t.Run("ReplacesEmbeddedValueOfOtherOriginByItsId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl)
+		iri := mustParse(testFederatedActivityIRI2)
+		forged := streams.NewActivityStreamsNote()
+		forgedId := streams.NewJSONLDIdProperty()
+		forgedId.Set(mustParse(testThreadOtherHostIRI2))
+		forged.SetJSONLDId(forgedId)
+		content := streams.NewActivityStreamsContentProperty()
+		content.AppendXMLSchemaString("forged")
+		forged.SetActivityStreamsContent(content)
+		announce := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(iri)
+		announce.SetJSONLDId(id)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(forged)
+		announce.SetActivityStreamsObject(op)
+		expect := streams.NewActivityStreamsAnnounce()
+		expect.SetJSONLDId(id)
+		expectOp := streams.NewActivityStreamsObjectProperty()
+		expectOp.AppendIRI(mustParse(testThreadOtherHostIRI2))
+		expect.SetActivityStreamsObject(expectOp)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(announce),
+		}, nil)
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expect))
+	})
+	t.Run("ResolvesEmbeddedValueOfOtherOriginFromItsOrigin", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, r := setupFn(ctl, WithResolverMaxDepth(1))
+		iri := mustParse(testFederatedActivityIRI2)
+		noteIRI := mustParse(testThreadOtherHostIRI2)
+		newNoteFn := func(text string) vocab.ActivityStreamsNote {
+			n := streams.NewActivityStreamsNote()
+			id := streams.NewJSONLDIdProperty()
+			id.Set(noteIRI)
+			n.SetJSONLDId(id)
+			content := streams.NewActivityStreamsContentProperty()
+			content.AppendXMLSchemaString(text)
+			n.SetActivityStreamsContent(content)
+			return n
+		}
+		announce := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(iri)
+		announce.SetJSONLDId(id)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(newNoteFn("forged"))
+		announce.SetActivityStreamsObject(op)
+		expect := streams.NewActivityStreamsAnnounce()
+		expect.SetJSONLDId(id)
+		expectOp := streams.NewActivityStreamsObjectProperty()
+		expectOp.AppendActivityStreamsNote(newNoteFn("original"))
+		expect.SetActivityStreamsObject(expectOp)
+		// Mock
+		expectRemote(db, iri)
+		cl.EXPECT().Now().Return(now())
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, iri, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(announce),
+		}, nil)
+		expectRemote(db, noteIRI)
+		cl.EXPECT().Now().Return(now())
+		tp.EXPECT().DereferenceIfNoneMatch(ctx, noteIRI, "").Return(DereferenceResponse{
+			Body: mustSerializeToBytes(newNoteFn("original")),
+		}, nil)
+		// Run
+		v, err := r.Resolve(ctx, mustParse(testMyInboxIRI), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expect))
+	})
+}
+
+// TestParseCacheControl ensures the relevant directives are parsed.
+func TestParseCacheControl(t *testing.T) {
+	cc := parseCacheControl(`Private, max-age="120", must-revalidate`)
+	assertEqual(t, cc, cacheControl{
+		private:   true,
+		hasMaxAge: true,
+		maxAge:    2 * time.Minute,
+	})
+	cc = parseCacheControl("public, max-age=60")
+	assertEqual(t, cc, cacheControl{
+		public:    true,
+		hasMaxAge: true,
+		maxAge:    time.Minute,
+	})
+	cc = parseCacheControl("no-cache, no-store, max-age=-1")
+	assertEqual(t, cc, cacheControl{
+		noStore: true,
+		noCache: true,
+	})
+}
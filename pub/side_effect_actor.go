@@ -27,6 +27,32 @@ type sideEffectActor struct {
 	c2s    SocialProtocol
 	db     Database
 	clock  Clock
+	// deliveryQueue, if non-nil, receives outbound deliveries instead of
+	// delivering them immediately.
+	deliveryQueue DeliveryQueue
+	// publicKeyCache, if non-nil, has the keys of deleted actors evicted.
+	publicKeyCache PublicKeyCache
+	// maxCollectionPages limits the number of pages of a collection that
+	// are dereferenced when resolving delivery recipients. Zero or negative
+	// numbers indicate no limit.
+	maxCollectionPages int
+	// maxCollectionItems limits the number of members of a collection that
+	// are resolved as delivery recipients. Zero or negative numbers indicate
+	// no limit.
+	maxCollectionItems int
+	// localFollowers, if non-nil, determines the local recipients of
+	// activities received in the shared inbox that are addressed to the
+	// public or to the followers of their actor.
+	localFollowers LocalFollowersFunc
+	// federationPolicy, if non-nil, determines how to federate with other
+	// servers by their host.
+	federationPolicy FederationPolicy
+	// threadFetcher, if non-nil, backfills the threads of received
+	// replies.
+	threadFetcher *ThreadFetcher
+	// knownSharedInboxes, if non-nil, determines the additional recipients
+	// of the Delete of a local actor.
+	knownSharedInboxes KnownSharedInboxesFunc
 }
 
 // PostInboxRequestBodyHook defers to the delegate.
@@ -90,6 +116,18 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 			return
 		}
 	}
+	// Determine if the server sending this request is suspended.
+	var origins []*url.URL
+	if origins, err = activityOrigins(activity); err != nil {
+		return
+	}
+	var policy HostPolicy
+	if policy, err = newHostPolicies(a.federationPolicy).merged(c, origins); err != nil {
+		return
+	} else if policy.Suspend {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 	// Determine if the actor(s) sending this request are blocked.
 	var blocked bool
 	if blocked, err = a.s2s.Blocked(c, iris); err != nil {
@@ -98,6 +136,21 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
+	// Determine if the actor owning the inbox blocks the actor(s) sending
+	// this request. Blocks in the shared inbox are instead applied to
+	// each of its recipients.
+	if inboxIRI := inboxIRIFromContext(c); inboxIRI != nil {
+		var actorIRIs []*url.URL
+		if actorIRIs, err = getActorIds(activity); err != nil {
+			return
+		}
+		if blocked, err = isBlockedByInbox(c, a.db, inboxIRI, actorIRIs); err != nil {
+			return
+		} else if blocked {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
 	authorized = true
 	return
 }
@@ -111,6 +164,19 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 		return err
 	}
 	if isNew {
+		// Let the application know how to treat the activity, such as
+		// not showing the activities of silenced hosts publicly.
+		if a.federationPolicy != nil {
+			origins, err := activityOrigins(activity)
+			if err != nil {
+				return err
+			}
+			policy, err := newHostPolicies(a.federationPolicy).merged(c, origins)
+			if err != nil {
+				return err
+			}
+			c = context.WithValue(c, hostPolicyContextKey{}, policy)
+		}
 		wrapped, other, err := a.s2s.FederatingCallbacks(c)
 		if err != nil {
 			return err
@@ -121,6 +187,10 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 		wrapped.newTransport = a.common.NewTransport
 		wrapped.deliver = a.Deliver
 		wrapped.addNewIds = a.AddNewIDs
+		wrapped.addToOutbox = a.addToOutbox
+		wrapped.clock = a.clock
+		wrapped.publicKeyCache = a.publicKeyCache
+		wrapped.threadFetcher = a.threadFetcher
 		res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
 		if err != nil {
 			return err
@@ -137,12 +207,127 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 	return nil
 }
 
+// SharedInboxRecipients determines the inboxes of the local actors that an
+// activity received in the shared inbox is addressed to.
+//
+// Local actors addressed directly receive the activity in their inbox. When
+// the activity is addressed to the public or to a collection that is not
+// ours, such as the followers of its actor, the local followers of its actors
+// receive it as well, if a LocalFollowersFunc was provided.
+//
+// Local actors blocking any of the activity's actors do not receive it.
+//
+// An activity already in the database, as it was received before, has no
+// recipients.
+func (a *sideEffectActor) SharedInboxRecipients(c context.Context, activity Activity) (inboxes []*url.URL, err error) {
+	id := activity.GetJSONLDId().Get()
+	err = a.db.Lock(c, id)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock is not deferred
+	exists, err := a.db.Exists(c, id)
+	a.db.Unlock(c, id)
+	// Unlock by this point and in every branch above.
+	if err != nil || exists {
+		return
+	}
+	recipients, err := getRecipients(activity)
+	if err != nil {
+		return
+	}
+	toFollowers := false
+	for _, iri := range recipients {
+		if IsPublic(iri.String()) {
+			toFollowers = true
+			continue
+		}
+		var owns bool
+		var inbox *url.URL
+		owns, inbox, err = a.localInbox(c, iri)
+		if err != nil {
+			return
+		} else if !owns {
+			toFollowers = true
+		} else if inbox != nil {
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	if toFollowers && a.localFollowers != nil {
+		if actors := activity.GetActivityStreamsActor(); actors != nil {
+			for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+				var actorIRI *url.URL
+				actorIRI, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				var followers []*url.URL
+				followers, err = a.localFollowers(c, actorIRI)
+				if err != nil {
+					return
+				}
+				inboxes = append(inboxes, followers...)
+			}
+		}
+	}
+	inboxes = dedupeIRIs(inboxes, nil)
+	if len(inboxes) == 0 {
+		return
+	}
+	actorIRIs, err := getActorIds(activity)
+	if err != nil {
+		return
+	}
+	unblocked := make([]*url.URL, 0, len(inboxes))
+	for _, inbox := range inboxes {
+		var blocked bool
+		blocked, err = isBlockedByInbox(c, a.db, inbox, actorIRIs)
+		if err != nil {
+			return
+		} else if !blocked {
+			unblocked = append(unblocked, inbox)
+		}
+	}
+	return unblocked, nil
+}
+
+// localInbox determines whether the IRI is owned by us and, if so, the inbox
+// of the local actor it identifies. The inbox is nil if the IRI is not a local
+// actor's.
+func (a *sideEffectActor) localInbox(c context.Context, iri *url.URL) (owns bool, inbox *url.URL, err error) {
+	err = a.db.Lock(c, iri)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock is not deferred
+	owns, err = a.db.Owns(c, iri)
+	if err != nil {
+		a.db.Unlock(c, iri)
+		return
+	}
+	if owns {
+		inbox, err = a.db.InboxForActor(c, iri)
+		if err != nil {
+			a.db.Unlock(c, iri)
+			return
+		}
+	}
+	a.db.Unlock(c, iri)
+	// Unlock must be called by now and every branch above.
+	return
+}
+
 // InboxForwarding implements the 3-part inbox forwarding algorithm specified in
 // the ActivityPub specification. Does not modify the Activity, but may send
 // outbound requests as a side effect.
 //
 // InboxForwarding sets the federated data in the database.
 func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	// The first inbox of an activity received in the shared inbox forwards
+	// it for all of them.
+	if isSharedInboxCopy(c) {
+		return nil
+	}
 	// 1. Must be first time we have seen this Activity.
 	//
 	// Obtain the id of the activity
@@ -154,24 +339,40 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 	}
 	// WARNING: Unlock is not deferred
 	//
-	// If the database already contains the activity, exit early.
+	// If the database already contains the activity, exit early. A
+	// retried InboxJob may have stored it in an attempt that failed to
+	// forward it, so continue instead.
 	exists, err := a.db.Exists(c, id.Get())
 	if err != nil {
 		a.db.Unlock(c, id.Get())
 		return err
-	} else if exists {
+	} else if exists && !isInboxRetry(c) {
 		a.db.Unlock(c, id.Get())
 		return nil
 	}
 	// Attempt to create the activity entry.
-	err = a.db.Create(c, activity)
-	if err != nil {
-		a.db.Unlock(c, id.Get())
-		return err
+	if !exists {
+		err = a.db.Create(c, activity)
+		if err != nil {
+			a.db.Unlock(c, id.Get())
+			return err
+		}
 	}
 	a.db.Unlock(c, id.Get())
 	// Unlock by this point and in every branch above.
 	//
+	// The activities of silenced or suspended servers are not forwarded.
+	policies := newHostPolicies(a.federationPolicy)
+	origins, err := activityOrigins(activity)
+	if err != nil {
+		return err
+	}
+	if policy, err := policies.merged(c, origins); err != nil {
+		return err
+	} else if policy.Silence || policy.Suspend {
+		return nil
+	}
+	//
 	// 2. The values of 'to', 'cc', or 'audience' are Collections owned by
 	//    this server.
 	var r []*url.URL
@@ -314,6 +515,10 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 			}
 		}
 	}
+	recipients, err = policies.withoutSuspended(c, recipients)
+	if err != nil {
+		return err
+	}
 	return a.deliverToRecipients(c, inboxIRI, activity, recipients)
 }
 
@@ -338,6 +543,10 @@ func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outbo
 		wrapped.rawActivity = rawJSON
 		wrapped.clock = a.clock
 		wrapped.newTransport = a.common.NewTransport
+		wrapped.addNewIds = a.AddNewIDs
+		if a.s2s != nil {
+			wrapped.deliver = a.Deliver
+		}
 		undeliverable := false
 		wrapped.undeliverable = &undeliverable
 		var res *streams.TypeResolver
@@ -407,6 +616,84 @@ func (a *sideEffectActor) Deliver(c context.Context, outboxIRI *url.URL, activit
 	return a.deliverToRecipients(c, outboxIRI, activity, recipients)
 }
 
+// DeleteActor adds a Delete of the local actor owning the outbox to the outbox,
+// and delivers it to the actor's followers and the known shared inboxes. The
+// actor is then replaced with a Tombstone.
+//
+// The actor is only replaced once the recipients are determined, as doing so
+// requires its 'followers' and 'inbox'.
+func (a *sideEffectActor) DeleteActor(c context.Context, outboxIRI *url.URL) (Activity, error) {
+	if err := a.db.Lock(c, outboxIRI); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := a.db.ActorForOutbox(c, outboxIRI)
+	a.db.Unlock(c, outboxIRI)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return nil, err
+	}
+	if err = a.db.Lock(c, actorIRI); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock not deferred.
+	actor, err := a.db.Get(c, actorIRI)
+	a.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	if err != nil {
+		return nil, err
+	} else if streams.IsOrExtendsActivityStreamsTombstone(actor) {
+		return nil, fmt.Errorf("cannot delete actor %s: it is already deleted", actorIRI)
+	}
+	d := streams.NewActivityStreamsDelete()
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(actorIRI)
+	d.SetActivityStreamsActor(actorProp)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(actorIRI)
+	d.SetActivityStreamsObject(op)
+	public, err := url.Parse(PublicActivityPubIRI)
+	if err != nil {
+		return nil, err
+	}
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(public)
+	d.SetActivityStreamsTo(to)
+	if followers := getFollowers(actor); followers != nil {
+		cc := streams.NewActivityStreamsCcProperty()
+		cc.AppendIRI(followers)
+		d.SetActivityStreamsCc(cc)
+	}
+	if err = a.AddNewIDs(c, d); err != nil {
+		return nil, err
+	} else if err = a.addToOutbox(c, outboxIRI, d); err != nil {
+		return nil, err
+	}
+	recipients, err := a.prepare(c, outboxIRI, d)
+	if err != nil {
+		return nil, err
+	}
+	if a.knownSharedInboxes != nil {
+		var sharedInboxes []*url.URL
+		if sharedInboxes, err = a.knownSharedInboxes(c, actorIRI); err != nil {
+			return nil, err
+		}
+		sharedInboxes, err = newHostPolicies(a.federationPolicy).withoutSuspended(c, sharedInboxes)
+		if err != nil {
+			return nil, err
+		}
+		recipients = dedupeIRIs(append(recipients, sharedInboxes...), nil)
+	}
+	if err = a.deliverToRecipients(c, outboxIRI, d, recipients); err != nil {
+		return nil, err
+	}
+	if err = a.db.Lock(c, actorIRI); err != nil {
+		return nil, err
+	}
+	defer a.db.Unlock(c, actorIRI)
+	return d, a.db.Update(c, toTombstone(actor, actorIRI, a.clock.Now()))
+}
+
 // WrapInCreate wraps an object with a Create activity.
 func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outboxIRI *url.URL) (create vocab.ActivityStreamsCreate, err error) {
 	err = a.db.Lock(c, outboxIRI)
@@ -426,6 +713,8 @@ func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outbox
 
 // deliverToRecipients will take a prepared Activity and send it to specific
 // recipients on behalf of an actor.
+//
+// If a DeliveryQueue is configured, the deliveries are only enqueued.
 func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL, activity Activity, recipients []*url.URL) error {
 	m, err := streams.Serialize(activity)
 	if err != nil {
@@ -435,6 +724,17 @@ func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL
 	if err != nil {
 		return err
 	}
+	if a.deliveryQueue != nil {
+		var activityIRI *url.URL
+		if id := activity.GetJSONLDId(); id != nil {
+			activityIRI = id.Get()
+		}
+		jobs, err := newDeliveryJobs(activityIRI, boxIRI, b, recipients, a.clock.Now())
+		if err != nil {
+			return err
+		}
+		return a.deliveryQueue.Enqueue(c, jobs)
+	}
 	tp, err := a.common.NewTransport(c, boxIRI, goFedUserAgent())
 	if err != nil {
 		return err
@@ -488,7 +788,7 @@ func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, act
 //
 // It does not add the activity to this database's know federated data.
 //
-// Returns true when the activity is novel.
+// Returns true when the activity is novel, or when retrying an InboxJob.
 func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL, activity Activity) (isNew bool, err error) {
 	// Acquire a lock to read the inbox. Defer release.
 	err = a.db.Lock(c, inboxIRI)
@@ -503,6 +803,9 @@ func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL,
 	if err != nil {
 		return
 	} else if contains {
+		// A retried InboxJob may have added the activity in an
+		// attempt whose side effects failed, so treat it as new.
+		isNew = isInboxRetry(c)
 		return
 	}
 	// It is a new id, acquire the inbox.
@@ -615,58 +918,50 @@ func (a *sideEffectActor) hasInboxForwardingValues(c context.Context, inboxIRI *
 // target URIs. Additionally, the deliverableObject will have any hidden
 // hidden recipients ("bto" and "bcc") stripped from it.
 //
+// Actors blocked by the sender, and servers suspended by the
+// FederationPolicy, are not delivered to.
+//
 // Only call if both the social and federated protocol are supported.
 func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activity Activity) (r []*url.URL, err error) {
-	// Get inboxes of recipients
-	if to := activity.GetActivityStreamsTo(); to != nil {
-		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
-			var val *url.URL
-			val, err = ToId(iter)
-			if err != nil {
-				return
-			}
-			r = append(r, val)
-		}
+	// Get the sender, and the actors it blocks.
+	err = a.db.Lock(c, outboxIRI)
+	if err != nil {
+		return
 	}
-	if bto := activity.GetActivityStreamsBto(); bto != nil {
-		for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
-			var val *url.URL
-			val, err = ToId(iter)
-			if err != nil {
-				return
-			}
-			r = append(r, val)
-		}
+	// WARNING: No deferring the Unlock
+	actorIRI, err := a.db.ActorForOutbox(c, outboxIRI)
+	if err != nil {
+		a.db.Unlock(c, outboxIRI)
+		return
 	}
-	if cc := activity.GetActivityStreamsCc(); cc != nil {
-		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
-			var val *url.URL
-			val, err = ToId(iter)
-			if err != nil {
-				return
-			}
-			r = append(r, val)
-		}
+	a.db.Unlock(c, outboxIRI)
+	err = a.db.Lock(c, actorIRI)
+	if err != nil {
+		return nil, err
 	}
-	if bcc := activity.GetActivityStreamsBcc(); bcc != nil {
-		for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
-			var val *url.URL
-			val, err = ToId(iter)
-			if err != nil {
-				return
-			}
-			r = append(r, val)
-		}
+	// BEGIN LOCK
+	thisActor, err := a.db.Get(c, actorIRI)
+	a.db.Unlock(c, actorIRI)
+	// END LOCK -- Still need to handle err
+	if err != nil {
+		return nil, err
 	}
-	if audience := activity.GetActivityStreamsAudience(); audience != nil {
-		for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
-			var val *url.URL
-			val, err = ToId(iter)
-			if err != nil {
-				return
-			}
-			r = append(r, val)
-		}
+	isBlocked, err := blockedActors(c, a.db, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	// Get inboxes of recipients
+	r, err = getRecipients(activity)
+	if err != nil {
+		return
+	}
+	addressed := make([]*url.URL, len(r))
+	copy(addressed, r)
+	r = filterURLs(r, func(s string) bool { return isBlocked[s] })
+	policies := newHostPolicies(a.federationPolicy)
+	r, err = policies.withoutSuspended(c, r)
+	if err != nil {
+		return nil, err
 	}
 	// 1. When an object is being delivered to the originating actor's
 	//    followers, a server MAY reduce the number of receiving actors
@@ -724,7 +1019,26 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 	if err != nil {
 		return nil, err
 	}
-	foundInboxesFromRemote, err := getInboxes(foundActorsFromRemote)
+	// Members of collections may also be blocked.
+	unblockedActors := foundActorsFromRemote[:0]
+	for _, actor := range foundActorsFromRemote {
+		if id, err := GetId(actor); err == nil && isBlocked[id.String()] {
+			continue
+		}
+		unblockedActors = append(unblockedActors, actor)
+	}
+	foundActorsFromRemote = unblockedActors
+
+	// When delivering to the public or to the sender's followers, group
+	// the remote recipients by their shared inbox.
+	useSharedInbox := false
+	followers := getFollowers(thisActor)
+	for _, iri := range addressed {
+		if IsPublic(iri.String()) || (followers != nil && iri.String() == followers.String()) {
+			useSharedInbox = true
+		}
+	}
+	foundInboxesFromRemote, err := getDeliveryInboxes(foundActorsFromRemote, useSharedInbox)
 	if err != nil {
 		return nil, err
 	}
@@ -734,31 +1048,11 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 	targets := []*url.URL{}
 	targets = append(targets, foundInboxesFromDB...)
 	targets = append(targets, foundInboxesFromRemote...)
-
-	// Get inboxes of sender.
-	err = a.db.Lock(c, outboxIRI)
-	if err != nil {
-		return
-	}
-	// WARNING: No deferring the Unlock
-	actorIRI, err := a.db.ActorForOutbox(c, outboxIRI)
-	if err != nil {
-		a.db.Unlock(c, outboxIRI)
-		return
-	}
-	a.db.Unlock(c, outboxIRI)
-	// Get the inbox on the sender.
-	err = a.db.Lock(c, actorIRI)
-	if err != nil {
-		return nil, err
-	}
-	// BEGIN LOCK
-	thisActor, err := a.db.Get(c, actorIRI)
-	a.db.Unlock(c, actorIRI)
-	// END LOCK -- Still need to handle err
+	targets, err = policies.withoutSuspended(c, targets)
 	if err != nil {
 		return nil, err
 	}
+
 	// Post-processing
 	var ignore *url.URL
 	ignore, err = getInbox(thisActor)
@@ -811,47 +1105,121 @@ func (a *sideEffectActor) resolveActors(c context.Context, t Transport, r []*url
 // actor's inbox IRI to deliver to.
 //
 // The returned actor could be nil, if it wasn't an actor (ex: a Collection or
-// OrderedCollection).
+// OrderedCollection). In that case, the members of the collection are
+// returned, including those on its pages.
 func (a *sideEffectActor) dereferenceForResolvingInboxes(c context.Context, t Transport, actorIRI *url.URL) (actor vocab.Type, moreActorIRIs []*url.URL, err error) {
-	var resp []byte
-	resp, err = t.Dereference(c, actorIRI)
-	if err != nil {
-		return
-	}
-	var m map[string]interface{}
-	if err = json.Unmarshal(resp, &m); err != nil {
-		return
-	}
-	actor, err = streams.ToType(c, m)
+	actor, err = dereferenceType(c, t, actorIRI)
 	if err != nil {
 		return
 	}
 	// Attempt to see if the 'actor' is really some sort of type that has
 	// an 'items' or 'orderedItems' property.
-	if v, ok := actor.(itemser); ok {
+	_, isItemser := actor.(itemser)
+	_, isOrderedItemser := actor.(orderedItemser)
+	if isItemser || isOrderedItemser {
+		moreActorIRIs, err = a.collectionMembers(c, t, actor)
+		actor = nil
+	}
+	return
+}
+
+// collectionMembers returns the ids of the items in a Collection,
+// OrderedCollection, or one of their pages, and of the items on the pages
+// following it.
+//
+// Pages are followed through the 'first' and 'next' properties until either
+// the maxCollectionPages or maxCollectionItems limit is reached. A page that
+// cannot be dereferenced ends the collection.
+func (a *sideEffectActor) collectionMembers(c context.Context, t Transport, col vocab.Type) (members []*url.URL, err error) {
+	seen := make(map[string]bool)
+	for pages := 1; col != nil; pages++ {
+		if id, idErr := GetId(col); idErr == nil {
+			seen[id.String()] = true
+		}
+		var items []*url.URL
+		items, err = collectionItems(col)
+		if err != nil {
+			return
+		}
+		members = append(members, items...)
+		if a.maxCollectionItems > 0 && len(members) >= a.maxCollectionItems {
+			members = members[:a.maxCollectionItems]
+			return
+		} else if a.maxCollectionPages > 0 && pages >= a.maxCollectionPages {
+			return
+		}
+		col = nextCollectionPage(c, t, col, seen)
+	}
+	return
+}
+
+// collectionItems returns the ids of the 'items' or 'orderedItems' of a
+// collection or collection page.
+func collectionItems(col vocab.Type) (ids []*url.URL, err error) {
+	var iters []IdProperty
+	if v, ok := col.(itemser); ok {
 		if i := v.GetActivityStreamsItems(); i != nil {
 			for iter := i.Begin(); iter != i.End(); iter = iter.Next() {
-				var id *url.URL
-				id, err = ToId(iter)
-				if err != nil {
-					return
-				}
-				moreActorIRIs = append(moreActorIRIs, id)
+				iters = append(iters, iter)
 			}
 		}
-		actor = nil
-	} else if v, ok := actor.(orderedItemser); ok {
+	} else if v, ok := col.(orderedItemser); ok {
 		if i := v.GetActivityStreamsOrderedItems(); i != nil {
 			for iter := i.Begin(); iter != i.End(); iter = iter.Next() {
-				var id *url.URL
-				id, err = ToId(iter)
-				if err != nil {
-					return
-				}
-				moreActorIRIs = append(moreActorIRIs, id)
+				iters = append(iters, iter)
 			}
 		}
-		actor = nil
+	}
+	for _, iter := range iters {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
 	}
 	return
 }
+
+// nextCollectionPage returns the page following a collection or collection
+// page: its 'next' page, or otherwise its 'first' page.
+//
+// Returns nil if there is no such page, it was already seen, or it cannot be
+// dereferenced.
+func nextCollectionPage(c context.Context, t Transport, col vocab.Type, seen map[string]bool) vocab.Type {
+	var link IdProperty
+	if v, ok := col.(nexter); ok && v.GetActivityStreamsNext() != nil {
+		link = v.GetActivityStreamsNext()
+	} else if v, ok := col.(firster); ok && v.GetActivityStreamsFirst() != nil {
+		link = v.GetActivityStreamsFirst()
+	} else {
+		return nil
+	}
+	if page := link.GetType(); page != nil {
+		if id, err := GetId(page); err == nil && seen[id.String()] {
+			return nil
+		}
+		return page
+	} else if !link.IsIRI() || seen[link.GetIRI().String()] {
+		return nil
+	}
+	page, err := dereferenceType(c, t, link.GetIRI())
+	if err != nil {
+		return nil
+	}
+	return page
+}
+
+// dereferenceType dereferences an IRI and resolves it into an ActivityStreams
+// type.
+func dereferenceType(c context.Context, t Transport, iri *url.URL) (vocab.Type, error) {
+	resp, err := t.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(resp, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
@@ -3,6 +3,7 @@ package pub
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -173,6 +174,98 @@ func TestAuthorizePostInbox(t *testing.T) {
 		assertEqual(t, b, true)
 		assertEqual(t, err, nil)
 	})
+	t.Run("ActorBlockedByInboxOwnerNotAuthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, _, _, a := setupFn(ctl)
+		db := NewMockBlocksDatabase(ctl)
+		a.(*sideEffectActor).db = db
+		inboxCtx := withInboxIRI(ctx, mustParse(testMyInboxIRI))
+		blocks := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		blocks.SetActivityStreamsItems(items)
+		resp := httptest.NewRecorder()
+		fp.EXPECT().Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		db.EXPECT().Lock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(inboxCtx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().Lock(inboxCtx, mustParse(testPersonIRI))
+		db.EXPECT().Blocks(inboxCtx, mustParse(testPersonIRI)).Return(blocks, nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testPersonIRI))
+		// Run
+		b, err := a.AuthorizePostInbox(inboxCtx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, false)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("ActorNotBlockedByInboxOwnerAuthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, _, _, a := setupFn(ctl)
+		db := NewMockBlocksDatabase(ctl)
+		a.(*sideEffectActor).db = db
+		inboxCtx := withInboxIRI(ctx, mustParse(testMyInboxIRI))
+		fp.EXPECT().Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		db.EXPECT().Lock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(inboxCtx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().Lock(inboxCtx, mustParse(testPersonIRI))
+		db.EXPECT().Blocks(inboxCtx, mustParse(testPersonIRI)).Return(testMyBlocks, nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testPersonIRI))
+		// Run
+		b, err := a.AuthorizePostInbox(inboxCtx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, true)
+		assertEqual(t, err, nil)
+	})
+	t.Run("InboxOwnerBlocksIgnoredWithoutBlocksDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, _, _, a := setupFn(ctl)
+		inboxCtx := withInboxIRI(ctx, mustParse(testMyInboxIRI))
+		fp.EXPECT().Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		// Run
+		b, err := a.AuthorizePostInbox(inboxCtx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, true)
+		assertEqual(t, err, nil)
+	})
+	t.Run("ActorOfSuspendedServerNotAuthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, _, _, a := setupFn(ctl)
+		a.(*sideEffectActor).federationPolicy = DomainPolicy{
+			Suspended: []string{"example.com"},
+		}
+		resp := httptest.NewRecorder()
+		// Run
+		b, err := a.AuthorizePostInbox(ctx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, false)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("ActorOfSilencedServerAuthorized", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, _, _, a := setupFn(ctl)
+		a.(*sideEffectActor).federationPolicy = DomainPolicy{
+			Silenced: []string{"other.example.com"},
+		}
+		fp.EXPECT().Blocked(ctx, []*url.URL{mustParse(testFederatedActorIRI)}).Return(false, nil)
+		// Run
+		b, err := a.AuthorizePostInbox(ctx, resp, testCreate)
+		// Verify
+		assertEqual(t, b, true)
+		assertEqual(t, err, nil)
+	})
 	t.Run("OneActorNotAuthorized", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -347,6 +440,181 @@ func TestPostInbox(t *testing.T) {
 	})
 }
 
+// TestSharedInboxRecipients tests determining the local inboxes of an activity
+// received in the shared inbox.
+func TestSharedInboxRecipients(t *testing.T) {
+	ctx := context.Background()
+	otherInbox := mustParse("https://example.com/jordan/inbox")
+	setupFn := func(ctl *gomock.Controller, followers LocalFollowersFunc) (db *MockDatabase, a DelegateActor) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		a = &sideEffectActor{
+			db:             db,
+			localFollowers: followers,
+		}
+		return
+	}
+	toFollowers := func(want string, inboxes ...*url.URL) LocalFollowersFunc {
+		return func(c context.Context, actorIRI *url.URL) ([]*url.URL, error) {
+			if actorIRI.String() != want {
+				return nil, fmt.Errorf("unexpected actor %s", actorIRI)
+			}
+			return inboxes, nil
+		}
+	}
+	otherActor := mustParse("https://example.com/jordan")
+	expectBlocksFn := func(db *MockBlocksDatabase, inbox, actor *url.URL, blocks vocab.ActivityStreamsCollection) {
+		db.EXPECT().Lock(ctx, inbox)
+		db.EXPECT().ActorForInbox(ctx, inbox).Return(actor, nil)
+		db.EXPECT().Unlock(ctx, inbox)
+		db.EXPECT().Lock(ctx, actor)
+		db.EXPECT().Blocks(ctx, actor).Return(blocks, nil)
+		db.EXPECT().Unlock(ctx, actor)
+	}
+	newCreate := func(to ...string) vocab.ActivityStreamsCreate {
+		c := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		c.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		c.SetActivityStreamsActor(actor)
+		toProp := streams.NewActivityStreamsToProperty()
+		for _, iri := range to {
+			toProp.AppendIRI(mustParse(iri))
+		}
+		c.SetActivityStreamsTo(toProp)
+		return c
+	}
+	expectNewFn := func(db *MockDatabase) {
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		db.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+	}
+	t.Run("ReturnsNoInboxesForActivityAlreadyReceived", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, toFollowers(testFederatedActorIRI, mustParse(testMyInboxIRI)))
+		act := newCreate(testPersonIRI, PublicActivityPubIRI)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		db.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 0)
+	})
+	t.Run("ReturnsInboxesOfAddressedLocalActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, nil)
+		act := newCreate(testPersonIRI)
+		// Mock
+		expectNewFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		db.EXPECT().Owns(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		db.EXPECT().InboxForActor(ctx, mustParse(testPersonIRI)).Return(mustParse(testMyInboxIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+	})
+	t.Run("IgnoresUnownedIRIsWithoutLocalFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, nil)
+		act := newCreate(testAudienceIRI, PublicActivityPubIRI)
+		// Mock
+		expectNewFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		db.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 0)
+	})
+	t.Run("ReturnsLocalFollowersIfPublic", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, toFollowers(testFederatedActorIRI, mustParse(testMyInboxIRI), otherInbox))
+		act := newCreate(PublicActivityPubIRI)
+		// Mock
+		expectNewFn(db)
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 2)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+		assertEqual(t, inboxes[1].String(), otherInbox.String())
+	})
+	t.Run("ReturnsLocalFollowersIfAddressedToRemoteCollection", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, toFollowers(testFederatedActorIRI, otherInbox, mustParse(testMyInboxIRI)))
+		act := newCreate(testPersonIRI, testAudienceIRI)
+		// Mock
+		expectNewFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		db.EXPECT().Owns(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		db.EXPECT().InboxForActor(ctx, mustParse(testPersonIRI)).Return(mustParse(testMyInboxIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		db.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		db.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 2)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+		assertEqual(t, inboxes[1].String(), otherInbox.String())
+	})
+	t.Run("OmitsInboxesOfActorsBlockingTheActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, a := setupFn(ctl, toFollowers(testFederatedActorIRI, mustParse(testMyInboxIRI), otherInbox))
+		db := NewMockBlocksDatabase(ctl)
+		a.(*sideEffectActor).db = db
+		act := newCreate(PublicActivityPubIRI)
+		blocks := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		blocks.SetActivityStreamsItems(items)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		db.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		expectBlocksFn(db, mustParse(testMyInboxIRI), mustParse(testPersonIRI), blocks)
+		expectBlocksFn(db, otherInbox, otherActor, testMyBlocks)
+		// Run & Verify
+		inboxes, err := a.SharedInboxRecipients(ctx, act)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), otherInbox.String())
+	})
+	t.Run("ReturnsErrorIfLocalFollowersFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl, toFollowers(testFederatedActorIRI2))
+		act := newCreate(PublicActivityPubIRI)
+		// Mock
+		expectNewFn(db)
+		// Run & Verify
+		_, err := a.SharedInboxRecipients(ctx, act)
+		assertNotEqual(t, err, nil)
+	})
+}
+
 // TestInboxForwarding ensures that the inbox forwarding logic is correct.
 func TestInboxForwarding(t *testing.T) {
 	ctx := context.Background()
@@ -366,6 +634,16 @@ func TestInboxForwarding(t *testing.T) {
 		}
 		return
 	}
+	t.Run("DoesNotForwardSharedInboxCopy", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, _, _, a := setupFn(ctl)
+		// Run
+		err := a.InboxForwarding(withSharedInboxCopy(ctx), mustParse(testMyInboxIRI), testListen)
+		// Verify
+		assertEqual(t, err, nil)
+	})
 	t.Run("DoesNotForwardIfAlreadyExists", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -1119,6 +1397,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1138,6 +1422,84 @@ func TestDeliver(t *testing.T) {
 		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
 		assertEqual(t, err, nil)
 	})
+	t.Run("DoesNotSendToBlockedActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, _, _, a := setupFn(ctl)
+		mockDb := NewMockBlocksDatabase(ctl)
+		a.(*sideEffectActor).db = mockDb
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		to.AppendIRI(mustParse(testFederatedActorIRI2))
+		act.SetActivityStreamsTo(to)
+		blocks := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI2))
+		blocks.SetActivityStreamsItems(items)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI)).Times(2)
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Blocks(ctx, mustParse(testPersonIRI)).Return(
+			blocks, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI)).Times(2)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotSendToSuspendedServers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		a.(*sideEffectActor).federationPolicy = DomainPolicy{
+			Suspended: []string{"other.example.com"},
+		}
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		act.SetActivityStreamsTo(to)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), []*url.URL(nil))
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
 	t.Run("SendToRecipientsInBto", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -1158,6 +1520,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1196,6 +1564,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1235,6 +1609,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1273,6 +1653,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1312,6 +1698,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1331,6 +1723,98 @@ func TestDeliver(t *testing.T) {
 		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
 		assertEqual(t, err, nil)
 	})
+	t.Run("SendsToSharedInboxIfPublic", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		to.AppendIRI(mustParse(testFederatedActorIRI2))
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		act.SetActivityStreamsTo(to)
+		p1 := withSharedInbox(testFederatedPerson1, testFederatedSharedInboxIRI)
+		p2 := withSharedInbox(testFederatedPerson2, testFederatedSharedInboxIRI)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedSharedInboxIRI),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(p1), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(p2), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotSendToSharedInboxIfOnlyAddressedToActors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		to.AppendIRI(mustParse(testFederatedActorIRI2))
+		act.SetActivityStreamsTo(to)
+		p1 := withSharedInbox(testFederatedPerson1, testFederatedSharedInboxIRI)
+		p2 := withSharedInbox(testFederatedPerson2, testFederatedSharedInboxIRI)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+			mustParse(testFederatedInboxIRI2),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(p1), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(p2), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
 	t.Run("RecursivelyResolveCollectionActors", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -1349,6 +1833,9 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
 			mustSerializeToBytes(testCollectionOfActors), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
@@ -1388,6 +1875,9 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
 			mustSerializeToBytes(testOrderedCollectionOfActors), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI3)).Return(
@@ -1423,6 +1913,9 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
 			mustSerializeToBytes(testCollectionOfActors), nil)
 		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
@@ -1440,6 +1933,216 @@ func TestDeliver(t *testing.T) {
 		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
 		assertEqual(t, err, nil)
 	})
+	// toPagedCollection creates an OrderedCollection whose first page is at
+	// the IRI, and a page at each following IRI with one actor each.
+	toPagedCollection := func(pageIRIs []string, actorIRIs []string) (vocab.ActivityStreamsOrderedCollection, []vocab.ActivityStreamsOrderedCollectionPage) {
+		oc := streams.NewActivityStreamsOrderedCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testAudienceIRI))
+		oc.SetJSONLDId(id)
+		first := streams.NewActivityStreamsFirstProperty()
+		first.SetIRI(mustParse(pageIRIs[0]))
+		oc.SetActivityStreamsFirst(first)
+		var pages []vocab.ActivityStreamsOrderedCollectionPage
+		for i, pageIRI := range pageIRIs {
+			page := streams.NewActivityStreamsOrderedCollectionPage()
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(pageIRI))
+			page.SetJSONLDId(id)
+			oi := streams.NewActivityStreamsOrderedItemsProperty()
+			oi.AppendIRI(mustParse(actorIRIs[i]))
+			page.SetActivityStreamsOrderedItems(oi)
+			first := streams.NewActivityStreamsFirstProperty()
+			first.SetIRI(mustParse(pageIRIs[0]))
+			page.SetActivityStreamsFirst(first)
+			if i+1 < len(pageIRIs) {
+				next := streams.NewActivityStreamsNextProperty()
+				next.SetIRI(mustParse(pageIRIs[i+1]))
+				page.SetActivityStreamsNext(next)
+			}
+			pages = append(pages, page)
+		}
+		return oc, pages
+	}
+	testPageIRIs := []string{testAudienceIRI + "?page=1", testAudienceIRI + "?page=2"}
+	t.Run("ResolvesCollectionActorsOnPages", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testAudienceIRI))
+		act.SetActivityStreamsTo(to)
+		oc, pages := toPagedCollection(testPageIRIs, []string{testFederatedActorIRI, testFederatedActorIRI2})
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+			mustParse(testFederatedInboxIRI2),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
+			mustSerializeToBytes(oc), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testPageIRIs[0])).Return(
+			mustSerializeToBytes(pages[0]), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testPageIRIs[1])).Return(
+			mustSerializeToBytes(pages[1]), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(testFederatedPerson2), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("ResolvesCollectionActorsOnEmbeddedFirstPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testAudienceIRI))
+		act.SetActivityStreamsTo(to)
+		oc, pages := toPagedCollection(testPageIRIs, []string{testFederatedActorIRI, testFederatedActorIRI2})
+		first := streams.NewActivityStreamsFirstProperty()
+		first.SetActivityStreamsOrderedCollectionPage(pages[0])
+		oc.SetActivityStreamsFirst(first)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+			mustParse(testFederatedInboxIRI2),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
+			mustSerializeToBytes(oc), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testPageIRIs[1])).Return(
+			mustSerializeToBytes(pages[1]), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(testFederatedPerson2), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotResolveCollectionPagesBeyondLimit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		a.(*sideEffectActor).maxCollectionPages = 2
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testAudienceIRI))
+		act.SetActivityStreamsTo(to)
+		oc, pages := toPagedCollection(testPageIRIs, []string{testFederatedActorIRI, testFederatedActorIRI2})
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
+			mustSerializeToBytes(oc), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testPageIRIs[0])).Return(
+			mustSerializeToBytes(pages[0]), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotResolveCollectionItemsBeyondLimit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		a.(*sideEffectActor).maxCollectionItems = 1
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testAudienceIRI))
+		act.SetActivityStreamsTo(to)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockDb.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testAudienceIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testAudienceIRI)).Return(
+			mustSerializeToBytes(testCollectionOfActors), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
 	t.Run("DedupesRecipients", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -1474,6 +2177,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)).Times(4)
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil).Times(4)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)).Times(4)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2)).Times(4)
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil).Times(4)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2)).Times(4)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil).Times(4)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1514,6 +2223,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1554,6 +2269,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1591,6 +2312,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			[]byte{}, fmt.Errorf("test error"))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1630,6 +2357,12 @@ func TestDeliver(t *testing.T) {
 		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
 			mockTp, nil)
 		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDb.EXPECT().InboxForActor(ctx, mustParse(testFederatedActorIRI2)).Return(nil, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
 			mustSerializeToBytes(testFederatedPerson1), nil)
 		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
@@ -1654,6 +2387,112 @@ func TestDeliver(t *testing.T) {
 
 // TestWrapInCreate ensures an object received by the Social Protocol is
 // properly wrapped in a Create Activity.
+func TestDeleteActor(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, db *MockDatabase, cl *MockClock, a *sideEffectActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		fp = NewMockFederatingProtocol(ctl)
+		db = NewMockDatabase(ctl)
+		cl = NewMockClock(ctl)
+		a = &sideEffectActor{
+			common: c,
+			s2s:    fp,
+			db:     db,
+			clock:  cl,
+		}
+		return
+	}
+	expectDeleteFn := func() vocab.ActivityStreamsDelete {
+		d := streams.NewActivityStreamsDelete()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		d.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		d.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testPersonIRI))
+		d.SetActivityStreamsObject(op)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		d.SetActivityStreamsTo(to)
+		return d
+	}
+	t.Run("DeliversDeleteAndTombstonesActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, mockDb, mockClock, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		a.knownSharedInboxes = func(c context.Context, actorIRI *url.URL) ([]*url.URL, error) {
+			assertEqual(t, actorIRI.String(), testPersonIRI)
+			return []*url.URL{
+				mustParse(testFederatedSharedInboxIRI),
+				mustParse(testFederatedSharedInboxIRI),
+			}, nil
+		}
+		expect := expectDeleteFn()
+		expectTomb := toTombstone(testMyPerson, mustParse(testPersonIRI), now())
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI)).Times(3)
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil).Times(2)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI)).Times(3)
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI)).Times(3)
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil).Times(2)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI)).Times(3)
+		mockDb.EXPECT().NewID(ctx, gomock.Any()).Return(mustParse(testNewActivityIRI), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testNewActivityIRI))
+		mockDb.EXPECT().Create(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expect))
+			return nil
+		})
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI))
+		mockDb.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			streams.NewActivityStreamsOrderedCollectionPage(), nil)
+		mockDb.EXPECT().SetOutbox(ctx, gomock.Any()).Return(nil)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil).Times(2)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(expect), []*url.URL{
+			mustParse(testFederatedSharedInboxIRI),
+		})
+		mockClock.EXPECT().Now().Return(now())
+		mockDb.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, v vocab.Type) error {
+			assertByteEqual(t, mustSerializeToBytes(v), mustSerializeToBytes(expectTomb))
+			return nil
+		})
+		// Run
+		got, err := a.DeleteActor(ctx, mustParse(testMyOutboxIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(got), mustSerializeToBytes(expect))
+	})
+	t.Run("ErrorIfAlreadyDeleted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, mockDb, _, a := setupFn(ctl)
+		tomb := toTombstone(testMyPerson, mustParse(testPersonIRI), now())
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(tomb, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		_, err := a.DeleteActor(ctx, mustParse(testMyOutboxIRI))
+		// Verify
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+}
+
 func TestWrapInCreate(t *testing.T) {
 	baseNoteFn := func() (vocab.ActivityStreamsNote, vocab.ActivityStreamsCreate) {
 		n := streams.NewActivityStreamsNote()
@@ -18,7 +18,9 @@ type SocialWrappedCallbacks struct {
 	//
 	// The wrapping callback copies the actor(s) to the 'attributedTo'
 	// property and copies recipients between the Create activity and all
-	// objects. It then saves the entry in the database.
+	// objects. It then saves the entry in the database, and adds the
+	// objects replying to objects owned by this server to their 'replies'
+	// collection.
 	Create func(context.Context, vocab.ActivityStreamsCreate) error
 	// Update handles additional side effects for the Update ActivityStreams
 	// type.
@@ -31,7 +33,8 @@ type SocialWrappedCallbacks struct {
 	// type.
 	//
 	// The wrapping callback replaces the object(s) with tombstones in the
-	// database.
+	// database, and removes them from the 'replies' collection of the
+	// objects owned by this server.
 	Delete func(context.Context, vocab.ActivityStreamsDelete) error
 	// Follow handles additional side effects for the Follow ActivityStreams
 	// type.
@@ -69,20 +72,58 @@ type SocialWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// The wrapping function reverses the side effects of undone Follow,
+	// Accept, Like, Announce, and Block activities: the objects are
+	// removed from the "following", "liked", or blocks collection of this
+	// actor, the actors from its "followers" collection, and the activity
+	// from the "likes" or "shares" collection of all 'object' targets
+	// owned by this server. Activities referred to by IRI are resolved
+	// from the database.
+	//
+	// Like the Blocks they undo, Undos of Blocks are not federated.
+	//
 	// It is expected that the application will implement the proper
-	// reversal of activities that are being undone.
+	// reversal of any other activities that are being undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type.
 	//
-	// The wrapping callback only ensures the 'Block' has at least one
-	// 'object' entry, but otherwise has no default side effect. It is up
-	// to the wrapped application function to properly enforce the new
-	// blocking behavior.
+	// The wrapping callback ensures the 'Block' has at least one 'object'
+	// entry. If the Database is a BlocksDatabase, it adds the objects to
+	// the blocks collection of this actor, and removes them from its
+	// "followers" and "following" collections. Afterwards, the activities
+	// of the blocked actors are refused in the inbox of this actor, and
+	// activities from this actor are not delivered to them.
 	//
 	// Note that go-fed does not federate 'Block' activities received in the
 	// Social Protocol.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type.
+	//
+	// The wrapping callback ensures the 'Move' has a single 'object' that
+	// is the actor of this outbox, and a single 'target' listing the
+	// 'object' in its 'alsoKnownAs' property. It then sets the 'movedTo'
+	// property of the actor to the 'target', and addresses the 'Move' to
+	// the actor's followers so that they may follow the 'target'.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
+	// Flag handles additional side effects for the Flag ActivityStreams
+	// type.
+	//
+	// The wrapping callback ensures the 'Flag' has at least one 'object'
+	// and is addressed to recipients, none of which may be the public, so
+	// that the report is delivered only to the peers it concerns.
+	//
+	// If AnonymousFlagOutbox is set, the 'Flag' is not delivered as is.
+	// Instead, a copy is delivered with the actor of that outbox as its
+	// 'actor', so that the reporter's identity is not disclosed.
+	Flag func(context.Context, vocab.ActivityStreamsFlag) error
+	// AnonymousFlagOutbox is the outbox of an instance-level actor that
+	// delivers 'Flag' activities on behalf of the reporting actors. It may
+	// be set when returned by SocialCallbacks for requests where the
+	// reporter asked to remain anonymous. Delivering anonymous reports
+	// requires the Federating Protocol.
+	AnonymousFlagOutbox *url.URL
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -99,6 +140,12 @@ type SocialWrappedCallbacks struct {
 	clock Clock
 	// newTransport creates a new Transport.
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	// addNewIds creates new 'id' entries on an activity and its objects if
+	// it is a Create activity.
+	addNewIds func(c context.Context, activity Activity) error
+	// deliver delivers an outgoing message. It is nil if the Federating
+	// Protocol is not supported.
+	deliver func(c context.Context, outboxIRI *url.URL, activity Activity) error
 	// undeliverable is a sidechannel out, indicating if the handled activity
 	// should not be delivered to a peer.
 	//
@@ -122,6 +169,8 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableLike := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
+	enableFlag := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -144,6 +193,10 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
+		case func(context.Context, vocab.ActivityStreamsFlag) error:
+			enableFlag = false
 		}
 	}
 	if enableCreate {
@@ -173,6 +226,12 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
+	if enableFlag {
+		fns = append(fns, w.flag)
+	}
 	return fns
 }
 
@@ -275,6 +334,12 @@ func (w SocialWrappedCallbacks) create(c context.Context, a vocab.ActivityStream
 			return err
 		}
 	}
+	// Add the objects replying to local objects to their replies.
+	for i := 0; i < op.Len(); i++ {
+		if err := addReply(c, w.db, op.At(i).GetType()); err != nil {
+			return err
+		}
+	}
 	if w.Create != nil {
 		return w.Create(c, a)
 	}
@@ -367,6 +432,7 @@ func (w SocialWrappedCallbacks) deleteFn(c context.Context, a vocab.ActivityStre
 		}
 		objIds = append(objIds, id)
 	}
+	var deleted []vocab.Type
 	// Create anonymous loop function to be able to properly scope the defer
 	// for the database lock at each iteration.
 	loopFn := func(idx int, loopId *url.URL) error {
@@ -379,6 +445,7 @@ func (w SocialWrappedCallbacks) deleteFn(c context.Context, a vocab.ActivityStre
 		if err != nil {
 			return err
 		}
+		deleted = append(deleted, t)
 		tomb := toTombstone(t, loopId, w.clock.Now())
 		if err := w.db.Update(c, tomb); err != nil {
 			return err
@@ -390,6 +457,11 @@ func (w SocialWrappedCallbacks) deleteFn(c context.Context, a vocab.ActivityStre
 			return err
 		}
 	}
+	for _, t := range deleted {
+		if err := removeReply(c, w.db, t); err != nil {
+			return err
+		}
+	}
 	if w.Delete != nil {
 		return w.Delete(c, a)
 	}
@@ -511,6 +583,11 @@ func (w SocialWrappedCallbacks) undo(c context.Context, a vocab.ActivityStreamsU
 	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.outboxIRI); err != nil {
 		return err
 	}
+	u := &undoer{db: w.db, boxIRI: w.outboxIRI, federated: false}
+	if err := u.undo(c, a); err != nil {
+		return err
+	}
+	*w.undeliverable = u.undidBlock
 	if w.Undo != nil {
 		return w.Undo(c, a)
 	}
@@ -524,8 +601,173 @@ func (w SocialWrappedCallbacks) block(c context.Context, a vocab.ActivityStreams
 	if op == nil || op.Len() == 0 {
 		return ErrObjectRequired
 	}
+	if db, ok := w.db.(BlocksDatabase); ok {
+		objectIds, err := getObjectIds(a)
+		if err != nil {
+			return err
+		}
+		if err := db.Lock(c, w.outboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		actorIRI, err := db.ActorForOutbox(c, w.outboxIRI)
+		if err != nil {
+			db.Unlock(c, w.outboxIRI)
+			return err
+		}
+		db.Unlock(c, w.outboxIRI)
+		// Unlock must be called by now and every branch above.
+		if err := addBlocks(c, db, actorIRI, objectIds); err != nil {
+			return err
+		}
+	}
 	if w.Block != nil {
 		return w.Block(c, a)
 	}
 	return nil
 }
+
+// move implements the social Move activity side effects.
+func (w SocialWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	*w.undeliverable = false
+	origin, target, err := getMoveOriginAndTarget(a)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Lock(c, w.outboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.outboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.outboxIRI)
+	// Unlock must be called by now and every branch above.
+	if origin.String() != actorIRI.String() {
+		return fmt.Errorf("cannot move %s: only the actor %s of this outbox may be moved", origin, actorIRI)
+	}
+	if err := mustHaveMoveTargetAlias(c, w.db, w.newTransport, w.outboxIRI, origin, target); err != nil {
+		return err
+	}
+	// Set the 'movedTo' property of the actor.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	t, err := w.db.Get(c, actorIRI)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	u, ok := t.(unknownPropertieser)
+	if !ok {
+		w.db.Unlock(c, actorIRI)
+		return fmt.Errorf("cannot set movedTo on actor %s of type %T", actorIRI, t)
+	}
+	// The 'movedTo' property is not part of the ActivityStreams
+	// vocabulary, so it is set as an unknown property.
+	u.GetUnknownProperties()["movedTo"] = target.String()
+	if err = w.db.Update(c, t); err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	//
+	// Ensure the Move is delivered to the followers.
+	if followers := getFollowers(t); followers != nil {
+		recipients, err := getRecipients(a)
+		if err != nil {
+			return err
+		}
+		if !containsIRI(recipients, followers) {
+			cc := a.GetActivityStreamsCc()
+			if cc == nil {
+				cc = streams.NewActivityStreamsCcProperty()
+				a.SetActivityStreamsCc(cc)
+			}
+			cc.AppendIRI(followers)
+		}
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
+
+// flag implements the social Flag activity side effects.
+func (w SocialWrappedCallbacks) flag(c context.Context, a vocab.ActivityStreamsFlag) error {
+	*w.undeliverable = false
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	recipients, err := getRecipients(a)
+	if err != nil {
+		return err
+	} else if len(recipients) == 0 {
+		return fmt.Errorf("a Flag must be addressed to the peers it reports")
+	}
+	for _, iri := range recipients {
+		if IsPublic(iri.String()) {
+			return fmt.Errorf("a Flag must not be addressed to the public")
+		}
+	}
+	if w.AnonymousFlagOutbox != nil {
+		if w.deliver == nil {
+			return fmt.Errorf("cannot deliver an anonymous Flag without the Federating Protocol")
+		}
+		anon, err := w.anonymousFlag(c, a)
+		if err != nil {
+			return err
+		} else if err = w.addNewIds(c, anon); err != nil {
+			return err
+		} else if err = w.deliver(c, w.AnonymousFlagOutbox, anon); err != nil {
+			return err
+		}
+		// Only the anonymous copy is delivered.
+		*w.undeliverable = true
+	}
+	if w.Flag != nil {
+		return w.Flag(c, a)
+	}
+	return nil
+}
+
+// anonymousFlag copies the Flag, replacing its 'actor' with the actor of the
+// AnonymousFlagOutbox. The copy has no 'id'.
+func (w SocialWrappedCallbacks) anonymousFlag(c context.Context, a vocab.ActivityStreamsFlag) (Activity, error) {
+	if err := w.db.Lock(c, w.AnonymousFlagOutbox); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock not deferred.
+	instanceActor, err := w.db.ActorForOutbox(c, w.AnonymousFlagOutbox)
+	if err != nil {
+		w.db.Unlock(c, w.AnonymousFlagOutbox)
+		return nil, err
+	}
+	w.db.Unlock(c, w.AnonymousFlagOutbox)
+	// Unlock must be called by now and every branch above.
+	m, err := streams.Serialize(a)
+	if err != nil {
+		return nil, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	anon, ok := t.(Activity)
+	if !ok {
+		return nil, fmt.Errorf("a copied Flag does not satisfy the Activity interface")
+	}
+	anon.SetJSONLDId(nil)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(instanceActor)
+	anon.SetActivityStreamsActor(actor)
+	if at, ok := anon.(attributedToer); ok {
+		at.SetActivityStreamsAttributedTo(nil)
+	}
+	return anon, nil
+}
@@ -0,0 +1,382 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+func TestSocialMove(t *testing.T) {
+	const (
+		testMyFollowersIRI = "https://example.com/addison/followers"
+		testMyNewActorIRI  = "https://example.com/addison2"
+	)
+	newMoveFn := func() vocab.ActivityStreamsMove {
+		m := streams.NewActivityStreamsMove()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		m.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testPersonIRI))
+		m.SetActivityStreamsObject(op)
+		tp := streams.NewActivityStreamsTargetProperty()
+		tp.AppendIRI(mustParse(testMyNewActorIRI))
+		m.SetActivityStreamsTarget(tp)
+		return m
+	}
+	newPersonFn := func(id string) vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		idProp := streams.NewJSONLDIdProperty()
+		idProp.Set(mustParse(id))
+		p.SetJSONLDId(idProp)
+		return p
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w SocialWrappedCallbacks, mockDB *MockDatabase, mockTp *MockTransport) {
+		mockDB = NewMockDatabase(ctl)
+		mockTp = NewMockTransport(ctl)
+		w.outboxIRI = mustParse(testMyOutboxIRI)
+		w.db = mockDB
+		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
+			return mockTp, nil
+		}
+		undeliverable := true
+		w.undeliverable = &undeliverable
+		return
+	}
+	expectActorFn := func(mockDB *MockDatabase) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+	}
+	t.Run("ErrorIfNoTarget", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		m := newMoveFn()
+		m.SetActivityStreamsTarget(nil)
+		err := w.move(ctx, m)
+		assertEqual(t, err, ErrTargetRequired)
+	})
+	t.Run("ErrorIfObjectIsNotOutboxActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		expectActorFn(mockDB)
+		m := newMoveFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsObject(op)
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ErrorIfTargetDoesNotListAlias", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		expectActorFn(mockDB)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyNewActorIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testMyNewActorIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testMyNewActorIRI)).Return(
+			newPersonFn(testMyNewActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyNewActorIRI))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("SetsMovedToAndAddressesFollowers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		target := newPersonFn(testMyNewActorIRI)
+		target.GetUnknownProperties()["alsoKnownAs"] = testPersonIRI
+		me := newPersonFn(testPersonIRI)
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(mustParse(testMyFollowersIRI))
+		me.SetActivityStreamsFollowers(followers)
+		expectActorFn(mockDB)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyNewActorIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testMyNewActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyNewActorIRI))
+		mockTp.EXPECT().Dereference(ctx, mustParse(testMyNewActorIRI)).Return(
+			mustSerializeToBytes(target), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(me, nil)
+		mockDB.EXPECT().Update(ctx, me)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, *w.undeliverable, false)
+		assertEqual(t, me.GetUnknownProperties()["movedTo"], testMyNewActorIRI)
+		cc := m.GetActivityStreamsCc()
+		if cc == nil || cc.Len() != 1 {
+			t.Fatalf("expected followers in cc")
+		}
+		assertEqual(t, cc.At(0).GetIRI().String(), testMyFollowersIRI)
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		target := newPersonFn(testMyNewActorIRI)
+		target.GetUnknownProperties()["alsoKnownAs"] = []interface{}{testPersonIRI}
+		me := newPersonFn(testPersonIRI)
+		expectActorFn(mockDB)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyNewActorIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testMyNewActorIRI)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testMyNewActorIRI)).Return(target, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyNewActorIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(me, nil)
+		mockDB.EXPECT().Update(ctx, me)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		var gotc context.Context
+		var got vocab.ActivityStreamsMove
+		w.Move = func(ctx context.Context, v vocab.ActivityStreamsMove) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, m, got)
+	})
+}
+
+func TestSocialFlag(t *testing.T) {
+	const testInstanceOutboxIRI = "https://example.com/actor/outbox"
+	const testInstanceActorIRI = "https://example.com/actor"
+	newFlagFn := func() vocab.ActivityStreamsFlag {
+		f := streams.NewActivityStreamsFlag()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		f.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		f.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		f.SetActivityStreamsObject(op)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		f.SetActivityStreamsTo(to)
+		content := streams.NewActivityStreamsContentProperty()
+		content.AppendXMLSchemaString("Spam")
+		f.SetActivityStreamsContent(content)
+		return f
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w SocialWrappedCallbacks, mockDB *MockDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		w.outboxIRI = mustParse(testMyOutboxIRI)
+		w.db = mockDB
+		undeliverable := true
+		w.undeliverable = &undeliverable
+		return
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		f := newFlagFn()
+		f.SetActivityStreamsObject(nil)
+		err := w.flag(ctx, f)
+		assertEqual(t, err, ErrObjectRequired)
+	})
+	t.Run("ErrorIfNotAddressed", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		f := newFlagFn()
+		f.SetActivityStreamsTo(nil)
+		err := w.flag(ctx, f)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ErrorIfAddressedToPublic", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		f := newFlagFn()
+		f.GetActivityStreamsTo().AppendIRI(mustParse(PublicActivityPubIRI))
+		err := w.flag(ctx, f)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("DeliversAsReporterByDefault", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		f := newFlagFn()
+		err := w.flag(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, *w.undeliverable, false)
+	})
+	t.Run("ErrorIfAnonymousWithoutFederation", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		w.AnonymousFlagOutbox = mustParse(testInstanceOutboxIRI)
+		f := newFlagFn()
+		err := w.flag(ctx, f)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("DeliversAnonymousCopy", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.AnonymousFlagOutbox = mustParse(testInstanceOutboxIRI)
+		var gotOutbox *url.URL
+		var delivered Activity
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(testNewActivityIRI2))
+			activity.SetJSONLDId(id)
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			gotOutbox = outboxIRI
+			delivered = activity
+			return nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testInstanceOutboxIRI))
+		mockDB.EXPECT().ActorForOutbox(ctx, mustParse(testInstanceOutboxIRI)).Return(
+			mustParse(testInstanceActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testInstanceOutboxIRI))
+		f := newFlagFn()
+		err := w.flag(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		expect := newFlagFn()
+		expect.GetJSONLDId().Set(mustParse(testNewActivityIRI2))
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testInstanceActorIRI))
+		expect.SetActivityStreamsActor(actor)
+		assertEqual(t, *w.undeliverable, true)
+		assertEqual(t, gotOutbox.String(), testInstanceOutboxIRI)
+		assertByteEqual(t, mustSerializeToBytes(delivered), mustSerializeToBytes(expect))
+		// The reporter's own Flag is unchanged.
+		assertByteEqual(t, mustSerializeToBytes(f), mustSerializeToBytes(newFlagFn()))
+	})
+}
+
+func TestSocialBlock(t *testing.T) {
+	newCollectionFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	newBlockFn := func() vocab.ActivityStreamsBlock {
+		b := streams.NewActivityStreamsBlock()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI))
+		b.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		b.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		b.SetActivityStreamsObject(op)
+		return b
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w SocialWrappedCallbacks, mockDB *MockBlocksDatabase) {
+		mockDB = NewMockBlocksDatabase(ctl)
+		w.outboxIRI = mustParse(testMyOutboxIRI)
+		w.db = mockDB
+		undeliverable := false
+		w.undeliverable = &undeliverable
+		return
+	}
+	expectBlockFn := func(mockDB *MockBlocksDatabase) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Blocks(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI, testFederatedActorIRI2))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI, testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI3))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		b := newBlockFn()
+		b.SetActivityStreamsObject(nil)
+		err := w.block(ctx, b)
+		assertEqual(t, err, ErrObjectRequired)
+	})
+	t.Run("AddsToBlocksAndRemovesFromFollowers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		expectBlockFn(mockDB)
+		err := w.block(ctx, newBlockFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, *w.undeliverable, true)
+	})
+	t.Run("SkipsBlocksWithoutBlocksDatabase", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		w.db = NewMockDatabase(ctl)
+		err := w.block(ctx, newBlockFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, *w.undeliverable, true)
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		expectBlockFn(mockDB)
+		var got vocab.ActivityStreamsBlock
+		w.Block = func(ctx context.Context, v vocab.ActivityStreamsBlock) error {
+			got = v
+			return nil
+		}
+		b := newBlockFn()
+		err := w.block(ctx, b)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, b, got)
+	})
+}
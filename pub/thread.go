@@ -0,0 +1,432 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// ThreadFetchPolicy bounds the requests a ThreadFetcher makes to backfill a
+// thread.
+type ThreadFetchPolicy struct {
+	// MaxObjects is the maximum number of objects of a thread visited in
+	// one backfill, including those already in the Database.
+	MaxObjects int
+	// MaxPages is the maximum number of pages of each 'replies'
+	// collection that are dereferenced.
+	MaxPages int
+	// HostInterval is the minimum delay between two requests to the same
+	// host. Zero or negative does not limit the rate of requests.
+	HostInterval time.Duration
+	// Timeout bounds the duration of each backfill run in the background
+	// for a received reply. Zero or negative does not bound it.
+	Timeout time.Duration
+	// MaxConcurrent is the maximum number of backfills running in the
+	// background at once. Replies received while it is reached are not
+	// backfilled. Zero or negative does not bound it.
+	MaxConcurrent int
+}
+
+// DefaultThreadFetchPolicy returns a policy visiting up to 200 objects of a
+// thread, with up to 5 pages of replies each, while making at most one request
+// per second to each host, for up to 5 minutes in the background with up to 8
+// backfills at once.
+func DefaultThreadFetchPolicy() ThreadFetchPolicy {
+	return ThreadFetchPolicy{
+		MaxObjects:    200,
+		MaxPages:      5,
+		HostInterval:  time.Second,
+		Timeout:       5 * time.Minute,
+		MaxConcurrent: 8,
+	}
+}
+
+// ThreadFetcher backfills the threads of objects: it walks their 'inReplyTo'
+// ancestors upward, and the 'replies' collections of the top-most ancestor and
+// its descendants downward. Objects missing from the Database are dereferenced
+// and stored with Create.
+//
+// Objects that cannot be dereferenced, or whose id is not on the origin of
+// their IRI, are skipped along with their part of the thread.
+//
+// Federating Actors configured with WithThreadFetcher backfill the thread of a
+// created reply when the object it replies to is not in the Database. As this
+// may take minutes, the backfill runs in the background, with a context that
+// keeps the values of the request's context but not its cancellation, bounded
+// by the policy's Timeout. Its errors are discarded, as the Create has already
+// been handled. No backfill is started for a reply to an object whose thread is
+// already being backfilled in the background, nor while MaxConcurrent backfills
+// are running, in which case the reply is only stored. Wait blocks until these backfills are done, such as before
+// shutting down. The application may also call Backfill on demand.
+//
+// A ThreadFetcher is safe for concurrent use, and its HostInterval applies
+// across concurrent backfills.
+type ThreadFetcher struct {
+	db          Database
+	common      CommonBehavior
+	clock       Clock
+	policy      ThreadFetchPolicy
+	mu          *sync.Mutex
+	nextRequest map[string]time.Time
+	// background tracks the backfills running in the background.
+	background *sync.WaitGroup
+	// inFlight are the ids of the objects replied to whose threads are
+	// being backfilled in the background, guarded by mu.
+	inFlight map[string]bool
+	// sleep waits for the duration, unless the context is done first.
+	sleep func(c context.Context, d time.Duration) error
+}
+
+// NewThreadFetcher returns a ThreadFetcher storing objects in the Database, and
+// dereferencing them with the Transports of the CommonBehavior.
+func NewThreadFetcher(db Database, common CommonBehavior, clock Clock, policy ThreadFetchPolicy) *ThreadFetcher {
+	return &ThreadFetcher{
+		db:          db,
+		common:      common,
+		clock:       clock,
+		policy:      policy,
+		mu:          &sync.Mutex{},
+		nextRequest: make(map[string]time.Time),
+		background:  &sync.WaitGroup{},
+		inFlight:    make(map[string]bool),
+		sleep:       sleepContext,
+	}
+}
+
+// threadBackfill is the state of a single backfill.
+type threadBackfill struct {
+	// t dereferences on behalf of the actor owning the inbox or outbox.
+	t *threadTransport
+	// seen are the ids of the objects visited.
+	seen map[string]bool
+}
+
+// Backfill fetches the missing objects of the thread of the object, on behalf
+// of the actor owning the inbox or outbox.
+//
+// Only errors of the Database, or of the context being done, are returned.
+func (f *ThreadFetcher) Backfill(c context.Context, boxIRI *url.URL, object vocab.Type) error {
+	id, err := GetId(object)
+	if err != nil {
+		return err
+	}
+	b := &threadBackfill{
+		t:    &threadTransport{f: f, boxIRI: boxIRI},
+		seen: map[string]bool{id.String(): true},
+	}
+	// Walk the ancestors upward, following the first object each is in
+	// reply to.
+	top := object
+	for {
+		var parent vocab.Type
+		for _, parentIRI := range getInReplyToIds(top) {
+			if parent, err = f.visit(c, b, parentIRI); err != nil {
+				return err
+			} else if parent != nil {
+				break
+			}
+		}
+		if parent == nil {
+			break
+		}
+		top = parent
+	}
+	// Walk the replies downward from the top-most ancestor.
+	queue := []vocab.Type{top}
+	for len(queue) > 0 {
+		var replyIRIs []*url.URL
+		replyIRIs, err = f.replies(c, b, queue[0])
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+		for _, replyIRI := range replyIRIs {
+			var reply vocab.Type
+			if reply, err = f.visit(c, b, replyIRI); err != nil {
+				return err
+			} else if reply != nil {
+				queue = append(queue, reply)
+			}
+		}
+	}
+	return nil
+}
+
+// Wait blocks until the backfills running in the background are done.
+func (f *ThreadFetcher) Wait() {
+	f.background.Wait()
+}
+
+// backfillMissingParent backfills the thread of the object in the background
+// if it is in reply to an object that is not in the Database, unless that
+// thread is already being backfilled or MaxConcurrent backfills are running.
+//
+// Only errors of determining whether the objects replied to exist are returned.
+func (f *ThreadFetcher) backfillMissingParent(c context.Context, boxIRI *url.URL, object vocab.Type) error {
+	for _, parentIRI := range getInReplyToIds(object) {
+		exists, err := f.exists(c, parentIRI)
+		if err != nil {
+			return err
+		} else if !exists {
+			if !f.startBackground(parentIRI) {
+				return nil
+			}
+			f.background.Add(1)
+			go func() {
+				defer f.background.Done()
+				defer f.finishBackground(parentIRI)
+				var bc context.Context = detachedContext{c}
+				if f.policy.Timeout > 0 {
+					var cancel context.CancelFunc
+					bc, cancel = context.WithTimeout(bc, f.policy.Timeout)
+					defer cancel()
+				}
+				f.Backfill(bc, boxIRI, object)
+			}()
+			return nil
+		}
+	}
+	return nil
+}
+
+// startBackground marks the thread of the object replied to as being
+// backfilled in the background. Returns false if it already is, or if the
+// MaxConcurrent backfills are running.
+func (f *ThreadFetcher) startBackground(parentIRI *url.URL) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.inFlight[parentIRI.String()] {
+		return false
+	} else if f.policy.MaxConcurrent > 0 && len(f.inFlight) >= f.policy.MaxConcurrent {
+		return false
+	}
+	f.inFlight[parentIRI.String()] = true
+	return true
+}
+
+// finishBackground marks the thread of the object replied to as no longer
+// being backfilled in the background.
+func (f *ThreadFetcher) finishBackground(parentIRI *url.URL) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, parentIRI.String())
+}
+
+// visit returns the object from the Database, or dereferences and stores it.
+//
+// Returns nil if the object was already visited, the MaxObjects are reached, or
+// it cannot be dereferenced.
+func (f *ThreadFetcher) visit(c context.Context, b *threadBackfill, iri *url.URL) (vocab.Type, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if b.seen[iri.String()] || (f.policy.MaxObjects > 0 && len(b.seen) >= f.policy.MaxObjects) {
+		return nil, nil
+	}
+	b.seen[iri.String()] = true
+	t, err := f.get(c, iri)
+	if err != nil || t != nil {
+		return t, err
+	}
+	raw, err := b.t.Dereference(c, iri)
+	if err != nil {
+		// Missing object -- skip.
+		return nil, nil
+	}
+	m, err := unmarshalMap(raw)
+	if err != nil || checkOrigin(iri, m) != nil {
+		return nil, nil
+	}
+	t, err = streams.ToType(c, m)
+	if err != nil {
+		return nil, nil
+	}
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err = func() error {
+		if err := f.db.Lock(c, iri); err != nil {
+			return err
+		}
+		defer f.db.Unlock(c, iri)
+		return f.db.Create(c, t)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return t, addReply(c, f.db, t)
+}
+
+// replies returns the ids of the replies to the object, from the pages of its
+// 'replies' collection.
+func (f *ThreadFetcher) replies(c context.Context, b *threadBackfill, object vocab.Type) (ids []*url.URL, err error) {
+	r, ok := object.(replieser)
+	if !ok || r.GetActivityStreamsReplies() == nil {
+		return
+	}
+	replies := r.GetActivityStreamsReplies()
+	col := replies.GetType()
+	if col == nil && replies.IsIRI() {
+		if col, err = f.get(c, replies.GetIRI()); err != nil {
+			return
+		} else if col == nil {
+			if col, err = dereferenceType(c, b.t, replies.GetIRI()); err != nil {
+				// Missing collection -- skip.
+				return nil, nil
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for pages := 1; col != nil; pages++ {
+		if id, idErr := GetId(col); idErr == nil {
+			seen[id.String()] = true
+		}
+		var items []*url.URL
+		if items, err = collectionItems(col); err != nil {
+			// Malformed collection -- skip.
+			return ids, nil
+		}
+		ids = append(ids, items...)
+		if f.policy.MaxPages > 0 && pages >= f.policy.MaxPages {
+			return
+		}
+		col = nextCollectionPage(c, b.t, col, seen)
+	}
+	return
+}
+
+// get returns the object from the Database, or nil if it is not there.
+func (f *ThreadFetcher) get(c context.Context, iri *url.URL) (vocab.Type, error) {
+	if err := f.db.Lock(c, iri); err != nil {
+		return nil, err
+	}
+	defer f.db.Unlock(c, iri)
+	if exists, err := f.db.Exists(c, iri); err != nil || !exists {
+		return nil, err
+	}
+	return f.db.Get(c, iri)
+}
+
+// exists returns true if the object is in the Database.
+func (f *ThreadFetcher) exists(c context.Context, iri *url.URL) (bool, error) {
+	if err := f.db.Lock(c, iri); err != nil {
+		return false, err
+	}
+	defer f.db.Unlock(c, iri)
+	return f.db.Exists(c, iri)
+}
+
+// wait blocks until a request may be sent to the host under the HostInterval.
+func (f *ThreadFetcher) wait(c context.Context, host string) error {
+	if f.policy.HostInterval <= 0 {
+		return nil
+	}
+	f.mu.Lock()
+	now := f.clock.Now()
+	next, ok := f.nextRequest[host]
+	if !ok || next.Before(now) {
+		next = now
+	}
+	f.nextRequest[host] = next.Add(f.policy.HostInterval)
+	// Forget the hosts that may be requested again right away.
+	for h, n := range f.nextRequest {
+		if !n.After(now) {
+			delete(f.nextRequest, h)
+		}
+	}
+	f.mu.Unlock()
+	return f.sleep(c, next.Sub(now))
+}
+
+// threadTransport is the Transport of a backfill. It creates the Transport of
+// the actor on first use, and waits for the HostInterval before each request.
+type threadTransport struct {
+	f      *ThreadFetcher
+	boxIRI *url.URL
+	t      Transport
+}
+
+// threadTransport is a Transport.
+var _ Transport = &threadTransport{}
+
+// transport returns the Transport of the actor, creating it on first use.
+func (t *threadTransport) transport(c context.Context) (Transport, error) {
+	if t.t == nil {
+		tp, err := t.f.common.NewTransport(c, t.boxIRI, goFedUserAgent())
+		if err != nil {
+			return nil, err
+		}
+		t.t = tp
+	}
+	return t.t, nil
+}
+
+// Dereference waits for the HostInterval before dereferencing the IRI.
+func (t *threadTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	tp, err := t.transport(c)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.f.wait(c, iri.Host); err != nil {
+		return nil, err
+	}
+	return tp.Dereference(c, iri)
+}
+
+// Deliver sends the ActivityStreams object with the Transport of the actor.
+func (t *threadTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	tp, err := t.transport(c)
+	if err != nil {
+		return err
+	}
+	return tp.Deliver(c, b, to)
+}
+
+// BatchDeliver sends the ActivityStreams object with the Transport of the
+// actor.
+func (t *threadTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	tp, err := t.transport(c)
+	if err != nil {
+		return err
+	}
+	return tp.BatchDeliver(c, b, recipients)
+}
+
+// detachedContext has the values of its parent context, but is never done
+// when its parent is, so that work may outlive the request that started it.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline returns no deadline.
+func (d detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+// Done returns nil, as the context is never done.
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil, as the context is never done.
+func (d detachedContext) Err() error {
+	return nil
+}
+
+// sleepContext waits for the duration, unless the context is done first.
+func sleepContext(c context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,237 @@
+package pub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testThreadNoteIRI1      = "https://other.example.com/note/1"
+	testThreadNoteIRI2      = "https://other.example.com/note/2"
+	testThreadNoteIRI3      = "https://other.example.com/note/3"
+	testThreadRepliesIRI    = "https://other.example.com/note/1/replies"
+	testThreadOtherHostIRI2 = "https://evil.example.org/note/2"
+)
+
+// TestThreadFetcher ensures the ancestors and replies of an object are fetched
+// and stored within the limits of the policy.
+func TestThreadFetcher(t *testing.T) {
+	ctx := context.Background()
+	newNoteFn := func(id, inReplyTo string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		idProp := streams.NewJSONLDIdProperty()
+		idProp.Set(mustParse(id))
+		n.SetJSONLDId(idProp)
+		if len(inReplyTo) > 0 {
+			irt := streams.NewActivityStreamsInReplyToProperty()
+			irt.AppendIRI(mustParse(inReplyTo))
+			n.SetActivityStreamsInReplyTo(irt)
+		}
+		return n
+	}
+	setupFn := func(ctl *gomock.Controller, policy ThreadFetchPolicy) (db *MockDatabase, c *MockCommonBehavior, cl *MockClock, tp *MockTransport, f *ThreadFetcher) {
+		db = NewMockDatabase(ctl)
+		c = NewMockCommonBehavior(ctl)
+		cl = NewMockClock(ctl)
+		tp = NewMockTransport(ctl)
+		f = NewThreadFetcher(db, c, cl, policy)
+		return
+	}
+	expectMissing := func(db *MockDatabase, iri string) {
+		db.EXPECT().Lock(ctx, mustParse(iri))
+		db.EXPECT().Exists(ctx, mustParse(iri)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(iri))
+	}
+	expectFetched := func(db *MockDatabase, tp *MockTransport, note vocab.ActivityStreamsNote) {
+		id, _ := GetId(note)
+		expectMissing(db, id.String())
+		tp.EXPECT().Dereference(ctx, id).Return(mustSerializeToBytes(note), nil)
+		db.EXPECT().Lock(ctx, id)
+		db.EXPECT().Create(ctx, toDeserializedForm(note))
+		db.EXPECT().Unlock(ctx, id)
+	}
+	expectNotOwned := func(db *MockDatabase, iri string) {
+		db.EXPECT().Lock(ctx, mustParse(iri))
+		db.EXPECT().Owns(ctx, mustParse(iri)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(iri))
+	}
+	t.Run("FetchesMissingAncestors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, _, tp, f := setupFn(ctl, ThreadFetchPolicy{})
+		grandparent := newNoteFn(testThreadNoteIRI1, "")
+		parent := newNoteFn(testThreadNoteIRI2, testThreadNoteIRI1)
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		expectFetched(db, tp, parent)
+		expectNotOwned(db, testThreadNoteIRI1)
+		expectFetched(db, tp, grandparent)
+		// Run & Verify
+		err := f.Backfill(ctx, mustParse(testMyInboxIRI), reply)
+		assertEqual(t, err, nil)
+	})
+	t.Run("FetchesRepliesDownward", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, _, tp, f := setupFn(ctl, ThreadFetchPolicy{})
+		root := newNoteFn(testThreadNoteIRI1, "")
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetIRI(mustParse(testThreadRepliesIRI))
+		root.SetActivityStreamsReplies(replies)
+		col := streams.NewActivityStreamsCollection()
+		colId := streams.NewJSONLDIdProperty()
+		colId.Set(mustParse(testThreadRepliesIRI))
+		col.SetJSONLDId(colId)
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testThreadNoteIRI2))
+		col.SetActivityStreamsItems(items)
+		reply := newNoteFn(testThreadNoteIRI2, testThreadNoteIRI1)
+		// Mock
+		expectMissing(db, testThreadRepliesIRI)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testThreadRepliesIRI)).Return(mustSerializeToBytes(col), nil)
+		expectFetched(db, tp, reply)
+		expectNotOwned(db, testThreadNoteIRI1)
+		// Run & Verify
+		err := f.Backfill(ctx, mustParse(testMyInboxIRI), root)
+		assertEqual(t, err, nil)
+	})
+	t.Run("StopsAtMaxObjects", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, _, tp, f := setupFn(ctl, ThreadFetchPolicy{MaxObjects: 2})
+		parent := newNoteFn(testThreadNoteIRI2, testThreadNoteIRI1)
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		expectFetched(db, tp, parent)
+		expectNotOwned(db, testThreadNoteIRI1)
+		// Run & Verify
+		err := f.Backfill(ctx, mustParse(testMyInboxIRI), reply)
+		assertEqual(t, err, nil)
+	})
+	t.Run("SkipsObjectsOfOtherOrigin", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, _, tp, f := setupFn(ctl, ThreadFetchPolicy{})
+		forged := newNoteFn(testThreadNoteIRI2, "")
+		reply := newNoteFn(testThreadNoteIRI3, testThreadOtherHostIRI2)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		expectMissing(db, testThreadOtherHostIRI2)
+		tp.EXPECT().Dereference(ctx, mustParse(testThreadOtherHostIRI2)).Return(mustSerializeToBytes(forged), nil)
+		// Run & Verify
+		err := f.Backfill(ctx, mustParse(testMyInboxIRI), reply)
+		assertEqual(t, err, nil)
+	})
+	t.Run("WaitsBetweenRequestsToSameHost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, cl, tp, f := setupFn(ctl, ThreadFetchPolicy{HostInterval: time.Second})
+		var waits []time.Duration
+		f.sleep = func(c context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+		grandparent := newNoteFn(testThreadNoteIRI1, "")
+		parent := newNoteFn(testThreadNoteIRI2, testThreadNoteIRI1)
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		cl.EXPECT().Now().Return(now()).Times(2)
+		expectFetched(db, tp, parent)
+		expectNotOwned(db, testThreadNoteIRI1)
+		expectFetched(db, tp, grandparent)
+		// Run
+		err := f.Backfill(ctx, mustParse(testMyInboxIRI), reply)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(waits), 2)
+		assertEqual(t, waits[0], time.Duration(0))
+		assertEqual(t, waits[1], time.Second)
+	})
+	t.Run("DoesNotBackfillReplyToKnownObject", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _, _, f := setupFn(ctl, ThreadFetchPolicy{})
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testThreadNoteIRI2))
+		db.EXPECT().Exists(ctx, mustParse(testThreadNoteIRI2)).Return(true, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testThreadNoteIRI2))
+		// Run & Verify
+		err := f.backfillMissingParent(ctx, mustParse(testMyInboxIRI), reply)
+		assertEqual(t, err, nil)
+	})
+	t.Run("BackfillsReplyToMissingObjectInBackground", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, c, _, tp, f := setupFn(ctl, ThreadFetchPolicy{})
+		rctx, cancel := context.WithCancel(ctx)
+		bctx := detachedContext{rctx}
+		parent := newNoteFn(testThreadNoteIRI2, "")
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		parentIRI := mustParse(testThreadNoteIRI2)
+		// Mock
+		db.EXPECT().Lock(rctx, parentIRI)
+		db.EXPECT().Exists(rctx, parentIRI).Return(false, nil)
+		db.EXPECT().Unlock(rctx, parentIRI)
+		c.EXPECT().NewTransport(bctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		db.EXPECT().Lock(bctx, parentIRI).Times(2)
+		db.EXPECT().Exists(bctx, parentIRI).Return(false, nil)
+		tp.EXPECT().Dereference(bctx, parentIRI).Return(mustSerializeToBytes(parent), nil)
+		db.EXPECT().Create(bctx, toDeserializedForm(parent))
+		db.EXPECT().Unlock(bctx, parentIRI).Times(2)
+		// Run
+		err := f.backfillMissingParent(rctx, mustParse(testMyInboxIRI), reply)
+		// The request is done before the backfill is.
+		cancel()
+		f.Wait()
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotBackfillThreadAlreadyInBackground", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _, _, f := setupFn(ctl, ThreadFetchPolicy{})
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		assertEqual(t, f.startBackground(mustParse(testThreadNoteIRI2)), true)
+		// Mock
+		expectMissing(db, testThreadNoteIRI2)
+		// Run & Verify
+		err := f.backfillMissingParent(ctx, mustParse(testMyInboxIRI), reply)
+		f.Wait()
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNotBackfillBeyondMaxConcurrent", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, _, _, f := setupFn(ctl, ThreadFetchPolicy{MaxConcurrent: 1})
+		reply := newNoteFn(testThreadNoteIRI3, testThreadNoteIRI2)
+		assertEqual(t, f.startBackground(mustParse(testThreadNoteIRI1)), true)
+		// Mock
+		expectMissing(db, testThreadNoteIRI2)
+		// Run & Verify
+		err := f.backfillMissingParent(ctx, mustParse(testMyInboxIRI), reply)
+		f.Wait()
+		assertEqual(t, err, nil)
+		// Once done, another thread may be backfilled.
+		f.finishBackground(mustParse(testThreadNoteIRI1))
+		assertEqual(t, f.startBackground(mustParse(testThreadNoteIRI2)), true)
+	})
+}
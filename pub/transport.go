@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -28,6 +27,33 @@ func isSuccess(code int) bool {
 		code == http.StatusAccepted
 }
 
+// HttpStatusError is returned by a Transport when a peer responds to a request
+// with an unsuccessful HTTP status code.
+//
+// Transports other than the HttpSigTransport should also return it, as the
+// library relies on it to detect peers that are Gone.
+type HttpStatusError struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// IRI is the IRI the request was sent to.
+	IRI *url.URL
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Status is the HTTP status of the response.
+	Status string
+}
+
+// Error describes the failed request.
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("%s request to %s failed (%d): %s", e.Method, e.IRI, e.StatusCode, e.Status)
+}
+
+// isGone returns true if the error is an HttpStatusError for a 410 Gone.
+func isGone(err error) bool {
+	e, ok := err.(*HttpStatusError)
+	return ok && e.StatusCode == http.StatusGone
+}
+
 // Transport makes ActivityStreams calls to other servers in order to send or
 // receive ActivityStreams data.
 //
@@ -52,6 +78,38 @@ type Transport interface {
 // Transport must be implemented by HttpSigTransport.
 var _ Transport = &HttpSigTransport{}
 
+// DereferenceResponse is the response of a peer to a conditional GET request.
+type DereferenceResponse struct {
+	// Body is the ActivityStreams value, or nil if NotModified.
+	Body []byte
+	// NotModified is true if the peer responded with a 304 Not Modified,
+	// as its value still matches the ETag of the request.
+	NotModified bool
+	// ETag is the ETag header of the response.
+	ETag string
+	// CacheControl is the Cache-Control header of the response.
+	CacheControl string
+	// Unsigned is true if the request had no HTTP Signature, so that the
+	// response cannot depend on the actor making it.
+	Unsigned bool
+}
+
+// ConditionalTransport is a Transport that can also make conditional GET
+// requests, and reports the caching headers of the responses.
+//
+// The Resolver revalidates the values it caches with Transports implementing
+// it, and otherwise caches them for a fixed duration.
+type ConditionalTransport interface {
+	Transport
+	// DereferenceIfNoneMatch fetches the ActivityStreams object located
+	// at this IRI with a GET request, unless it still matches the ETag.
+	// An empty ETag makes the request unconditional.
+	DereferenceIfNoneMatch(c context.Context, iri *url.URL, etag string) (DereferenceResponse, error)
+}
+
+// ConditionalTransport must be implemented by HttpSigTransport.
+var _ ConditionalTransport = &HttpSigTransport{}
+
 // HttpSigTransport makes a dereference call using HTTP signatures to
 // authenticate the request on behalf of a particular actor.
 //
@@ -69,6 +127,19 @@ type HttpSigTransport struct {
 	postSignerMu *sync.Mutex
 	pubKeyId     string
 	privKey      crypto.PrivateKey
+	limits       PayloadLimits
+}
+
+// HttpSigTransportOption configures optional behaviors of an HttpSigTransport.
+type HttpSigTransportOption func(h *HttpSigTransport)
+
+// WithDereferenceLimits bounds the size and structure of the responses read by
+// Dereference, which returns a PayloadLimitError for those exceeding them.
+// Without this option, DefaultPayloadLimits apply.
+func WithDereferenceLimits(l PayloadLimits) HttpSigTransportOption {
+	return func(h *HttpSigTransport) {
+		h.limits = l
+	}
 }
 
 // NewHttpSigTransport returns a new Transport.
@@ -92,8 +163,9 @@ func NewHttpSigTransport(
 	clock Clock,
 	getSigner, postSigner httpsig.Signer,
 	pubKeyId string,
-	privKey crypto.PrivateKey) *HttpSigTransport {
-	return &HttpSigTransport{
+	privKey crypto.PrivateKey,
+	opts ...HttpSigTransportOption) *HttpSigTransport {
+	h := &HttpSigTransport{
 		client:       client,
 		appAgent:     appAgent,
 		gofedAgent:   goFedUserAgent(),
@@ -104,37 +176,75 @@ func NewHttpSigTransport(
 		postSignerMu: &sync.Mutex{},
 		pubKeyId:     pubKeyId,
 		privKey:      privKey,
+		limits:       DefaultPayloadLimits(),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Dereference sends a GET request signed with an HTTP Signature to obtain an
 // ActivityStreams value.
+//
+// A PayloadLimitError is returned if the response exceeds the PayloadLimits.
 func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
-	req, err := http.NewRequest("GET", iri.String(), nil)
+	r, err := h.DereferenceIfNoneMatch(c, iri, "")
 	if err != nil {
 		return nil, err
 	}
+	return r.Body, nil
+}
+
+// DereferenceIfNoneMatch sends a GET request signed with an HTTP Signature to
+// obtain an ActivityStreams value, unless it still matches the ETag.
+//
+// A PayloadLimitError is returned if the response exceeds the PayloadLimits.
+func (h HttpSigTransport) DereferenceIfNoneMatch(c context.Context, iri *url.URL, etag string) (DereferenceResponse, error) {
+	req, err := http.NewRequest("GET", iri.String(), nil)
+	if err != nil {
+		return DereferenceResponse{}, err
+	}
 	req = req.WithContext(c)
 	req.Header.Add(acceptHeader, acceptHeaderValue)
 	req.Header.Add("Accept-Charset", "utf-8")
 	req.Header.Add("Date", h.clock.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05")+" GMT")
 	req.Header.Add("User-Agent", fmt.Sprintf("%s %s", h.appAgent, h.gofedAgent))
 	req.Header.Set("Host", iri.Host)
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
 	h.getSignerMu.Lock()
 	err = h.getSigner.SignRequest(h.privKey, h.pubKeyId, req, nil)
 	h.getSignerMu.Unlock()
 	if err != nil {
-		return nil, err
+		return DereferenceResponse{}, err
 	}
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return nil, err
+		return DereferenceResponse{}, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GET request to %s failed (%d): %s", iri.String(), resp.StatusCode, resp.Status)
+	r := DereferenceResponse{
+		ETag:         resp.Header.Get("ETag"),
+		CacheControl: resp.Header.Get(cacheControlHeader),
+	}
+	if len(etag) > 0 && resp.StatusCode == http.StatusNotModified {
+		r.NotModified = true
+		return r, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return DereferenceResponse{}, &HttpStatusError{
+			Method:     "GET",
+			IRI:        iri,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+	r.Body, err = h.limits.read(resp.Body)
+	if err != nil {
+		return DereferenceResponse{}, err
 	}
-	return ioutil.ReadAll(resp.Body)
+	return r, nil
 }
 
 // Deliver sends a POST request with an HTTP Signature.
@@ -161,7 +271,12 @@ func (h HttpSigTransport) Deliver(c context.Context, b []byte, to *url.URL) erro
 	}
 	defer resp.Body.Close()
 	if !isSuccess(resp.StatusCode) {
-		return fmt.Errorf("POST request to %s failed (%d): %s", to.String(), resp.StatusCode, resp.Status)
+		return &HttpStatusError{
+			Method:     "POST",
+			IRI:        to,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
 	}
 	return nil
 }
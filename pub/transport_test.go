@@ -66,6 +66,7 @@ func TestHttpSigTransportDereference(t *testing.T) {
 		expectReq.Header.Add("Accept-Charset", "utf-8")
 		expectReq.Header.Add("Date", nowDateHeader())
 		expectReq.Header.Add("User-Agent", fmt.Sprintf("%s %s", testAppAgent, goFedUserAgent()))
+		expectReq.Header.Set("Host", "example.com")
 		respR := httptest.NewRecorder()
 		respR.Write(testRespBody)
 		resp := respR.Result()
@@ -78,6 +79,89 @@ func TestHttpSigTransportDereference(t *testing.T) {
 		assertByteEqual(t, b, testRespBody)
 		assertEqual(t, err, nil)
 	})
+	t.Run("ReturnsHttpStatusErrorWhenGone", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, gs, _ := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.WriteHeader(http.StatusGone)
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now())
+		gs.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), nil)
+		hc.EXPECT().Do(gomock.Any()).Return(resp, nil)
+		// Run & Verify
+		_, err := tp.Dereference(ctx, mustParse(testNoteId1))
+		assertEqual(t, isGone(err), true)
+	})
+	t.Run("ReturnsPayloadLimitErrorWhenTooLarge", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, gs, _ := httpSigSetupFn(ctl)
+		WithDereferenceLimits(PayloadLimits{MaxBytes: 4})(tp)
+		respR := httptest.NewRecorder()
+		respR.Write(testRespBody)
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now())
+		gs.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), nil)
+		hc.EXPECT().Do(gomock.Any()).Return(resp, nil)
+		// Run & Verify
+		b, err := tp.Dereference(ctx, mustParse(testNoteId1))
+		assertEqual(t, len(b), 0)
+		assertEqual(t, IsPayloadLimitError(err), true)
+	})
+}
+
+func TestHttpSigTransportDereferenceIfNoneMatch(t *testing.T) {
+	ctx := context.Background()
+	t.Run("ReturnsNotModified", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, gs, _ := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.Header().Set("ETag", `"v1"`)
+		respR.Header().Set("Cache-Control", "max-age=60")
+		respR.WriteHeader(http.StatusNotModified)
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now())
+		gs.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), nil)
+		hc.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assertEqual(t, req.Header.Get("If-None-Match"), `"v1"`)
+			return resp, nil
+		})
+		// Run & Verify
+		r, err := tp.DereferenceIfNoneMatch(ctx, mustParse(testNoteId1), `"v1"`)
+		assertEqual(t, err, nil)
+		assertEqual(t, r.NotModified, true)
+		assertEqual(t, len(r.Body), 0)
+		assertEqual(t, r.ETag, `"v1"`)
+		assertEqual(t, r.CacheControl, "max-age=60")
+	})
+	t.Run("ReturnsBodyAndCachingHeaders", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, gs, _ := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.Header().Set("ETag", `"v2"`)
+		respR.Write(testRespBody)
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now())
+		gs.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), nil)
+		hc.EXPECT().Do(gomock.Any()).Return(resp, nil)
+		// Run & Verify
+		r, err := tp.DereferenceIfNoneMatch(ctx, mustParse(testNoteId1), `"v1"`)
+		assertEqual(t, err, nil)
+		assertEqual(t, r.NotModified, false)
+		assertByteEqual(t, r.Body, testRespBody)
+		assertEqual(t, r.ETag, `"v2"`)
+	})
 }
 
 func TestHttpSigTransportDeliver(t *testing.T) {
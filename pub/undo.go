@@ -0,0 +1,469 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// undoer reverses the side effects of the activities undone by an Undo. This
+// logic is shared by both the C2S and S2S protocols.
+//
+// The side effects reversed are those of Follow, Accept of a Follow, Like,
+// Announce, and Block: the actors are removed from the 'followers',
+// 'following', and blocks collections, the Like from the object's 'likes' and
+// the actor's 'liked', and the Announce from the object's 'shares'.
+type undoer struct {
+	db Database
+	// boxIRI is the inbox receiving a federated Undo, or the outbox
+	// receiving an Undo from a client.
+	boxIRI *url.URL
+	// federated is true when the Undo's actors are peers undoing their
+	// activities towards the local actor, and false when the Undo's actor is
+	// the local actor itself.
+	federated bool
+	// actorIRI is the local actor owning the box, determined when first
+	// needed.
+	actorIRI *url.URL
+	// undidBlock is set when one of the undone activities is a Block of
+	// the local actor.
+	undidBlock bool
+}
+
+// undo reverses the side effects of every activity in the Undo's 'object'.
+//
+// Activities given only as an IRI are resolved from the database; those not in
+// it have no side effects to reverse. Each undone activity must originate from
+// the host of one of the Undo's actors.
+//
+// The actors of the Undo must already be verified to match the actors of the
+// undone activities.
+func (u *undoer) undo(c context.Context, a vocab.ActivityStreamsUndo) error {
+	actorIds, err := getActorIds(a)
+	if err != nil {
+		return err
+	}
+	origins := make(map[string]bool, len(actorIds))
+	for _, id := range actorIds {
+		origins[id.Host] = true
+	}
+	op := a.GetActivityStreamsObject()
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		t, err := u.resolve(c, iter)
+		if err != nil {
+			return err
+		} else if t == nil {
+			continue
+		}
+		activity, ok := t.(Activity)
+		if !ok {
+			continue
+		}
+		if id := activity.GetJSONLDId(); id != nil && !origins[id.Get().Host] {
+			return fmt.Errorf("cannot undo %s: it does not originate from an actor of the Undo", id.Get())
+		}
+		if streams.IsOrExtendsActivityStreamsFollow(t) {
+			err = u.undoFollow(c, activity)
+		} else if streams.IsOrExtendsActivityStreamsAccept(t) {
+			err = u.undoAccept(c, activity)
+		} else if streams.IsOrExtendsActivityStreamsLike(t) {
+			err = u.undoLike(c, activity)
+		} else if streams.IsOrExtendsActivityStreamsAnnounce(t) {
+			err = u.undoAnnounce(c, activity)
+		} else if streams.IsOrExtendsActivityStreamsBlock(t) {
+			err = u.undoBlock(c, activity)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoFollow removes the peers from the local actor's 'followers' when they no
+// longer follow it, or from its 'following' when it no longer follows them.
+func (u *undoer) undoFollow(c context.Context, follow Activity) error {
+	me, err := u.localActor(c)
+	if err != nil {
+		return err
+	}
+	actorIds, err := getActorIds(follow)
+	if err != nil {
+		return err
+	}
+	objectIds, err := getObjectIds(follow)
+	if err != nil {
+		return err
+	}
+	if u.federated {
+		if !containsIRI(objectIds, me) {
+			return nil
+		}
+		return u.removeFromActorCollection(c, me, u.db.Followers, actorIds)
+	}
+	if !containsIRI(actorIds, me) {
+		return nil
+	}
+	return u.removeFromActorCollection(c, me, u.db.Following, objectIds)
+}
+
+// undoAccept reverses the acceptance of a Follow: the peers are removed from
+// the local actor's 'following' when they rescind accepting its Follow, or from
+// its 'followers' when it rescinds accepting theirs.
+func (u *undoer) undoAccept(c context.Context, accept Activity) error {
+	op := accept.GetActivityStreamsObject()
+	if op == nil {
+		return nil
+	}
+	me, err := u.localActor(c)
+	if err != nil {
+		return err
+	}
+	acceptActorIds, err := getActorIds(accept)
+	if err != nil {
+		return err
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		t, err := u.resolve(c, iter)
+		if err != nil {
+			return err
+		} else if t == nil || !streams.IsOrExtendsActivityStreamsFollow(t) {
+			continue
+		}
+		follow, ok := t.(Activity)
+		if !ok {
+			return fmt.Errorf("a Follow in an Accept does not satisfy the Activity interface")
+		}
+		actorIds, err := getActorIds(follow)
+		if err != nil {
+			return err
+		}
+		objectIds, err := getObjectIds(follow)
+		if err != nil {
+			return err
+		}
+		if u.federated {
+			if !containsIRI(actorIds, me) {
+				continue
+			}
+			// Only the peers that were followed may rescind.
+			var rescinded []*url.URL
+			for _, id := range acceptActorIds {
+				if containsIRI(objectIds, id) {
+					rescinded = append(rescinded, id)
+				}
+			}
+			err = u.removeFromActorCollection(c, me, u.db.Following, rescinded)
+		} else {
+			if !containsIRI(objectIds, me) {
+				continue
+			}
+			err = u.removeFromActorCollection(c, me, u.db.Followers, actorIds)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoLike removes the Like from the 'likes' of the objects owned by this
+// server, as well as the objects from the local actor's 'liked' when it is the
+// one no longer liking them.
+func (u *undoer) undoLike(c context.Context, like Activity) error {
+	objectIds, err := getObjectIds(like)
+	if err != nil {
+		return err
+	}
+	if id := like.GetJSONLDId(); id != nil {
+		for _, objId := range objectIds {
+			err = u.removeFromOwnedObject(c, objId, id.Get(), func(t vocab.Type) (vocab.Type, *url.URL, error) {
+				l, ok := t.(likeser)
+				if !ok || l.GetActivityStreamsLikes() == nil {
+					return nil, nil, nil
+				}
+				likes := l.GetActivityStreamsLikes()
+				return likes.GetType(), likes.GetIRI(), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if u.federated {
+		return nil
+	}
+	me, err := u.localActor(c)
+	if err != nil {
+		return err
+	}
+	actorIds, err := getActorIds(like)
+	if err != nil {
+		return err
+	}
+	if !containsIRI(actorIds, me) {
+		return nil
+	}
+	return u.removeFromActorCollection(c, me, u.db.Liked, objectIds)
+}
+
+// undoAnnounce removes the Announce from the 'shares' of the objects owned by
+// this server.
+func (u *undoer) undoAnnounce(c context.Context, announce Activity) error {
+	id := announce.GetJSONLDId()
+	if id == nil {
+		return nil
+	}
+	objectIds, err := getObjectIds(announce)
+	if err != nil {
+		return err
+	}
+	for _, objId := range objectIds {
+		err = u.removeFromOwnedObject(c, objId, id.Get(), func(t vocab.Type) (vocab.Type, *url.URL, error) {
+			s, ok := t.(shareser)
+			if !ok || s.GetActivityStreamsShares() == nil {
+				return nil, nil, nil
+			}
+			shares := s.GetActivityStreamsShares()
+			return shares.GetType(), shares.GetIRI(), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoBlock removes the objects of the local actor's Block from its blocks
+// collection. Blocks are not federated, so a peer has none to undo.
+func (u *undoer) undoBlock(c context.Context, block Activity) error {
+	if u.federated {
+		return nil
+	}
+	me, err := u.localActor(c)
+	if err != nil {
+		return err
+	}
+	actorIds, err := getActorIds(block)
+	if err != nil {
+		return err
+	}
+	if !containsIRI(actorIds, me) {
+		return nil
+	}
+	objectIds, err := getObjectIds(block)
+	if err != nil {
+		return err
+	}
+	u.undidBlock = true
+	db, ok := u.db.(BlocksDatabase)
+	if !ok {
+		return nil
+	}
+	return u.removeFromActorCollection(c, me, db.Blocks, objectIds)
+}
+
+// resolve returns the value of the property, resolving an IRI from the
+// database. It returns nil if the IRI is not in the database.
+func (u *undoer) resolve(c context.Context, iter interface {
+	GetType() vocab.Type
+	IsIRI() bool
+	GetIRI() *url.URL
+}) (vocab.Type, error) {
+	if t := iter.GetType(); t != nil {
+		return t, nil
+	} else if !iter.IsIRI() {
+		return nil, nil
+	}
+	iri := iter.GetIRI()
+	if err := u.db.Lock(c, iri); err != nil {
+		return nil, err
+	}
+	defer u.db.Unlock(c, iri)
+	if exists, err := u.db.Exists(c, iri); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, nil
+	}
+	return u.db.Get(c, iri)
+}
+
+// localActor returns the local actor owning the box that received the Undo.
+func (u *undoer) localActor(c context.Context) (*url.URL, error) {
+	if u.actorIRI != nil {
+		return u.actorIRI, nil
+	}
+	if err := u.db.Lock(c, u.boxIRI); err != nil {
+		return nil, err
+	}
+	defer u.db.Unlock(c, u.boxIRI)
+	var err error
+	if u.federated {
+		u.actorIRI, err = u.db.ActorForInbox(c, u.boxIRI)
+	} else {
+		u.actorIRI, err = u.db.ActorForOutbox(c, u.boxIRI)
+	}
+	return u.actorIRI, err
+}
+
+// removeFromActorCollection removes the ids from one of the local actor's
+// collections, such as its 'followers'.
+func (u *undoer) removeFromActorCollection(c context.Context,
+	actorIRI *url.URL,
+	collection func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error),
+	ids []*url.URL) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := u.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer u.db.Unlock(c, actorIRI)
+	col, err := collection(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if removeCollectionItems(col, ids) {
+		return u.db.Update(c, col)
+	}
+	return nil
+}
+
+// removeFromOwnedObject removes the id from the collection of an object owned
+// by this server, such as its 'likes'. The collection is obtained from the
+// object's property, and is either embedded in the object or referred to by
+// its IRI.
+func (u *undoer) removeFromOwnedObject(c context.Context,
+	objId, id *url.URL,
+	collection func(t vocab.Type) (embedded vocab.Type, iri *url.URL, err error)) error {
+	var colIRI *url.URL
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err := func() error {
+		if err := u.db.Lock(c, objId); err != nil {
+			return err
+		}
+		defer u.db.Unlock(c, objId)
+		if owns, err := u.db.Owns(c, objId); err != nil {
+			return err
+		} else if !owns {
+			return nil
+		}
+		t, err := u.db.Get(c, objId)
+		if err != nil {
+			return err
+		}
+		embedded, iri, err := collection(t)
+		if err != nil {
+			return err
+		} else if embedded != nil {
+			if removeCollectionItems(embedded, []*url.URL{id}) {
+				return u.db.Update(c, t)
+			}
+			return nil
+		}
+		colIRI = iri
+		return nil
+	}()
+	if err != nil || colIRI == nil {
+		return err
+	}
+	if err = u.db.Lock(c, colIRI); err != nil {
+		return err
+	}
+	defer u.db.Unlock(c, colIRI)
+	if owns, err := u.db.Owns(c, colIRI); err != nil {
+		return err
+	} else if !owns {
+		return nil
+	}
+	col, err := u.db.Get(c, colIRI)
+	if err != nil {
+		return err
+	}
+	if removeCollectionItems(col, []*url.URL{id}) {
+		return u.db.Update(c, col)
+	}
+	return nil
+}
+
+// removeCollectionItems removes the items with the given ids from a Collection
+// or OrderedCollection, returning true if any were removed.
+func removeCollectionItems(t vocab.Type, ids []*url.URL) (removed bool) {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id.String()] = true
+	}
+	if oi, ok := t.(orderedItemser); ok {
+		if oiProp := oi.GetActivityStreamsOrderedItems(); oiProp != nil {
+			for i := 0; i < oiProp.Len(); /*Conditional*/ {
+				if id, err := ToId(oiProp.At(i)); err == nil && remove[id.String()] {
+					oiProp.Remove(i)
+					removed = true
+				} else {
+					i++
+				}
+			}
+		}
+	}
+	if it, ok := t.(itemser); ok {
+		if iProp := it.GetActivityStreamsItems(); iProp != nil {
+			for i := 0; i < iProp.Len(); /*Conditional*/ {
+				if id, err := ToId(iProp.At(i)); err == nil && remove[id.String()] {
+					iProp.Remove(i)
+					removed = true
+				} else {
+					i++
+				}
+			}
+		}
+	}
+	return
+}
+
+// getActorIds returns the ids of the 'actor' property of an activity.
+func getActorIds(a actorer) (ids []*url.URL, err error) {
+	actors := a.GetActivityStreamsActor()
+	if actors == nil {
+		return
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// getObjectIds returns the ids of the 'object' property of an activity.
+func getObjectIds(a objecter) (ids []*url.URL, err error) {
+	op := a.GetActivityStreamsObject()
+	if op == nil {
+		return
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// containsIRI returns true if the IRI is among the ids.
+func containsIRI(ids []*url.URL, iri *url.URL) bool {
+	for _, id := range ids {
+		if id.String() == iri.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package pub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+func TestUndoerFromOutbox(t *testing.T) {
+	ctx := context.Background()
+	newCollectionFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	newUndoFn := func(t vocab.Type) vocab.ActivityStreamsUndo {
+		u := streams.NewActivityStreamsUndo()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNewActivityIRI2))
+		u.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		if err := op.AppendType(t); err != nil {
+			panic(err)
+		}
+		u.SetActivityStreamsObject(op)
+		return u
+	}
+	setupFn := func(ctl *gomock.Controller) (u *undoer, mockDB *MockDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		u = &undoer{db: mockDB, boxIRI: mustParse(testMyOutboxIRI)}
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		return
+	}
+	t.Run("UndoFollowRemovesFromFollowing", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		u, mockDB := setupFn(ctl)
+		follow := streams.NewActivityStreamsFollow()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://maybe.example.com/follow/1"))
+		follow.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		follow.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		follow.SetActivityStreamsObject(op)
+		// Mock
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI, testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI2)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run & Verify
+		err := u.undo(ctx, newUndoFn(follow))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoLikeRemovesFromLiked", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		u, mockDB := setupFn(ctl)
+		like := streams.NewActivityStreamsLike()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://maybe.example.com/like/1"))
+		like.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		like.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId1))
+		like.SetActivityStreamsObject(op)
+		// Mock
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Liked(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testNoteId2, testNoteId1), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testNoteId2)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run & Verify
+		err := u.undo(ctx, newUndoFn(like))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoAcceptRemovesFromFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		u, mockDB := setupFn(ctl)
+		accept := streams.NewActivityStreamsAccept()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://maybe.example.com/accept/1"))
+		accept.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		accept.SetActivityStreamsActor(actor)
+		follow := streams.NewActivityStreamsFollow()
+		followActor := streams.NewActivityStreamsActorProperty()
+		followActor.AppendIRI(mustParse(testFederatedActorIRI))
+		follow.SetActivityStreamsActor(followActor)
+		followOp := streams.NewActivityStreamsObjectProperty()
+		followOp.AppendIRI(mustParse(testPersonIRI))
+		follow.SetActivityStreamsObject(followOp)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		accept.SetActivityStreamsObject(op)
+		// Mock
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI, testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI3)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run & Verify
+		err := u.undo(ctx, newUndoFn(accept))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("UndoBlockRemovesFromBlocks", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockBlocksDatabase(ctl)
+		u := &undoer{db: mockDB, boxIRI: mustParse(testMyOutboxIRI)}
+		block := streams.NewActivityStreamsBlock()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://maybe.example.com/block/1"))
+		block.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		block.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		block.SetActivityStreamsObject(op)
+		// Mock
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Blocks(ctx, mustParse(testPersonIRI)).Return(
+			newCollectionFn(testFederatedActorIRI, testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Update(ctx, newCollectionFn(testFederatedActorIRI2)).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run & Verify
+		err := u.undo(ctx, newUndoFn(block))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, u.undidBlock, true)
+	})
+	t.Run("UndoBlockWithoutBlocksDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		u, _ := setupFn(ctl)
+		block := streams.NewActivityStreamsBlock()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://maybe.example.com/block/1"))
+		block.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testPersonIRI))
+		block.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		block.SetActivityStreamsObject(op)
+		// Run & Verify
+		err := u.undo(ctx, newUndoFn(block))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, u.undidBlock, true)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/go-fed/activity/streams/vocab"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -129,6 +130,24 @@ const (
 	digestDelimiter = "="
 	// SHA-256 string for the Digest header.
 	sha256Digest = "SHA-256"
+	// Contains the ActivityPub Content-Type value.
+	activityJSONContentTypeValue = "application/activity+json"
+	// The JSON-LD media type.
+	jsonLDMediaType = "application/ld+json"
+	// The ActivityStreams JSON-LD profile.
+	activityStreamsProfile = "https://www.w3.org/ns/activitystreams"
+	// The Vary header.
+	varyHeader = "Vary"
+	// The ETag header.
+	eTagHeader = "ETag"
+	// The Last-Modified header.
+	lastModifiedHeader = "Last-Modified"
+	// The If-None-Match header.
+	ifNoneMatchHeader = "If-None-Match"
+	// The If-Modified-Since header.
+	ifModifiedSinceHeader = "If-Modified-Since"
+	// The Cache-Control header.
+	cacheControlHeader = "Cache-Control"
 )
 
 // addResponseHeaders sets headers needed in the HTTP response, such but not
@@ -146,6 +165,102 @@ func addResponseHeaders(h http.Header, c Clock, responseContent []byte) {
 	h.Set(digestHeader, b.String())
 }
 
+// negotiateMediaType returns the ActivityStreams media type to respond with
+// given the Accept header of a request: the accepted ActivityStreams media type
+// with the highest quality, and the JSON-LD one with the ActivityStreams
+// profile if none is accepted.
+func negotiateMediaType(accept string) string {
+	mediaType := contentTypeHeaderValue
+	best := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		q := 1.0
+		hasProfile := false
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.Trim(strings.TrimSpace(kv[1]), "\"")
+			switch strings.ToLower(strings.TrimSpace(kv[0])) {
+			case "q":
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			case "profile":
+				// The profile may be a space-separated list.
+				for _, profile := range strings.Fields(v) {
+					if profile == activityStreamsProfile {
+						hasProfile = true
+					}
+				}
+			}
+		}
+		if q <= best {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case activityJSONContentTypeValue:
+			mediaType = activityJSONContentTypeValue
+			best = q
+		case jsonLDMediaType:
+			if hasProfile {
+				mediaType = contentTypeHeaderValue
+				best = q
+			}
+		}
+	}
+	return mediaType
+}
+
+// entityTag returns the strong ETag header value of the response content.
+func entityTag(responseContent []byte) string {
+	hashed := sha256.Sum256(responseContent)
+	return "\"" + base64.StdEncoding.EncodeToString(hashed[:]) + "\""
+}
+
+// lastModifiedTime returns the 'updated' time of an ActivityStreams value, or
+// its 'published' time when it has never been updated.
+func lastModifiedTime(t vocab.Type) (lastModified time.Time, ok bool) {
+	if upder, isUpdateder := t.(updateder); isUpdateder {
+		if upd := upder.GetActivityStreamsUpdated(); upd != nil && upd.IsXMLSchemaDateTime() {
+			return upd.Get(), true
+		}
+	}
+	if pubber, isPublisheder := t.(publisheder); isPublisheder {
+		if pub := pubber.GetActivityStreamsPublished(); pub != nil && pub.IsXMLSchemaDateTime() {
+			return pub.Get(), true
+		}
+	}
+	return
+}
+
+// isNotModified returns true if the conditional GET request already has the
+// response content identified by the entity tag and last modification time.
+//
+// As specified by RFC 7232, If-Modified-Since is ignored when the request has
+// an If-None-Match header, which uses the weak comparison function.
+func isNotModified(r *http.Request, eTag string, lastModified time.Time, hasLastModified bool) bool {
+	if inm := r.Header[ifNoneMatchHeader]; len(inm) > 0 {
+		for _, tag := range strings.Split(strings.Join(inm, ","), ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == eTag {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasLastModified {
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get(ifModifiedSinceHeader))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a precision of one second.
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
 // IdProperty is a property that can readily have its id obtained
 type IdProperty interface {
 	// GetIRI returns the IRI of this property. When IsIRI returns false,
@@ -357,6 +472,62 @@ func IsPublic(s string) bool {
 	return s == PublicActivityPubIRI || s == publicJsonLD || s == publicJsonLDAS
 }
 
+// getRecipients returns the IRIs in the 'to', 'bto', 'cc', 'bcc', and
+// 'audience' properties of an activity.
+func getRecipients(a Activity) (r []*url.URL, err error) {
+	if to := a.GetActivityStreamsTo(); to != nil {
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if bto := a.GetActivityStreamsBto(); bto != nil {
+		for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if cc := a.GetActivityStreamsCc(); cc != nil {
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if bcc := a.GetActivityStreamsBcc(); bcc != nil {
+		for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	if audience := a.GetActivityStreamsAudience(); audience != nil {
+		for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
+			var val *url.URL
+			val, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			r = append(r, val)
+		}
+	}
+	return
+}
+
 // getInboxes extracts the 'inbox' IRIs from actor types.
 func getInboxes(t []vocab.Type) (u []*url.URL, err error) {
 	for _, elem := range t {
@@ -381,6 +552,180 @@ func getInbox(t vocab.Type) (u *url.URL, err error) {
 	return ToId(inbox)
 }
 
+// getDeliveryInboxes extracts the IRIs to deliver to from actor types. If
+// useSharedInbox is true, the shared inbox of an actor is used instead of its
+// 'inbox' when it has one.
+func getDeliveryInboxes(t []vocab.Type, useSharedInbox bool) (u []*url.URL, err error) {
+	for _, elem := range t {
+		var iri *url.URL
+		if useSharedInbox {
+			iri = getSharedInbox(elem)
+		}
+		if iri == nil {
+			iri, err = getInbox(elem)
+			if err != nil {
+				return
+			}
+		}
+		u = append(u, iri)
+	}
+	return
+}
+
+// getSharedInbox extracts the 'sharedInbox' IRI from the 'endpoints' of an
+// actor type, or returns nil if it has none.
+//
+// The 'endpoints' property is not part of the ActivityStreams vocabulary, so
+// it is read from the unknown properties of the actor.
+func getSharedInbox(t vocab.Type) *url.URL {
+	v, ok := t.(unknownPropertieser)
+	if !ok {
+		return nil
+	}
+	endpoints, ok := v.GetUnknownProperties()["endpoints"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s, ok := endpoints["sharedInbox"].(string)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// getAlsoKnownAs extracts the 'alsoKnownAs' IRIs from an actor type.
+//
+// The 'alsoKnownAs' property is not part of the ActivityStreams vocabulary, so
+// it is read from the unknown properties of the actor.
+func getAlsoKnownAs(t vocab.Type) (iris []*url.URL) {
+	v, ok := t.(unknownPropertieser)
+	if !ok {
+		return
+	}
+	var values []interface{}
+	switch aka := v.GetUnknownProperties()["alsoKnownAs"].(type) {
+	case string:
+		values = []interface{}{aka}
+	case []interface{}:
+		values = aka
+	}
+	for _, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() {
+			continue
+		}
+		iris = append(iris, u)
+	}
+	return
+}
+
+// getMoveOriginAndTarget extracts the actor being moved from the 'object' of a
+// Move, and the actor it is moved to from its 'target'.
+func getMoveOriginAndTarget(a vocab.ActivityStreamsMove) (origin, target *url.URL, err error) {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		err = ErrObjectRequired
+		return
+	} else if op.Len() > 1 {
+		err = fmt.Errorf("a Move must have exactly one object, got %d", op.Len())
+		return
+	}
+	tp := a.GetActivityStreamsTarget()
+	if tp == nil || tp.Len() == 0 {
+		err = ErrTargetRequired
+		return
+	} else if tp.Len() > 1 {
+		err = fmt.Errorf("a Move must have exactly one target, got %d", tp.Len())
+		return
+	}
+	if origin, err = ToId(op.At(0)); err != nil {
+		return
+	}
+	if target, err = ToId(tp.At(0)); err != nil {
+		return
+	}
+	if origin.String() == target.String() {
+		err = fmt.Errorf("cannot move %s to itself", origin)
+	}
+	return
+}
+
+// mustHaveMoveTargetAlias ensures the actor an account is moved to lists the
+// moved account in its 'alsoKnownAs' property, so that a Move cannot take
+// followers to an actor that did not consent.
+//
+// The target actor is read from the database if it is owned by this server,
+// and otherwise is dereferenced.
+func mustHaveMoveTargetAlias(c context.Context,
+	db Database,
+	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
+	boxIRI, origin, target *url.URL) error {
+	var t vocab.Type
+	// Use an anonymous function to properly scope the database lock,
+	// immediately call it.
+	err := func() error {
+		if err := db.Lock(c, target); err != nil {
+			return err
+		}
+		defer db.Unlock(c, target)
+		owns, err := db.Owns(c, target)
+		if err != nil || !owns {
+			return err
+		}
+		t, err = db.Get(c, target)
+		return err
+	}()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		tport, err := newTransport(c, boxIRI, goFedUserAgent())
+		if err != nil {
+			return err
+		}
+		b, err := tport.Dereference(c, target)
+		if err != nil {
+			return err
+		}
+		var m map[string]interface{}
+		if err = json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		t, err = streams.ToType(c, m)
+		if err != nil {
+			return err
+		}
+	}
+	for _, aka := range getAlsoKnownAs(t) {
+		if aka.String() == origin.String() {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move %s to %s: target does not list it in alsoKnownAs", origin, target)
+}
+
+// getFollowers extracts the 'followers' IRI from an actor type, or returns nil
+// if it has none.
+func getFollowers(t vocab.Type) *url.URL {
+	f, ok := t.(followerser)
+	if !ok || f.GetActivityStreamsFollowers() == nil {
+		return nil
+	}
+	id, err := ToId(f.GetActivityStreamsFollowers())
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
 // dedupeIRIs will deduplicate final inbox IRIs. The ignore list is applied to
 // the final list.
 func dedupeIRIs(recipients, ignored []*url.URL) (out []*url.URL) {
@@ -74,3 +74,60 @@ func TestHeaderIsActivityPubMediaType(t *testing.T) {
 		})
 	}
 }
+
+func TestNegotiateMediaType(t *testing.T) {
+	const ldJSON = "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"Mastodon Accept Header",
+			"application/activity+json, application/ld+json",
+			"application/activity+json",
+		},
+		{
+			"Plain Type",
+			"application/activity+json",
+			"application/activity+json",
+		},
+		{
+			"With Profile",
+			"application/ld+json; profile=https://www.w3.org/ns/activitystreams",
+			ldJSON,
+		},
+		{
+			"With Profile List",
+			"application/ld+json; profile=\"https://www.w3.org/ns/activitystreams https://example.com/profile\"",
+			ldJSON,
+		},
+		{
+			"Missing Profile",
+			"application/ld+json, text/html",
+			ldJSON,
+		},
+		{
+			"Highest Quality",
+			"application/activity+json; q=0.8, application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"",
+			ldJSON,
+		},
+		{
+			"First Of Equal Quality",
+			"application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\", application/activity+json",
+			ldJSON,
+		},
+		{
+			"Not Acceptable",
+			"application/activity+json; q=0, application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"; q=0.5",
+			ldJSON,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := negotiateMediaType(test.input); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package webfinger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// ErrNoActor indicates that the JRD of a resource has no 'self' link to an
+// ActivityPub actor.
+var ErrNoActor = errors.New("webfinger: the resource has no ActivityPub actor")
+
+// maxResponseSize is the maximum number of bytes read from a response.
+const maxResponseSize = 1 << 20
+
+// ClientOption configures optional behaviors of a Client.
+type ClientOption func(c *Client)
+
+// WithScheme sets the protocol scheme of the requests of a Client, such as
+// "http" for local development. The default is "https".
+func WithScheme(scheme string) ClientOption {
+	return func(c *Client) {
+		c.scheme = scheme
+	}
+}
+
+// Client resolves the 'acct:' URIs of other servers with WebFinger.
+//
+// When the WebFinger endpoint of a server responds with an unsuccessful status,
+// the Client looks for the LRDD template in its host-meta document, in either
+// its XRD or JSON form, and requests the JRD from there instead.
+type Client struct {
+	client   pub.HttpClient
+	appAgent string
+	scheme   string
+}
+
+// NewClient creates a Client sending requests with the HttpClient, such as the
+// one given to the HttpSigTransport.
+//
+// The appAgent is the User-Agent of the requests.
+func NewClient(client pub.HttpClient, appAgent string, opts ...ClientOption) *Client {
+	c := &Client{
+		client:   client,
+		appAgent: appAgent,
+		scheme:   "https",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Resolve returns the IRI of the ActivityPub actor of the account, given in
+// any form accepted by ParseAcct.
+//
+// The subject of the JRD must be the account. When the actor is on another
+// host than the account, that host must also respond to a WebFinger request
+// for the account with the same actor, so that a server cannot claim the
+// actors of others.
+//
+// Returns ErrNoActor if the account has no ActivityPub actor.
+func (c *Client) Resolve(ctx context.Context, acct string) (*url.URL, error) {
+	username, host, err := ParseAcct(acct)
+	if err != nil {
+		return nil, err
+	}
+	resource := Acct(username, host)
+	j, err := c.lookupResource(ctx, host, resource)
+	if err != nil {
+		return nil, err
+	}
+	actorIRI, err := actorOf(j, resource)
+	if err != nil {
+		return nil, err
+	} else if strings.EqualFold(actorIRI.Host, host) {
+		return actorIRI, nil
+	}
+	// Confirm the actor with its own host.
+	j, err = c.lookupResource(ctx, actorIRI.Host, resource)
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := actorOf(j, resource)
+	if err != nil {
+		return nil, err
+	} else if confirmed.String() != actorIRI.String() {
+		return nil, fmt.Errorf("webfinger: %s does not confirm that %s is the actor of %s", actorIRI.Host, actorIRI, resource)
+	}
+	return actorIRI, nil
+}
+
+// actorOf returns the IRI of the ActivityPub actor of the JRD, after ensuring
+// that its subject is the 'acct:' resource.
+func actorOf(j *JRD, resource string) (*url.URL, error) {
+	if !sameAcct(j.Subject, resource) {
+		return nil, fmt.Errorf("webfinger: the JRD of %s has the subject %q", resource, j.Subject)
+	}
+	href := j.ActorIRI()
+	if len(href) == 0 {
+		return nil, ErrNoActor
+	}
+	return url.Parse(href)
+}
+
+// sameAcct returns true if the subject is the same 'acct:' URI as the
+// resource, ignoring the case of its host.
+func sameAcct(subject, resource string) bool {
+	if !strings.HasPrefix(subject, acctScheme) {
+		return false
+	}
+	username, host, err := ParseAcct(subject)
+	return err == nil && Acct(username, host) == resource
+}
+
+// Lookup returns the JRD of the account, given in any form accepted by
+// ParseAcct.
+//
+// A *pub.HttpStatusError is returned if the server does not successfully
+// respond with one.
+func (c *Client) Lookup(ctx context.Context, acct string) (*JRD, error) {
+	username, host, err := ParseAcct(acct)
+	if err != nil {
+		return nil, err
+	}
+	return c.lookupResource(ctx, host, Acct(username, host))
+}
+
+// lookupResource returns the JRD of the resource served by the host.
+func (c *Client) lookupResource(ctx context.Context, host, resource string) (*JRD, error) {
+	u := &url.URL{
+		Scheme:   c.scheme,
+		Host:     host,
+		Path:     WellKnownPath,
+		RawQuery: url.Values{"resource": []string{resource}}.Encode(),
+	}
+	j, err := c.lookup(ctx, u)
+	if _, ok := err.(*pub.HttpStatusError); !ok {
+		return j, err
+	}
+	// Fall back to the LRDD template of the host-meta document, reporting
+	// the original error if there is none.
+	template, lrddErr := c.lrddTemplate(ctx, host)
+	if lrddErr != nil || len(template) == 0 {
+		return nil, err
+	}
+	u, err = url.Parse(strings.Replace(template, "{uri}", url.QueryEscape(resource), -1))
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "https" && u.Scheme != c.scheme {
+		return nil, fmt.Errorf("webfinger: the LRDD template of %s has the unsupported scheme %q", host, u.Scheme)
+	}
+	return c.lookup(ctx, u)
+}
+
+// lookup requests the JRD at the URL.
+func (c *Client) lookup(ctx context.Context, u *url.URL) (*JRD, error) {
+	b, err := c.get(ctx, u, JRDContentType+", application/json")
+	if err != nil {
+		return nil, err
+	}
+	j := &JRD{}
+	if err = json.Unmarshal(b, j); err != nil {
+		return nil, fmt.Errorf("webfinger: cannot parse the JRD at %s: %s", u, err)
+	}
+	return j, nil
+}
+
+// lrddTemplate returns the LRDD template of the host-meta document of the
+// host, or an empty string if there is none.
+func (c *Client) lrddTemplate(ctx context.Context, host string) (string, error) {
+	u := &url.URL{
+		Scheme: c.scheme,
+		Host:   host,
+		Path:   HostMetaPath,
+	}
+	b, err := c.get(ctx, u, "application/xrd+xml, "+JRDContentType)
+	if err != nil {
+		return "", err
+	}
+	var links []Link
+	if b = bytes.TrimSpace(b); bytes.HasPrefix(b, []byte("{")) {
+		var j JRD
+		if err = json.Unmarshal(b, &j); err != nil {
+			return "", fmt.Errorf("webfinger: cannot parse the host-meta of %s: %s", host, err)
+		}
+		links = j.Links
+	} else {
+		var x xrd
+		if err = xml.Unmarshal(b, &x); err != nil {
+			return "", fmt.Errorf("webfinger: cannot parse the host-meta of %s: %s", host, err)
+		}
+		links = x.Links
+	}
+	for _, l := range links {
+		if l.Rel == LRDDRel && len(l.Template) > 0 {
+			return l.Template, nil
+		}
+	}
+	return "", nil
+}
+
+// get sends a GET request, returning the body of a successful response.
+func (c *Client) get(ctx context.Context, u *url.URL, accept string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", c.appAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &pub.HttpStatusError{
+			Method:     "GET",
+			IRI:        u,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(b) > maxResponseSize {
+		return nil, fmt.Errorf("webfinger: the response of %s exceeds %d bytes", u, maxResponseSize)
+	}
+	return b, nil
+}
+
+// xrd is an Extensible Resource Descriptor, the XML form of host-meta
+// documents.
+type xrd struct {
+	XMLName xml.Name `xml:"XRD"`
+	Links   []Link   `xml:"Link"`
+}
@@ -0,0 +1,22 @@
+// Package webfinger implements WebFinger (RFC 7033) for ActivityPub servers,
+// resolving 'acct:' URIs such as 'acct:alex@example.com' to actor IRIs, as is
+// needed for mentions and remote follows.
+//
+// A Handler serves the '/.well-known/webfinger' endpoint of a server with the
+// actors returned by a Lookup:
+//
+//	h := webfinger.NewHandler(func(c context.Context, username, host string) (*url.URL, error) {
+//		// Return the IRI of the local actor, or nil if there is none.
+//	})
+//	serveMux.Handle(webfinger.WellKnownPath, h)
+//
+// A Client resolves the 'acct:' URIs of other servers, falling back to the
+// LRDD template of their host-meta document for servers that serve WebFinger
+// elsewhere:
+//
+//	client := webfinger.NewClient(http.DefaultClient, "myApp")
+//	actorIRI, err := client.Resolve(ctx, "acct:alex@example.com")
+//
+// An actor on another host than its account is only resolved if that host
+// confirms it for the account too.
+package webfinger
@@ -0,0 +1,93 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Lookup returns the IRI of the local actor with the username on the host, or
+// nil if there is no such actor.
+//
+// The host is the one of the requested account, which the Lookup should check
+// is served by this server.
+type Lookup func(c context.Context, username, host string) (actorIRI *url.URL, err error)
+
+// Handler serves the WebFinger endpoint, describing the local actors found by
+// a Lookup.
+//
+// Only 'acct:' resources are supported. Their JRD has the actor IRI as an
+// alias and as the 'self' link of type 'application/activity+json'. The links
+// are filtered by the 'rel' parameters of the request, if any.
+//
+// Requests without a valid resource receive a 400 Bad Request, and those for
+// unknown actors a 404 Not Found. A 500 Internal Server Error is written if the
+// Lookup returns an error.
+type Handler struct {
+	lookup Lookup
+}
+
+// Handler must implement http.Handler.
+var _ http.Handler = &Handler{}
+
+// NewHandler creates a Handler describing the actors found by the Lookup.
+func NewHandler(lookup Lookup) *Handler {
+	return &Handler{
+		lookup: lookup,
+	}
+}
+
+// ServeHTTP writes the JRD of the requested resource.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	username, host, err := ParseAcct(q.Get("resource"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	actorIRI, err := h.lookup(r.Context(), username, host)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if actorIRI == nil {
+		http.NotFound(w, r)
+		return
+	}
+	j := JRD{
+		Subject: Acct(username, host),
+		Aliases: []string{actorIRI.String()},
+	}
+	if rels, ok := q["rel"]; !ok || containsString(rels, SelfRel) {
+		j.Links = append(j.Links, Link{
+			Rel:  SelfRel,
+			Type: ActivityJSONType,
+			Href: actorIRI.String(),
+		})
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", JRDContentType)
+	// RFC 7033 §5 lets browser-based clients query any server.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// containsString returns true if the string is among the values.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
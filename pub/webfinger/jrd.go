@@ -0,0 +1,108 @@
+package webfinger
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+const (
+	// WellKnownPath is the path of the WebFinger endpoint.
+	WellKnownPath = "/.well-known/webfinger"
+	// HostMetaPath is the path of the host-meta document.
+	HostMetaPath = "/.well-known/host-meta"
+	// JRDContentType is the media type of JSON Resource Descriptors.
+	JRDContentType = "application/jrd+json"
+	// SelfRel is the relation of the links to the ActivityPub actor.
+	SelfRel = "self"
+	// LRDDRel is the relation of the link templates to resource
+	// descriptors in host-meta documents.
+	LRDDRel = "lrdd"
+	// ActivityJSONType is the media type of the links to the ActivityPub
+	// actor.
+	ActivityJSONType = "application/activity+json"
+	// ldJSONType is the media type of the links to the ActivityPub actor
+	// used by some servers instead of ActivityJSONType, along with the
+	// ActivityStreams profile.
+	ldJSONType = "application/ld+json"
+	// activityStreamsProfile is the JSON-LD profile of ActivityStreams.
+	activityStreamsProfile = "https://www.w3.org/ns/activitystreams"
+	// acctScheme is the scheme of the URIs identifying accounts.
+	acctScheme = "acct:"
+)
+
+// JRD is a JSON Resource Descriptor, the document describing a resource.
+type JRD struct {
+	// Subject is the URI of the described resource.
+	Subject string `json:"subject"`
+	// Aliases are other URIs identifying the resource.
+	Aliases []string `json:"aliases,omitempty"`
+	// Properties are additional information about the resource.
+	Properties map[string]*string `json:"properties,omitempty"`
+	// Links are the resources related to the resource.
+	Links []Link `json:"links,omitempty"`
+}
+
+// Link is a resource related to the resource described by a JRD.
+type Link struct {
+	// Rel is the relation type of the link.
+	Rel string `json:"rel" xml:"rel,attr"`
+	// Type is the media type of the linked resource.
+	Type string `json:"type,omitempty" xml:"type,attr"`
+	// Href is the URI of the linked resource.
+	Href string `json:"href,omitempty" xml:"href,attr"`
+	// Template is a URI template of the linked resource, used instead of
+	// Href in host-meta documents.
+	Template string `json:"template,omitempty" xml:"template,attr"`
+	// Titles are the human-readable titles of the link, keyed by language.
+	Titles map[string]string `json:"titles,omitempty" xml:"-"`
+	// Properties are additional information about the link.
+	Properties map[string]*string `json:"properties,omitempty" xml:"-"`
+}
+
+// ActorIRI returns the href of the 'self' link to the ActivityPub actor, or
+// an empty string if there is none.
+func (j *JRD) ActorIRI() string {
+	for _, l := range j.Links {
+		if l.Rel == SelfRel && isActivityStreamsType(l.Type) {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// isActivityStreamsType returns true if the media type identifies an
+// ActivityStreams document.
+func isActivityStreamsType(t string) bool {
+	mediaType, params, err := mime.ParseMediaType(t)
+	if err != nil {
+		return false
+	} else if mediaType == ActivityJSONType {
+		return true
+	}
+	for _, profile := range strings.Fields(params["profile"]) {
+		if mediaType == ldJSONType && profile == activityStreamsProfile {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAcct returns the username and host of an account, given as an 'acct:'
+// URI or in the 'user@host' and '@user@host' forms used in mentions.
+func ParseAcct(acct string) (username, host string, err error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(acct, acctScheme), "@")
+	i := strings.LastIndex(s, "@")
+	if i <= 0 || i == len(s)-1 ||
+		strings.ContainsAny(s[:i], "/?#") ||
+		strings.ContainsAny(s[i+1:], "/?#") {
+		err = fmt.Errorf("webfinger: %q is not an account of the form user@host", acct)
+		return
+	}
+	return s[:i], strings.ToLower(s[i+1:]), nil
+}
+
+// Acct returns the 'acct:' URI of the account with the username on the host.
+func Acct(username, host string) string {
+	return acctScheme + username + "@" + host
+}
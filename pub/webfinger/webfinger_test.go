@@ -0,0 +1,256 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+const (
+	testHost     = "example.com"
+	testActorIRI = "https://example.com/users/alex"
+)
+
+// mustParse parses a URL or panics.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// assertEqual ensures two values are equal.
+func assertEqual(t *testing.T, a, b interface{}) {
+	if a != b {
+		t.Errorf("expected equal: %v != %v", a, b)
+	}
+}
+
+// testLookup finds the actor 'alex' on testHost.
+func testLookup(c context.Context, username, host string) (*url.URL, error) {
+	if username == "alex" && host == testHost {
+		return mustParse(testActorIRI), nil
+	}
+	return nil, nil
+}
+
+// handlerClient is an HttpClient serving the requests with a handler in the
+// same process, recording the URLs requested.
+type handlerClient struct {
+	h    http.Handler
+	urls []string
+}
+
+func (h *handlerClient) Do(req *http.Request) (*http.Response, error) {
+	h.urls = append(h.urls, req.URL.String())
+	resp := httptest.NewRecorder()
+	h.h.ServeHTTP(resp, req)
+	return resp.Result(), nil
+}
+
+var _ pub.HttpClient = &handlerClient{}
+
+func TestParseAcct(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		username string
+		host     string
+		isErr    bool
+	}{
+		{"Acct URI", "acct:alex@example.com", "alex", "example.com", false},
+		{"Plain", "alex@Example.com", "alex", "example.com", false},
+		{"Mention", "@alex@example.com", "alex", "example.com", false},
+		{"At In Username", "acct:alex@work@example.com", "alex@work", "example.com", false},
+		{"Port", "alex@localhost:8080", "alex", "localhost:8080", false},
+		{"Missing Host", "acct:alex@", "", "", true},
+		{"Missing Username", "@example.com", "", "", true},
+		{"IRI", "https://example.com/users/alex", "", "", true},
+		{"Path In Host", "alex@example.com/evil", "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			username, host, err := ParseAcct(test.input)
+			assertEqual(t, err != nil, test.isErr)
+			assertEqual(t, username, test.username)
+			assertEqual(t, host, test.host)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(testLookup)
+	t.Run("ServesActorOfAcct", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get("Content-Type"), JRDContentType)
+		assertEqual(t, resp.Header().Get("Access-Control-Allow-Origin"), "*")
+		var j JRD
+		assertEqual(t, json.Unmarshal(resp.Body.Bytes(), &j), nil)
+		assertEqual(t, j.Subject, "acct:alex@example.com")
+		assertEqual(t, len(j.Aliases), 1)
+		assertEqual(t, j.Aliases[0], testActorIRI)
+		assertEqual(t, len(j.Links), 1)
+		assertEqual(t, j.Links[0].Rel, SelfRel)
+		assertEqual(t, j.Links[0].Type, ActivityJSONType)
+		assertEqual(t, j.ActorIRI(), testActorIRI)
+	})
+	t.Run("FiltersLinksByRel", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com&rel=http%3A%2F%2Fwebfinger.net%2Frel%2Favatar", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusOK)
+		var j JRD
+		assertEqual(t, json.Unmarshal(resp.Body.Bytes(), &j), nil)
+		assertEqual(t, len(j.Links), 0)
+	})
+	t.Run("NotFoundForUnknownActor", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://example.com/.well-known/webfinger?resource=acct%3Asam%40example.com", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("BadRequestWithoutAcctResource", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://example.com/.well-known/webfinger?resource=https%3A%2F%2Fexample.com%2Fusers%2Falex", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("InternalErrorWhenLookupFails", func(t *testing.T) {
+		h := NewHandler(func(c context.Context, username, host string) (*url.URL, error) {
+			return nil, fmt.Errorf("test error")
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "https://example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusInternalServerError)
+	})
+	t.Run("RefusesPost", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "https://example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com", nil)
+		h.ServeHTTP(resp, req)
+		assertEqual(t, resp.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	t.Run("ResolvesAcctWithWebFinger", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle(WellKnownPath, NewHandler(testLookup))
+		hc := &handlerClient{h: mux}
+		c := NewClient(hc, "testApp")
+		actorIRI, err := c.Resolve(ctx, "@alex@example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, actorIRI.String(), testActorIRI)
+		assertEqual(t, len(hc.urls), 1)
+		assertEqual(t, hc.urls[0], "https://example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com")
+	})
+	t.Run("FallsBackToLRDDOfXMLHostMeta", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(HostMetaPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xrd+xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" template="https://example.com/api/webfinger?resource={uri}"/>
+</XRD>`)
+		})
+		mux.Handle("/api/webfinger", NewHandler(testLookup))
+		hc := &handlerClient{h: mux}
+		c := NewClient(hc, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, actorIRI.String(), testActorIRI)
+		assertEqual(t, len(hc.urls), 3)
+		assertEqual(t, hc.urls[1], "https://example.com/.well-known/host-meta")
+		assertEqual(t, hc.urls[2], "https://example.com/api/webfinger?resource=acct%3Aalex%40example.com")
+	})
+	t.Run("FallsBackToLRDDOfJSONHostMeta", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(HostMetaPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", JRDContentType)
+			fmt.Fprint(w, `{"links":[{"rel":"lrdd","template":"https://example.com/api/webfinger?resource={uri}"}]}`)
+		})
+		mux.Handle("/api/webfinger", NewHandler(testLookup))
+		c := NewClient(&handlerClient{h: mux}, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, actorIRI.String(), testActorIRI)
+	})
+	t.Run("ReportsStatusWithoutHostMeta", func(t *testing.T) {
+		c := NewClient(&handlerClient{h: http.NewServeMux()}, "testApp")
+		_, err := c.Resolve(ctx, "acct:alex@example.com")
+		statusErr, ok := err.(*pub.HttpStatusError)
+		assertEqual(t, ok, true)
+		assertEqual(t, statusErr.StatusCode, http.StatusNotFound)
+		assertEqual(t, statusErr.IRI.Path, WellKnownPath)
+	})
+	t.Run("ErrNoActorWithoutSelfLink", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(WellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"subject":"acct:alex@example.com","links":[{"rel":"self","type":"text/html","href":"https://example.com/@alex"}]}`)
+		})
+		c := NewClient(&handlerClient{h: mux}, "testApp")
+		_, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, err, ErrNoActor)
+	})
+	t.Run("AcceptsJSONLDSelfLink", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(WellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"subject":"acct:alex@example.com","links":[{"rel":"self","type":"application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"","href":"https://example.com/users/alex"}]}`)
+		})
+		c := NewClient(&handlerClient{h: mux}, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, actorIRI.String(), testActorIRI)
+	})
+	t.Run("RefusesJRDOfOtherSubject", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(WellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"subject":"acct:sam@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://example.com/users/sam"}]}`)
+		})
+		c := NewClient(&handlerClient{h: mux}, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, actorIRI, (*url.URL)(nil))
+		assertEqual(t, err != nil, true)
+	})
+	t.Run("ConfirmsActorOnOtherHost", func(t *testing.T) {
+		const socialActorIRI = "https://social.example.com/users/alex"
+		socialLookup := func(c context.Context, username, host string) (*url.URL, error) {
+			if username == "alex" && host == testHost {
+				return mustParse(socialActorIRI), nil
+			}
+			return nil, nil
+		}
+		mux := http.NewServeMux()
+		mux.Handle(testHost+WellKnownPath, NewHandler(socialLookup))
+		mux.Handle("social.example.com"+WellKnownPath, NewHandler(socialLookup))
+		hc := &handlerClient{h: mux}
+		c := NewClient(hc, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, err, nil)
+		assertEqual(t, actorIRI.String(), socialActorIRI)
+		assertEqual(t, len(hc.urls), 2)
+		assertEqual(t, hc.urls[1], "https://social.example.com/.well-known/webfinger?resource=acct%3Aalex%40example.com")
+	})
+	t.Run("RefusesActorNotConfirmedByItsHost", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc(testHost+WellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"subject":"acct:alex@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://victim.example.org/users/sam"}]}`)
+		})
+		mux.Handle("victim.example.org"+WellKnownPath, NewHandler(testLookup))
+		c := NewClient(&handlerClient{h: mux}, "testApp")
+		actorIRI, err := c.Resolve(ctx, "acct:alex@example.com")
+		assertEqual(t, actorIRI, (*url.URL)(nil))
+		assertEqual(t, err != nil, true)
+	})
+}